@@ -0,0 +1,114 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prestonvasquez/diskhop/internal/exif"
+)
+
+// AutoTagger derives tags from the contents of a file that is pushed, which
+// are pushed along with the tags of the file. See FilePusher.AutoTagger.
+type AutoTagger func(file *os.File) ([]string, error)
+
+// sniffLen is the number of bytes that the content type of a file is detected
+// from.
+const sniffLen = 512
+
+// ExifTags is an AutoTagger that derives tags from the EXIF data of JPEG
+// images:
+//
+//   - camera:<make> <model>
+//   - taken:<yyyy-mm-dd>
+//   - gps-lat:<latitude> and gps-lon:<longitude>, to four decimal places
+//
+// Files that are not JPEG images, going by their contents rather than their
+// names, and images without EXIF data get no tags.
+func ExifTags(file *os.File) ([]string, error) {
+	head := make([]byte, sniffLen)
+
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if http.DetectContentType(head[:n]) != "image/jpeg" {
+		return nil, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to start of file: %w", err)
+	}
+
+	info, err := exif.Read(file)
+	if errors.Is(err, exif.ErrNoExif) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read EXIF data: %w", err)
+	}
+
+	return exifTags(info), nil
+}
+
+// exifTags returns the tags of an image with the EXIF data.
+func exifTags(info *exif.Info) []string {
+	var tags []string
+
+	// Many cameras repeat the brand, the first word of the make, at the
+	// start of the model.
+	camera := info.Model
+	if brand, _, _ := strings.Cut(info.Make, " "); !strings.HasPrefix(strings.ToLower(camera), strings.ToLower(brand)) {
+		camera = strings.TrimSpace(info.Make + " " + camera)
+	}
+
+	if camera != "" {
+		tags = append(tags, "camera:"+camera)
+	}
+
+	if !info.Taken.IsZero() {
+		tags = append(tags, "taken:"+info.Taken.Format("2006-01-02"))
+	}
+
+	// The coordinates are separate tags, since tags are stored separated by
+	// commas.
+	if info.HasGPS {
+		tags = append(tags,
+			"gps-lat:"+strconv.FormatFloat(info.Latitude, 'f', 4, 64),
+			"gps-lon:"+strconv.FormatFloat(info.Longitude, 'f', 4, 64))
+	}
+
+	return tags
+}
+
+// autoTag returns the tags that the tagger derives from the file, leaving the
+// file at its start to be pushed.
+func autoTag(file *os.File, tagger AutoTagger) ([]string, error) {
+	tags, err := tagger(file)
+
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, fmt.Errorf("failed to seek to start of file: %w", seekErr)
+	}
+
+	return tags, err
+}
@@ -0,0 +1,180 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/internal/exif"
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExifTags(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		info exif.Info
+		want []string
+	}{
+		{
+			name: "all fields",
+			info: exif.Info{
+				Make:      "Canon",
+				Model:     "EOS R5",
+				Taken:     time.Date(2024, 6, 30, 18, 45, 10, 0, time.UTC),
+				HasGPS:    true,
+				Latitude:  37.775,
+				Longitude: -122.419166,
+			},
+			want: []string{"camera:Canon EOS R5", "taken:2024-06-30", "gps-lat:37.7750", "gps-lon:-122.4192"},
+		},
+		{
+			name: "model repeats make",
+			info: exif.Info{Make: "NIKON CORPORATION", Model: "NIKON Z 6"},
+			want: []string{"camera:NIKON Z 6"},
+		},
+		{
+			name: "make only",
+			info: exif.Info{Make: "Apple"},
+			want: []string{"camera:Apple"},
+		},
+		{
+			name: "nothing recorded",
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, exifTags(&tt.info), tt.name)
+	}
+}
+
+func TestExifTagsRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	// If error contains "unsupported operating system", then skip the test.
+	if err := osutil.SetTags(nil); err != nil && strings.Contains(err.Error(), "unsupported operating system") {
+		t.Skip("unsupported operating system")
+	}
+
+	info := exif.Info{
+		Make:      "Canon",
+		Model:     "EOS R5",
+		Taken:     time.Date(2024, 6, 30, 18, 45, 10, 0, time.UTC),
+		HasGPS:    true,
+		Latitude:  -33.8568,
+		Longitude: 151.2153,
+	}
+
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o600))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	// The tags of a pulled file are set on it, and read back when it is
+	// pushed again.
+	tags := exifTags(&info)
+	require.NoError(t, osutil.SetTags(file, tags...))
+
+	got, err := osutil.GetTags(file)
+	require.NoError(t, err)
+
+	assert.Equal(t, tags, got)
+}
+
+func TestExifTagsNotJPEG(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "notes.jpg")
+	require.NoError(t, os.WriteFile(path, []byte("not really a photo"), 0o600))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	tags, err := ExifTags(file)
+	require.NoError(t, err)
+
+	assert.Empty(t, tags)
+}
+
+// tagsPusher records the tags and contents of the pushed files by base name.
+type tagsPusher struct {
+	tags map[string][]string
+	data map[string]string
+}
+
+func (p *tagsPusher) Push(_ context.Context, name string, r io.ReadSeeker, opts ...store.PushOption) (string, error) {
+	var pushOpts store.PushOptions
+	for _, opt := range opts {
+		opt(&pushOpts)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	p.tags[filepath.Base(name)] = pushOpts.Tags
+	p.data[filepath.Base(name)] = string(data)
+
+	return "", nil
+}
+
+func TestFilePusherAutoTagger(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("data"), 0o600))
+	require.NoError(t, osutil.WriteSidecarTags(filepath.Join(dir, "a.jpg"), "beach", "camera:Canon"))
+
+	pusher := &tagsPusher{tags: map[string][]string{}, data: map[string]string{}}
+
+	fp := NewFilePusher(pusher)
+	fp.ConfirmClean = func(int) bool { return false }
+	fp.OnTagError = func(string, error) {}
+	fp.AutoTagger = func(file *os.File) ([]string, error) {
+		// The tagger reads the file, which is pushed from its start all the
+		// same.
+		if _, err := io.ReadAll(file); err != nil {
+			return nil, err
+		}
+
+		return []string{"camera:Canon", "taken:2024-06-30"}, nil
+	}
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	require.NoError(t, fp.Push(context.Background(), f))
+
+	assert.Equal(t, []string{"beach", "camera:Canon", "taken:2024-06-30"}, pusher.tags["a.jpg"])
+	assert.Equal(t, "data", pusher.data["a.jpg"])
+}
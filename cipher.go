@@ -0,0 +1,139 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// CipherAESGCM selects AES in Galois/Counter Mode.
+	CipherAESGCM = "aes-gcm"
+
+	// CipherChaCha20Poly1305 selects ChaCha20-Poly1305 with a 12-byte nonce.
+	CipherChaCha20Poly1305 = "chacha20-poly1305"
+
+	// CipherXChaCha20Poly1305 selects XChaCha20-Poly1305 with a 24-byte nonce.
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+
+	// DefaultCipher is the cipher used when none is configured.
+	DefaultCipher = CipherAESGCM
+)
+
+// minAESGCMNonceSize is the smallest nonce accepted for AES-GCM. Shorter
+// nonces make IV collisions far more likely.
+const minAESGCMNonceSize = 12
+
+// ValidateCipher returns an error if the cipher and nonce size combination is
+// not supported. An empty cipher selects DefaultCipher and a zero nonce size
+// selects the cipher's standard nonce size.
+func ValidateCipher(name string, nonceSize int) error {
+	if nonceSize < 0 {
+		return fmt.Errorf("invalid nonce size: %d", nonceSize)
+	}
+
+	switch name {
+	case "", CipherAESGCM:
+		if nonceSize != 0 && nonceSize < minAESGCMNonceSize {
+			return fmt.Errorf("%s requires a nonce size of at least %d bytes, got %d",
+				CipherAESGCM, minAESGCMNonceSize, nonceSize)
+		}
+	case CipherChaCha20Poly1305:
+		if nonceSize != 0 && nonceSize != chacha20poly1305.NonceSize {
+			return fmt.Errorf("%s requires a nonce size of %d bytes, got %d",
+				name, chacha20poly1305.NonceSize, nonceSize)
+		}
+	case CipherXChaCha20Poly1305:
+		if nonceSize != 0 && nonceSize != chacha20poly1305.NonceSizeX {
+			return fmt.Errorf("%s requires a nonce size of %d bytes, got %d",
+				name, chacha20poly1305.NonceSizeX, nonceSize)
+		}
+	default:
+		return fmt.Errorf("unsupported cipher: %s", name)
+	}
+
+	return nil
+}
+
+// NewSealOpener returns a SealOpener for the named cipher and nonce size. See
+// ValidateCipher for the supported combinations.
+func NewSealOpener(mgr dcrypto.IVManagerGetter, key []byte, name string, nonceSize int) (dcrypto.SealOpener, error) {
+	if err := ValidateCipher(name, nonceSize); err != nil {
+		return nil, err
+	}
+
+	var (
+		aead cipher.AEAD
+		err  error
+	)
+
+	switch name {
+	case "", CipherAESGCM:
+		if nonceSize == 0 {
+			return NewAESGCM(mgr, key)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new AES cipher: %w", err)
+		}
+
+		aead, err = cipher.NewGCMWithNonceSize(block, nonceSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new GCM cipher: %w", err)
+		}
+	case CipherChaCha20Poly1305:
+		aead, err = chacha20poly1305.New(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new ChaCha20-Poly1305 cipher: %w", err)
+		}
+	case CipherXChaCha20Poly1305:
+		aead, err = chacha20poly1305.NewX(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new XChaCha20-Poly1305 cipher: %w", err)
+		}
+	}
+
+	return dcrypto.NewAEADWithNonceSize(mgr, aead, aead.NonceSize()), nil
+}
+
+// NormalizeCipher resolves an empty cipher to DefaultCipher and a zero nonce
+// size to the cipher's standard nonce size, so that equivalent configurations
+// compare equal.
+func NormalizeCipher(name string, nonceSize int) (string, int) {
+	if name == "" {
+		name = DefaultCipher
+	}
+
+	if nonceSize != 0 {
+		return name, nonceSize
+	}
+
+	switch name {
+	case CipherAESGCM:
+		nonceSize = minAESGCMNonceSize
+	case CipherChaCha20Poly1305:
+		nonceSize = chacha20poly1305.NonceSize
+	case CipherXChaCha20Poly1305:
+		nonceSize = chacha20poly1305.NonceSizeX
+	}
+
+	return name, nonceSize
+}
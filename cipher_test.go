@@ -0,0 +1,129 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCipher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		cipher    string
+		nonceSize int
+		wantErr   string
+	}{
+		{
+			name:   "default",
+			cipher: "",
+		},
+		{
+			name:      "aes-gcm with larger nonce",
+			cipher:    CipherAESGCM,
+			nonceSize: 16,
+		},
+		{
+			name:      "aes-gcm with short nonce",
+			cipher:    CipherAESGCM,
+			nonceSize: 8,
+			wantErr:   "aes-gcm requires a nonce size of at least 12 bytes, got 8",
+		},
+		{
+			name:      "chacha20-poly1305",
+			cipher:    CipherChaCha20Poly1305,
+			nonceSize: 12,
+		},
+		{
+			name:      "chacha20-poly1305 with extended nonce",
+			cipher:    CipherChaCha20Poly1305,
+			nonceSize: 24,
+			wantErr:   "chacha20-poly1305 requires a nonce size of 12 bytes, got 24",
+		},
+		{
+			name:      "xchacha20-poly1305",
+			cipher:    CipherXChaCha20Poly1305,
+			nonceSize: 24,
+		},
+		{
+			name:    "unknown cipher",
+			cipher:  "rot13",
+			wantErr: "unsupported cipher: rot13",
+		},
+		{
+			name:      "negative nonce",
+			cipher:    CipherAESGCM,
+			nonceSize: -1,
+			wantErr:   "invalid nonce size: -1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateCipher(tt.cipher, tt.nonceSize)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeCipher(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		cipher        string
+		nonceSize     int
+		wantCipher    string
+		wantNonceSize int
+	}{
+		{
+			name:          "default",
+			wantCipher:    CipherAESGCM,
+			wantNonceSize: 12,
+		},
+		{
+			name:          "aes-gcm with larger nonce",
+			cipher:        CipherAESGCM,
+			nonceSize:     16,
+			wantCipher:    CipherAESGCM,
+			wantNonceSize: 16,
+		},
+		{
+			name:          "xchacha20-poly1305",
+			cipher:        CipherXChaCha20Poly1305,
+			wantCipher:    CipherXChaCha20Poly1305,
+			wantNonceSize: 24,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			gotCipher, gotNonceSize := NormalizeCipher(tt.cipher, tt.nonceSize)
+			assert.Equal(t, tt.wantCipher, gotCipher)
+			assert.Equal(t, tt.wantNonceSize, gotNonceSize)
+		})
+	}
+}
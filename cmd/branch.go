@@ -16,8 +16,10 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
 
+	"github.com/prestonvasquez/diskhop"
 	"github.com/spf13/cobra"
 )
 
@@ -33,9 +35,72 @@ func newBranchCommand() *cobra.Command {
 		}
 	}
 
+	cmd.AddCommand(newBranchResetCommand())
+
 	return cmd
 }
 
+type branchResetFlags struct {
+	yes bool // Skip the confirmation before deleting the files
+}
+
+func newBranchResetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reset",
+		Short: "Delete every file, version and commit of the current branch",
+		Args:  cobra.NoArgs,
+	}
+
+	flags := branchResetFlags{}
+
+	cmd.Flags().BoolVarP(&flags.yes, "yes", "y", false, "reset the branch without asking for confirmation")
+
+	cmd.Run = func(cmd *cobra.Command, _ []string) {
+		if err := runBranchReset(cmd, flags); err != nil {
+			log.Fatalf("failed to reset branch: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runBranchReset(cmd *cobra.Command, flags branchResetFlags) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	prompt := fmt.Sprintf("Delete every file, version and commit of branch %q? This cannot be undone.", cfg.CurrentBranch)
+	if !confirmDestructive(flags.yes, prompt) {
+		fmt.Fprintln(os.Stderr, "branch was not reset, pass --yes to reset it")
+
+		return nil
+	}
+
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	if err := diskhop.Reset(cmd.Context(), *diskhopStore); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "reset branch %s\n", cfg.CurrentBranch)
+
+	return nil
+}
+
 func runBranch(_ *cobra.Command, args []string) error {
 	curDir, err := os.Getwd()
 	if err != nil {
@@ -15,11 +15,14 @@
 package main
 
 import (
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
@@ -31,7 +34,8 @@ type checkoutFlags struct {
 func newCheckoutCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "checkout",
-		Short: "Checkout a branch",
+		Short: "Checkout a branch or the files as of a commit",
+		Long:  "checkout switches to a branch or, given the SHA of a commit that is not a branch name, replaces the files in the repository with those on the remote host right after that push. It fails, naming the files, if versions of files in that state have been pruned",
 	}
 
 	checkoutFlags := checkoutFlags{}
@@ -63,25 +67,84 @@ func checkoutNewBranch(cfg *config, newName string) error {
 
 func checkoutBranch(cfg *config, branchName string) error {
 	// Check to see if the branch exists.
-	found := false
+	if !hasBranch(*cfg, branchName) {
+		return fmt.Errorf("branch does not exist: %s", branchName)
+	}
+
+	// Update the current branch.
+	cfg.CurrentBranch = branchName
+
+	return nil
+}
+
+func hasBranch(cfg config, name string) bool {
 	for _, branch := range cfg.Branches {
-		if branch == branchName {
-			found = true
-			break
+		if branch == name {
+			return true
 		}
 	}
 
-	if !found {
-		return fmt.Errorf("branch does not exist: %s", branchName)
+	return false
+}
+
+// isCommitSHA reports whether s has the form of a commit SHA.
+func isCommitSHA(s string) bool {
+	_, err := hex.DecodeString(s)
+
+	return err == nil && len(s) == 40
+}
+
+// checkoutCommit replaces the files in the repository with those on the remote
+// host as of the commit sha.
+func checkoutCommit(cmd *cobra.Command, sha string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Update the current branch.
-	cfg.CurrentBranch = branchName
+	if cfg.KeyFile == "" && len(cfg.Recipients) == 0 {
+		return fmt.Errorf("checking out a commit requires a key file")
+	}
+
+	diskhopStore, err := newDiskhopReadStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	pullOpts := []store.PullOption{
+		store.WithPullLimiter(newLimiter(cmd, cfg)),
+		store.WithPullSealOpener(so),
+	}
+
+	if mso != nil {
+		pullOpts = append(pullOpts, store.WithPullMetadataSealOpener(mso))
+	}
+
+	dp := diskhop.NewFilePuller(diskhopStore.Puller)
+	dp.StrictTags = strictTags(cmd, cfg)
+	dp.OnTagError = warnTagError
+
+	desc, err := diskhop.Checkout(cmd.Context(), diskhop.Config(cfg), dp, sha, pullOpts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked out %d file(s) as of %s\n", desc.Count, sha)
 
 	return nil
 }
 
-func runCheckout(_ *cobra.Command, args []string, flags checkoutFlags) error {
+func runCheckout(cmd *cobra.Command, args []string, flags checkoutFlags) error {
 	curDir, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
@@ -93,7 +156,7 @@ func runCheckout(_ *cobra.Command, args []string, flags checkoutFlags) error {
 	}
 
 	// Read the .diskhop file.
-	cfg, err := loadConfig()
+	cfg, err := loadLocalConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
@@ -110,6 +173,10 @@ func runCheckout(_ *cobra.Command, args []string, flags checkoutFlags) error {
 		}
 
 		branch := args[0]
+		if !hasBranch(cfg, branch) && isCommitSHA(branch) {
+			return checkoutCommit(cmd, branch)
+		}
+
 		if err := checkoutBranch(&cfg, branch); err != nil {
 			return fmt.Errorf("failed to checkout branch: %w", err)
 		}
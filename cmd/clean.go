@@ -49,27 +49,11 @@ func runClean(cmd *cobra.Command, args []string) error {
 		return errNotDiskhop
 	}
 
-	// Get the files in the directory.
-	f, err := os.Open(curDir)
+	// Read the .diskhop file.
+	cfg, err := loadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to open directory: %w", err)
+		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	defer f.Close()
-
-	// Read the directory contents
-	entities, err := f.Readdir(-1)
-	if err != nil {
-		return fmt.Errorf("failed to read directory contents: %w", err)
-	}
-
-	if len(entities) == 0 {
-		return nil
-	}
-
-	if err := diskhop.Clean(entities); err != nil {
-		return fmt.Errorf("failed to clean: %w", err)
-	}
-
-	return nil
+	return diskhop.CleanRepository(diskhop.Config(cfg))
 }
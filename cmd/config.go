@@ -15,22 +15,76 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
 
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
 
 // config represents the configuration for the diskhop application.
 type config struct {
-	ConnString    string   `yaml:"connString"`              // Remote host
-	KeyFile       string   `yaml:"keyFile,omitempty"`       // Path to private key
-	Branches      []string `yaml:"branches,omitempty"`      // Branches to sync
-	CurrentBranch string   `yaml:"currentBranch,omitempty"` // Current branch
-	DB            string   `yaml:"db,omitempty"`            // Database
+	ConnString     string   `yaml:"connString"`               // Remote host
+	KeyFile        string   `yaml:"keyFile,omitempty"`        // Path to private key, or a reference such as env:<name>
+	Branches       []string `yaml:"branches,omitempty"`       // Branches to sync
+	CurrentBranch  string   `yaml:"currentBranch,omitempty"`  // Current branch
+	DB             string   `yaml:"db,omitempty"`             // Database
+	Concurrency    int      `yaml:"concurrency,omitempty"`    // Max concurrent streams
+	Cipher         string   `yaml:"cipher,omitempty"`         // Encryption algorithm
+	NonceSize      int      `yaml:"nonceSize,omitempty"`      // Nonce size in bytes
+	StrictTags     bool     `yaml:"strictTags,omitempty"`     // Fail when tags cannot be read or set
+	StrictEnv      bool     `yaml:"strictEnv,omitempty"`      // Fail on unset variables in expanded values
+	WriteConcern   string   `yaml:"writeConcern,omitempty"`   // "majority" or a number of nodes
+	ReadPreference string   `yaml:"readPreference,omitempty"` // Read preference mode for pulls
+	TempDir        string   `yaml:"tempDir,omitempty"`        // Spill streamed uploads here so they can resume
+	Versioning     bool     `yaml:"versioning,omitempty"`     // Keep the versions replaced by pushes for reverts
+	KeepVersions   int      `yaml:"keepVersions,omitempty"`   // Replaced versions kept per file with versioning, 0 for any
+	VersionMaxAge  string   `yaml:"versionMaxAge,omitempty"`  // Prune versions replaced longer ago, e.g. "720h"
+	NameEncoding   string   `yaml:"nameEncoding,omitempty"`   // "objectid" or "ciphertext" for new buckets
+
+	// Finder color of each tag set on pull, e.g. important: red
+	TagColors map[string]string `yaml:"tagColors,omitempty"`
+
+	// Path to a separate key for names and metadata, which keyFile encrypts
+	// too if it is unset
+	MetadataKeyFile string `yaml:"metadataKeyFile,omitempty"`
+
+	// Use key files that other users can access, with a warning, rather
+	// than refusing them
+	InsecureKeyFile bool `yaml:"insecureKeyFile,omitempty"`
+
+	// Paths to the RSA public keys of the people that a shared bucket is
+	// sealed for, in place of keyFile
+	Recipients []string `yaml:"recipients,omitempty"`
+
+	// Private key that opens what is sealed for the recipients, a path or a
+	// reference such as keychain:<service>
+	IdentityFile string `yaml:"identityFile,omitempty"`
+
+	// Keep the tags of the files that a pull cleans, and merge them into
+	// those of the files pulled again: "remote-wins", "local-wins" or
+	// "union"
+	TagMerge string `yaml:"tagMerge,omitempty"`
+
+	// Split the name collection of the database into this many shards, so
+	// that pushes and pulls by name load only the names they need
+	NameShards int `yaml:"nameShards,omitempty"`
+
+	// Cache the sealed names of the remote in a SQLite database in the
+	// repository, so they are not downloaded on every connection
+	NameCache bool `yaml:"nameCache,omitempty"`
+
+	// Retention policy that prune enforces along with keepVersions and
+	// versionMaxAge: delete the files pushed longer ago than an age, e.g.
+	// "90d", and the oldest files beyond a stored size, e.g. "500GB"
+	RetainMaxAge  string `yaml:"retainMaxAge,omitempty"`
+	RetainMaxSize string `yaml:"retainMaxSize,omitempty"`
 
 	// Metadata
 	CurDir string `yaml:"-"`
@@ -47,20 +101,28 @@ const (
 	storeTypeMongo
 )
 
-// getAESKey will read the private key from the file system.
-func getAESKey(cfg config) ([]byte, error) {
-	if cfg.KeyFile == "" {
-		return nil, nil
-	}
-
-	aesKey, err := os.ReadFile(cfg.KeyFile)
+// getAESKey will resolve the private key from the source that the scheme of
+// the key file selects, such as a file, the environment or the OS keychain.
+func getAESKey(cmd *cobra.Command, cfg config) ([]byte, error) {
+	aesKey, err := resolveKey(cmd, cfg, cfg.KeyFile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read key file: %w", err)
+		return nil, err
 	}
 
 	return aesKey, nil
 }
 
+// getMetadataSealOpener returns the seal opener for names and metadata if the
+// repository has a key for them, and nil otherwise, so that the data key
+// encrypts them too.
+func getMetadataSealOpener(cmd *cobra.Command, cfg config, mgr dcrypto.IVManagerGetter) (dcrypto.SealOpener, error) {
+	warnInsecureKey(cmd, cfg, cfg.MetadataKeyFile)
+
+	so, err := diskhop.LoadMetadataSealOpener(cmd.Context(), repoConfig(cmd, cfg), mgr)
+
+	return so, insecureKeyHint(err)
+}
+
 // getStoreType returns the type of store based on the connection string schema.
 func getStoreType(cfg config) storeType {
 	uri, err := url.Parse(cfg.ConnString)
@@ -72,7 +134,7 @@ func getStoreType(cfg config) storeType {
 
 	//nolint:gocritic,revive
 	switch uri.Scheme {
-	case "mongodb":
+	case "mongodb", "mongodb+srv":
 		stype = storeTypeMongo
 	}
 
@@ -91,34 +153,108 @@ func isDiskhopRepository(path string) bool {
 	return true
 }
 
-// loadConfig will load the configuration file from the current working
-// directory.
-// Get the current working directory
+// globalConfigPath returns the path of the global configuration file, which
+// holds defaults shared by every repository. It lives in $XDG_CONFIG_HOME,
+// falling back to ~/.config.
+func globalConfigPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+
+		configHome = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configHome, "diskhop", "config.yaml"), nil
+}
+
+// loadConfig will load the configuration for the repository in the current
+// working directory. Values in the global configuration file are used as
+// defaults and overridden by the repository's .diskhop file. Environment
+// variable references in connString and the key files are expanded.
 func loadConfig() (config, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return config{}, fmt.Errorf("failed to get working directory: %w", err)
 	}
 
-	// Read the config file.
-	diskhopFilePath := filepath.Join(currentDir, ".diskhop")
+	cfg := config{CurDir: currentDir}
 
-	cbytes, err := os.ReadFile(filepath.Clean(diskhopFilePath))
+	globalPath, err := globalConfigPath()
 	if err != nil {
-		return config{}, fmt.Errorf("failed to read config file: %w", err)
+		return config{}, err
 	}
 
-	// Unmarshal the config file.
-	cfg := config{CurDir: currentDir}
+	if err := unmarshalConfigFile(globalPath, &cfg); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return config{}, fmt.Errorf("failed to load global config: %w", err)
+	}
+
+	if err := unmarshalConfigFile(filepath.Join(currentDir, ".diskhop"), &cfg); err != nil {
+		return config{}, err
+	}
+
+	if cfg.ConnString, err = diskhop.ExpandEnv(cfg.ConnString, cfg.StrictEnv); err != nil {
+		return config{}, fmt.Errorf("failed to expand connString: %w", err)
+	}
 
-	err = yaml.Unmarshal(cbytes, &cfg)
+	if cfg.KeyFile, err = diskhop.ExpandEnv(cfg.KeyFile, cfg.StrictEnv); err != nil {
+		return config{}, fmt.Errorf("failed to expand keyFile: %w", err)
+	}
+
+	if cfg.MetadataKeyFile, err = diskhop.ExpandEnv(cfg.MetadataKeyFile, cfg.StrictEnv); err != nil {
+		return config{}, fmt.Errorf("failed to expand metadataKeyFile: %w", err)
+	}
+
+	if cfg.IdentityFile, err = diskhop.ExpandEnv(cfg.IdentityFile, cfg.StrictEnv); err != nil {
+		return config{}, fmt.Errorf("failed to expand identityFile: %w", err)
+	}
+
+	if cfg.TempDir, err = diskhop.ExpandEnv(cfg.TempDir, cfg.StrictEnv); err != nil {
+		return config{}, fmt.Errorf("failed to expand tempDir: %w", err)
+	}
+
+	if err := diskhop.CheckKeySources(cfg.KeyFile, cfg.MetadataKeyFile, cfg.IdentityFile); err != nil {
+		return config{}, fmt.Errorf("invalid key files: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// loadLocalConfig will load only the .diskhop file from the current working
+// directory. Commands that rewrite the file use it so that global defaults
+// and expanded environment variables are not copied into the repository.
+func loadLocalConfig() (config, error) {
+	currentDir, err := os.Getwd()
 	if err != nil {
-		return config{}, fmt.Errorf("failed to unmarshal config file: %w", err)
+		return config{}, fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	cfg := config{CurDir: currentDir}
+
+	if err := unmarshalConfigFile(filepath.Join(currentDir, ".diskhop"), &cfg); err != nil {
+		return config{}, err
 	}
 
 	return cfg, nil
 }
 
+// unmarshalConfigFile decodes the YAML file at path into cfg. Fields that are
+// absent from the file keep their current values.
+func unmarshalConfigFile(path string, cfg *config) error {
+	cbytes, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(cbytes, cfg); err != nil {
+		return fmt.Errorf("failed to unmarshal config file: %w", err)
+	}
+
+	return nil
+}
+
 // newConfigCommand creates a new cobra command for managing configuration.
 func newConfigCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -127,6 +263,8 @@ func newConfigCommand() *cobra.Command {
 	}
 
 	cmd.AddCommand(newSetCommand())
+	cmd.AddCommand(newGetCommand())
+	cmd.AddCommand(newSetKeyCommand())
 
 	return cmd
 }
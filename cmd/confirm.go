@@ -0,0 +1,66 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+// confirm writes the prompt to w and reads a yes/no answer from r. Anything
+// other than "y" or "yes" is treated as no.
+func confirm(r io.Reader, w io.Writer, prompt string) bool {
+	fmt.Fprintf(w, "%s [y/N]: ", prompt)
+
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
+// confirmDestructive asks the user to confirm a destructive action. If yes is
+// true, the action is confirmed without prompting. In non-interactive contexts
+// the action is declined unless yes is true.
+func confirmDestructive(yes bool, prompt string) bool {
+	if yes {
+		return true
+	}
+
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+
+	return confirm(os.Stdin, os.Stderr, prompt)
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+type cpFlags struct {
+	prefix string // Subpath of the bucket that the name is relative to
+}
+
+// newCpCommand creates the command that copies one remote file to a local
+// path, leaving the repository untouched.
+func newCpCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cp NAME DEST",
+		Short: "Copy a remote file to a local path, or into a local directory",
+		Long:  "cp downloads and decrypts the named remote file to DEST, tagging it, like scp. Unlike pull, it neither writes into nor cleans the repository",
+		Args:  cobra.ExactArgs(2),
+	}
+
+	flags := cpFlags{}
+
+	cmd.Flags().StringVar(&flags.prefix, "prefix", "", "resolve the name under this subpath of the bucket")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runCp(cmd, args[0], args[1], flags); err != nil {
+			log.Fatalf("failed to copy: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runCp(cmd *cobra.Command, name, dest string, flags cpFlags) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
+	}
+
+	tagColors, err := diskhop.ParseTagColors(cfg.TagColors)
+	if err != nil {
+		return fmt.Errorf("invalid tag colors: %w", err)
+	}
+
+	diskhopStore, err := newDiskhopReadStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	dp := diskhop.NewFilePuller(diskhopStore.Puller)
+	dp.StrictTags = strictTags(cmd, cfg)
+	dp.OnTagError = warnTagError
+	dp.TagColors = tagColors
+
+	pullOpts := []store.PullOption{
+		store.WithPullPrefix(flags.prefix),
+		store.WithPullLimiter(newLimiter(cmd, cfg)),
+	}
+
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if so != nil {
+		pullOpts = append(pullOpts, store.WithPullSealOpener(so))
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		pullOpts = append(pullOpts, store.WithPullMetadataSealOpener(mso))
+	}
+
+	path, err := dp.Copy(cmd.Context(), remoteNames(cfg, []string{name})[0], dest, pullOpts...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "copied %s to %s\n", name, path)
+
+	return nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// renderDescription writes the pull description to w. If asJSON is true, the
+// file descriptions are written as a JSON array for programmatic use.
+func renderDescription(w io.Writer, desc *store.PullDescription, asJSON bool) error {
+	if asJSON {
+		files := desc.Files
+		if files == nil {
+			files = []store.FileDescription{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(files); err != nil {
+			return fmt.Errorf("failed to encode description: %w", err)
+		}
+
+		return nil
+	}
+
+	if desc.Files != nil {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Name", "Size", "Tags", "Uploaded"})
+
+		for _, file := range desc.Files {
+			table.Append([]string{
+				file.Name,
+				strconv.FormatInt(file.Size, 10),
+				strings.Join(file.Tags, ","),
+				file.UploadDate.Format(time.RFC3339),
+			})
+		}
+
+		table.Render()
+	}
+
+	if desc.Stats != nil {
+		table := tablewriter.NewWriter(w)
+		table.SetHeader([]string{"Files", "Total Size", "Min Size", "Max Size", "Avg Size"})
+		table.Append([]string{
+			strconv.Itoa(desc.Stats.Files),
+			strconv.FormatInt(desc.Stats.Bytes, 10),
+			strconv.FormatInt(desc.Stats.Min, 10),
+			strconv.FormatInt(desc.Stats.Max, 10),
+			strconv.FormatInt(desc.Stats.Avg, 10),
+		})
+
+		table.Render()
+	}
+
+	// Create a new tablewriter instance with os.Stdout as output
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"File Count"})
+	table.Append([]string{strconv.Itoa(desc.Count)})
+
+	// Render the table
+	table.Render()
+
+	return nil
+}
+
+// renderExplanation writes why each candidate file was or was not selected by
+// a pull to w, as a table or, if asJSON is true, a JSON array.
+func renderExplanation(w io.Writer, explanations []store.FileExplanation, asJSON bool) error {
+	if asJSON {
+		if explanations == nil {
+			explanations = []store.FileExplanation{}
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(explanations); err != nil {
+			return fmt.Errorf("failed to encode explanation: %w", err)
+		}
+
+		return nil
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Name", "Size", "Filter", "Sample", "Reason"})
+
+	for _, explanation := range explanations {
+		table.Append([]string{
+			explanation.Name,
+			strconv.FormatInt(explanation.Size, 10),
+			yesNo(explanation.Matched),
+			yesNo(explanation.Sampled),
+			explanation.Reason,
+		})
+	}
+
+	table.Render()
+
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}
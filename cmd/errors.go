@@ -14,12 +14,30 @@
 
 package main
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
+)
 
 // errNotDiskhop is an error that indicates the directory is not a diskhop
 // repository.
-var errNotDiskhop = errors.New("not a diskhop repository")
+var errNotDiskhop = diskhop.ErrNotDiskhop
 
 // errConnStringEmpty represents an error where the connection string is
 // empty.
 var errConnStringEmpty = errors.New("connection string cannot be empty")
+
+// storeErrorHint returns a suggestion for resolving a store error, based on
+// its kind, or the empty string if there is none.
+func storeErrorHint(err error) string {
+	switch {
+	case errors.Is(err, store.ErrUnauthorized):
+		return " (check the credentials in the connection string)"
+	case errors.Is(err, store.ErrUnavailable):
+		return " (check that the remote host is reachable and retry)"
+	}
+
+	return ""
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store/mongodop"
+	"github.com/spf13/cobra"
+)
+
+// newExcludeCommand creates the command that manages the exclude policy of the
+// remote: the glob patterns of the names of the files that every client's
+// pulls leave out unless run with --include-excluded.
+func newExcludeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "exclude",
+		Short: "List the patterns of the files that pulls of the remote leave out",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Run = func(cmd *cobra.Command, _ []string) {
+		if err := runExclude(cmd, func(patterns []string) ([]string, bool) { return patterns, false }); err != nil {
+			log.Fatalf("failed to list exclude policy: %v", err)
+		}
+	}
+
+	add := &cobra.Command{
+		Use:   "add PATTERN...",
+		Short: `Leave the files matching the glob patterns, such as "*.raw", out of pulls`,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runExclude(cmd, func(patterns []string) ([]string, bool) { return addPatterns(patterns, args), true }); err != nil {
+				log.Fatalf("failed to add to exclude policy: %v", err)
+			}
+		},
+	}
+
+	rm := &cobra.Command{
+		Use:   "rm PATTERN...",
+		Short: "Stop leaving the files matching the glob patterns out of pulls",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runExclude(cmd, func(patterns []string) ([]string, bool) { return removePatterns(patterns, args), true }); err != nil {
+				log.Fatalf("failed to remove from exclude policy: %v", err)
+			}
+		},
+	}
+
+	clearCmd := &cobra.Command{
+		Use:   "clear",
+		Short: "Remove every pattern of the exclude policy",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			if err := runExclude(cmd, func([]string) ([]string, bool) { return nil, true }); err != nil {
+				log.Fatalf("failed to clear exclude policy: %v", err)
+			}
+		},
+	}
+
+	cmd.AddCommand(add, rm, clearCmd)
+
+	return cmd
+}
+
+// runExclude applies update to the patterns of the exclude policy of the
+// remote, recording them if update reports a change, and lists them.
+func runExclude(cmd *cobra.Command, update func(patterns []string) ([]string, bool)) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	patterns, err := diskhop.ExcludePolicy(cmd.Context(), *diskhopStore)
+	if err != nil {
+		return err
+	}
+
+	updated, changed := update(patterns)
+	if changed {
+		if err := mongodop.ValidateExcludePatterns(updated); err != nil {
+			return err
+		}
+
+		if err := diskhop.SetExcludePolicy(cmd.Context(), *diskhopStore, updated); err != nil {
+			return err
+		}
+	}
+
+	for _, pattern := range updated {
+		fmt.Println(pattern)
+	}
+
+	return nil
+}
+
+// addPatterns returns the patterns with those of add that it does not hold
+// yet appended, in order.
+func addPatterns(patterns, add []string) []string {
+	updated := slices.Clone(patterns)
+
+	for _, pattern := range add {
+		if !slices.Contains(updated, pattern) {
+			updated = append(updated, pattern)
+		}
+	}
+
+	return updated
+}
+
+// removePatterns returns the patterns without those of remove.
+func removePatterns(patterns, remove []string) []string {
+	return slices.DeleteFunc(slices.Clone(patterns), func(pattern string) bool {
+		return slices.Contains(remove, pattern)
+	})
+}
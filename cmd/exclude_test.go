@@ -0,0 +1,40 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddPatterns(t *testing.T) {
+	t.Parallel()
+
+	current := []string{"*.raw"}
+
+	assert.Equal(t, []string{"*.raw", "video/*"}, addPatterns(current, []string{"video/*", "*.raw", "video/*"}))
+	assert.Equal(t, []string{"*.raw"}, current)
+}
+
+func TestRemovePatterns(t *testing.T) {
+	t.Parallel()
+
+	current := []string{"*.raw", "video/*", "*.iso"}
+
+	assert.Equal(t, []string{"video/*"}, removePatterns(current, []string{"*.raw", "*.iso", "*.tmp"}))
+	assert.Equal(t, []string{"*.raw", "video/*", "*.iso"}, current)
+	assert.Empty(t, removePatterns(current, current))
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/spf13/cobra"
+)
+
+func newFilterCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "filter",
+		Short: "Work with pull filter expressions",
+	}
+
+	cmd.AddCommand(newFilterValidateCommand())
+
+	return cmd
+}
+
+func newFilterValidateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "validate <expression>",
+		Short: "Check a filter expression without running a query",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runFilterValidate(os.Stdout, args[0]); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runFilterValidate(w io.Writer, expr string) error {
+	err := diskhop.ValidateFilter(expr)
+	if err == nil {
+		fmt.Fprintln(w, "filter is valid")
+
+		return nil
+	}
+
+	// Point at the problem in the expression when it can be located.
+	var syntaxErr *diskhop.FilterSyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Pos >= 0 {
+		fmt.Fprintf(w, "  %s\n  %s^\n", expr, strings.Repeat(" ", syntaxErr.Pos))
+	}
+
+	return err
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+// newFsckCommand creates a new cobra command that checks the consistency of
+// the remote.
+func newFsckCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check the remote for orphaned names, chunks, and commits",
+		Long: "Check that the files, chunks, names, commits, and IVs on the remote " +
+			"agree with each other. Use --fix to remove orphaned names and chunks " +
+			"and commits of files that are gone.",
+		Args: cobra.NoArgs,
+	}
+
+	var fix bool
+
+	cmd.Flags().BoolVar(&fix, "fix", false, "repair the issues that can be repaired safely")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runFsck(cmd, fix); err != nil {
+			log.Fatalf("failed to check remote: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runFsck(cmd *cobra.Command, fix bool) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Connect to the primary, since a stale secondary would report issues
+	// that do not exist.
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	if diskhopStore.Checker == nil {
+		return fmt.Errorf("store does not support fsck")
+	}
+
+	report, err := diskhopStore.Checker.Check(cmd.Context(), fix)
+	if err != nil {
+		return err
+	}
+
+	if err := renderCheckReport(os.Stdout, report); err != nil {
+		return fmt.Errorf("failed to render report: %w", err)
+	}
+
+	if n := report.Unfixed(); n > 0 {
+		return fmt.Errorf("%d issues remain", n)
+	}
+
+	return nil
+}
+
+// renderCheckReport writes the issues of a consistency check to w.
+func renderCheckReport(w io.Writer, report *store.CheckReport) error {
+	if len(report.Issues) == 0 {
+		_, err := fmt.Fprintln(w, "no issues found")
+
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "KIND\tID\tFIXED\tDETAIL")
+
+	for _, issue := range report.Issues {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", issue.Kind, issue.ID, yesNo(issue.Fixed), issue.Detail)
+	}
+
+	return tw.Flush()
+}
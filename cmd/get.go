@@ -0,0 +1,153 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+type getFlags struct {
+	json bool // Render the configuration as JSON
+}
+
+// configValues returns the configuration keys and their values in the order
+// they are declared, with the credentials in the connection string redacted.
+func configValues(cfg config) yaml.MapSlice {
+	cfg.ConnString = diskhop.RedactConnString(cfg.ConnString)
+
+	val := reflect.ValueOf(cfg)
+	typ := val.Type()
+
+	values := make(yaml.MapSlice, 0, typ.NumField())
+
+	for i := 0; i < typ.NumField(); i++ {
+		key, _, _ := strings.Cut(typ.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+
+		values = append(values, yaml.MapItem{Key: key, Value: val.Field(i).Interface()})
+	}
+
+	return values
+}
+
+// renderConfig writes the value of key, or every value if key is empty, to w
+// as YAML or, if asJSON is true, JSON.
+func renderConfig(w io.Writer, cfg config, key string, asJSON bool) error {
+	values := configValues(cfg)
+
+	var out interface{} = values
+	if asJSON {
+		m := make(map[string]interface{}, len(values))
+		for _, item := range values {
+			m[item.Key.(string)] = item.Value
+		}
+
+		out = m
+	}
+
+	if key != "" {
+		found := false
+
+		for _, item := range values {
+			if item.Key == key {
+				out, found = item.Value, true
+
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("unknown configuration key %q", key)
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(out); err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+
+		return nil
+	}
+
+	bytes, err := yaml.Marshal(out)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	_, err = w.Write(bytes)
+
+	return err
+}
+
+func runGet(_ *cobra.Command, args []string, flags getFlags) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	if !isDiskhopRepository(wd) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	key := ""
+	if len(args) > 0 {
+		key = args[0]
+	}
+
+	return renderConfig(os.Stdout, cfg, key, flags.json)
+}
+
+// newGetCommand creates a new cobra command for printing the resolved
+// configuration.
+func newGetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print the resolved configuration",
+		Long:  "get prints the configuration after merging the global config, the .diskhop file and the environment, or only the value of key. Credentials are redacted",
+		Args:  cobra.MaximumNArgs(1),
+	}
+
+	flags := getFlags{}
+
+	cmd.Flags().BoolVar(&flags.json, "json", false, "render the configuration as JSON")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runGet(cmd, args, flags); err != nil {
+			log.Fatalf("failed to get configuration: %v", err)
+		}
+	}
+
+	return cmd
+}
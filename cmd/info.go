@@ -0,0 +1,106 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+// newInfoCommand creates a new cobra command that summarizes the repository
+// and its remote.
+func newInfoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "info",
+		Aliases: []string{"whoami"},
+		Short:   "Show the current branch, remote, and remote stats",
+		Args:    cobra.NoArgs,
+	}
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runInfo(cmd, args); err != nil {
+			log.Fatalf("failed to get info: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runInfo(cmd *cobra.Command, _ []string) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	// Read the .diskhop file.
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	diskhopStore, err := newDiskhopReadStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	if diskhopStore.Stater == nil {
+		return fmt.Errorf("store does not support stats")
+	}
+
+	stats, err := diskhopStore.Stater.Stats(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get remote stats: %w", err)
+	}
+
+	return renderInfo(os.Stdout, cfg, stats)
+}
+
+// renderInfo writes a summary of the configuration and remote stats to w.
+func renderInfo(w io.Writer, cfg config, stats *store.Stats) error {
+	encryption := "none"
+	if len(cfg.Recipients) > 0 {
+		encryption = fmt.Sprintf("aes-gcm sealed for %d recipient(s)", len(cfg.Recipients))
+	} else if cfg.KeyFile != "" {
+		cipher, nonceSize := diskhop.NormalizeCipher(cfg.Cipher, cfg.NonceSize)
+		encryption = fmt.Sprintf("%s (%d-byte nonce)", cipher, nonceSize)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Branch:\t%s\n", cfg.CurrentBranch)
+	fmt.Fprintf(tw, "Remote:\t%s\n", diskhop.RedactConnString(cfg.ConnString))
+	fmt.Fprintf(tw, "Encryption:\t%s\n", encryption)
+	fmt.Fprintf(tw, "Files:\t%d\n", stats.FileCount)
+	fmt.Fprintf(tw, "Total size:\t%d bytes\n", stats.TotalSize)
+	fmt.Fprintf(tw, "Format version:\t%d\n", stats.FormatVersion)
+
+	if stats.NameEncoding != "" {
+		fmt.Fprintf(tw, "Name encoding:\t%s\n", stats.NameEncoding)
+	}
+
+	return tw.Flush()
+}
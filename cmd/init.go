@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/prestonvasquez/diskhop"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
@@ -36,6 +37,10 @@ func runInit(_ *cobra.Command, _ []string, cfg config) error {
 		return errNotDiskhop
 	}
 
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
+	}
+
 	// Turn the cfg into the .diskhop yaml file.
 	bytes, err := yaml.Marshal(cfg)
 	if err != nil {
@@ -63,6 +68,8 @@ func newInitCommand() *cobra.Command {
 
 	cmd.Flags().StringVar(&cfg.ConnString, "conn-string", "", "connection string")
 	cmd.Flags().StringVar(&cfg.KeyFile, "key", "", "path to private key for CSE")
+	cmd.Flags().StringVar(&cfg.Cipher, "cipher", diskhop.DefaultCipher, "encryption algorithm for CSE")
+	cmd.Flags().IntVar(&cfg.NonceSize, "nonce-size", 0, "nonce size in bytes, defaults to the cipher's standard size")
 
 	cmd.Run = func(cmd *cobra.Command, args []string) {
 		if err := runInit(cmd, args, cfg); err != nil {
@@ -0,0 +1,100 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/spf13/cobra"
+)
+
+// insecureFlag is the name of the global flag that accepts key files that
+// other users can access.
+const insecureFlag = "insecure"
+
+// insecureKeys reports whether key files that other users can access are used
+// rather than refused. The global --insecure flag takes precedence over the
+// insecureKeyFile configuration.
+func insecureKeys(cmd *cobra.Command, cfg config) bool {
+	insecure := cfg.InsecureKeyFile
+
+	if flag := cmd.Flags().Lookup(insecureFlag); flag != nil && flag.Changed {
+		insecure, _ = cmd.Flags().GetBool(insecureFlag)
+	}
+
+	return insecure
+}
+
+// repoConfig returns the library configuration of the repository, with the
+// --insecure flag applied.
+func repoConfig(cmd *cobra.Command, cfg config) diskhop.Config {
+	dcfg := diskhop.Config(cfg)
+	dcfg.InsecureKeyFile = insecureKeys(cmd, cfg)
+
+	return dcfg
+}
+
+// warnInsecureKey logs a warning if ref is a key file that other users can
+// access and insecure keys are allowed.
+func warnInsecureKey(cmd *cobra.Command, cfg config, ref string) {
+	if !insecureKeys(cmd, cfg) {
+		return
+	}
+
+	if path, ok := diskhop.ParseKeySource(ref).(diskhop.FileKeySource); ok {
+		if err := path.CheckPermissions(); errors.Is(err, diskhop.ErrInsecureKeyFile) {
+			log.Printf("warning: %v", err)
+		}
+	}
+}
+
+// insecureKeyHint tells the user how to resolve a refused key file.
+func insecureKeyHint(err error) error {
+	if errors.Is(err, diskhop.ErrInsecureKeyFile) {
+		return fmt.Errorf("%w, restrict it with chmod 600 or pass --%s", err, insecureFlag)
+	}
+
+	return err
+}
+
+// resolveKey resolves the key that ref references. A key file that other
+// users can access is refused, or only warned about if insecure keys are
+// allowed.
+func resolveKey(cmd *cobra.Command, cfg config, ref string) ([]byte, error) {
+	warnInsecureKey(cmd, cfg, ref)
+
+	key, err := diskhop.LoadKey(cmd.Context(), repoConfig(cmd, cfg), ref)
+
+	return key, insecureKeyHint(err)
+}
+
+// getSealOpener returns the seal opener of the repository: one for its
+// recipients if it has any, one for the key if it has that, and nil
+// otherwise.
+func getSealOpener(cmd *cobra.Command, cfg config, mgr dcrypto.IVManagerGetter) (dcrypto.SealOpener, error) {
+	if len(cfg.Recipients) > 0 {
+		warnInsecureKey(cmd, cfg, cfg.IdentityFile)
+	} else {
+		warnInsecureKey(cmd, cfg, cfg.KeyFile)
+	}
+
+	so, err := diskhop.LoadSealOpener(cmd.Context(), repoConfig(cmd, cfg), mgr)
+
+	return so, insecureKeyHint(err)
+}
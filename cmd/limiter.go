@@ -0,0 +1,37 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+// concurrencyFlag is the name of the global flag that bounds the number of
+// concurrent streams to the remote host.
+const concurrencyFlag = "concurrency"
+
+// newLimiter returns the limiter shared by every worker in a command. The
+// global --concurrency flag takes precedence over the configuration file. If
+// neither is set, the returned limiter is nil and concurrency is unbounded.
+func newLimiter(cmd *cobra.Command, cfg config) *store.Limiter {
+	concurrency := cfg.Concurrency
+
+	if flag := cmd.Flags().Lookup(concurrencyFlag); flag != nil && flag.Changed {
+		concurrency, _ = cmd.Flags().GetInt(concurrencyFlag)
+	}
+
+	return store.NewLimiter(concurrency)
+}
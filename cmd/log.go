@@ -0,0 +1,106 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+type logFlags struct {
+	limit int // Maximum number of commits to list
+}
+
+func newLogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "log",
+		Short: "List the commits of the current branch, newest first",
+		Args:  cobra.NoArgs,
+	}
+
+	flags := logFlags{}
+
+	cmd.Flags().IntVarP(&flags.limit, "limit", "n", 20, "list at most this many commits, or all of them if 0")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runLog(cmd, flags); err != nil {
+			log.Fatalf("failed to list commits: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runLog(cmd *cobra.Command, flags logFlags) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	diskhopStore, err := newDiskhopReadStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	commits, err := diskhop.Log(cmd.Context(), *diskhopStore, flags.limit)
+	if err != nil {
+		return err
+	}
+
+	renderLog(os.Stdout, commits)
+
+	return nil
+}
+
+// renderLog writes the commits to w.
+func renderLog(w io.Writer, commits []store.Commit) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"SHA", "Time", "Message", "Files"})
+
+	for _, commit := range commits {
+		// Commits recorded before their time was kept have none to show.
+		when := ""
+		if !commit.Time.IsZero() {
+			when = commit.Time.Local().Format(time.DateTime)
+		}
+
+		files := commit.FileID
+		if len(commit.FileIDs) > 0 {
+			files = fmt.Sprintf("%d files", len(commit.FileIDs))
+		}
+
+		table.Append([]string{commit.SHA, when, commit.Message, files})
+	}
+
+	table.Render()
+}
@@ -28,14 +28,31 @@ func main() {
 		Version: diskhop.Version,
 	}
 
+	cmd.PersistentFlags().Int(concurrencyFlag, 0, "maximum number of concurrent streams to the remote host")
+	cmd.PersistentFlags().Bool(strictTagsFlag, false, "fail when file tags cannot be read or set")
+	cmd.PersistentFlags().Bool(insecureFlag, false, "use key files that other users can access, with a warning")
+
 	cmd.AddCommand(newBranchCommand())
 	cmd.AddCommand(newCheckoutCommand())
 	cmd.AddCommand(newCleanCommand())
 	cmd.AddCommand(newConfigCommand())
+	cmd.AddCommand(newCpCommand())
+	cmd.AddCommand(newExcludeCommand())
+	cmd.AddCommand(newFilterCommand())
+	cmd.AddCommand(newFsckCommand())
+	cmd.AddCommand(newInfoCommand())
 	cmd.AddCommand(newInitCommand())
+	cmd.AddCommand(newLogCommand())
+	cmd.AddCommand(newMountCommand())
 	cmd.AddCommand(newPullCommand())
+	cmd.AddCommand(newPruneCommand())
 	cmd.AddCommand(newPushCommand())
+	cmd.AddCommand(newRecipientsCommand())
 	cmd.AddCommand(newRevertCommand())
+	cmd.AddCommand(newRmCommand())
+	cmd.AddCommand(newTagsCommand())
+	cmd.AddCommand(newUnmaskCommand())
+	cmd.AddCommand(newUpgradeCommand())
 
 	if err := cmd.Execute(); err != nil {
 		log.Fatalf("error: %v", err)
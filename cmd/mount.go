@@ -0,0 +1,112 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/mount"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+type mountFlags struct {
+	prefix string // Subpath of the bucket to mount
+}
+
+// newMountCommand creates the command that serves the remote files as a
+// read-only file system.
+func newMountCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mount MOUNTPOINT",
+		Short: "Mount the remote files read-only at a local directory",
+		Long:  "mount serves the remote files, decrypted, as a read-only FUSE file system at MOUNTPOINT until it is interrupted or unmounted. Files are downloaded when they are read, and the listing is taken when the command starts",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	flags := mountFlags{}
+
+	cmd.Flags().StringVar(&flags.prefix, "prefix", "", "mount this subpath of the bucket")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runMount(cmd, args[0], flags); err != nil {
+			log.Fatalf("failed to mount: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runMount(cmd *cobra.Command, mountpoint string, flags mountFlags) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	diskhopStore, err := newDiskhopReadStore(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	pullOpts := []store.PullOption{
+		store.WithPullPrefix(flags.prefix),
+		store.WithPullLimiter(newLimiter(cmd, cfg)),
+	}
+
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if so != nil {
+		pullOpts = append(pullOpts, store.WithPullSealOpener(so))
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		pullOpts = append(pullOpts, store.WithPullMetadataSealOpener(mso))
+	}
+
+	fmt.Fprintf(os.Stderr, "mounting at %s, interrupt to unmount\n", mountpoint)
+
+	// An interrupt unmounts the file system rather than failing the command.
+	return mount.Mount(ctx, diskhopStore.Puller, mountpoint, pullOpts...)
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// progressInterval is how often the pull progress is redrawn.
+const progressInterval = 250 * time.Millisecond
+
+// transferRate counts the bytes written by a pull to estimate its throughput
+// and the time remaining, measured from the first byte written.
+type transferRate struct {
+	mu    sync.Mutex
+	start time.Time
+	bytes int64
+}
+
+// Add records n bytes written.
+func (r *transferRate) Add(n int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+
+	r.bytes += int64(n)
+
+	return nil
+}
+
+// estimate returns the bytes written by now, the overall throughput in bytes
+// per second, and the time remaining to write total bytes. The throughput and
+// time remaining are zero until they can be estimated.
+func (r *transferRate) estimate(now time.Time, total int64) (int64, float64, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elapsed := now.Sub(r.start).Seconds()
+	if r.start.IsZero() || elapsed <= 0 {
+		return r.bytes, 0, 0
+	}
+
+	rate := float64(r.bytes) / elapsed
+
+	var eta time.Duration
+	if remaining := total - r.bytes; remaining > 0 {
+		eta = time.Duration(float64(remaining) / rate * float64(time.Second)).Round(time.Second)
+	}
+
+	return r.bytes, rate, eta
+}
+
+// describeProgress returns the description of the pull progress bar.
+func describeProgress(files, total int, rate float64, eta time.Duration) string {
+	desc := fmt.Sprintf("[cyan][1/1][reset] Pulling %d/%d files", files, total)
+	if rate > 0 {
+		desc += fmt.Sprintf(", %s/s, ETA %s", formatBytes(rate), eta)
+	}
+
+	return desc
+}
+
+// formatBytes returns n as a decimal size, such as 4.2 MB.
+func formatBytes(n float64) string {
+	units := []string{"B", "kB", "MB", "GB", "TB"}
+
+	i := 0
+	for ; n >= 1000 && i < len(units)-1; i++ {
+		n /= 1000
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+// migrateProgress reports the files of a migration to w as they are copied.
+// The bytes of a file are only reported when it is streamed through the
+// client, since the server copies the others without reporting them.
+type migrateProgress struct {
+	w   io.Writer
+	now func() time.Time
+
+	mu    sync.Mutex
+	start time.Time // When the current file started
+	bytes int64     // Bytes of the current file streamed so far
+	drawn time.Time // When the progress of the current file was last drawn
+}
+
+var _ store.ProgressObserver = (*migrateProgress)(nil)
+
+func newMigrateProgress(w io.Writer) *migrateProgress {
+	return &migrateProgress{w: w, now: time.Now}
+}
+
+func (p *migrateProgress) OnFileStart(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.start, p.bytes, p.drawn = p.now(), 0, time.Time{}
+
+	fmt.Fprintf(p.w, "migrating %s\n", name)
+}
+
+func (p *migrateProgress) OnFileProgress(name string, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.bytes += n
+
+	now := p.now()
+	if now.Sub(p.drawn) < progressInterval {
+		return
+	}
+
+	p.drawn = now
+
+	desc := fmt.Sprintf("  %s: %s copied", name, formatBytes(float64(p.bytes)))
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		desc += fmt.Sprintf(", %s/s", formatBytes(float64(p.bytes)/elapsed))
+	}
+
+	fmt.Fprintln(p.w, desc)
+}
+
+func (p *migrateProgress) OnFileDone(name string, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "migrated %s (%s)\n", name, formatBytes(float64(bytes)))
+}
+
+func (p *migrateProgress) OnError(name string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "failed to migrate %s: %v\n", name, err)
+}
+
+func (p *migrateProgress) OnBatchDone(files int, bytes int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "migrated %d file(s), %s\n", files, formatBytes(float64(bytes)))
+}
@@ -0,0 +1,131 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferRateEstimate(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		bytes    int64
+		elapsed  time.Duration
+		total    int64
+		wantRate float64
+		wantETA  time.Duration
+	}{
+		{
+			name:  "nothing written",
+			total: 100,
+		},
+		{
+			name:     "half written",
+			bytes:    50,
+			elapsed:  10 * time.Second,
+			total:    100,
+			wantRate: 5,
+			wantETA:  10 * time.Second,
+		},
+		{
+			name:     "all written",
+			bytes:    100,
+			elapsed:  4 * time.Second,
+			total:    100,
+			wantRate: 25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			rate := &transferRate{bytes: tt.bytes}
+			if tt.bytes > 0 {
+				rate.start = start
+			}
+
+			done, gotRate, gotETA := rate.estimate(start.Add(tt.elapsed), tt.total)
+			assert.Equal(t, tt.bytes, done)
+			assert.Equal(t, tt.wantRate, gotRate)
+			assert.Equal(t, tt.wantETA, gotETA)
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "4.2 MB", formatBytes(4.2e6))
+	assert.Equal(t, "1500.0 TB", formatBytes(1.5e15))
+}
+
+func TestMigrateProgress(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	var buf bytes.Buffer
+
+	progress := newMigrateProgress(&buf)
+	progress.now = func() time.Time { return now }
+
+	// The server copy of a.txt reports no bytes.
+	progress.OnFileStart("a.txt")
+	progress.OnFileDone("a.txt", 2000)
+
+	// The streamed copy of b.txt is drawn at most once per interval.
+	progress.OnFileStart("b.txt")
+
+	now = now.Add(time.Second)
+	progress.OnFileProgress("b.txt", 1000)
+
+	now = now.Add(progressInterval / 2)
+	progress.OnFileProgress("b.txt", 1000)
+
+	now = now.Add(progressInterval)
+	progress.OnFileProgress("b.txt", 1000)
+	progress.OnFileDone("b.txt", 3000)
+
+	progress.OnFileStart("c.txt")
+	progress.OnError("c.txt", errors.New("boom"))
+	progress.OnBatchDone(2, 5000)
+
+	want := []string{
+		"migrating a.txt",
+		"migrated a.txt (2.0 kB)",
+		"migrating b.txt",
+		"  b.txt: 1.0 kB copied, 1.0 kB/s",
+		"  b.txt: 3.0 kB copied, 2.2 kB/s",
+		"migrated b.txt (3.0 kB)",
+		"migrating c.txt",
+		"failed to migrate c.txt: boom",
+		"migrated 2 file(s), 5.0 kB",
+	}
+
+	assert.Equal(t, want, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"))
+}
@@ -0,0 +1,209 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/internal/filter"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+type pruneFlags struct {
+	dryRun bool // List what would be deleted without deleting it
+	yes    bool // Skip the confirmation before deleting the files
+}
+
+func newPruneCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the files and versions of the current branch that the retention policy does not keep",
+		Long: "prune enforces the retention policy of the config: keepVersions and versionMaxAge for the " +
+			"replaced versions, retainMaxAge for the files and retainMaxSize for the whole branch, " +
+			"deleting the oldest files first",
+		Args: cobra.NoArgs,
+	}
+
+	flags := pruneFlags{}
+
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "list the files and versions that would be deleted without deleting them")
+	cmd.Flags().BoolVarP(&flags.yes, "yes", "y", false, "prune without asking for confirmation")
+
+	cmd.Run = func(cmd *cobra.Command, _ []string) {
+		if err := runPrune(cmd, flags); err != nil {
+			log.Fatalf("failed to prune: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runPrune(cmd *cobra.Command, flags pruneFlags) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	policy, err := retentionPolicy(cfg)
+	if err != nil {
+		return err
+	}
+
+	if policy == (store.RetentionPolicy{}) {
+		return fmt.Errorf("no retention policy is configured, set keepVersions, versionMaxAge, retainMaxAge or retainMaxSize")
+	}
+
+	if !flags.dryRun {
+		prompt := fmt.Sprintf("Delete the files and versions of branch %q that the retention policy does not keep? This cannot be undone.",
+			cfg.CurrentBranch)
+		if !confirmDestructive(flags.yes, prompt) {
+			fmt.Fprintln(os.Stderr, "nothing was pruned, pass --yes to prune")
+
+			return nil
+		}
+	}
+
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	if flags.dryRun {
+		return describePrune(cmd, cfg, diskhopStore, policy)
+	}
+
+	n, err := diskhop.Prune(cmd.Context(), *diskhopStore, policy)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "pruned %d file(s) and version(s)\n", n)
+
+	return nil
+}
+
+// retentionPolicy returns the retention policy of the config.
+func retentionPolicy(cfg config) (store.RetentionPolicy, error) {
+	policy := store.RetentionPolicy{KeepVersions: cfg.KeepVersions}
+
+	var err error
+
+	if cfg.VersionMaxAge != "" {
+		if policy.VersionMaxAge, err = time.ParseDuration(cfg.VersionMaxAge); err != nil {
+			return policy, fmt.Errorf("invalid version max age %q: %w", cfg.VersionMaxAge, err)
+		}
+	}
+
+	if cfg.RetainMaxAge != "" {
+		if policy.MaxAge, err = parseAge(cfg.RetainMaxAge); err != nil {
+			return policy, err
+		}
+	}
+
+	if cfg.RetainMaxSize != "" {
+		if policy.MaxSize, err = filter.ParseSize(cfg.RetainMaxSize); err != nil {
+			return policy, err
+		}
+
+		if policy.MaxSize <= 0 {
+			return policy, fmt.Errorf("invalid size %q, must be positive", cfg.RetainMaxSize)
+		}
+	}
+
+	return policy, nil
+}
+
+// describePrune writes the files and versions that pruning would delete to
+// stdout, with their names if the repository has a key to decrypt them.
+func describePrune(cmd *cobra.Command, cfg config, diskhopStore *diskhopStore, policy store.RetentionPolicy) error {
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	var opener dcrypto.Opener
+	if so != nil {
+		opener = so
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		opener = mso
+	}
+
+	files, err := diskhop.DescribePrune(cmd.Context(), *diskhopStore, policy, opener)
+	if err != nil {
+		return err
+	}
+
+	renderPrune(os.Stdout, files)
+
+	return nil
+}
+
+// renderPrune writes the files and versions that pruning would delete to w.
+func renderPrune(w io.Writer, files []store.PrunedFile) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Name", "ID", "Kind", "Size", "Pushed", "Reason"})
+
+	var versions int
+	var size int64
+
+	for _, file := range files {
+		kind := "file"
+		if file.Version {
+			kind = "version"
+			versions++
+		}
+
+		size += file.Size
+
+		table.Append([]string{
+			file.Name,
+			file.ID,
+			kind,
+			formatBytes(float64(file.Size)),
+			file.UploadDate.Local().Format(time.DateTime),
+			file.Reason,
+		})
+	}
+
+	table.Render()
+
+	fmt.Fprintf(w, "%d file(s) and %d version(s) would be deleted, freeing %s\n",
+		len(files)-versions, versions, formatBytes(float64(size)))
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := retentionPolicy(config{
+		KeepVersions:  3,
+		VersionMaxAge: "720h",
+		RetainMaxAge:  "90d",
+		RetainMaxSize: "2GB",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, store.RetentionPolicy{
+		KeepVersions:  3,
+		VersionMaxAge: 720 * time.Hour,
+		MaxAge:        90 * 24 * time.Hour,
+		MaxSize:       2_000_000_000,
+	}, policy)
+
+	policy, err = retentionPolicy(config{})
+	require.NoError(t, err)
+	assert.Zero(t, policy)
+
+	// Sizes are parsed like those of the size() filter, in decimal or binary
+	// units.
+	policy, err = retentionPolicy(config{RetainMaxSize: "1.5 GiB"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1.5*(1<<30)), policy.MaxSize)
+
+	for _, size := range []string{"lots", "GB", "0GB", "-1MB", "5PB"} {
+		_, err = retentionPolicy(config{RetainMaxSize: size})
+		assert.Error(t, err, size)
+	}
+}
@@ -15,16 +15,14 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"fmt"
 	"log"
 	"os"
-	"strconv"
+	"path/filepath"
+	"time"
 
-	"github.com/olekukonko/tablewriter"
 	"github.com/prestonvasquez/diskhop"
-	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/internal/filter"
 	"github.com/prestonvasquez/diskhop/store"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
@@ -32,7 +30,57 @@ import (
 
 const defaultSampeSize = 5
 
-func runPull(cmd *cobra.Command, _ []string, opts store.PullOptions) error {
+type pullFlags struct {
+	opts   store.PullOptions
+	json   bool // Render the description as JSON
+	stdout bool // Write the single selected file to stdout
+
+	noRepeat bool // Sample from the files not pulled before
+
+	contentAddressed bool // Name the pulled files by the hash of their contents
+
+	maxMemory string // Bound on the bytes of the files held in memory at once
+}
+
+func runPull(cmd *cobra.Command, args []string, flags pullFlags) error {
+	opts := flags.opts
+
+	if flags.json && !opts.DescribeFiles && !opts.Explain {
+		return fmt.Errorf("--json requires --describe-files or --explain")
+	}
+
+	if len(args) > 0 && opts.Filter != "" {
+		return fmt.Errorf("file names cannot be combined with --filter")
+	}
+
+	if len(args) > 0 && flags.noRepeat {
+		return fmt.Errorf("file names cannot be combined with --no-repeat")
+	}
+
+	if err := diskhop.ValidateFilter(opts.Filter); err != nil {
+		return err
+	}
+
+	var maxMemory int64
+	if flags.maxMemory != "" {
+		var err error
+		if maxMemory, err = filter.ParseSize(flags.maxMemory); err != nil {
+			return fmt.Errorf("invalid --max-memory: %w", err)
+		}
+
+		if maxMemory <= 0 {
+			return fmt.Errorf("invalid --max-memory %q, must be positive", flags.maxMemory)
+		}
+	}
+
+	if opts.ParallelChunks < 0 {
+		return fmt.Errorf("--parallel-chunks must not be negative")
+	}
+
+	if flags.stdout && opts.DescribeOnly {
+		return fmt.Errorf("--stdout cannot be combined with --describe or --describe-files")
+	}
+
 	curDir, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
@@ -49,130 +97,200 @@ func runPull(cmd *cobra.Command, _ []string, opts store.PullOptions) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Get the files in the directory.
-	f, err := os.Open(curDir)
-	if err != nil {
-		return fmt.Errorf("failed to open directory: %w", err)
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
 	}
 
-	defer f.Close()
-
-	// Read the directory contents
-	fileInfo, _ := f.Readdir(-1)
-
-	if err := diskhop.Clean(fileInfo); err != nil {
-		return fmt.Errorf("failed to clean directory: %w", err)
+	if err := diskhop.ValidateTagMerge(cfg.TagMerge); err != nil {
+		return fmt.Errorf("invalid tag merge policy: %w", err)
 	}
 
-	// Get the AEAD key, if it exists.
-	key, err := getAESKey(cfg)
+	tagColors, err := diskhop.ParseTagColors(cfg.TagColors)
 	if err != nil {
-		return fmt.Errorf("failed to get AES key from config: %w", err)
+		return fmt.Errorf("invalid tag colors: %w", err)
 	}
 
-	defer dcrypto.Zero(key)
-
 	// Geth the pusher for the remote host.
-	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	diskhopStore, err := newDiskhopReadStore(cmd.Context(), cfg)
 	if err != nil {
 		return fmt.Errorf("failed to create diskhop store: %w", err)
 	}
 
-	dp := diskhop.NewFilePuller(diskhopStore.puller)
+	dp := diskhop.NewFilePuller(diskhopStore.Puller)
+	dp.StrictTags = strictTags(cmd, cfg)
+	dp.OnTagError = warnTagError
+	dp.TagColors = tagColors
+	dp.TagMerge = cfg.TagMerge
+
+	if flags.noRepeat {
+		dp.NoRepeat = cfg.CurrentBranch
+	}
+
+	dp.ContentAddressed = flags.contentAddressed
+
+	// The rate is only tracked when the progress bar is shown.
+	showProgress := !opts.DescribeOnly && !flags.stdout
+
+	rate := &transferRate{}
+	if showProgress {
+		dp.Tracker = rate
+	}
 
 	trackerDone := make(chan struct{}, 1)
 	go func() {
 		defer close(trackerDone)
 
-		if opts.DescribeOnly {
+		// The progress bar would corrupt the file written to stdout.
+		if !showProgress {
 			return
 		}
 
-		total := <-dp.Total()
-		bar := progressbar.NewOptions(total,
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetWidth(15),
-			progressbar.OptionSetDescription("[cyan][1/1][reset] Pulling data..."),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}))
-
-		for range dp.Progress() {
-			bar.Add(1)
-		}
+		renderPullProgress(dp, rate)
 	}()
 
 	pullOpts := []store.PullOption{
 		func(o *store.PullOptions) {
 			*o = opts
 		},
+		store.WithPullLimiter(newLimiter(cmd, cfg)),
+		store.WithPullMemoryBudget(store.NewMemoryBudget(maxMemory)),
 	}
 
-	if key != nil {
-		block, err := aes.NewCipher(key)
-		if err != nil {
-			return fmt.Errorf("failed to create new AES cipher: %w", err)
-		}
-
-		aesgcm, err := cipher.NewGCM(block)
-		if err != nil {
-			return fmt.Errorf("failed to create new GCM cipher: %w", err)
-		}
+	if len(args) > 0 {
+		pullOpts = append(pullOpts, store.WithPullNames(remoteNames(cfg, args)...))
+	}
 
-		so := dcrypto.NewAEAD(diskhopStore.ivMgr, aesgcm)
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
 
+	if so != nil {
 		pullOpts = append(pullOpts, store.WithPullSealOpener(so))
 	}
 
-	desc, err := dp.Pull(cmd.Context(), pullOpts...)
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
 	if err != nil {
-		return fmt.Errorf("failed to push: %w", err)
+		return err
+	}
+
+	if mso != nil {
+		pullOpts = append(pullOpts, store.WithPullMetadataSealOpener(mso))
+	}
+
+	if flags.stdout {
+		return diskhop.PullSingle(cmd.Context(), dp, os.Stdout, pullOpts...)
+	}
+
+	desc, err := diskhop.PullFiles(cmd.Context(), repoConfig(cmd, cfg), dp, pullOpts...)
+	if err != nil {
+		return err
 	}
 
 	<-trackerDone
 
-	description := [][]string{
-		{strconv.Itoa(desc.Count)},
+	if opts.Explain {
+		return renderExplanation(os.Stdout, desc.Explanations, flags.json)
 	}
 
-	// Create a new tablewriter instance with os.Stdout as output
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"File Count"})
+	return renderDescription(os.Stdout, desc, flags.json)
+}
 
-	// Append data to the table
-	for _, v := range description {
-		table.Append(v)
+// remoteNames returns the stored names of the files that names refer to.
+// Files are stored under their absolute paths, so a relative name is resolved
+// against the repository directory.
+func remoteNames(cfg config, names []string) []string {
+	resolved := make([]string, 0, len(names))
+	for _, name := range names {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(cfg.CurDir, name)
+		}
+
+		resolved = append(resolved, filepath.Clean(name))
 	}
 
-	// Render the table
-	table.Render() // Send output to stdout
+	return resolved
+}
+
+// renderPullProgress draws the bytes written by the pull, along with the
+// files written, the throughput, and the time remaining, until the pull is
+// done.
+func renderPullProgress(dp *diskhop.FilePuller, rate *transferRate) {
+	total := <-dp.Total()
+	totalSize := <-dp.TotalSize()
+
+	bar := progressbar.NewOptions64(totalSize,
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionSetPredictTime(false),
+		progressbar.OptionSetDescription(describeProgress(0, total, 0, 0)),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}))
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	files := 0
+	progress := dp.Progress()
+
+	for progress != nil {
+		select {
+		case _, ok := <-progress:
+			if !ok {
+				progress = nil
+
+				break
+			}
+
+			files++
+		case <-ticker.C:
+		}
+
+		done, bytesPerSec, eta := rate.estimate(time.Now(), totalSize)
 
-	return nil
+		bar.Describe(describeProgress(files, total, bytesPerSec, eta))
+		_ = bar.Set64(min(done, totalSize))
+	}
 }
 
 // newPullCommand creates a new cobra command for the pull subcommand to pull
 // files from the remote host.
 func newPullCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use: "pull",
-		// Args: cobra.ExactArgs(1), // Ensures exactly one argument is provided
-		Long: "pull will download files from the remote host to a local diskhop directory",
+		Use:  "pull [name...]",
+		Long: "pull will download files from the remote host to a local diskhop directory. Naming files pulls exactly those files instead of a random sample",
 	}
 
-	flags := store.PullOptions{}
-
-	cmd.Flags().IntVar(&flags.SampleSize, "sample", defaultSampeSize, "chose a random subset of data")
-	cmd.Flags().StringVarP(&flags.Filter, "filter", "f", "", "filter documents by expression")
-	cmd.Flags().BoolVarP(&flags.DescribeOnly, "describe", "d", false, "describe the query without actually pulling data")
-	cmd.Flags().IntVarP(&flags.Workers, "workers", "w", 1, "number of workers to use")
-	cmd.Flags().BoolVarP(&flags.MaskName, "mask", "m", false, "mask the file name")
+	flags := pullFlags{}
+
+	cmd.Flags().IntVar(&flags.opts.SampleSize, "sample", defaultSampeSize, "chose a random subset of data")
+	cmd.Flags().StringVarP(&flags.opts.Filter, "filter", "f", "", "filter documents by expression")
+	cmd.Flags().BoolVarP(&flags.opts.DescribeOnly, "describe", "d", false, "describe the query without actually pulling data")
+	cmd.Flags().BoolVar(&flags.opts.DescribeFiles, "describe-files", false, "list the files matching the query without pulling data")
+	cmd.Flags().BoolVar(&flags.opts.Stats, "stats", false, "summarize the sizes of the files matching the query without pulling data")
+	cmd.Flags().BoolVar(&flags.opts.Explain, "explain", false, "show whether each file matched the filter and the sampling without pulling data")
+	cmd.Flags().BoolVar(&flags.json, "json", false, "render the file description as JSON")
+	cmd.Flags().BoolVar(&flags.stdout, "stdout", false, "write the selected file to stdout, failing unless exactly one matches")
+	cmd.Flags().IntVarP(&flags.opts.Workers, "workers", "w", 1, "number of workers to use")
+	cmd.Flags().StringVar(&flags.maxMemory, "max-memory", "", `bound the bytes of the files held in memory at once across workers, e.g. "2GB"`)
+	cmd.Flags().IntVar(&flags.opts.ParallelChunks, "parallel-chunks", 0, "download each large file as this many ranges of chunks at once")
+	cmd.Flags().StringVar(&flags.opts.Prefix, "prefix", "", "only pull files pushed under this subpath of the bucket")
+	cmd.Flags().BoolVarP(&flags.opts.MaskName, "mask", "m", false, "mask the file name, keeping its extension")
+	cmd.Flags().BoolVar(&flags.contentAddressed, "content-addressed", false, "name the pulled files by the hash of their contents, listing their names in "+diskhop.ManifestName)
+	cmd.Flags().BoolVar(&flags.opts.IncludeExcluded, "include-excluded", false, "select the files that the exclude policy of the remote leaves out")
+	cmd.Flags().BoolVar(&flags.noRepeat, "no-repeat", false, "sample from the files not pulled before, starting over once all have been pulled")
 
 	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if flags.opts.DescribeFiles || flags.opts.Explain || flags.opts.Stats {
+			flags.opts.DescribeOnly = true
+		}
+
 		if err := runPull(cmd, args, flags); err != nil {
 			log.Fatalf("failed to pull: %v", err)
 		}
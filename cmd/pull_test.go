@@ -0,0 +1,104 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namePuller is a store that holds files by their stored names and serves the
+// files that a pull names.
+type namePuller struct {
+	files map[string][]byte
+}
+
+func (p *namePuller) Pull(_ context.Context, buf store.DocumentBuffer, opts ...store.PullOption) (*store.PullDescription, error) {
+	pullOpts := store.PullOptions{}
+	for _, opt := range opts {
+		opt(&pullOpts)
+	}
+
+	docs := make([]*store.Document, 0, len(pullOpts.Names))
+	for _, name := range pullOpts.Names {
+		data, ok := p.files[name]
+		if !ok {
+			return nil, store.ErrFileNotFound
+		}
+
+		docs = append(docs, &store.Document{Filename: name, Data: data, Size: int64(len(data))})
+	}
+
+	go func() {
+		for _, doc := range docs {
+			buf.Send(doc, nil)
+		}
+
+		buf.Send(nil, io.EOF)
+	}()
+
+	return &store.PullDescription{Count: len(docs)}, nil
+}
+
+func TestRunPullRelativeName(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".diskhop"), []byte("connString: namepuller://test\n"), 0o600))
+
+	// Files are stored under their absolute paths.
+	puller := &namePuller{files: map[string][]byte{
+		filepath.Join(dir, "a.jpg"): []byte("diskhop"),
+	}}
+
+	diskhop.RegisterStore("namepuller", func(context.Context, diskhop.Config, bool) (*diskhop.Store, error) {
+		return &diskhop.Store{Puller: puller}, nil
+	})
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	cmd := newPullCommand()
+	cmd.SetContext(context.Background())
+
+	flags := pullFlags{opts: store.PullOptions{SampleSize: defaultSampeSize, Workers: 1}}
+	require.NoError(t, runPull(cmd, []string{"a.jpg"}, flags))
+
+	got, err := os.ReadFile(filepath.Join(dir, "a.jpg"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "diskhop", string(got))
+}
+
+func TestRemoteNames(t *testing.T) {
+	t.Parallel()
+
+	cfg := config{CurDir: "/repo"}
+
+	got := remoteNames(cfg, []string{"a.jpg", "./photos/../b.jpg", "/other/c.jpg"})
+	assert.Equal(t, []string{"/repo/a.jpg", "/repo/b.jpg", "/other/c.jpg"}, got)
+}
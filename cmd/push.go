@@ -15,15 +15,12 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
 
 	"github.com/prestonvasquez/diskhop"
-	"github.com/prestonvasquez/diskhop/exp/dcrypto"
 	"github.com/prestonvasquez/diskhop/store"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/cobra"
@@ -56,7 +53,22 @@ func extractName(arg string) (string, error) {
 	return "", fmt.Errorf("invalid format: %s. Must be 'migrate/{name}'", arg)
 }
 
-func runPush(cmd *cobra.Command, args []string) error {
+type pushFlags struct {
+	yes    bool   // Skip the confirmation before deleting local files
+	label  string // Label of the batch of pushed files
+	prefix string // Subpath of the bucket to push to
+
+	message string // Message recorded with the commits of the push
+	group   bool   // Record the push as one commit
+	amend   bool   // Fold the push into the last commit
+
+	skipExisting bool // Skip files whose name and hash match the remote
+	dedup        bool // Share the storage of files with the same contents
+
+	exifTags bool // Tag images with the camera, date and location they record
+}
+
+func runPush(cmd *cobra.Command, args []string, flags pushFlags) error {
 	curDir, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
@@ -73,16 +85,14 @@ func runPush(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Get the AEAD key, if it exists.
-	key, err := getAESKey(cfg)
-	if err != nil {
-		return fmt.Errorf("failed to get AES key from config: %w", err)
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
 	}
 
-	defer dcrypto.Zero(key)
+	migrate := args[0] != "origin"
 
 	var diskhopStore *diskhopStore
-	if args[0] == "origin" {
+	if !migrate {
 		// Geth the pusher for the remote host.
 		diskhopStore, err = newDiskhopStore(cmd.Context(), cfg)
 		if err != nil {
@@ -95,7 +105,7 @@ func runPush(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	dopPusher := diskhop.NewFilePusher(diskhopStore.pusher)
+	dopPusher := diskhop.NewFilePusher(diskhopStore.Pusher)
 
 	// Get the files in the directory.
 	f, err := os.Open(curDir)
@@ -108,44 +118,114 @@ func runPush(cmd *cobra.Command, args []string) error {
 	// Read the directory contents
 	fileInfo, _ := f.Readdir(-1)
 
-	dopPusher.ProgressTracker = progressbar.NewOptions(len(fileInfo),
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowBytes(true),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetDescription("[cyan][1/1][reset] Pushing data..."),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
+	opts := []store.PushOption{
+		store.WithPushLimiter(newLimiter(cmd, cfg)),
+		store.WithPushPrefix(flags.prefix),
+	}
+
+	// A migration reports each file as it is copied, and the bytes of those
+	// streamed through the client, in place of the progress bar.
+	if migrate {
+		opts = append(opts, store.WithPushObserver(newMigrateProgress(os.Stderr)))
+	} else {
+		dopPusher.ProgressTracker = newPushProgressBar(len(fileInfo))
+	}
 
-	opts := []store.PushOption{}
+	dopPusher.Batch = diskhop.NewBatchID()
+	dopPusher.BatchLabel = flags.label
+	dopPusher.Message = flags.message
+	dopPusher.GroupCommits = flags.group
 
-	if key != nil {
-		block, err := aes.NewCipher(key)
+	if flags.amend {
+		commits, err := diskhop.Log(cmd.Context(), *diskhopStore, 1)
 		if err != nil {
-			return fmt.Errorf("failed to create new AES cipher: %w", err)
+			return err
 		}
 
-		aesgcm, err := cipher.NewGCM(block)
-		if err != nil {
-			return fmt.Errorf("failed to create new GCM cipher: %w", err)
+		if len(commits) == 0 {
+			return fmt.Errorf("there is no commit to amend")
+		}
+
+		dopPusher.Amend = commits[0].SHA
+	}
+
+	dopPusher.StrictTags = strictTags(cmd, cfg)
+	dopPusher.OnTagError = warnTagError
+
+	if flags.exifTags {
+		dopPusher.AutoTagger = diskhop.ExifTags
+	}
+
+	dopPusher.ConfirmClean = func(n int) bool {
+		prompt := fmt.Sprintf("Securely delete %d local file(s) now that they have been pushed?", n)
+		if confirmDestructive(flags.yes, prompt) {
+			return true
 		}
 
-		so := dcrypto.NewAEAD(diskhopStore.ivMgr, aesgcm)
+		fmt.Fprintln(os.Stderr, "local files were kept, pass --yes to delete them after pushing")
+
+		return false
+	}
 
+	dopPusher.OnCleanError = func(err error) {
+		log.Printf("warning: files were pushed but some local copies were not deleted: %v", err)
+	}
+
+	if flags.skipExisting {
+		opts = append(opts, store.WithPushSkipExisting())
+	}
+
+	if flags.dedup {
+		opts = append(opts, store.WithPushDedup())
+	}
+
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if so != nil {
 		opts = append(opts, store.WithPushSealOpener(so))
 	}
 
-	if err := dopPusher.Push(cmd.Context(), f, opts...); err != nil {
-		return fmt.Errorf("failed to push: %w", err)
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		opts = append(opts, store.WithPushMetadataSealOpener(mso))
+	}
+
+	if err := diskhop.PushFiles(cmd.Context(), repoConfig(cmd, cfg), dopPusher, opts...); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "pushed batch %s, pull it with --filter \"batch('%s')\"\n", dopPusher.Batch, dopPusher.Batch)
+
+	if dopPusher.Amend != "" {
+		fmt.Fprintf(os.Stderr, "amended commit %s\n", dopPusher.Amend)
 	}
 
 	return nil
 }
 
+// newPushProgressBar returns the progress bar of a push of n files.
+func newPushProgressBar(n int) *progressbar.ProgressBar {
+	return progressbar.NewOptions(n,
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionSetDescription("[cyan][1/1][reset] Pushing data..."),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}))
+}
+
 // newPushCommand creates a new cobra command for the push operation.
 func newPushCommand() *cobra.Command {
 	cmd := &cobra.Command{
@@ -160,8 +240,20 @@ func newPushCommand() *cobra.Command {
 		Long: "upsert the files from the local diskhop directory to remote host",
 	}
 
+	flags := pushFlags{}
+
+	cmd.Flags().BoolVarP(&flags.yes, "yes", "y", false, "delete local files after pushing without asking for confirmation")
+	cmd.Flags().StringVar(&flags.prefix, "prefix", "", "push the files under this subpath of the bucket")
+	cmd.Flags().BoolVar(&flags.skipExisting, "skip-existing", false, "skip files whose name and contents already match the remote")
+	cmd.Flags().BoolVar(&flags.dedup, "dedup", false, "store files whose contents the remote already holds as references to them")
+	cmd.Flags().StringVarP(&flags.message, "message", "m", "", "message recorded with the commits of the push")
+	cmd.Flags().BoolVar(&flags.group, "group", false, "record the push as one commit, reverted as a unit")
+	cmd.Flags().BoolVar(&flags.amend, "amend", false, "fold the push into the last commit instead of recording new ones")
+	cmd.Flags().BoolVar(&flags.exifTags, "exif-tags", false, "tag JPEG images with the camera, date and location in their EXIF data")
+	cmd.Flags().StringVar(&flags.label, "label", "", "label the pushed files as a batch that the batch() filter can match")
+
 	cmd.Run = func(cmd *cobra.Command, args []string) {
-		if err := runPush(cmd, args); err != nil {
+		if err := runPush(cmd, args, flags); err != nil {
 			log.Fatalf("failed to push: %v", err)
 		}
 	}
@@ -0,0 +1,169 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/spf13/cobra"
+)
+
+// newRecipientsCommand creates the command that manages the people that a
+// shared bucket is sealed for.
+func newRecipientsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "List the public keys that the remote files are sealed for",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Run = func(cmd *cobra.Command, _ []string) {
+		if err := runRecipients(cmd, func(paths []string) ([]string, bool) { return paths, false }); err != nil {
+			log.Fatalf("failed to list recipients: %v", err)
+		}
+	}
+
+	long := "%s the recipients of the repository and rewraps the data key of every file, name and metadata of " +
+		"its branches for them, without re-encrypting anything. The data keys stay the same, so a removed " +
+		"recipient who kept those they unwrapped can still open the files sealed with them"
+
+	add := &cobra.Command{
+		Use:   "add PUBLIC_KEY...",
+		Short: "Seal the remote files for the owners of the PEM-encoded public keys too",
+		Long:  fmt.Sprintf(long, "add adds the public keys to"),
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runRecipients(cmd, func(paths []string) ([]string, bool) { return addPatterns(paths, args), true }); err != nil {
+				log.Fatalf("failed to add recipients: %v", err)
+			}
+		},
+	}
+
+	rm := &cobra.Command{
+		Use:   "rm PUBLIC_KEY...",
+		Short: "Stop sealing the remote files for the owners of the public keys",
+		Long:  fmt.Sprintf(long, "rm removes the public keys from"),
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runRecipients(cmd, func(paths []string) ([]string, bool) { return removePatterns(paths, args), true }); err != nil {
+				log.Fatalf("failed to remove recipients: %v", err)
+			}
+		},
+	}
+
+	cmd.AddCommand(add, rm)
+
+	return cmd
+}
+
+// runRecipients applies update to the paths of the public keys of the
+// recipients, rewrapping the branches of the remote for them and recording
+// them if update reports a change, and lists them.
+func runRecipients(cmd *cobra.Command, update func(paths []string) ([]string, bool)) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	updated, changed := update(cfg.Recipients)
+	if changed && !slices.Equal(updated, cfg.Recipients) {
+		if err := rewrapRecipients(cmd, cfg, updated); err != nil {
+			return err
+		}
+
+		if err := runSet(cmd, nil, func(cfg *config) error {
+			cfg.Recipients = updated
+
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range updated {
+		fmt.Println(path)
+	}
+
+	return nil
+}
+
+// rewrapRecipients rewraps every branch of the remote of the repository with
+// the config for the recipients with the public keys at paths.
+func rewrapRecipients(cmd *cobra.Command, cfg config, paths []string) error {
+	switch {
+	case len(cfg.Recipients) == 0:
+		return fmt.Errorf("the repository is sealed with a key rather than for recipients")
+	case len(paths) == 0:
+		return fmt.Errorf("the repository needs at least one recipient")
+	case cfg.MetadataKeyFile != "":
+		return fmt.Errorf("names and metadata sealed with a separate metadata key cannot be rewrapped")
+	}
+
+	rewrapped := cfg
+	rewrapped.Recipients = paths
+
+	// The identity opens what was sealed for the current recipients, and
+	// wraps the data keys for the new ones.
+	so, err := getSealOpener(cmd, rewrapped, nil)
+	if err != nil {
+		return err
+	}
+
+	rw, ok := so.(dcrypto.Rewrapper)
+	if !ok {
+		return fmt.Errorf("the seal opener of the recipients cannot rewrap")
+	}
+
+	branches := slices.Clone(cfg.Branches)
+	if !slices.Contains(branches, cfg.CurrentBranch) {
+		branches = append(branches, cfg.CurrentBranch)
+	}
+
+	for _, branch := range branches {
+		branchCfg := cfg
+		branchCfg.CurrentBranch = branch
+
+		diskhopStore, err := newDiskhopStore(cmd.Context(), branchCfg)
+		if err != nil {
+			return fmt.Errorf("failed to create diskhop store: %w", err)
+		}
+
+		n, err := diskhop.Rewrap(cmd.Context(), *diskhopStore, rw)
+		_ = diskhopStore.Close(cmd.Context())
+
+		if err != nil {
+			return fmt.Errorf("failed to rewrap branch %s: %w", branch, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "rewrapped %d files of branch %s\n", n, branch)
+	}
+
+	return nil
+}
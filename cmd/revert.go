@@ -16,21 +16,34 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"log"
 	"os"
 
+	"github.com/olekukonko/tablewriter"
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
 	"github.com/spf13/cobra"
 )
 
+type revertFlags struct {
+	dryRun bool // List the files that would be deleted without deleting them
+}
+
 func newRevertCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "revert",
-		Short: "Revert to a previous commit",
+		Short: "Revert a push, restoring the files it replaced",
 		Args:  cobra.ExactArgs(1),
 	}
 
+	flags := revertFlags{}
+
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "list the files that would be deleted without deleting them")
+
 	cmd.Run = func(cmd *cobra.Command, args []string) {
-		if err := runRevert(cmd, args); err != nil {
+		if err := runRevert(cmd, args, flags); err != nil {
 			log.Fatalf("failed to revert: %v", err)
 		}
 	}
@@ -38,7 +51,7 @@ func newRevertCommand() *cobra.Command {
 	return cmd
 }
 
-func runRevert(cmd *cobra.Command, args []string) error {
+func runRevert(cmd *cobra.Command, args []string, flags revertFlags) error {
 	curDir, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("failed to get current directory: %w", err)
@@ -61,13 +74,55 @@ func runRevert(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create diskhop store: %w", err)
 	}
 
-	if diskhopStore.reverter == nil {
-		return fmt.Errorf("store does not support revert")
+	if flags.dryRun {
+		return describeRevert(cmd, cfg, diskhopStore, args[0])
+	}
+
+	return diskhop.Revert(cmd.Context(), *diskhopStore, args[0])
+}
+
+// describeRevert writes the files that reverting sha would delete to stdout,
+// with their names if the repository has a key to decrypt them.
+func describeRevert(cmd *cobra.Command, cfg config, diskhopStore *diskhopStore, sha string) error {
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	var opener dcrypto.Opener
+	if so != nil {
+		opener = so
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		opener = mso
 	}
 
-	if err := diskhopStore.reverter.Revert(cmd.Context(), args[0]); err != nil {
-		return fmt.Errorf("failed to revert: %w", err)
+	files, err := diskhop.DescribeRevert(cmd.Context(), *diskhopStore, sha, opener)
+	if err != nil {
+		return err
 	}
 
+	renderRevert(os.Stdout, files)
+
 	return nil
 }
+
+// renderRevert writes the files that a revert would delete to w.
+func renderRevert(w io.Writer, files []store.RevertedFile) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Name", "ID", "Restores Previous"})
+
+	for _, file := range files {
+		table.Append([]string{file.Name, file.ID, yesNo(file.Restores)})
+	}
+
+	table.Render()
+
+	fmt.Fprintf(w, "%d file(s) would be deleted\n", len(files))
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderRevert(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	renderRevert(&buf, []store.RevertedFile{
+		{ID: "6500aa", Name: "/a.jpg"},
+		{ID: "6500bb", Name: "/b.jpg", Restores: true},
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.NotEmpty(t, lines)
+
+	var rows []string
+
+	for _, line := range lines {
+		if strings.Contains(line, ".jpg") {
+			rows = append(rows, strings.Join(strings.Fields(strings.ReplaceAll(line, "|", " ")), " "))
+		}
+	}
+
+	assert.Equal(t, []string{"/a.jpg 6500aa no", "/b.jpg 6500bb yes"}, rows)
+	assert.Equal(t, "2 file(s) would be deleted", lines[len(lines)-1])
+}
@@ -0,0 +1,185 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+type rmFlags struct {
+	olderThan string // Remove the files pushed longer ago than this age
+	dryRun    bool   // List the files that would be deleted without deleting them
+	yes       bool   // Skip the confirmation before deleting the files
+}
+
+func newRmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm",
+		Short: "Delete the files of the current branch pushed longer ago than an age",
+		Args:  cobra.NoArgs,
+	}
+
+	flags := rmFlags{}
+
+	cmd.Flags().StringVar(&flags.olderThan, "older-than", "", `delete the files pushed longer ago than this age, e.g. "90d" or "36h"`)
+	cmd.Flags().BoolVar(&flags.dryRun, "dry-run", false, "list the files that would be deleted without deleting them")
+	cmd.Flags().BoolVarP(&flags.yes, "yes", "y", false, "delete the files without asking for confirmation")
+
+	_ = cmd.MarkFlagRequired("older-than")
+
+	cmd.Run = func(cmd *cobra.Command, _ []string) {
+		if err := runRm(cmd, flags); err != nil {
+			log.Fatalf("failed to remove files: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runRm(cmd *cobra.Command, flags rmFlags) error {
+	age, err := parseAge(flags.olderThan)
+	if err != nil {
+		return err
+	}
+
+	before := time.Now().Add(-age)
+
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if !flags.dryRun {
+		prompt := fmt.Sprintf("Delete every file of branch %q pushed before %s, with its versions? This cannot be undone.",
+			cfg.CurrentBranch, before.Format(time.DateTime))
+		if !confirmDestructive(flags.yes, prompt) {
+			fmt.Fprintln(os.Stderr, "no files were removed, pass --yes to remove them")
+
+			return nil
+		}
+	}
+
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	if flags.dryRun {
+		return describeRm(cmd, cfg, diskhopStore, before)
+	}
+
+	n, err := diskhop.RemoveOlderThan(cmd.Context(), *diskhopStore, before)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "removed %d file(s)\n", n)
+
+	return nil
+}
+
+// describeRm writes the files pushed before the time to stdout, with their
+// names if the repository has a key to decrypt them.
+func describeRm(cmd *cobra.Command, cfg config, diskhopStore *diskhopStore, before time.Time) error {
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	var opener dcrypto.Opener
+	if so != nil {
+		opener = so
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		opener = mso
+	}
+
+	files, err := diskhop.DescribeRemoveOlderThan(cmd.Context(), *diskhopStore, before, opener)
+	if err != nil {
+		return err
+	}
+
+	renderRm(os.Stdout, files)
+
+	return nil
+}
+
+// renderRm writes the files that a removal would delete to w.
+func renderRm(w io.Writer, files []store.RemovedFile) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Name", "ID", "Pushed"})
+
+	for _, file := range files {
+		table.Append([]string{file.Name, file.ID, file.UploadDate.Local().Format(time.DateTime)})
+	}
+
+	table.Render()
+
+	fmt.Fprintf(w, "%d file(s) would be deleted\n", len(files))
+}
+
+// parseAge parses a positive age, either a number of days such as "90d" or a
+// duration such as "36h".
+func parseAge(s string) (time.Duration, error) {
+	var age time.Duration
+
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid age %q: %w", s, err)
+		}
+
+		age = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if age, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("invalid age %q: %w", s, err)
+		}
+	}
+
+	if age <= 0 {
+		return 0, fmt.Errorf("invalid age %q, must be positive", s)
+	}
+
+	return age, nil
+}
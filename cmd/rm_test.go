@@ -0,0 +1,48 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		age  string
+		want time.Duration
+	}{
+		{age: "90d", want: 90 * 24 * time.Hour},
+		{age: "1d", want: 24 * time.Hour},
+		{age: "36h", want: 36 * time.Hour},
+		{age: "1h30m", want: 90 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got, err := parseAge(tt.age)
+		require.NoError(t, err, tt.age)
+		assert.Equal(t, tt.want, got, tt.age)
+	}
+
+	for _, age := range []string{"", "d", "ninety", "-5d", "0d", "0s", "3x"} {
+		_, err := parseAge(age)
+		assert.Error(t, err, age)
+	}
+}
@@ -32,6 +32,7 @@ func newSetCommand() *cobra.Command {
 
 	cmd.AddCommand(newSetKeyFileCommand())
 	cmd.AddCommand(newSetConnStringCommand())
+	cmd.AddCommand(newSetCipherCommand())
 
 	return cmd
 }
@@ -48,7 +49,7 @@ func runSet(_ *cobra.Command, _ []string, set func(*config) error) error {
 	}
 	// Load the configuration
 
-	cfg, err := loadConfig()
+	cfg, err := loadLocalConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load configuration: %w", err)
 	}
@@ -0,0 +1,61 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/spf13/cobra"
+)
+
+// newSetCipherCommand creates a new cobra command for setting the encryption
+// algorithm and, optionally, its nonce size.
+func newSetCipherCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cipher <name> [nonce-size]",
+		Short: "Set the encryption algorithm used for CSE",
+		Args:  cobra.RangeArgs(1, 2),
+	}
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runSet(cmd, args, func(cfg *config) error {
+			nonceSize := 0
+			if len(args) == 2 {
+				var err error
+
+				nonceSize, err = strconv.Atoi(args[1])
+				if err != nil {
+					return fmt.Errorf("invalid nonce size: %w", err)
+				}
+			}
+
+			if err := diskhop.ValidateCipher(args[0], nonceSize); err != nil {
+				return err
+			}
+
+			cfg.Cipher = args[0]
+			cfg.NonceSize = nonceSize
+
+			return nil
+		}); err != nil {
+			log.Fatalf("failed to set cipher: %v", err)
+		}
+	}
+
+	return cmd
+}
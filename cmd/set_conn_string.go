@@ -15,11 +15,18 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"time"
 
+	"github.com/prestonvasquez/diskhop"
 	"github.com/spf13/cobra"
 )
 
+// verifyTimeout bounds the ping made by conn-string --verify.
+const verifyTimeout = 10 * time.Second
+
 // newSetConnStringCommand creates a new cobra command for setting the
 // connection string.
 func newSetConnStringCommand() *cobra.Command {
@@ -29,11 +36,13 @@ func newSetConnStringCommand() *cobra.Command {
 		Args:  cobra.ExactArgs(1), // Ensures exactly one argument is provided
 	}
 
+	var verify bool
+
+	cmd.Flags().BoolVar(&verify, "verify", false, "check that the remote host responds before saving")
+
 	cmd.Run = func(cmd *cobra.Command, args []string) {
 		if err := runSet(cmd, args, func(cfg *config) error {
-			cfg.ConnString = args[0]
-
-			return nil
+			return setConnString(cmd.Context(), cfg, args[0], verify)
 		}); err != nil {
 			log.Fatalf("failed to set connection string: %v", err)
 		}
@@ -41,3 +50,30 @@ func newSetConnStringCommand() *cobra.Command {
 
 	return cmd
 }
+
+// setConnString validates connString, and if verify is true pings the store,
+// before setting it in cfg. Environment variable references are expanded for
+// the checks, but kept in the config.
+func setConnString(ctx context.Context, cfg *config, connString string, verify bool) error {
+	expanded, err := diskhop.ExpandEnv(connString, cfg.StrictEnv)
+	if err != nil {
+		return fmt.Errorf("failed to expand connection string: %w", err)
+	}
+
+	if err := diskhop.ValidateConnString(expanded); err != nil {
+		return err
+	}
+
+	if verify {
+		ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+		defer cancel()
+
+		if err := pingStore(ctx, expanded); err != nil {
+			return err
+		}
+	}
+
+	cfg.ConnString = connString
+
+	return nil
+}
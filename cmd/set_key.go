@@ -0,0 +1,97 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/spf13/cobra"
+)
+
+// defaultKeychainService is the keychain service that set-key stores the key
+// under if none is given.
+const defaultKeychainService = "diskhop"
+
+// newSetKeyCommand creates a new cobra command for moving the key of the
+// repository into the OS keychain.
+func newSetKeyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "set-key [service]",
+		Short: "Store the key in the OS keychain and use it from there",
+		Long: "store the key in the OS keychain under the service, \"diskhop\" by default, " +
+			"and set keyFile to keychain:<service>",
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	var from string
+
+	cmd.Flags().StringVar(&from, "from", "", "path to the key to store, the configured key file by default")
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		service := defaultKeychainService
+		if len(args) > 0 {
+			service = args[0]
+		}
+
+		// The key file may be set in the global config rather than the
+		// repository's, so it is read from the merged config.
+		if from == "" {
+			cfg, err := loadConfig()
+			if err != nil {
+				log.Fatalf("failed to load config: %v", err)
+			}
+
+			from = cfg.KeyFile
+		}
+
+		if err := runSet(cmd, args, func(cfg *config) error {
+			return setKey(cmd.Context(), cfg, from, service)
+		}); err != nil {
+			log.Fatalf("failed to set key: %v", err)
+		}
+
+		fmt.Printf("stored key in keychain as %q, securely delete the key file once it is backed up\n", service)
+	}
+
+	return cmd
+}
+
+// setKey stores the key in the file at from in the keychain under the service
+// and points cfg at it.
+func setKey(ctx context.Context, cfg *config, from, service string) error {
+	source, ok := diskhop.ParseKeySource(from).(diskhop.FileKeySource)
+	if !ok {
+		return fmt.Errorf("no key file to store, pass --from")
+	}
+
+	key, err := source.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer dcrypto.Zero(key)
+
+	if err := diskhop.KeychainKeySource(service).StoreKey(key); err != nil {
+		return fmt.Errorf("failed to store key: %w", err)
+	}
+
+	cfg.KeyFile = diskhop.KeychainKeyScheme + service
+
+	return nil
+}
@@ -18,46 +18,43 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/prestonvasquez/diskhop/exp/dcrypto"
-	"github.com/prestonvasquez/diskhop/store"
+	"github.com/prestonvasquez/diskhop"
 	"github.com/prestonvasquez/diskhop/store/mongodop"
 )
 
-type diskhopStore struct {
-	pusher   store.Pusher
-	puller   store.Puller
-	reverter store.Reverter
-	ivMgr    dcrypto.IVManagerGetter
-}
+// diskhopStore is the set of remote capabilities used by the commands.
+type diskhopStore = diskhop.Store
 
 func newDiskhopStore(ctx context.Context, cfg config) (*diskhopStore, error) {
-	switch getStoreType(cfg) {
-	case storeTypeMongo:
-		return newMongoStore(ctx, cfg)
-	default:
-		return nil, fmt.Errorf("unknown store type")
-	}
+	return openStore(ctx, cfg, diskhop.OpenStore)
 }
 
-func newMongoStore(ctx context.Context, cfg config) (*diskhopStore, error) {
-	db := cfg.DB
-	if db == "" {
-		db = mongodop.DefaultDBName
-	}
+// newDiskhopReadStore is like newDiskhopStore, but applies the configured read
+// preference. Reads may be served by secondaries and be slightly stale, so it
+// must only be used by commands that do not push.
+func newDiskhopReadStore(ctx context.Context, cfg config) (*diskhopStore, error) {
+	return openStore(ctx, cfg, diskhop.OpenReadStore)
+}
 
-	mdb, err := mongodop.Connect(ctx, cfg.ConnString, db, cfg.CurrentBranch)
+// openStore opens the store of the repository with open, suggesting how to
+// resolve a failure.
+func openStore(ctx context.Context, cfg config, open func(context.Context, diskhop.Config) (*diskhop.Store, error)) (*diskhopStore, error) {
+	s, err := open(ctx, diskhop.Config(cfg))
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to store: %w", err)
+		return nil, fmt.Errorf("%w%s", err, storeErrorHint(err))
 	}
 
-	diskhopStore := &diskhopStore{
-		pusher:   mdb,
-		reverter: mdb,
-		puller:   mdb,
-		ivMgr:    mdb,
+	return s, nil
+}
+
+// pingStore checks that the store at connString responds, suggesting how to
+// resolve a failure.
+func pingStore(ctx context.Context, connString string) error {
+	if err := diskhop.PingStore(ctx, connString); err != nil {
+		return fmt.Errorf("%w%s", err, storeErrorHint(err))
 	}
 
-	return diskhopStore, nil
+	return nil
 }
 
 func newDiskhopStoreUpstream(ctx context.Context, upstreamName string, cfg config) (*diskhopStore, error) {
@@ -65,7 +62,7 @@ func newDiskhopStoreUpstream(ctx context.Context, upstreamName string, cfg confi
 	case storeTypeMongo:
 		return newMongoStoreUpstream(ctx, upstreamName, cfg)
 	default:
-		return nil, fmt.Errorf("unknown store type")
+		return nil, fmt.Errorf("unknown store type for %s", diskhop.RedactConnString(cfg.ConnString))
 	}
 }
 
@@ -80,19 +77,26 @@ func newMongoStoreUpstream(ctx context.Context, upstreamName string, cfg config)
 		db = mongodop.DefaultDBName
 	}
 
-	mdb, err := mongodop.ConnectMigrator(ctx, cfg.ConnString, db, cfg.CurrentBranch, up)
+	connectOpts, err := mongodop.ConfigConnectOptions(diskhop.Config(cfg), false)
+	if err != nil {
+		return nil, err
+	}
+
+	mdb, err := mongodop.ConnectMigrator(ctx, cfg.ConnString, db, cfg.CurrentBranch, up, connectOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to store: %w", err)
+		return nil, fmt.Errorf("failed to connect to store at %s: %w%s",
+			diskhop.RedactConnString(cfg.ConnString), diskhop.RedactError(err, cfg.ConnString), storeErrorHint(err))
 	}
 
-	mdbc, err := mongodop.Connect(ctx, cfg.ConnString, db, cfg.CurrentBranch)
+	mdbc, err := mongodop.Connect(ctx, cfg.ConnString, db, cfg.CurrentBranch, connectOpts...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to store: %w", err)
+		return nil, fmt.Errorf("failed to connect to store at %s: %w%s",
+			diskhop.RedactConnString(cfg.ConnString), diskhop.RedactError(err, cfg.ConnString), storeErrorHint(err))
 	}
 
 	diskhopStore := &diskhopStore{
-		pusher: mdb,
-		ivMgr:  mdbc,
+		Pusher: mdb,
+		IVMgr:  mdbc,
 	}
 
 	return diskhopStore, nil
@@ -0,0 +1,177 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/spf13/cobra"
+)
+
+// strictTagsFlag is the name of the global flag that makes tag failures fatal.
+const strictTagsFlag = "strict-tags"
+
+// strictTags reports whether a failure to read or set file tags should abort
+// the command. The global --strict-tags flag takes precedence over the
+// configuration file.
+func strictTags(cmd *cobra.Command, cfg config) bool {
+	strict := cfg.StrictTags
+
+	if flag := cmd.Flags().Lookup(strictTagsFlag); flag != nil && flag.Changed {
+		strict, _ = cmd.Flags().GetBool(strictTagsFlag)
+	}
+
+	return strict
+}
+
+// warnTagError reports a tag failure that does not abort the command.
+func warnTagError(name string, err error) {
+	log.Printf("warning: continuing without tags for %s: %v", name, err)
+}
+
+type tagsFlags struct {
+	filter string // Only count the tags of the files matching the filter
+	json   bool   // Render the tags as JSON
+}
+
+// newTagsCommand creates a new cobra command for the tags subcommand to list
+// the tags of the files on the remote host.
+func newTagsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags",
+		Short: "List the tags of the files on the remote host with the number of files carrying each",
+		Args:  cobra.NoArgs,
+	}
+
+	flags := tagsFlags{}
+
+	cmd.PersistentFlags().StringVarP(&flags.filter, "filter", "f", "", "only count the tags of the files matching the expression")
+	cmd.PersistentFlags().BoolVar(&flags.json, "json", false, "render the tags as JSON")
+
+	cmd.Run = func(cmd *cobra.Command, _ []string) {
+		if err := runTags(cmd, flags, ""); err != nil {
+			log.Fatalf("failed to list tags: %v", err)
+		}
+	}
+
+	search := &cobra.Command{
+		Use:   "search <substr>",
+		Short: "List the tags that contain a substring, ignoring case",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	search.Run = func(cmd *cobra.Command, args []string) {
+		if err := runTags(cmd, flags, args[0]); err != nil {
+			log.Fatalf("failed to search tags: %v", err)
+		}
+	}
+
+	cmd.AddCommand(search)
+
+	return cmd
+}
+
+// runTags lists the tags of the remote files, keeping those that contain
+// substr unless it is empty.
+func runTags(cmd *cobra.Command, flags tagsFlags, substr string) error {
+	if err := diskhop.ValidateFilter(flags.filter); err != nil {
+		return err
+	}
+
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	diskhopStore, err := newDiskhopReadStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	pullOpts := []store.PullOption{store.WithPullFilter(flags.filter)}
+
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if so != nil {
+		pullOpts = append(pullOpts, store.WithPullSealOpener(so))
+	}
+
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		pullOpts = append(pullOpts, store.WithPullMetadataSealOpener(mso))
+	}
+
+	tags, err := diskhop.ListTags(cmd.Context(), diskhopStore.Puller, pullOpts...)
+	if err != nil {
+		return err
+	}
+
+	if substr != "" {
+		tags = diskhop.SearchTags(tags, substr)
+	}
+
+	return renderTags(os.Stdout, tags, flags.json)
+}
+
+// renderTags writes the tags with their file counts to w, as a table or, if
+// asJSON is true, a JSON array.
+func renderTags(w io.Writer, tags []diskhop.TagCount, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(tags); err != nil {
+			return fmt.Errorf("failed to encode tags: %w", err)
+		}
+
+		return nil
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Tag", "Files"})
+
+	for _, tag := range tags {
+		table.Append([]string{tag.Tag, strconv.Itoa(tag.Files)})
+	}
+
+	table.Render()
+
+	return nil
+}
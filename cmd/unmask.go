@@ -0,0 +1,91 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/spf13/cobra"
+)
+
+func newUnmaskCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unmask",
+		Short: "Restore the real names of files pulled with --mask",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runUnmask(cmd, args); err != nil {
+			log.Fatalf("failed to unmask: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runUnmask(cmd *cobra.Command, _ []string) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	// Read the .diskhop file.
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
+	}
+
+	if cfg.KeyFile == "" && len(cfg.Recipients) == 0 {
+		return fmt.Errorf("unmask requires a key file")
+	}
+
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	so, err := getSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	// The masks are sealed with the metadata key if there is one.
+	mso, err := getMetadataSealOpener(cmd, cfg, diskhopStore.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	if mso != nil {
+		so = mso
+	}
+
+	n, err := diskhop.Unmask(cmd.Context(), curDir, so)
+	fmt.Printf("unmasked %d files\n", n)
+
+	return err
+}
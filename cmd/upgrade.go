@@ -0,0 +1,109 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/spf13/cobra"
+)
+
+func newUpgradeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Migrate the remote bucket to the newest format version",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.Run = func(cmd *cobra.Command, args []string) {
+		if err := runUpgrade(cmd, args); err != nil {
+			log.Fatalf("failed to upgrade: %v", err)
+		}
+	}
+
+	return cmd
+}
+
+func runUpgrade(cmd *cobra.Command, _ []string) error {
+	curDir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	// Do nothing if we are not in a diskhop repository.
+	if !isDiskhopRepository(curDir) {
+		return errNotDiskhop
+	}
+
+	// Read the .diskhop file.
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := diskhop.ValidateCipher(cfg.Cipher, cfg.NonceSize); err != nil {
+		return fmt.Errorf("invalid cipher configuration: %w", err)
+	}
+
+	// Upgrade re-encrypts the names and metadata with the data key.
+	if cfg.MetadataKeyFile != "" {
+		return fmt.Errorf("upgrade does not support a separate metadata key")
+	}
+
+	if len(cfg.Recipients) > 0 {
+		return fmt.Errorf("upgrade does not support recipients")
+	}
+
+	// Upgrading reads every file, so the key is required.
+	key, err := getAESKey(cmd, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to get AES key from config: %w", err)
+	}
+
+	if key == nil {
+		return fmt.Errorf("upgrade requires a key file")
+	}
+
+	defer dcrypto.Zero(key)
+
+	diskhopStore, err := newDiskhopStore(cmd.Context(), cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create diskhop store: %w", err)
+	}
+
+	so, err := diskhop.NewSealOpener(diskhopStore.IVMgr, key, cfg.Cipher, cfg.NonceSize)
+	if err != nil {
+		return fmt.Errorf("failed to create seal opener: %w", err)
+	}
+
+	from, to, err := diskhop.Upgrade(cmd.Context(), *diskhopStore, so)
+	if err != nil {
+		return err
+	}
+
+	if from == to {
+		fmt.Printf("bucket is already at format version %d\n", to)
+
+		return nil
+	}
+
+	fmt.Printf("upgraded bucket from format version %d to %d\n", from, to)
+
+	return nil
+}
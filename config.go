@@ -18,17 +18,69 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
 
 // Config represents the configuration for the diskhop application.
 type Config struct {
-	ConnString    string   `yaml:"connString"`              // Remote host
-	KeyFile       string   `yaml:"keyFile,omitempty"`       // Path to private key
-	Branches      []string `yaml:"branches,omitempty"`      // Branches to sync
-	CurrentBranch string   `yaml:"currentBranch,omitempty"` // Current branch
-	DB            string   `yaml:"db,omitempty"`            // Database
+	ConnString     string   `yaml:"connString"`               // Remote host
+	KeyFile        string   `yaml:"keyFile,omitempty"`        // Path to private key, or a reference such as env:<name>
+	Branches       []string `yaml:"branches,omitempty"`       // Branches to sync
+	CurrentBranch  string   `yaml:"currentBranch,omitempty"`  // Current branch
+	DB             string   `yaml:"db,omitempty"`             // Database
+	Concurrency    int      `yaml:"concurrency,omitempty"`    // Max concurrent streams
+	Cipher         string   `yaml:"cipher,omitempty"`         // Encryption algorithm
+	NonceSize      int      `yaml:"nonceSize,omitempty"`      // Nonce size in bytes
+	StrictTags     bool     `yaml:"strictTags,omitempty"`     // Fail when tags cannot be read or set
+	StrictEnv      bool     `yaml:"strictEnv,omitempty"`      // Fail on unset variables in expanded values
+	WriteConcern   string   `yaml:"writeConcern,omitempty"`   // "majority" or a number of nodes
+	ReadPreference string   `yaml:"readPreference,omitempty"` // Read preference mode for pulls
+	TempDir        string   `yaml:"tempDir,omitempty"`        // Spill streamed uploads here so they can resume
+	Versioning     bool     `yaml:"versioning,omitempty"`     // Keep the versions replaced by pushes for reverts
+	KeepVersions   int      `yaml:"keepVersions,omitempty"`   // Replaced versions kept per file with versioning, 0 for any
+	VersionMaxAge  string   `yaml:"versionMaxAge,omitempty"`  // Prune versions replaced longer ago, e.g. "720h"
+	NameEncoding   string   `yaml:"nameEncoding,omitempty"`   // "objectid" or "ciphertext" for new buckets
+
+	// Finder color of each tag set on pull, e.g. important: red
+	TagColors map[string]string `yaml:"tagColors,omitempty"`
+
+	// Path to a separate key for names and metadata, which keyFile encrypts
+	// too if it is unset
+	MetadataKeyFile string `yaml:"metadataKeyFile,omitempty"`
+
+	// Use key files that other users can access, with a warning, rather
+	// than refusing them
+	InsecureKeyFile bool `yaml:"insecureKeyFile,omitempty"`
+
+	// Paths to the RSA public keys of the people that a shared bucket is
+	// sealed for, in place of keyFile
+	Recipients []string `yaml:"recipients,omitempty"`
+
+	// Private key that opens what is sealed for the recipients, a path or a
+	// reference such as keychain:<service>
+	IdentityFile string `yaml:"identityFile,omitempty"`
+
+	// Keep the tags of the files that a pull cleans, and merge them into
+	// those of the files pulled again: "remote-wins", "local-wins" or
+	// "union"
+	TagMerge string `yaml:"tagMerge,omitempty"`
+
+	// Split the name collection of the database into this many shards, so
+	// that pushes and pulls by name load only the names they need
+	NameShards int `yaml:"nameShards,omitempty"`
+
+	// Cache the sealed names of the remote in a SQLite database in the
+	// repository, so they are not downloaded on every connection
+	NameCache bool `yaml:"nameCache,omitempty"`
+
+	// Retention policy that prune enforces along with keepVersions and
+	// versionMaxAge: delete the files pushed longer ago than an age, e.g.
+	// "90d", and the oldest files beyond a stored size, e.g. "500GB"
+	RetainMaxAge  string `yaml:"retainMaxAge,omitempty"`
+	RetainMaxSize string `yaml:"retainMaxSize,omitempty"`
 
 	// Metadata
 	CurDir string `yaml:"-"`
@@ -66,5 +118,62 @@ func LoadConfig(path string) (Config, error) {
 		return Config{}, fmt.Errorf("failed to unmarshal config file: %w", err)
 	}
 
+	if cfg.ConnString, err = ExpandEnv(cfg.ConnString, cfg.StrictEnv); err != nil {
+		return Config{}, fmt.Errorf("failed to expand connString: %w", err)
+	}
+
+	if cfg.KeyFile, err = ExpandEnv(cfg.KeyFile, cfg.StrictEnv); err != nil {
+		return Config{}, fmt.Errorf("failed to expand keyFile: %w", err)
+	}
+
+	if cfg.TempDir, err = ExpandEnv(cfg.TempDir, cfg.StrictEnv); err != nil {
+		return Config{}, fmt.Errorf("failed to expand tempDir: %w", err)
+	}
+
 	return cfg, nil
 }
+
+// envReference matches a ${VAR} reference to an environment variable.
+var envReference = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// ExpandEnv replaces ${VAR} references in s with the values of the
+// corresponding environment variables, so that secrets such as credentials in
+// the connection string can be kept out of the config file. Any other "$" is
+// kept as it is, so that values such as passwords may contain one. Unset
+// variables expand to the empty string, unless strict is true, in which case
+// an error naming them is returned.
+func ExpandEnv(s string, strict bool) (string, error) {
+	var unset []string
+
+	expanded := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			unset = append(unset, name)
+		}
+
+		return value
+	})
+
+	if strict && len(unset) > 0 {
+		return "", fmt.Errorf("unset environment variables: %s", strings.Join(unset, ", "))
+	}
+
+	return expanded, nil
+}
+
+// TempDir returns the directory in which large intermediate files should be
+// created: dir if it is set, and os.TempDir otherwise. The directory is
+// created if it does not exist.
+func TempDir(dir string) (string, error) {
+	if dir == "" {
+		return os.TempDir(), nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	return dir, nil
+}
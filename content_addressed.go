@@ -0,0 +1,124 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// ManifestName is the file, at the root of a content-addressed pull, that
+// maps the hash of each pulled file to its name and tags, one JSON object per
+// line.
+const ManifestName = "manifest.jsonl"
+
+// ManifestEntry is a line of the manifest of a content-addressed pull.
+type ManifestEntry struct {
+	SHA256 string   `json:"sha256"`         // Hex-encoded hash, which names the file
+	Name   string   `json:"name"`           // Name of the file on the remote host
+	Tags   []string `json:"tags,omitempty"` // Tags of the file
+	Size   int64    `json:"size"`           // Size of the file
+}
+
+// ContentPath returns the path of the file with the hex-encoded hash in a
+// content-addressed layout under dir, sharded by the first two bytes of the
+// hash.
+func ContentPath(dir, sum string) string {
+	return filepath.Join(dir, sum[:2], sum[2:4], sum)
+}
+
+// writeContentAddressed writes the contents of the document under dir, named
+// by their SHA-256, and records them in the manifest. Contents that are
+// already held are not written again, so files with the same contents share
+// one copy.
+func (fp *FilePuller) writeContentAddressed(dir string, doc *store.Document) (int64, error) {
+	tmp, err := os.CreateTemp(dir, ".pull-*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	h := sha256.New()
+
+	n, err := writeDocument(tmp, doc, fp.streams().Hash(h))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if want := doc.Metadata.SHA256; want != "" && want != sum {
+		return 0, fmt.Errorf("hash mismatch for %s: expected %s, got %s", realName(doc), want, sum)
+	}
+
+	path := ContentPath(dir, sum)
+
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return 0, fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		if err := os.Rename(tmp.Name(), path); err != nil {
+			return 0, fmt.Errorf("failed to move file: %w", err)
+		}
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	entry := ManifestEntry{
+		SHA256: sum,
+		Name:   realName(doc),
+		Tags:   doc.Metadata.Tags,
+		Size:   n,
+	}
+
+	if err := appendManifest(dir, entry); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// appendManifest adds the entry to the manifest under dir.
+func appendManifest(dir string, entry ManifestEntry) error {
+	f, err := os.OpenFile(filepath.Join(dir, ManifestName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open manifest: %w", err)
+	}
+
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close manifest: %w", err)
+	}
+
+	return nil
+}
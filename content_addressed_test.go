@@ -0,0 +1,88 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteContentAddressed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	sum := sha256.Sum256([]byte("data"))
+	hash := hex.EncodeToString(sum[:])
+
+	fp := NewFilePuller(nil)
+
+	docs := []*store.Document{
+		{Filename: "a.jpg", Data: []byte("data"), Metadata: store.Metadata{Tags: []string{"x"}}},
+		{Filename: "b.jpg", Data: []byte("data"), Metadata: store.Metadata{SHA256: hash}},
+	}
+
+	for _, doc := range docs {
+		n, err := fp.writeContentAddressed(dir, doc)
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(4), n)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, hash[:2], hash[2:4], hash))
+	require.NoError(t, err)
+
+	assert.Equal(t, "data", string(data))
+
+	f, err := os.Open(filepath.Join(dir, ManifestName))
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	var entries []ManifestEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry ManifestEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+
+		entries = append(entries, entry)
+	}
+
+	assert.Equal(t, []ManifestEntry{
+		{SHA256: hash, Name: "a.jpg", Tags: []string{"x"}, Size: 4},
+		{SHA256: hash, Name: "b.jpg", Size: 4},
+	}, entries)
+
+	t.Run("rejects contents that do not match the hash", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := fp.writeContentAddressed(t.TempDir(), &store.Document{
+			Filename: "c.jpg",
+			Data:     []byte("other"),
+			Metadata: store.Metadata{SHA256: hash},
+		})
+		assert.ErrorContains(t, err, "hash mismatch")
+	})
+}
@@ -0,0 +1,148 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// Copy downloads the remote file with the name to dest, like scp, and tags it
+// with its remote tags. If dest is a directory, or ends in a separator, the
+// file is written into it under its base name, transformed by
+// NameTransformer. It returns the path written.
+//
+// Unlike Pull, Copy leaves the repository untouched: it neither cleans nor
+// records what was pulled, and runs no PostPull hook. The file is written to
+// a hidden temporary file beside dest that replaces it once complete, so that
+// an interrupted copy never leaves a truncated file at dest.
+func (fp *FilePuller) Copy(ctx context.Context, name, dest string, opts ...store.PullOption) (string, error) {
+	path, err := copyPath(name, dest, fp.NameTransformer)
+	if err != nil {
+		return "", err
+	}
+
+	buf := store.NewDocumentBuffer()
+	defer buf.Close()
+
+	opts = append(opts, store.WithPullNames(name), store.WithPullSingle())
+	if _, err := fp.p.Pull(ctx, buf, opts...); err != nil {
+		return "", fmt.Errorf("failed to pull: %w", err)
+	}
+
+	// The pull sends to the buffer until io.EOF, so it is read that far
+	// before it is closed, as Pull does.
+	doc, err := buf.Next()
+	if !errors.Is(err, io.EOF) {
+		defer drainDocuments(&buf)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", name, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*"+partialExt)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// The temporary file holds plaintext, so a copy that fails deletes it
+	// securely. Once moved into place, it no longer exists.
+	defer func() { _ = secureDeleteWithRetry(tmp.Name()) }()
+
+	h := sha256.New()
+
+	_, err = writeDocument(tmp, doc, fp.streams().Hash(h))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if want, got := doc.Metadata.SHA256, hex.EncodeToString(h.Sum(nil)); want != "" && want != got {
+		return "", fmt.Errorf("hash mismatch for %s: expected %s, got %s", name, want, got)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	if len(doc.Metadata.Tags) == 0 {
+		return path, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer file.Close()
+
+	if err := fp.tagPolicy().handle(path, setTagsOrSidecar(file, fp.TagColors, doc.Metadata.Tags...)); err != nil {
+		return "", fmt.Errorf("failed to set tags: %w", err)
+	}
+
+	return path, nil
+}
+
+// drainDocuments reads the buffer until the pull filling it sends io.EOF,
+// discarding the documents and errors before it.
+func drainDocuments(buf *store.DocumentBuffer) {
+	for {
+		if _, err := buf.Next(); errors.Is(err, io.EOF) {
+			return
+		}
+	}
+}
+
+// copyPath returns the path that a copy of the remote file with the name to
+// dest writes.
+func copyPath(name, dest string, transform func(string) string) (string, error) {
+	if dest == "" {
+		return "", fmt.Errorf("destination must not be empty")
+	}
+
+	info, err := os.Stat(dest)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to stat destination: %w", err)
+	}
+
+	isDir := err == nil && info.IsDir()
+	if !isDir && !strings.HasSuffix(dest, string(filepath.Separator)) && !strings.HasSuffix(dest, "/") {
+		return dest, nil
+	}
+
+	base := filepath.Base(filepath.FromSlash(name))
+	if base == "." || base == string(filepath.Separator) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	if !isDir {
+		return "", fmt.Errorf("destination directory %s does not exist", dest)
+	}
+
+	return filepath.Join(dest, transformName(base, transform)), nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namedPuller serves the documents it holds to named pulls.
+type namedPuller struct {
+	docs map[string]store.Document
+}
+
+func (p *namedPuller) Pull(_ context.Context, buf store.DocumentBuffer, opts ...store.PullOption) (*store.PullDescription, error) {
+	var pullOpts store.PullOptions
+	for _, opt := range opts {
+		opt(&pullOpts)
+	}
+
+	doc, ok := p.docs[pullOpts.Names[0]]
+	if !ok {
+		return nil, store.ErrFileNotFound
+	}
+
+	go func() {
+		buf.Send(&doc, nil)
+		buf.Send(nil, io.EOF)
+	}()
+
+	return &store.PullDescription{Count: 1}, nil
+}
+
+func TestFilePullerCopy(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte("data"))
+
+	puller := &namedPuller{docs: map[string]store.Document{
+		"photos/cat.jpg": {
+			Filename: "photos/cat.jpg",
+			Data:     []byte("data"),
+			Metadata: store.Metadata{Tags: []string{"pets"}, SHA256: hex.EncodeToString(sum[:])},
+		},
+		"corrupt.jpg": {
+			Filename: "corrupt.jpg",
+			Data:     []byte("atad"),
+			Metadata: store.Metadata{SHA256: hex.EncodeToString(sum[:])},
+		},
+	}}
+
+	newPuller := func() *FilePuller {
+		fp := NewFilePuller(puller)
+		fp.OnTagError = func(string, error) {}
+
+		return fp
+	}
+
+	t.Run("to a file", func(t *testing.T) {
+		t.Parallel()
+
+		dest := filepath.Join(t.TempDir(), "kitten.jpg")
+
+		path, err := newPuller().Copy(context.Background(), "photos/cat.jpg", dest)
+		require.NoError(t, err)
+
+		assert.Equal(t, dest, path)
+
+		got, err := os.ReadFile(dest)
+		require.NoError(t, err)
+
+		assert.Equal(t, "data", string(got))
+
+		file, err := os.Open(dest)
+		require.NoError(t, err)
+
+		defer file.Close()
+
+		tags, err := getTagsOrSidecar(file)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"pets"}, tags)
+	})
+
+	t.Run("into a directory", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		path, err := newPuller().Copy(context.Background(), "photos/cat.jpg", dir)
+		require.NoError(t, err)
+
+		assert.Equal(t, filepath.Join(dir, "cat.jpg"), path)
+		assert.FileExists(t, path)
+	})
+
+	t.Run("into a missing directory", func(t *testing.T) {
+		t.Parallel()
+
+		dest := filepath.Join(t.TempDir(), "missing") + string(filepath.Separator)
+
+		_, err := newPuller().Copy(context.Background(), "photos/cat.jpg", dest)
+		assert.ErrorContains(t, err, "does not exist")
+	})
+
+	t.Run("hash mismatch leaves nothing", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		_, err := newPuller().Copy(context.Background(), "corrupt.jpg", filepath.Join(dir, "corrupt.jpg"))
+		assert.ErrorContains(t, err, "hash mismatch")
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+
+		assert.Empty(t, entries)
+	})
+}
+
+// emptyPuller sends no document to a pull, like a pull whose only file is
+// discarded.
+type emptyPuller struct{}
+
+func (emptyPuller) Pull(_ context.Context, buf store.DocumentBuffer, _ ...store.PullOption) (*store.PullDescription, error) {
+	go buf.Send(nil, io.EOF)
+
+	return &store.PullDescription{}, nil
+}
+
+func TestFilePullerCopyNothingSent(t *testing.T) {
+	t.Parallel()
+
+	fp := NewFilePuller(emptyPuller{})
+
+	_, err := fp.Copy(context.Background(), "cat.jpg", filepath.Join(t.TempDir(), "cat.jpg"))
+	assert.ErrorIs(t, err, io.EOF)
+}
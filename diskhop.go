@@ -17,10 +17,16 @@ package diskhop
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/prestonvasquez/diskhop/internal/osutil"
 	"github.com/prestonvasquez/diskhop/store"
 )
 
@@ -32,8 +38,24 @@ func commit(ctx context.Context, commiter store.Commiter, msg string, fileID str
 	sha := store.NewSHA(msg)
 
 	commiter.AddCommit(ctx, &store.Commit{
-		SHA:    sha,
-		FileID: fileID,
+		SHA:     sha,
+		FileID:  fileID,
+		Message: msg,
+		Time:    time.Now().UTC(),
+	})
+}
+
+// commitGroup records the files written by a push as one commit.
+func commitGroup(ctx context.Context, commiter store.Commiter, msg string, fileIDs []string) {
+	if commiter == nil || len(fileIDs) == 0 {
+		return
+	}
+
+	commiter.AddCommit(ctx, &store.Commit{
+		SHA:     store.NewSHA(msg),
+		FileIDs: fileIDs,
+		Message: msg,
+		Time:    time.Now().UTC(),
 	})
 }
 
@@ -91,18 +113,98 @@ func secureDelete(filename string) error {
 	return nil
 }
 
+// cleanAttempts is the number of times a file is securely deleted before the
+// failure is reported.
+const cleanAttempts = 3
+
+// cleanRetryDelay is the delay before the first retry, doubled on each
+// subsequent attempt.
+const cleanRetryDelay = 100 * time.Millisecond
+
+// isCleanable reports whether the entity is removed by a clean. Hidden files,
+// such as the .diskhop configuration, and directories are left in place,
+// except for the partial files of interrupted pulls, which hold plaintext.
+func isCleanable(entry os.FileInfo) bool {
+	if entry.IsDir() {
+		return false
+	}
+
+	return entry.Name()[0] != '.' || isPartial(entry.Name())
+}
+
+// isPartial reports whether the file with the name holds a pulled file that
+// is not yet complete. See partialName.
+func isPartial(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, partialExt)
+}
+
+// onlyConfirmed returns the entities that are confirmed, along with their
+// sidecars, so that a clean leaves every other file in place.
+func onlyConfirmed(entities []os.FileInfo, confirmed map[string]bool) []os.FileInfo {
+	kept := make([]os.FileInfo, 0, len(confirmed))
+
+	for _, entry := range entities {
+		base, isSidecar := strings.CutSuffix(entry.Name(), osutil.SidecarExt)
+		if confirmed[entry.Name()] || (isSidecar && confirmed[base]) {
+			kept = append(kept, entry)
+		}
+	}
+
+	return kept
+}
+
+// countVisible returns the number of entities that a clean would remove.
+func countVisible(entities []os.FileInfo) int {
+	n := 0
+	for _, entry := range entities {
+		if isCleanable(entry) {
+			n++
+		}
+	}
+
+	return n
+}
+
 func Clean(entities []os.FileInfo) error {
-	// Remove the files from the directory.
+	return CleanDir(".", entities)
+}
+
+// CleanDir securely deletes the non-hidden files in entities from dir. Every
+// file is attempted, even if an earlier one fails, and the failures are
+// returned together.
+func CleanDir(dir string, entities []os.FileInfo) error {
+	var errs []error
+
 	for _, entry := range entities {
-		// Don't remove hidden files
-		if entry.Name()[0] == '.' {
+		if !isCleanable(entry) {
 			continue
 		}
 
-		if err := secureDelete(entry.Name()); err != nil {
-			return fmt.Errorf("failed to securely delete file: %w", err)
+		if err := secureDeleteWithRetry(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, fmt.Errorf("failed to securely delete %s: %w", entry.Name(), err))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// secureDeleteWithRetry securely deletes the file, retrying transient
+// failures. A file that no longer exists is considered deleted.
+func secureDeleteWithRetry(filename string) error {
+	delay := cleanRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= cleanAttempts; attempt++ {
+		err = secureDelete(filename)
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		if attempt < cleanAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+
+	return err
 }
@@ -0,0 +1,60 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanDir(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// The partial file of an interrupted pull holds plaintext, so it is
+	// cleaned even though it is hidden.
+	for _, name := range []string{"a.txt", "b.txt", ".diskhop", ".c.txt.partial"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	entities, err := f.Readdir(-1)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Remove a file out from under the clean, which must not fail it.
+	require.NoError(t, os.Remove(filepath.Join(dir, "b.txt")))
+
+	require.NoError(t, CleanDir(dir, entities))
+
+	remaining, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := make([]string, 0, len(remaining))
+	for _, entry := range remaining {
+		names = append(names, entry.Name())
+	}
+
+	assert.ElementsMatch(t, []string{".diskhop", "sub"}, names)
+}
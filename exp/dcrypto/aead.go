@@ -58,6 +58,10 @@ func (a *AEAD) Open(ctx context.Context, ciphertext []byte) ([]byte, error) {
 		nonceSize = DefaultAEADNonceSize
 	}
 
+	if len(ciphertext) < nonceSize {
+		return nil, fmt.Errorf("ciphertext is shorter than the %d byte nonce", nonceSize)
+	}
+
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 
 	return a.Cipher.Open(nil, nonce, ciphertext, nil)
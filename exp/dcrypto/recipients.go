@@ -0,0 +1,456 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dcrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrNotRecipient indicates that a message was not sealed for the identity
+// opening it.
+var ErrNotRecipient = errors.New("not a recipient of the message")
+
+// envelopeVersion is the first byte of an envelope.
+const envelopeVersion = 1
+
+// keyIDSize is the size of the ID of a recipient key in an envelope.
+const keyIDSize = 8
+
+// dataKeySize is the size of the AES-256 key that seals each message.
+const dataKeySize = 32
+
+// maxRecipients bounds the number of wrapped keys read from an envelope so
+// that a corrupt envelope cannot force a huge allocation.
+const maxRecipients = 1 << 10
+
+// Recipients is a SealOpener for a bucket shared by several people, each with
+// their own RSA key pair. Data is sealed with a data key, which is wrapped
+// with RSA-OAEP for each of the recipients in an envelope ahead of the
+// ciphertext. Identity opens what was sealed for its public key.
+//
+// Every stream, which holds the data of a file, is sealed with a fresh data
+// key. The messages that a Recipients seals, such as names and metadata, share
+// one, so that opening them costs one RSA operation rather than one each. The
+// data keys that a Recipients unwraps are kept for the next envelope that
+// wraps them.
+//
+// The envelope is kept with the ciphertext, rather than beside it, so that
+// every value that a store seals is shared the same way. Adding or removing a
+// recipient rewraps the data key of each envelope with Rewrap, leaving the
+// ciphertext as it is. A removed recipient can still open what they could read
+// before, so removing one only protects what is sealed after.
+type Recipients struct {
+	Recipients []*rsa.PublicKey
+	Identity   *rsa.PrivateKey
+
+	mu         sync.Mutex
+	sealKey    []byte            // Data key of the messages sealed
+	sealHeader []byte            // Envelope of sealKey
+	opened     map[string][]byte // Wrapped for Identity -> data key
+	rewrapped  map[string][]byte // Wrapped for Identity -> new envelope
+}
+
+var (
+	_ StreamSealOpener = (*Recipients)(nil)
+	_ Rewrapper        = (*Recipients)(nil)
+)
+
+// Rewrapper rewraps the data key of a sealed value, copying it from r to w.
+type Rewrapper interface {
+	Rewrap(w io.Writer, r io.Reader) error
+}
+
+// KeyID returns the ID of the public key in envelopes, the start of the
+// SHA-256 of its PKIX encoding.
+func KeyID(pub *rsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+
+	return sum[:keyIDSize], nil
+}
+
+// Envelope holds the data key of a message wrapped for each recipient, by the
+// ID of their key.
+type Envelope struct {
+	Keys []WrappedKey
+}
+
+// WrappedKey is the data key of a message wrapped for one recipient.
+type WrappedKey struct {
+	KeyID   []byte
+	Wrapped []byte
+}
+
+// MarshalBinary encodes the envelope as it is written ahead of the
+// ciphertext.
+func (e *Envelope) MarshalBinary() ([]byte, error) {
+	buf := []byte{envelopeVersion}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(e.Keys)))
+
+	for _, key := range e.Keys {
+		if len(key.KeyID) != keyIDSize {
+			return nil, fmt.Errorf("key ID is %d bytes, expected %d", len(key.KeyID), keyIDSize)
+		}
+
+		buf = append(buf, key.KeyID...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(key.Wrapped)))
+		buf = append(buf, key.Wrapped...)
+	}
+
+	return buf, nil
+}
+
+// ReadEnvelope reads the envelope from the start of r, leaving r at the
+// ciphertext.
+func ReadEnvelope(r io.Reader) (*Envelope, error) {
+	var head [3]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, fmt.Errorf("failed to read envelope: %w", err)
+	}
+
+	if head[0] != envelopeVersion {
+		return nil, fmt.Errorf("unknown envelope version %d", head[0])
+	}
+
+	count := int(binary.BigEndian.Uint16(head[1:]))
+	if count > maxRecipients {
+		return nil, fmt.Errorf("envelope has %d recipients, at most %d are allowed", count, maxRecipients)
+	}
+
+	env := &Envelope{Keys: make([]WrappedKey, count)}
+
+	for i := range env.Keys {
+		var keyHead [keyIDSize + 2]byte
+		if _, err := io.ReadFull(r, keyHead[:]); err != nil {
+			return nil, fmt.Errorf("failed to read wrapped key %d: %w", i, err)
+		}
+
+		wrapped := make([]byte, binary.BigEndian.Uint16(keyHead[keyIDSize:]))
+		if _, err := io.ReadFull(r, wrapped); err != nil {
+			return nil, fmt.Errorf("failed to read wrapped key %d: %w", i, err)
+		}
+
+		env.Keys[i] = WrappedKey{KeyID: bytes.Clone(keyHead[:keyIDSize]), Wrapped: wrapped}
+	}
+
+	return env, nil
+}
+
+// wrap returns an envelope with the data key wrapped for each recipient.
+func (r *Recipients) wrap(dataKey []byte) (*Envelope, error) {
+	if len(r.Recipients) == 0 {
+		return nil, fmt.Errorf("no recipients to seal for")
+	}
+
+	env := &Envelope{Keys: make([]WrappedKey, 0, len(r.Recipients))}
+
+	for _, pub := range r.Recipients {
+		id, err := KeyID(pub)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, dataKey, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to wrap data key: %w", err)
+		}
+
+		env.Keys = append(env.Keys, WrappedKey{KeyID: id, Wrapped: wrapped})
+	}
+
+	return env, nil
+}
+
+// wrappedKey returns the data key that the envelope wraps for the identity,
+// still wrapped.
+func (r *Recipients) wrappedKey(env *Envelope) ([]byte, error) {
+	if r.Identity == nil {
+		return nil, fmt.Errorf("no identity to open with")
+	}
+
+	id, err := KeyID(&r.Identity.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range env.Keys {
+		if bytes.Equal(key.KeyID, id) {
+			return key.Wrapped, nil
+		}
+	}
+
+	return nil, ErrNotRecipient
+}
+
+// unwrap returns the data key that the envelope wraps for the identity. The
+// key is kept, so the caller must not zero it.
+func (r *Recipients) unwrap(env *Envelope) ([]byte, error) {
+	wrapped, err := r.wrappedKey(env)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if dataKey, ok := r.opened[string(wrapped)]; ok {
+		return dataKey, nil
+	}
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), nil, r.Identity, wrapped, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	if r.opened == nil {
+		r.opened = make(map[string][]byte)
+	}
+
+	r.opened[string(wrapped)] = dataKey
+
+	return dataKey, nil
+}
+
+// newDataKey returns a fresh data key and its envelope.
+func (r *Recipients) newDataKey() ([]byte, []byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	env, err := r.wrap(dataKey)
+	if err != nil {
+		Zero(dataKey)
+
+		return nil, nil, err
+	}
+
+	header, err := env.MarshalBinary()
+	if err != nil {
+		Zero(dataKey)
+
+		return nil, nil, err
+	}
+
+	return dataKey, header, nil
+}
+
+// messageKey returns the data key that the messages are sealed with, and its
+// envelope, generating them for the first message.
+func (r *Recipients) messageKey() ([]byte, []byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sealKey == nil {
+		dataKey, header, err := r.newDataKey()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		r.sealKey, r.sealHeader = dataKey, header
+	}
+
+	return r.sealKey, r.sealHeader, nil
+}
+
+// dataAEAD returns the cipher that seals with a data key. A data key is only
+// used by one Recipients, for few enough messages that its random nonces do
+// not repeat, so they need not be registered.
+func dataAEAD(dataKey []byte) (*AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new AES cipher: %w", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new GCM cipher: %w", err)
+	}
+
+	return NewAEAD(unregisteredIVs{}, aesgcm), nil
+}
+
+// openEnvelope reads the envelope from r and returns the cipher that opens
+// the ciphertext after it.
+func (r *Recipients) openEnvelope(rd io.Reader) (*AEAD, error) {
+	env, err := ReadEnvelope(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := r.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return dataAEAD(dataKey)
+}
+
+// Seal encrypts the plaintext with the data key of the messages, wrapped for
+// each recipient in the envelope that starts the ciphertext.
+func (r *Recipients) Seal(ctx context.Context, plaintext []byte) ([]byte, error) {
+	dataKey, header, err := r.messageKey()
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := dataAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := aead.Seal(ctx, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(bytes.Clone(header), ciphertext...), nil
+}
+
+// Open decrypts a message sealed for the identity.
+func (r *Recipients) Open(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	rd := bytes.NewReader(ciphertext)
+
+	aead, err := r.openEnvelope(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(ctx, ciphertext[len(ciphertext)-rd.Len():])
+}
+
+// SealStream encrypts r to w like AEAD.SealStream, with a fresh data key
+// wrapped for each recipient in the envelope that starts the stream.
+func (r *Recipients) SealStream(ctx context.Context, w io.Writer, rd io.Reader, chunkSize int) error {
+	dataKey, header, err := r.newDataKey()
+	if err != nil {
+		return err
+	}
+
+	defer Zero(dataKey)
+
+	aead, err := dataAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write envelope: %w", err)
+	}
+
+	return aead.SealStream(ctx, w, rd, chunkSize)
+}
+
+// OpenStream decrypts a stream sealed for the identity from r to w.
+func (r *Recipients) OpenStream(ctx context.Context, w io.Writer, rd io.Reader) error {
+	aead, err := r.openEnvelope(rd)
+	if err != nil {
+		return err
+	}
+
+	return aead.OpenStream(ctx, w, rd)
+}
+
+// Rewrap copies a message or stream sealed for the identity from r to w with
+// its data key wrapped for the current recipients instead, so that adding or
+// removing one does not re-encrypt the ciphertext. The messages that share a
+// data key share the new envelope too.
+func (r *Recipients) Rewrap(w io.Writer, rd io.Reader) error {
+	env, err := ReadEnvelope(rd)
+	if err != nil {
+		return err
+	}
+
+	header, err := r.rewrapEnvelope(env)
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write envelope: %w", err)
+	}
+
+	if _, err := io.Copy(w, rd); err != nil {
+		return fmt.Errorf("failed to copy ciphertext: %w", err)
+	}
+
+	return nil
+}
+
+// rewrapEnvelope returns the envelope that wraps the data key of env for the
+// current recipients.
+func (r *Recipients) rewrapEnvelope(env *Envelope) ([]byte, error) {
+	wrapped, err := r.wrappedKey(env)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	header, ok := r.rewrapped[string(wrapped)]
+	r.mu.Unlock()
+
+	if ok {
+		return header, nil
+	}
+
+	dataKey, err := r.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if env, err = r.wrap(dataKey); err != nil {
+		return nil, err
+	}
+
+	if header, err = env.MarshalBinary(); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rewrapped == nil {
+		r.rewrapped = make(map[string][]byte)
+	}
+
+	r.rewrapped[string(wrapped)] = header
+
+	return header, nil
+}
+
+// unregisteredIVs is an IV manager that registers nothing, for keys that only
+// ever seal one message.
+type unregisteredIVs struct{}
+
+func (unregisteredIVs) GetIVManager() IVManager { return IVManager{IVPusher: unregisteredIVs{}} }
+
+func (unregisteredIVs) Exists(context.Context, []byte) (bool, error) { return false, nil }
+func (unregisteredIVs) Push(context.Context, []byte) error           { return nil }
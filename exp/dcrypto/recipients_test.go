@@ -0,0 +1,159 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dcrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return key
+}
+
+func TestRecipients(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	team := []*rsa.PublicKey{&alice.PublicKey, &bob.PublicKey}
+
+	sealer := &Recipients{Recipients: team, Identity: alice}
+
+	ciphertext, err := sealer.Seal(ctx, []byte("shared"))
+	require.NoError(t, err)
+
+	for _, identity := range []*rsa.PrivateKey{alice, bob} {
+		plaintext, err := (&Recipients{Identity: identity}).Open(ctx, ciphertext)
+		require.NoError(t, err)
+
+		assert.Equal(t, []byte("shared"), plaintext)
+	}
+
+	_, err = (&Recipients{Identity: carol}).Open(ctx, ciphertext)
+	assert.ErrorIs(t, err, ErrNotRecipient)
+
+	data := bytes.Repeat([]byte("stream"), 1000)
+
+	var stream bytes.Buffer
+	require.NoError(t, sealer.SealStream(ctx, &stream, bytes.NewReader(data), 64))
+
+	var opened bytes.Buffer
+	require.NoError(t, (&Recipients{Identity: bob}).OpenStream(ctx, &opened, bytes.NewReader(stream.Bytes())))
+
+	assert.Equal(t, data, opened.Bytes())
+}
+
+func TestRecipientsRewrap(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+
+	sealer := &Recipients{Recipients: []*rsa.PublicKey{&alice.PublicKey, &bob.PublicKey}}
+
+	ciphertext, err := sealer.Seal(ctx, []byte("shared"))
+	require.NoError(t, err)
+
+	// Alice replaces Bob with Carol.
+	rewrapper := &Recipients{
+		Recipients: []*rsa.PublicKey{&alice.PublicKey, &carol.PublicKey},
+		Identity:   alice,
+	}
+
+	var rewrapped bytes.Buffer
+	require.NoError(t, rewrapper.Rewrap(&rewrapped, bytes.NewReader(ciphertext)))
+
+	rd := bytes.NewReader(ciphertext)
+	_, err = ReadEnvelope(rd)
+	require.NoError(t, err)
+
+	assert.True(t, bytes.HasSuffix(rewrapped.Bytes(), ciphertext[len(ciphertext)-rd.Len():]))
+
+	plaintext, err := (&Recipients{Identity: carol}).Open(ctx, rewrapped.Bytes())
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("shared"), plaintext)
+
+	_, err = (&Recipients{Identity: bob}).Open(ctx, rewrapped.Bytes())
+	assert.ErrorIs(t, err, ErrNotRecipient)
+}
+
+func TestRecipientsMessageKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	alice, bob := newTestKey(t), newTestKey(t)
+
+	sealer := &Recipients{Recipients: []*rsa.PublicKey{&alice.PublicKey}, Identity: alice}
+
+	first, err := sealer.Seal(ctx, []byte("first"))
+	require.NoError(t, err)
+
+	second, err := sealer.Seal(ctx, []byte("second"))
+	require.NoError(t, err)
+
+	envelope := func(ciphertext []byte) []byte {
+		t.Helper()
+
+		rd := bytes.NewReader(ciphertext)
+		_, err := ReadEnvelope(rd)
+		require.NoError(t, err)
+
+		return ciphertext[:len(ciphertext)-rd.Len()]
+	}
+
+	// The messages share a data key, so opening the second unwraps nothing.
+	assert.Equal(t, envelope(first), envelope(second))
+	assert.NotEqual(t, first, second)
+
+	opener := &Recipients{Identity: alice}
+
+	for _, ciphertext := range [][]byte{first, second} {
+		_, err := opener.Open(ctx, ciphertext)
+		require.NoError(t, err)
+	}
+
+	assert.Len(t, opener.opened, 1)
+
+	// Rewrapping the messages wraps their shared key once.
+	rewrapper := &Recipients{Recipients: []*rsa.PublicKey{&alice.PublicKey, &bob.PublicKey}, Identity: alice}
+
+	var rewrapped [2]bytes.Buffer
+	for i, ciphertext := range [][]byte{first, second} {
+		require.NoError(t, rewrapper.Rewrap(&rewrapped[i], bytes.NewReader(ciphertext)))
+	}
+
+	assert.Equal(t, envelope(rewrapped[0].Bytes()), envelope(rewrapped[1].Bytes()))
+
+	plaintext, err := (&Recipients{Identity: bob}).Open(ctx, rewrapped[1].Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), plaintext)
+}
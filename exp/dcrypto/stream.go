@@ -0,0 +1,266 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dcrypto
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultStreamChunkSize is the plaintext size of each chunk sealed by
+// SealStream when no chunk size is given.
+const DefaultStreamChunkSize = 1 << 20
+
+// maxStreamChunkSize bounds the chunk size read from a stream header so that a
+// corrupt header cannot force a huge allocation.
+const maxStreamChunkSize = 64 << 20
+
+// StreamSealer encrypts a stream of plaintext in fixed-size chunks.
+type StreamSealer interface {
+	SealStream(ctx context.Context, w io.Writer, r io.Reader, chunkSize int) error
+}
+
+// StreamOpener decrypts a stream written by a StreamSealer.
+type StreamOpener interface {
+	OpenStream(ctx context.Context, w io.Writer, r io.Reader) error
+}
+
+// StreamResumer decrypts a stream written by a StreamSealer from part way
+// through, so that an interrupted download can resume where it stopped.
+type StreamResumer interface {
+	StreamHeaderSize() int
+	StreamResumePoint(header []byte, offset int64) (int64, error)
+	ResumeStream(ctx context.Context, w io.Writer, header []byte, r io.Reader, offset int64) error
+}
+
+// StreamSealOpener is a SealOpener that can also seal and open streams.
+type StreamSealOpener interface {
+	SealOpener
+	StreamSealer
+	StreamOpener
+}
+
+var (
+	_ StreamSealOpener = (*AEAD)(nil)
+	_ StreamResumer    = (*AEAD)(nil)
+)
+
+// SealStream encrypts r to w in chunks of chunkSize bytes so that neither the
+// plaintext nor the ciphertext has to fit in memory. The stream starts with a
+// header holding a base nonce and the chunk size. Each chunk is sealed with
+// the base nonce XORed with the chunk index, and the final chunk is marked in
+// the additional data so that truncation is detected on open.
+func (a *AEAD) SealStream(ctx context.Context, w io.Writer, r io.Reader, chunkSize int) error {
+	if chunkSize == 0 {
+		chunkSize = DefaultStreamChunkSize
+	}
+
+	if chunkSize < 0 || chunkSize > maxStreamChunkSize {
+		return fmt.Errorf("invalid chunk size: %d", chunkSize)
+	}
+
+	nonceSize := a.NonceSize
+	if nonceSize == 0 {
+		nonceSize = DefaultAEADNonceSize
+	}
+
+	baseNonce, err := generateInitializationVector(ctx, a.Mgr, nonceSize)
+	if err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := binary.BigEndian.AppendUint32(baseNonce, uint32(chunkSize))
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("failed to write stream header: %w", err)
+	}
+
+	br := bufio.NewReader(r)
+
+	plaintext := make([]byte, chunkSize)
+	ciphertext := make([]byte, 0, chunkSize+a.Cipher.Overhead())
+
+	for i := uint64(0); ; i++ {
+		n, final, err := readChunk(br, plaintext)
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %d: %w", i, err)
+		}
+
+		ciphertext = a.Cipher.Seal(ciphertext[:0], chunkNonce(baseNonce, i), plaintext[:n], chunkAD(final))
+		if _, err := w.Write(ciphertext); err != nil {
+			return fmt.Errorf("failed to write chunk %d: %w", i, err)
+		}
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// OpenStream decrypts a stream written by SealStream from r to w, one chunk at
+// a time. Data written to w before an error is returned has been
+// authenticated, but the stream as a whole has not.
+func (a *AEAD) OpenStream(_ context.Context, w io.Writer, r io.Reader) error {
+	header := make([]byte, a.StreamHeaderSize())
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	baseNonce, chunkSize, err := a.parseStreamHeader(header)
+	if err != nil {
+		return err
+	}
+
+	return a.openChunks(w, r, baseNonce, chunkSize, 0, 0)
+}
+
+// StreamHeaderSize returns the size of the header that starts a stream.
+func (a *AEAD) StreamHeaderSize() int {
+	nonceSize := a.NonceSize
+	if nonceSize == 0 {
+		nonceSize = DefaultAEADNonceSize
+	}
+
+	return nonceSize + 4
+}
+
+// StreamResumePoint returns the offset in the stream with the header of the
+// chunk that holds the plaintext byte at offset.
+func (a *AEAD) StreamResumePoint(header []byte, offset int64) (int64, error) {
+	_, chunkSize, err := a.parseStreamHeader(header)
+	if err != nil {
+		return 0, err
+	}
+
+	chunk := offset / int64(chunkSize)
+
+	return int64(len(header)) + chunk*int64(chunkSize+a.Cipher.Overhead()), nil
+}
+
+// ResumeStream decrypts the plaintext of the stream with the header from
+// offset on to w. r holds the stream from the resume point of offset, and the
+// part of its first chunk before offset is authenticated but not written.
+func (a *AEAD) ResumeStream(_ context.Context, w io.Writer, header []byte, r io.Reader, offset int64) error {
+	baseNonce, chunkSize, err := a.parseStreamHeader(header)
+	if err != nil {
+		return err
+	}
+
+	chunk := offset / int64(chunkSize)
+	skip := int(offset - chunk*int64(chunkSize))
+
+	return a.openChunks(w, r, baseNonce, chunkSize, uint64(chunk), skip)
+}
+
+// parseStreamHeader returns the base nonce and the chunk size of a stream.
+func (a *AEAD) parseStreamHeader(header []byte) ([]byte, int, error) {
+	nonceSize := a.StreamHeaderSize() - 4
+	if len(header) != nonceSize+4 {
+		return nil, 0, fmt.Errorf("stream header is %d bytes, expected %d", len(header), nonceSize+4)
+	}
+
+	chunkSize := int(binary.BigEndian.Uint32(header[nonceSize:]))
+	if chunkSize <= 0 || chunkSize > maxStreamChunkSize {
+		return nil, 0, fmt.Errorf("invalid chunk size in stream header: %d", chunkSize)
+	}
+
+	return header[:nonceSize], chunkSize, nil
+}
+
+// openChunks decrypts the chunks in r, the first of which has the index
+// first, to w, leaving out the first skip bytes of plaintext.
+func (a *AEAD) openChunks(w io.Writer, r io.Reader, baseNonce []byte, chunkSize int, first uint64, skip int) error {
+	br := bufio.NewReader(r)
+
+	ciphertext := make([]byte, chunkSize+a.Cipher.Overhead())
+	plaintext := make([]byte, 0, chunkSize)
+
+	for i := first; ; i++ {
+		n, final, err := readChunk(br, ciphertext)
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %d: %w", i, err)
+		}
+
+		plaintext, err = a.Cipher.Open(plaintext[:0], chunkNonce(baseNonce, i), ciphertext[:n], chunkAD(final))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt chunk %d: %w", i, err)
+		}
+
+		if skip > len(plaintext) {
+			return fmt.Errorf("offset is past the end of the stream")
+		}
+
+		if _, err := w.Write(plaintext[skip:]); err != nil {
+			return fmt.Errorf("failed to write chunk %d: %w", i, err)
+		}
+
+		skip = 0
+
+		if final {
+			return nil
+		}
+	}
+}
+
+// readChunk fills buf from br, reporting whether this is the last chunk of
+// the stream.
+func readChunk(br *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(br, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return n, true, nil
+	}
+
+	if err != nil {
+		return n, false, err
+	}
+
+	if _, err := br.Peek(1); errors.Is(err, io.EOF) {
+		return n, true, nil
+	} else if err != nil {
+		return n, false, err
+	}
+
+	return n, false, nil
+}
+
+// chunkNonce derives the nonce for chunk i by XORing the index into the last
+// eight bytes of the base nonce.
+func chunkNonce(baseNonce []byte, i uint64) []byte {
+	nonce := make([]byte, len(baseNonce))
+	copy(nonce, baseNonce)
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], i)
+
+	offset := len(nonce) - len(counter)
+	for j := range counter {
+		nonce[offset+j] ^= counter[j]
+	}
+
+	return nonce
+}
+
+// chunkAD returns the additional data marking whether a chunk is the last one
+// in the stream.
+func chunkAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dcrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockIVPusher struct{}
+
+func (mockIVPusher) Exists(context.Context, []byte) (bool, error) { return false, nil }
+func (mockIVPusher) Push(context.Context, []byte) error           { return nil }
+
+type mockIVManagerGetter struct{}
+
+func (mockIVManagerGetter) GetIVManager() IVManager {
+	return IVManager{IVPusher: mockIVPusher{}}
+}
+
+func newTestAEAD(t *testing.T) *AEAD {
+	t.Helper()
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	return NewAEAD(mockIVManagerGetter{}, aesgcm)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		size      int
+		chunkSize int
+	}{
+		{name: "empty", size: 0, chunkSize: 16},
+		{name: "less than one chunk", size: 10, chunkSize: 16},
+		{name: "exactly one chunk", size: 16, chunkSize: 16},
+		{name: "several chunks", size: 100, chunkSize: 16},
+		{name: "default chunk size", size: 3 << 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			aead := newTestAEAD(t)
+
+			plaintext := make([]byte, tt.size)
+			_, err := rand.Read(plaintext)
+			require.NoError(t, err)
+
+			sealed := &bytes.Buffer{}
+			err = aead.SealStream(context.Background(), sealed, bytes.NewReader(plaintext), tt.chunkSize)
+			require.NoError(t, err)
+
+			opened := &bytes.Buffer{}
+			err = aead.OpenStream(context.Background(), opened, bytes.NewReader(sealed.Bytes()))
+			require.NoError(t, err)
+
+			assert.True(t, bytes.Equal(plaintext, opened.Bytes()), "plaintext mismatch")
+		})
+	}
+}
+
+func TestOpenStreamTruncated(t *testing.T) {
+	t.Parallel()
+
+	aead := newTestAEAD(t)
+
+	plaintext := make([]byte, 64)
+
+	sealed := &bytes.Buffer{}
+	err := aead.SealStream(context.Background(), sealed, bytes.NewReader(plaintext), 16)
+	require.NoError(t, err)
+
+	// Drop the final chunk, leaving a stream that ends on a chunk boundary.
+	chunk := 16 + aead.Cipher.Overhead()
+	truncated := sealed.Bytes()[:sealed.Len()-chunk]
+
+	err = aead.OpenStream(context.Background(), &bytes.Buffer{}, bytes.NewReader(truncated))
+	assert.ErrorContains(t, err, "failed to decrypt chunk")
+}
+
+func TestResumeStream(t *testing.T) {
+	t.Parallel()
+
+	aead := newTestAEAD(t)
+
+	plaintext := make([]byte, 100)
+	_, err := rand.Read(plaintext)
+	require.NoError(t, err)
+
+	sealed := &bytes.Buffer{}
+	err = aead.SealStream(context.Background(), sealed, bytes.NewReader(plaintext), 16)
+	require.NoError(t, err)
+
+	header := sealed.Bytes()[:aead.StreamHeaderSize()]
+
+	for _, offset := range []int64{0, 1, 16, 40, 99} {
+		point, err := aead.StreamResumePoint(header, offset)
+		require.NoError(t, err)
+
+		opened := &bytes.Buffer{}
+		err = aead.ResumeStream(context.Background(), opened, header, bytes.NewReader(sealed.Bytes()[point:]), offset)
+		require.NoError(t, err, "offset %d", offset)
+
+		assert.True(t, bytes.Equal(plaintext[offset:], opened.Bytes()), "plaintext mismatch at offset %d", offset)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// FS is a read-only view of the files of a remote host. The names of the
+// files, split on "/", are its directory tree, and a file is downloaded and
+// decrypted only when it is read.
+//
+// FS is what Mount serves at a mountpoint.
+type FS struct {
+	ctx    context.Context
+	puller store.Puller
+	opts   []store.PullOption
+
+	mu   sync.Mutex
+	root *node // Loaded on first use
+}
+
+var (
+	_ fs.StatFS    = (*FS)(nil)
+	_ fs.ReadDirFS = (*FS)(nil)
+)
+
+// node is a file or directory of the tree.
+type node struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	children map[string]*node // Nil for a file
+}
+
+// New returns a view of the files that puller pulls with opts, such as the
+// seal opener that decrypts them.
+func New(ctx context.Context, puller store.Puller, opts ...store.PullOption) *FS {
+	return &FS{ctx: ctx, puller: puller, opts: opts}
+}
+
+// Open opens the named file or directory.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.children != nil {
+		return &dir{node: n, entries: n.entries()}, nil
+	}
+
+	return &file{fsys: fsys, node: n, path: name}, nil
+}
+
+// Stat describes the named file or directory without downloading it.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// ReadDir lists the named directory, sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.children == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return n.entries(), nil
+}
+
+// lookup returns the node of the name, listing the remote files the first
+// time it is called.
+func (fsys *FS) lookup(op, name string) (*node, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	root, err := fsys.load()
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	n := root
+	if name == "." {
+		return n, nil
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		if n = n.children[elem]; n == nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+
+	return n, nil
+}
+
+// load lists the remote files into a tree.
+func (fsys *FS) load() (*node, error) {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	if fsys.root != nil {
+		return fsys.root, nil
+	}
+
+	opts := append(slices.Clone(fsys.opts), store.WithPullDescribeFiles())
+
+	desc, err := fsys.puller.Pull(fsys.ctx, store.NewDocumentBuffer(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	root := &node{name: ".", children: map[string]*node{}}
+
+	for _, f := range desc.Files {
+		// Stored names are rooted at the repository. Names that are not
+		// valid paths below it are left out rather than rewritten so that
+		// they cannot shadow other files.
+		name, ok := strings.CutPrefix(f.Name, "/")
+		if !ok || !fs.ValidPath(name) || name == "." {
+			continue
+		}
+
+		f.Name = name
+		root.insert(f)
+	}
+
+	fsys.root = root
+
+	return root, nil
+}
+
+// insert adds the file to the tree under n, creating its parent directories.
+// A file whose name is a directory of another file is left out.
+func (n *node) insert(f store.FileDescription) {
+	elems := strings.Split(f.Name, "/")
+
+	for _, elem := range elems[:len(elems)-1] {
+		child := n.children[elem]
+		if child == nil {
+			child = &node{name: elem, children: map[string]*node{}}
+			n.children[elem] = child
+		}
+
+		if child.children == nil {
+			return
+		}
+
+		if f.UploadDate.After(child.modTime) {
+			child.modTime = f.UploadDate
+		}
+
+		n = child
+	}
+
+	base := elems[len(elems)-1]
+	if _, ok := n.children[base]; ok {
+		return
+	}
+
+	n.children[base] = &node{name: base, size: f.Size, modTime: f.UploadDate}
+}
+
+// entries returns the children of the directory sorted by name.
+func (n *node) entries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, 0, len(n.children))
+	for _, child := range n.children {
+		entries = append(entries, fs.FileInfoToDirEntry(child))
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries
+}
+
+func (n *node) Name() string       { return n.name }
+func (n *node) Size() int64        { return n.size }
+func (n *node) ModTime() time.Time { return n.modTime }
+func (n *node) IsDir() bool        { return n.children != nil }
+func (n *node) Sys() any           { return nil }
+
+func (n *node) Mode() fs.FileMode {
+	if n.children != nil {
+		return fs.ModeDir | 0o555
+	}
+
+	return 0o444
+}
+
+// dir is an open directory.
+type dir struct {
+	node    *node
+	entries []fs.DirEntry // Not yet read
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.node, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+
+	return entries, nil
+}
+
+// file is an open file, downloaded on its first read.
+type file struct {
+	fsys *FS
+	node *node
+	path string
+
+	body   io.ReadCloser
+	cancel context.CancelFunc
+	closed bool
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.node, nil }
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+
+	if f.body == nil {
+		if err := f.open(); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.path, Err: err}
+		}
+	}
+
+	return f.body.Read(p)
+}
+
+// open starts the download of the file.
+func (f *file) open() error {
+	ctx, cancel := context.WithCancel(f.fsys.ctx)
+
+	opts := append(slices.Clone(f.fsys.opts), store.WithPullNames("/"+f.path))
+
+	buf := store.NewDocumentBuffer()
+	if _, err := f.fsys.puller.Pull(ctx, buf, opts...); err != nil {
+		cancel()
+
+		return fmt.Errorf("failed to pull: %w", err)
+	}
+
+	doc, err := buf.Next()
+	if err != nil {
+		cancel()
+
+		return fmt.Errorf("failed to download: %w", err)
+	}
+
+	f.cancel = cancel
+	f.body = doc.Body
+
+	if f.body == nil {
+		f.body = io.NopCloser(bytes.NewReader(doc.Data))
+	}
+
+	return nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.path, Err: fs.ErrClosed}
+	}
+
+	f.closed = true
+
+	if f.body == nil {
+		return nil
+	}
+
+	err := f.body.Close()
+	f.cancel()
+
+	return err
+}
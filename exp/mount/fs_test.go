@@ -0,0 +1,117 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mount
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockPuller pulls files from memory, counting the downloads.
+type mockPuller struct {
+	files     map[string]string
+	downloads int
+}
+
+func (mp *mockPuller) Pull(_ context.Context, buf store.DocumentBuffer, opts ...store.PullOption) (*store.PullDescription, error) {
+	var pullOpts store.PullOptions
+	for _, opt := range opts {
+		opt(&pullOpts)
+	}
+
+	if pullOpts.DescribeFiles {
+		desc := &store.PullDescription{}
+		for name, data := range mp.files {
+			desc.Files = append(desc.Files, store.FileDescription{
+				Name:       name,
+				Size:       int64(len(data)),
+				UploadDate: time.Unix(1700000000, 0),
+			})
+		}
+
+		return desc, nil
+	}
+
+	mp.downloads++
+
+	name := pullOpts.Names[0]
+
+	go func() {
+		buf.Send(&store.Document{Filename: name, Data: []byte(mp.files[name])}, nil)
+		buf.Send(nil, io.EOF)
+	}()
+
+	return &store.PullDescription{Count: 1}, nil
+}
+
+func TestFS(t *testing.T) {
+	t.Parallel()
+
+	puller := &mockPuller{files: map[string]string{
+		"/notes.txt":             "hello",
+		"/photos/2024/beach.jpg": "waves",
+		"/photos/cat.jpg":        "meow",
+		"//etc/passwd":           "absolute",
+		"/../escape":             "relative",
+		"prefix/hidden.txt":      "outside the repository",
+	}}
+
+	fsys := New(context.Background(), puller)
+
+	require.NoError(t, fstest.TestFS(fsys, "notes.txt", "photos/2024/beach.jpg", "photos/cat.jpg"))
+
+	entries, err := fs.ReadDir(fsys, ".")
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	assert.Equal(t, []string{"notes.txt", "photos"}, names)
+
+	data, err := fs.ReadFile(fsys, "photos/cat.jpg")
+	require.NoError(t, err)
+
+	assert.Equal(t, "meow", string(data))
+}
+
+func TestFSDownloadsOnRead(t *testing.T) {
+	t.Parallel()
+
+	puller := &mockPuller{files: map[string]string{"/a/b.txt": "data"}}
+
+	fsys := New(context.Background(), puller)
+
+	f, err := fsys.Open("a/b.txt")
+	require.NoError(t, err)
+
+	info, err := f.Stat()
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), info.Size())
+	assert.Zero(t, puller.downloads)
+
+	require.NoError(t, f.Close())
+	assert.Zero(t, puller.downloads)
+}
@@ -0,0 +1,233 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package mount
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"syscall"
+
+	fusefs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// Mount serves the files that puller pulls with opts, such as the seal opener
+// that decrypts them, as a read-only FUSE file system at mountpoint. The
+// remote files are listed before the mount, so that a failure to reach the
+// remote host is returned rather than served. Mount blocks until the file
+// system is unmounted, or until ctx is done, which unmounts it.
+func Mount(ctx context.Context, puller store.Puller, mountpoint string, opts ...store.PullOption) error {
+	fsys := New(ctx, puller, opts...)
+
+	root, err := fsys.load()
+	if err != nil {
+		return err
+	}
+
+	server, err := fusefs.Mount(mountpoint, &fuseDir{fsys: fsys, node: root}, &fusefs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName:  "diskhop",
+			Name:    "diskhop",
+			Options: []string{"ro"},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mount %s: %w", mountpoint, err)
+	}
+
+	unmounted := make(chan struct{})
+
+	go func() {
+		server.Wait()
+		close(unmounted)
+	}()
+
+	select {
+	case <-unmounted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	if err := server.Unmount(); err != nil {
+		return fmt.Errorf("failed to unmount %s: %w", mountpoint, err)
+	}
+
+	<-unmounted
+
+	return nil
+}
+
+// fuseDir is a directory of the mounted tree. Its children are added when it
+// is, since the whole tree is listed up front.
+type fuseDir struct {
+	fusefs.Inode
+
+	fsys *FS
+	node *node
+	path string // Relative to the root of the tree, "." for the root
+}
+
+var (
+	_ fusefs.NodeOnAdder   = (*fuseDir)(nil)
+	_ fusefs.NodeGetattrer = (*fuseDir)(nil)
+)
+
+func (d *fuseDir) OnAdd(ctx context.Context) {
+	for name, child := range d.node.children {
+		childPath := path.Join(d.path, name)
+
+		var (
+			embedder fusefs.InodeEmbedder
+			mode     uint32 = fuse.S_IFREG
+		)
+
+		if child.children != nil {
+			embedder, mode = &fuseDir{fsys: d.fsys, node: child, path: childPath}, fuse.S_IFDIR
+		} else {
+			embedder = &fuseFile{fsys: d.fsys, node: child, path: childPath}
+		}
+
+		d.AddChild(name, d.NewPersistentInode(ctx, embedder, fusefs.StableAttr{Mode: mode}), false)
+	}
+}
+
+func (d *fuseDir) Getattr(_ context.Context, _ fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	setAttr(&out.Attr, d.node)
+
+	return 0
+}
+
+// fuseFile is a file of the mounted tree, downloaded when it is read.
+type fuseFile struct {
+	fusefs.Inode
+
+	fsys *FS
+	node *node
+	path string
+}
+
+var (
+	_ fusefs.NodeGetattrer = (*fuseFile)(nil)
+	_ fusefs.NodeOpener    = (*fuseFile)(nil)
+)
+
+func (f *fuseFile) Getattr(_ context.Context, _ fusefs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	setAttr(&out.Attr, f.node)
+
+	return 0
+}
+
+func (f *fuseFile) Open(_ context.Context, flags uint32) (fusefs.FileHandle, uint32, syscall.Errno) {
+	if flags&syscall.O_ACCMODE != syscall.O_RDONLY {
+		return nil, 0, syscall.EROFS
+	}
+
+	// The contents of a remote file do not change under the mount, so the
+	// kernel may keep them cached between opens.
+	return &fuseHandle{fsys: f.fsys, path: f.path}, fuse.FOPEN_KEEP_CACHE, 0
+}
+
+// setAttr describes the node in attr.
+func setAttr(attr *fuse.Attr, n *node) {
+	attr.Mode = uint32(n.Mode().Perm())
+	attr.Size = uint64(n.size)
+
+	modTime := n.modTime
+	attr.SetTimes(nil, &modTime, &modTime)
+}
+
+// fuseHandle reads an open file. The contents are streamed from the remote
+// host, so a read before the position of the stream starts the download over,
+// and a read past it skips ahead.
+type fuseHandle struct {
+	fsys *FS
+	path string
+
+	mu   sync.Mutex
+	file fs.File
+	pos  int64
+}
+
+var (
+	_ fusefs.FileReader   = (*fuseHandle)(nil)
+	_ fusefs.FileReleaser = (*fuseHandle)(nil)
+)
+
+func (h *fuseHandle) Read(_ context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file != nil && off < h.pos {
+		_ = h.file.Close()
+		h.file = nil
+	}
+
+	if h.file == nil {
+		file, err := h.fsys.Open(h.path)
+		if err != nil {
+			return nil, syscall.EIO
+		}
+
+		h.file, h.pos = file, 0
+	}
+
+	if off > h.pos {
+		n, err := io.CopyN(io.Discard, h.file, off-h.pos)
+		h.pos += n
+
+		if errors.Is(err, io.EOF) {
+			return fuse.ReadResultData(nil), 0
+		}
+
+		if err != nil {
+			return nil, syscall.EIO
+		}
+	}
+
+	n, err := io.ReadFull(h.file, dest)
+	h.pos += int64(n)
+
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, syscall.EIO
+	}
+
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (h *fuseHandle) Release(context.Context) syscall.Errno {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.file == nil {
+		return 0
+	}
+
+	err := h.file.Close()
+	h.file = nil
+
+	if err != nil {
+		return syscall.EIO
+	}
+
+	return 0
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin
+
+package mount
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuseHandleRead(t *testing.T) {
+	t.Parallel()
+
+	puller := &mockPuller{files: map[string]string{"/a.txt": "0123456789"}}
+
+	h := &fuseHandle{fsys: New(context.Background(), puller), path: "a.txt"}
+
+	read := func(off int64, size int) string {
+		t.Helper()
+
+		res, errno := h.Read(context.Background(), make([]byte, size), off)
+		require.Zero(t, errno)
+
+		data, status := res.Bytes(nil)
+		require.True(t, status.Ok())
+
+		return string(data)
+	}
+
+	assert.Equal(t, "0123", read(0, 4))
+	assert.Equal(t, "4567", read(4, 4))
+	assert.Equal(t, 1, puller.downloads, "sequential reads share a download")
+
+	assert.Equal(t, "89", read(8, 4), "a read past the position skips ahead")
+	assert.Equal(t, 1, puller.downloads)
+
+	assert.Equal(t, "12", read(1, 2), "a read before the position starts over")
+	assert.Equal(t, 2, puller.downloads)
+
+	assert.Empty(t, read(20, 4))
+
+	assert.Zero(t, h.Release(context.Background()))
+	assert.Nil(t, h.file)
+}
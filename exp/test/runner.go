@@ -36,8 +36,6 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
-const tmpDirRoot = "tmp"
-
 type TestStore struct {
 	Pusher   store.Pusher
 	Puller   store.Puller
@@ -60,8 +58,24 @@ type T struct {
 	NewTestMigrator func(t *testing.T, ctx context.Context, srcBucketName, targetBucketName string) *TestStore
 	Setup           func(t *testing.T, ctx context.Context)
 
-	buckets   map[string]*TestStore
-	migrators map[migratorKey]*TestStore
+	// TmpDir is the base directory for the working directories of the test
+	// cases. If empty, each case uses t.TempDir.
+	TmpDir string
+
+	// Parallel runs the test cases in parallel. Setup is then called once for
+	// the whole run rather than per case, and each case prefixes its bucket
+	// names so that it does not share buckets with the others.
+	Parallel bool
+
+	buckets      map[string]*TestStore
+	migrators    map[migratorKey]*TestStore
+	bucketPrefix string
+}
+
+// bucketName returns the name of the bucket used by the test case for a
+// bucket named in the test data.
+func (test T) bucketName(name string) string {
+	return test.bucketPrefix + name
 }
 
 type fileData struct {
@@ -80,9 +94,29 @@ type operation struct {
 	MigrationSrc    string `yaml:"migrationSrc"`
 	MigrationTarget string `yaml:"migrationTarget"`
 
+	// ExpectError, if set, requires the operation to fail with an error
+	// containing it.
+	ExpectError string `yaml:"expectError"`
+
 	sealerOpener dcrypto.SealOpener
 }
 
+// checkOpError asserts that err is the outcome expected by the operation. It
+// reports whether the operation succeeded and should carry on.
+func checkOpError(t *testing.T, op operation, err error, msg string) bool {
+	t.Helper()
+
+	if op.ExpectError == "" {
+		require.NoError(t, err, msg)
+
+		return true
+	}
+
+	require.ErrorContains(t, err, op.ExpectError, "expected %s operation to fail", op.Action)
+
+	return false
+}
+
 type testCase struct {
 	Name       string
 	Operations []operation
@@ -97,19 +131,19 @@ type testMatrix struct {
 
 var key = make([]byte, 32)
 
-func createTmpDir(t *testing.T) (string, func()) {
-	// Get the working directory
-	wd, err := os.Getwd()
-	require.NoError(t, err, "failed to get working directory")
-
-	dir := filepath.Join(wd, uuid.NewString())
+// createTmpDir returns a fresh directory for a test case under base. If base
+// is empty, the directory is created by t.TempDir and removed by the testing
+// package when the test ends.
+func createTmpDir(t *testing.T, base string) (string, func()) {
+	if base == "" {
+		return t.TempDir(), func() {}
+	}
 
-	err = os.RemoveAll(dir)
-	assert.NoError(t, err, "failed to remove temporary directory")
+	err := os.MkdirAll(base, 0o755)
+	require.NoError(t, err, "failed to make temporary base directory")
 
-	// Remake the tmp directory
-	err = os.Mkdir(dir, 0o755)
-	assert.NoError(t, err, "failed to make temporary directory")
+	dir, err := os.MkdirTemp(base, "diskhop-test-")
+	require.NoError(t, err, "failed to make temporary directory")
 
 	return dir, func() { os.RemoveAll(dir) }
 }
@@ -175,7 +209,7 @@ func runPushOperation(t *testing.T, client *TestStore, op operation, dir string)
 		}
 
 		err = fp.Push(context.Background(), f, pushOpts...)
-		require.NoError(t, err, "failed to push encrypted file")
+		checkOpError(t, op, err, "failed to push encrypted file")
 
 		return
 	}
@@ -194,7 +228,9 @@ func runPushOperation(t *testing.T, client *TestStore, op operation, dir string)
 		filepath := filepath.Join(dir, pushArgs.name)
 
 		fileID, err := client.Pusher.Push(context.Background(), filepath, pushArgs.data, opts...)
-		require.NoError(t, err) // TODO: add to case to allow for expected errors
+		if !checkOpError(t, op, err, "failed to push file") {
+			return
+		}
 
 		// If a commiter is defined, then we should commit.
 		if client.Commiter != nil && pushArgs.sha != "" {
@@ -211,7 +247,7 @@ func runPushOperation(t *testing.T, client *TestStore, op operation, dir string)
 	}
 }
 
-func runPullOperation(t *testing.T, client *TestStore, op operation) {
+func runPullOperation(t *testing.T, client *TestStore, op operation, dir string) {
 	t.Helper()
 
 	options := []store.PullOption{}
@@ -220,6 +256,11 @@ func runPullOperation(t *testing.T, client *TestStore, op operation) {
 			switch key {
 			case "filter":
 				options = append(options, store.WithPullFilter(value.(string)))
+			case "names":
+				// Files are pushed by their path in the working directory.
+				for _, name := range value.([]any) {
+					options = append(options, store.WithPullNames(filepath.Join(dir, name.(string))))
+				}
 			}
 		}
 	}
@@ -231,7 +272,7 @@ func runPullOperation(t *testing.T, client *TestStore, op operation) {
 	fp := diskhop.NewFilePuller(client.Puller)
 
 	_, err := fp.Pull(context.Background(), options...)
-	require.NoError(t, err, "failed to pull file")
+	checkOpError(t, op, err, "failed to pull file")
 }
 
 type revertArgs struct {
@@ -273,7 +314,9 @@ func runRevertOperation(t *testing.T, client *TestStore, op operation) {
 
 	for _, sha := range args.shas {
 		err := client.Reverter.Revert(context.Background(), sha)
-		require.NoError(t, err, "failed to revert")
+		if !checkOpError(t, op, err, "failed to revert") {
+			return
+		}
 	}
 }
 
@@ -325,7 +368,8 @@ func runMigrateOperation(t *testing.T, test T, op operation, dir string) {
 
 	client, ok := test.migrators[key]
 	if !ok {
-		client = test.NewTestMigrator(t, context.Background(), op.MigrationSrc, op.MigrationTarget)
+		client = test.NewTestMigrator(t, context.Background(),
+			test.bucketName(op.MigrationSrc), test.bucketName(op.MigrationTarget))
 		test.migrators[key] = client
 
 		client.Setup(t)
@@ -361,7 +405,9 @@ func runMigrateOperation(t *testing.T, test T, op operation, dir string) {
 	}
 
 	_, err := client.Pusher.Push(context.Background(), fileName, file, opts...)
-	require.NoError(t, err, "failed to migrate file")
+	if !checkOpError(t, op, err, "failed to migrate file") {
+		return
+	}
 
 	dirL, err := os.Open(dir)
 	require.NoError(t, err, "failed to open directory")
@@ -384,22 +430,35 @@ func runMigrateOperation(t *testing.T, test T, op operation, dir string) {
 	}
 }
 
+// tracef logs the progress of a test case when tests run in verbose mode.
+func tracef(t *testing.T, format string, args ...any) {
+	t.Helper()
+
+	if testing.Verbose() {
+		t.Logf(format, args...)
+	}
+}
+
 func runTestCase(t *testing.T, test T, tc testCase) {
 	t.Helper()
 
 	test.buckets = make(map[string]*TestStore)
 	test.migrators = make(map[migratorKey]*TestStore)
 
-	test.Setup(t, context.Background())
+	if test.Parallel {
+		test.bucketPrefix = uuid.NewString()[:8] + "_"
+	} else {
+		test.Setup(t, context.Background())
+	}
 
 	const defaultBucketName = "primaryTestBucket"
 
 	// Remove old tmp dir and create a new one.
-	dir, tmpTeardown := createTmpDir(t)
+	dir, tmpTeardown := createTmpDir(t, test.TmpDir)
 	defer tmpTeardown()
 
 	// Run the operations
-	for _, op := range tc.Operations {
+	for i, op := range tc.Operations {
 		if op.Cipher == "" {
 			op.Cipher = tc.Cipher
 		}
@@ -411,7 +470,7 @@ func runTestCase(t *testing.T, test T, tc testCase) {
 
 		client, ok := test.buckets[bucket]
 		if !ok {
-			client = test.NewTestStore(t, context.Background(), bucket)
+			client = test.NewTestStore(t, context.Background(), test.bucketName(bucket))
 			test.buckets[bucket] = client
 
 			client.Setup(t)
@@ -425,11 +484,13 @@ func runTestCase(t *testing.T, test T, tc testCase) {
 			t.Fatalf("unknown cipher: %s", op.Cipher)
 		}
 
+		tracef(t, "operation %d: %s on bucket %q (cipher %q, %d args)", i, op.Action, bucket, op.Cipher, len(op.Args))
+
 		switch op.Action {
 		case "push":
 			runPushOperation(t, client, op, dir)
 		case "pull":
-			runPullOperation(t, client, op)
+			runPullOperation(t, client, op, dir)
 		case "revert":
 			runRevertOperation(t, client, op)
 		case "migrate":
@@ -475,6 +536,8 @@ func runTestCase(t *testing.T, test T, tc testCase) {
 		file.Close()
 	}
 
+	tracef(t, "found %d files after %d operations", len(got), len(tc.Operations))
+
 	assert.ElementsMatch(t, tc.Want, got)
 
 	for _, client := range test.buckets {
@@ -501,6 +564,10 @@ func runTestMatrix(t *testing.T, test T, file os.DirEntry) {
 
 	for _, tc := range testMatrix.Cases {
 		t.Run(tc.Name, func(t *testing.T) {
+			if test.Parallel {
+				t.Parallel()
+			}
+
 			if tc.Cipher == "" {
 				tc.Cipher = testMatrix.Cipher
 			}
@@ -516,6 +583,11 @@ func Run(t *testing.T, test T) {
 	files, err := os.ReadDir(test.Dir)
 	require.NoError(t, err, "failed to read test data")
 
+	// Shared setup must not race with the cases, so it runs once up front.
+	if test.Parallel {
+		test.Setup(t, context.Background())
+	}
+
 	// Iterate through the entries of the directory
 	for _, file := range files {
 		if file.IsDir() {
@@ -523,6 +595,10 @@ func Run(t *testing.T, test T) {
 		}
 
 		t.Run(file.Name(), func(t *testing.T) {
+			if test.Parallel {
+				t.Parallel()
+			}
+
 			runTestMatrix(t, test, file)
 		})
 	}
@@ -15,21 +15,76 @@
 package diskhop
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 
-	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/prestonvasquez/diskhop/internal/streamutil"
 	"github.com/prestonvasquez/diskhop/store"
 )
 
 type FilePuller struct {
 	p store.Puller
 
+	// Output, if set, receives the contents of the pulled documents instead
+	// of local files.
+	Output io.Writer
+
+	// StrictTags makes a failure to set the tags of a file fatal. Otherwise
+	// the failure is reported to OnTagError and the file is kept untagged.
+	StrictTags bool
+	OnTagError TagErrorHandler
+
+	// TagColors gives the tags in it a macOS Finder color when the pulled
+	// files are tagged. See ParseTagColors.
+	TagColors map[string]int
+
+	// NoRepeat, if set, leaves the files pulled before under the same key out
+	// of the sample until every matching file has been pulled, so that
+	// repeated pulls work through the remote without overlap. The key is
+	// usually the branch.
+	NoRepeat string
+
+	// TagMerge, if set, is the policy that merges the remote tags of a file
+	// pulled again with the tags it had locally when a pull cleaned it, as
+	// recorded in the tag cache. See SnapshotTags and TagCacheName.
+	TagMerge string
+
+	// Tracker, if set, is told the number of bytes written as the pulled
+	// files are written.
+	Tracker ProgressTracker
+
+	// NameTransformer, if set, is applied to the base name of each pulled
+	// file before it is written, such as to reverse the transformation of a
+	// FilePusher. Masked names are left as they are, and the file is still
+	// recorded as pulled under its stored name.
+	NameTransformer func(name string) string
+
+	// ContentAddressed writes each pulled file under a path named by the
+	// SHA-256 of its contents, sharded as ab/cd/abcd..., rather than under its
+	// name. The names and tags of the files are written to the manifest. See
+	// ContentPath and ManifestName.
+	ContentAddressed bool
+
+	// PostPull, if set, is called with each file written by a pull, before
+	// it is tagged. See FileHook.
+	PostPull FileHook
+
+	// Dir is the directory that the pulled files, and the state of the
+	// repository such as the tag cache, are written to. Files whose remote
+	// names are absolute paths are written to those. If empty, the working
+	// directory is used.
+	Dir string
+
 	progressCh chan struct{} // progressCh is the progress of the push.
 	totalCh    chan int      // totalCh is the total progress of the push.
+	sizeCh     chan int64    // sizeCh is the total bytes of the push.
 }
 
 func NewFilePuller(p store.Puller) *FilePuller {
@@ -37,10 +92,46 @@ func NewFilePuller(p store.Puller) *FilePuller {
 		p:          p,
 		progressCh: make(chan struct{}),
 		totalCh:    make(chan int, 1),
+		sizeCh:     make(chan int64, 1),
 	}
 }
 
-func (fp *FilePuller) Pull(ctx context.Context, opts ...store.PullOption) (*store.PullDescription, error) {
+func (fp *FilePuller) Pull(ctx context.Context, opts ...store.PullOption) (_ *store.PullDescription, err error) {
+	mergedOpts := store.PullOptions{}
+	for _, opt := range opts {
+		opt(&mergedOpts)
+	}
+
+	if fp.NoRepeat != "" {
+		if mergedOpts.SealOpenerForMetadata() == nil {
+			return nil, fmt.Errorf("pulling without repetition requires encryption")
+		}
+
+		state, err := readSeenState(ctx, fp.dir(), mergedOpts.SealOpenerForMetadata())
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, store.WithPullExclude(state[fp.NoRepeat]...))
+	}
+
+	var cache tagCache
+	if fp.TagMerge != "" {
+		if mergedOpts.SealOpenerForMetadata() == nil {
+			return nil, fmt.Errorf("keeping local tags requires encryption")
+		}
+
+		if cache, err = readTagCache(ctx, fp.dir(), mergedOpts.SealOpenerForMetadata()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Streamed files interrupted by an earlier pull resume from the bytes
+	// already written to their partial files.
+	if fp.Output == nil && !fp.ContentAddressed {
+		opts = append(opts, store.WithPullResume(fp.partialSize))
+	}
+
 	buf := store.NewDocumentBuffer()
 	defer buf.Close()
 
@@ -49,49 +140,374 @@ func (fp *FilePuller) Pull(ctx context.Context, opts ...store.PullOption) (*stor
 		return nil, err
 	}
 
-	mergedOpts := store.PullOptions{}
-	for _, opt := range opts {
-		opt(&mergedOpts)
-	}
-
 	if mergedOpts.DescribeOnly {
 		return desc, nil
 	}
 
-	fp.totalCh <- desc.Count
+	// Masked names are recorded so that the files can be unmasked later, even
+	// if the pull fails part way through.
+	masks := maskMap{}
+	defer func() {
+		if len(masks) == 0 {
+			return
+		}
+
+		if recErr := recordMasks(ctx, fp.dir(), mergedOpts.SealOpenerForMetadata(), masks); recErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to record masked names: %w", recErr))
+		}
+	}()
+
+	// Pulled names are recorded even if the pull fails part way through, since
+	// the files that were written have been seen.
+	pulled := []string{}
+	defer func() {
+		if fp.NoRepeat == "" || len(pulled) == 0 {
+			return
+		}
+
+		if recErr := recordSeen(ctx, fp.dir(), mergedOpts.SealOpenerForMetadata(), fp.NoRepeat, pulled); recErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to record pulled names: %w", recErr))
+		}
+	}()
+
+	// The local tags of the files pulled again are dropped from the cache,
+	// since the files now carry them.
+	cacheLen := len(cache)
+	defer func() {
+		if len(cache) == cacheLen {
+			return
+		}
+
+		if cacheErr := writeTagCache(ctx, fp.dir(), mergedOpts.SealOpenerForMetadata(), cache); cacheErr != nil {
+			err = errors.Join(err, cacheErr)
+		}
+	}()
+
+	// The progress channel is replaced before the totals are sent, so that a
+	// receiver of the totals sees the new channel.
 	fp.progressCh = make(chan struct{}, desc.Count)
+	fp.totalCh <- desc.Count
+	fp.sizeCh <- desc.Size
 
 	defer close(fp.totalCh)
+	defer close(fp.sizeCh)
 	defer close(fp.progressCh)
 
+	observer := store.Observe(mergedOpts.Observer)
+
+	var (
+		files   int
+		written int64
+	)
+
 	for {
 		doc, err := buf.Next()
 		if errors.Is(err, io.EOF) {
 			break
 		}
 
-		file, err := os.Create(doc.Filename)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create file: %w", err)
+			return nil, err
+		}
+
+		if fp.Output != nil {
+			n, err := writeDocument(fp.Output, doc, fp.streams())
+			if err != nil {
+				err = fmt.Errorf("failed to write document: %w", err)
+				observer.OnError(realName(doc), err)
+
+				return nil, err
+			}
+
+			observer.OnFileDone(realName(doc), n)
+			files, written = files+1, written+n
+
+			pulled = append(pulled, realName(doc))
+			fp.progressCh <- struct{}{}
+
+			continue
+		}
+
+		if fp.ContentAddressed {
+			n, err := fp.writeContentAddressed(fp.dir(), doc)
+			if err != nil {
+				observer.OnError(realName(doc), err)
+
+				return nil, err
+			}
+
+			observer.OnFileDone(realName(doc), n)
+			files, written = files+1, written+n
+
+			pulled = append(pulled, realName(doc))
+			fp.progressCh <- struct{}{}
+
+			continue
 		}
 
-		if _, err := file.Write(doc.Data); err != nil {
-			return nil, fmt.Errorf("failed to write file: %w", err)
+		localName := doc.Filename
+		if doc.RealName == "" {
+			localName = transformName(localName, fp.NameTransformer)
 		}
 
-		if tags := doc.Metadata.Tags; len(tags) > 0 {
-			if err := osutil.SetTags(file, tags...); err != nil {
-				return nil, fmt.Errorf("failed to set tags: %w", err)
+		var (
+			file *os.File
+			n    int64
+		)
+
+		if doc.Body != nil {
+			file, n, err = fp.writePartial(fp.path(localName), doc)
+		} else {
+			file, n, err = fp.writeFile(fp.path(localName), doc)
+		}
+
+		if err != nil {
+			observer.OnError(realName(doc), err)
+
+			return nil, err
+		}
+
+		if fp.PostPull != nil {
+			// A skipped file is closed and deleted by the hook.
+			err := runPostPull(ctx, fp.PostPull, file)
+			if errors.Is(err, ErrSkipFile) {
+				observer.OnFileDone(realName(doc), 0)
+				fp.progressCh <- struct{}{}
+
+				continue
 			}
+
+			if err != nil {
+				_ = file.Close()
+
+				observer.OnError(realName(doc), err)
+
+				return nil, err
+			}
+		}
+
+		if doc.RealName != "" {
+			masks[doc.Filename] = doc.RealName
+		}
+
+		pulled = append(pulled, realName(doc))
+
+		tags := doc.Metadata.Tags
+		if local, ok := cache[localName]; ok {
+			tags = mergeTags(fp.TagMerge, tags, local)
+			delete(cache, localName)
 		}
 
+		if len(tags) > 0 {
+			if err := fp.tagPolicy().handle(file.Name(), setTagsOrSidecar(file, fp.TagColors, tags...)); err != nil {
+				_ = file.Close()
+
+				err = fmt.Errorf("failed to set tags: %w", err)
+				observer.OnError(realName(doc), err)
+
+				return nil, err
+			}
+		}
+
+		if err := file.Close(); err != nil {
+			err = fmt.Errorf("failed to close file: %w", err)
+			observer.OnError(realName(doc), err)
+
+			return nil, err
+		}
+
+		observer.OnFileDone(realName(doc), n)
+		files, written = files+1, written+n
+
 		// Do something with the document.
 		fp.progressCh <- struct{}{}
 	}
 
+	observer.OnBatchDone(files, written)
+
 	return desc, nil
 }
 
+// realName returns the name of the document on the remote host.
+func realName(doc *store.Document) string {
+	if doc.RealName != "" {
+		return doc.RealName
+	}
+
+	return doc.Filename
+}
+
+// writeDocument writes the contents of the document to w through the
+// middlewares of b, streaming them if the document is too large to have been
+// buffered, and returns the number of bytes written.
+func writeDocument(w io.Writer, doc *store.Document, b *streamutil.Builder) (int64, error) {
+	if doc.Body == nil {
+		return b.Copy(w, bytes.NewReader(doc.Data))
+	}
+
+	defer doc.Body.Close()
+
+	return b.Copy(w, doc.Body)
+}
+
+// writeFile writes the contents of the document to the file with the name,
+// returning the file and the number of bytes written. The caller closes the
+// file.
+func (fp *FilePuller) writeFile(name string, doc *store.Document) (*os.File, int64, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	n, err := writeDocument(file, doc, fp.streams())
+	if err != nil {
+		_ = file.Close()
+
+		return nil, 0, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return file, n, nil
+}
+
+// partialExt is the extension of the hidden files that pulled files are
+// written to until they are complete.
+const partialExt = ".partial"
+
+// partialName returns the name of the hidden file that a streamed file with
+// the name is written to until it is complete.
+func partialName(name string) string {
+	dir, base := filepath.Split(name)
+
+	return filepath.Join(dir, "."+base+partialExt)
+}
+
+// partialSize returns the number of bytes written to the partial file of the
+// remote file with the name, or zero if there is none.
+func (fp *FilePuller) partialSize(name string) int64 {
+	info, err := os.Stat(partialName(fp.path(transformName(name, fp.NameTransformer))))
+	if err != nil {
+		return 0
+	}
+
+	return info.Size()
+}
+
+// writePartial writes the streamed contents of the document to the partial
+// file of the file with the name, appending to the bytes already written if
+// the download was resumed, and returns the file and the number of bytes
+// written by this pull, which the caller closes. The complete file is checked
+// against the hash of the document before it is moved into place, since a
+// resumed download trusts that the bytes already written are those of the
+// same file.
+func (fp *FilePuller) writePartial(name string, doc *store.Document) (*os.File, int64, error) {
+	partial := partialName(name)
+
+	flag := os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	if doc.Offset > 0 {
+		flag = os.O_RDWR
+	}
+
+	file, err := os.OpenFile(partial, flag, 0o644)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	// Anything written past the offset, such as a part of a chunk that failed
+	// to decrypt, is discarded.
+	if doc.Offset > 0 {
+		if err := file.Truncate(doc.Offset); err != nil {
+			return nil, 0, fmt.Errorf("failed to truncate partial file: %w", err)
+		}
+
+		if _, err := file.Seek(doc.Offset, io.SeekStart); err != nil {
+			return nil, 0, fmt.Errorf("failed to seek partial file: %w", err)
+		}
+	}
+
+	n, err := writeDocument(file, doc, fp.streams())
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if want := doc.Metadata.SHA256; want != "" {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, fmt.Errorf("failed to seek partial file: %w", err)
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(h, file); err != nil {
+			return nil, 0, fmt.Errorf("failed to hash file: %w", err)
+		}
+
+		if got := hex.EncodeToString(h.Sum(nil)); got != want {
+			err := fmt.Errorf("hash mismatch for %s: expected %s, got %s", name, want, got)
+
+			// The partial file holds plaintext, so it is deleted securely,
+			// once it is closed.
+			_ = file.Close()
+
+			if delErr := secureDeleteWithRetry(partial); delErr != nil {
+				err = errors.Join(err, fmt.Errorf("failed to securely delete partial file: %w", delErr))
+			}
+
+			return nil, 0, err
+		}
+	}
+
+	// A write that failed may only be reported when the file is closed, so
+	// the partial file is only moved into place once it is.
+	if err := file.Close(); err != nil {
+		return nil, 0, fmt.Errorf("failed to close partial file: %w", err)
+	}
+
+	if err := os.Rename(partial, name); err != nil {
+		return nil, 0, fmt.Errorf("failed to move partial file: %w", err)
+	}
+
+	complete, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return complete, n, nil
+}
+
+// dir returns the directory that the pulled files are written to.
+func (fp *FilePuller) dir() string {
+	if fp.Dir == "" {
+		return "."
+	}
+
+	return fp.Dir
+}
+
+// path returns the path that the pulled file with the local name is written
+// to.
+func (fp *FilePuller) path(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+
+	return filepath.Join(fp.dir(), name)
+}
+
+// streams returns the middlewares applied to the pulled files, reporting the
+// bytes written to the tracker if one is set.
+func (fp *FilePuller) streams() *streamutil.Builder {
+	b := streamutil.NewBuilder()
+	if fp.Tracker != nil {
+		b.Progress(fp.Tracker.Add)
+	}
+
+	return b
+}
+
+func (fp *FilePuller) tagPolicy() tagPolicy {
+	return tagPolicy{strict: fp.StrictTags, onError: fp.OnTagError}
+}
+
 func (fp *FilePuller) Progress() <-chan struct{} {
 	return fp.progressCh
 }
@@ -99,3 +515,9 @@ func (fp *FilePuller) Progress() <-chan struct{} {
 func (fp *FilePuller) Total() <-chan int {
 	return fp.totalCh
 }
+
+// TotalSize returns a channel that receives the number of bytes selected by
+// the pull.
+func (fp *FilePuller) TotalSize() <-chan int64 {
+	return fp.sizeCh
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePullerWritePartial(t *testing.T) {
+	t.Parallel()
+
+	data := strings.Repeat("diskhop", 100)
+	sum := sha256.Sum256([]byte(data))
+
+	newDoc := func(body string, offset int64, hash string) *store.Document {
+		return &store.Document{
+			Metadata: store.Metadata{SHA256: hash},
+			Body:     io.NopCloser(strings.NewReader(body)),
+			Offset:   offset,
+		}
+	}
+
+	t.Run("resumes from the offset", func(t *testing.T) {
+		t.Parallel()
+
+		name := filepath.Join(t.TempDir(), "large.bin")
+
+		// The partial file holds more than the offset, as if the last write
+		// before the interruption was cut short.
+		require.NoError(t, os.WriteFile(partialName(name), []byte(data[:300]+"garbage"), 0o600))
+
+		fp := NewFilePuller(nil)
+
+		file, n, err := fp.writePartial(name, newDoc(data[300:], 300, hex.EncodeToString(sum[:])))
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		assert.Equal(t, int64(len(data)-300), n)
+
+		got, err := os.ReadFile(name)
+		require.NoError(t, err)
+
+		assert.Equal(t, data, string(got))
+		assert.NoFileExists(t, partialName(name))
+	})
+
+	t.Run("removes a file that does not match the hash", func(t *testing.T) {
+		t.Parallel()
+
+		name := filepath.Join(t.TempDir(), "large.bin")
+
+		require.NoError(t, os.WriteFile(partialName(name), []byte(strings.Repeat("x", 300)), 0o600))
+
+		fp := NewFilePuller(nil)
+
+		_, _, err := fp.writePartial(name, newDoc(data[300:], 300, hex.EncodeToString(sum[:])))
+		assert.ErrorContains(t, err, "hash mismatch")
+
+		assert.NoFileExists(t, name)
+		assert.NoFileExists(t, partialName(name))
+	})
+}
+
+func TestFilePullerPartialSize(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(partialName(filepath.Join(dir, "photo.jpg")), []byte("data"), 0o600))
+
+	fp := NewFilePuller(nil)
+	fp.NameTransformer = strings.ToLower
+
+	assert.Equal(t, int64(4), fp.partialSize(filepath.Join(dir, "Photo.JPG")))
+	assert.Zero(t, fp.partialSize(filepath.Join(dir, "other.jpg")))
+}
+
+func TestFilePullerPath(t *testing.T) {
+	t.Parallel()
+
+	fp := NewFilePuller(nil)
+	assert.Equal(t, "photo.jpg", fp.path("photo.jpg"))
+
+	fp.Dir = "/repo"
+	assert.Equal(t, "/repo/photo.jpg", fp.path("photo.jpg"))
+	assert.Equal(t, "/other/photo.jpg", fp.path("/other/photo.jpg"))
+}
+
+// isOpen reports whether the process holds the file at path open, or skips
+// the test where open files cannot be listed.
+func isOpen(t *testing.T, path string) bool {
+	t.Helper()
+
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files cannot be listed")
+	}
+
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && target == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestFilePullerWriteFileClosesOnError(t *testing.T) {
+	t.Parallel()
+
+	name := filepath.Join(t.TempDir(), "photo.jpg")
+
+	doc := &store.Document{
+		Filename: "photo.jpg",
+		Body:     io.NopCloser(iotest.ErrReader(errors.New("connection reset"))),
+	}
+
+	_, _, err := NewFilePuller(nil).writeFile(name, doc)
+	assert.ErrorContains(t, err, "connection reset")
+
+	assert.False(t, isOpen(t, name), "the file is closed")
+}
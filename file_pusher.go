@@ -16,10 +16,16 @@ package diskhop
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/google/uuid"
+	"github.com/prestonvasquez/diskhop/internal/osutil"
 	"github.com/prestonvasquez/diskhop/store"
 )
 
@@ -28,6 +34,58 @@ type FilePusher struct {
 	p store.Pusher
 
 	ProgressTracker ProgressTracker
+
+	// ConfirmClean is called with the number of local files that will be
+	// securely deleted after the push. If it returns false, the local files are
+	// left in place. A nil ConfirmClean always cleans.
+	ConfirmClean func(n int) bool
+
+	// StrictTags makes a failure to read the tags of a file fatal. Otherwise
+	// the failure is reported to OnTagError and the file is pushed untagged.
+	StrictTags bool
+	OnTagError TagErrorHandler
+
+	// OnCleanError is called if the local files cannot be securely deleted
+	// after a successful push. If nil, the failure is returned by Push.
+	OnCleanError func(err error)
+
+	// Batch is recorded, along with BatchLabel, in the metadata of the files
+	// written by a Push, so that they can be pulled as a group with the
+	// batch() filter. If empty, each Push generates its own ID.
+	Batch      string
+	BatchLabel string
+
+	// GroupCommits records the files written by a Push as one commit, so that
+	// they are logged and reverted as a unit, rather than one commit each.
+	GroupCommits bool
+
+	// Message is recorded with the commit of each pushed file. If empty,
+	// the commits are recorded as "push".
+	Message string
+
+	// Amend is the SHA of a commit that the files written by a Push are
+	// folded into, rather than recorded as commits of their own. Its message
+	// is replaced by Message if that is set.
+	Amend string
+
+	// NameTransformer, if set, is applied to the base name of each file
+	// before it is pushed, such as to normalize names. The transformed name
+	// is the one stored, indexed and matched by filters.
+	NameTransformer func(name string) string
+
+	// PrePush, if set, is called with each file before it is pushed. See
+	// FileHook.
+	PrePush FileHook
+
+	// AutoTagger, if set, derives tags from the contents of each file, such
+	// as ExifTags, which are added to the tags of the file. A failure is
+	// handled like a failure to read the tags of the file.
+	AutoTagger AutoTagger
+}
+
+// NewBatchID returns a new ID for the files written by one push.
+func NewBatchID() string {
+	return uuid.NewString()
 }
 
 // NewFilePusher creates a new file pusher.
@@ -36,7 +94,11 @@ func NewFilePusher(p store.Pusher) *FilePusher {
 }
 
 func (fp *FilePusher) PushFromInfo(ctx context.Context, fi os.FileInfo, opts ...store.PushOption) (string, error) {
-	filePath, err := filepath.Abs(fi.Name())
+	return fp.pushFromPath(ctx, fi.Name(), opts...)
+}
+
+func (fp *FilePusher) pushFromPath(ctx context.Context, name string, opts ...store.PushOption) (string, error) {
+	filePath, err := filepath.Abs(name)
 	if err != nil {
 		return "", fmt.Errorf("failed to get absolute path: %w", err)
 	}
@@ -51,6 +113,12 @@ func (fp *FilePusher) PushFromInfo(ctx context.Context, fi os.FileInfo, opts ...
 		return "", nil
 	}
 
+	if fp.PrePush != nil {
+		if err := runPrePush(ctx, fp.PrePush, filepath.Clean(filePath)); err != nil {
+			return "", err
+		}
+	}
+
 	// Open the file
 	file, err := os.Open(filepath.Clean(filePath))
 	if err != nil {
@@ -59,12 +127,23 @@ func (fp *FilePusher) PushFromInfo(ctx context.Context, fi os.FileInfo, opts ...
 
 	defer file.Close()
 
-	tags, err := GetTags(file)
-	if err != nil {
+	tags, err := getTagsOrSidecar(file)
+	if err := fp.tagPolicy().handle(file.Name(), err); err != nil {
 		return "", fmt.Errorf("failed to get tags for file: %w", err)
 	}
 
-	fileID, err := fp.p.Push(ctx, file.Name(), file, append(opts, store.WithPushTags(tags...))...)
+	if fp.AutoTagger != nil {
+		derived, err := autoTag(file, fp.AutoTagger)
+		if err := fp.tagPolicy().handle(file.Name(), err); err != nil {
+			return "", fmt.Errorf("failed to derive tags for file: %w", err)
+		}
+
+		tags = mergeTags(TagMergeUnion, tags, derived)
+	}
+
+	storedName := transformName(file.Name(), fp.NameTransformer)
+
+	fileID, err := fp.p.Push(ctx, storedName, file, append(opts, store.WithPushTags(tags...))...)
 	if err != nil {
 		return "", fmt.Errorf("failed to push file from path: %w", err)
 	}
@@ -72,15 +151,136 @@ func (fp *FilePusher) PushFromInfo(ctx context.Context, fi os.FileInfo, opts ...
 	return fileID, nil
 }
 
-// Push will push the files in the directory to the store.
-func (fp *FilePusher) Push(ctx context.Context, f *os.File, opts ...store.PushOption) error {
+// verify confirms that the file with the ID holds the contents of the local
+// file at path, which are read again so that a file changed since its upload
+// is not confirmed.
+func (fp *FilePusher) verify(ctx context.Context, verifier store.Verifier, id, path string, opts []store.PushOption) error {
+	want, err := digestFile(path)
+	if err != nil {
+		return err
+	}
+
+	return verifier.VerifyPush(ctx, id, want, opts...)
+}
+
+// digestFile returns the size and hash of the file at path.
+func digestFile(path string) (store.Digest, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return store.Digest{}, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	defer file.Close()
+
+	h := sha256.New()
+
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return store.Digest{}, fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	return store.Digest{Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// transformName applies transform to the base name of name, leaving the
+// directory as it is.
+func transformName(name string, transform func(string) string) string {
+	if transform == nil {
+		return name
+	}
+
+	dir, base := filepath.Split(name)
+
+	return dir + transform(base)
+}
+
+// message returns the message recorded with the commits of the push.
+func (fp *FilePusher) message() string {
+	if fp.Message == "" {
+		return "push"
+	}
+
+	return fp.Message
+}
+
+// addProgress adds a file to the progress tracker, if one is set.
+func (fp *FilePusher) addProgress() error {
+	if fp.ProgressTracker == nil {
+		return nil
+	}
+
+	if err := fp.ProgressTracker.Add(1); err != nil {
+		return fmt.Errorf("failed to add to progress tracker: %w", err)
+	}
+
+	return nil
+}
+
+func (fp *FilePusher) tagPolicy() tagPolicy {
+	return tagPolicy{strict: fp.StrictTags, onError: fp.OnTagError}
+}
+
+// Push will push the files in the directory to the store, moving them: the
+// local files are securely deleted once they are stored remotely. The steps
+// are ordered so that a crash at any point leaves every file either in the
+// directory or stored durably, and never neither:
+//
+//  1. Each file is uploaded, along with its name and tags.
+//  2. If the store is a store.Verifier, the file is read back until the store
+//     confirms that it is durable, such as once a majority of a replica set
+//     holds it, and that it holds the size and hash of the local file. A file
+//     that cannot be confirmed fails the push.
+//  3. Only once every file is pushed and confirmed, and the commits of the
+//     push are recorded, are the confirmed files, and their sidecars,
+//     cleaned. Files skipped by PrePush are never cleaned, and files pushed
+//     by a store that returned no ID to verify them by are only cleaned if the
+//     store is not a store.Verifier.
+//
+// A push interrupted before the clean leaves the local files in place, and
+// pushing them again replaces the copies already stored.
+func (fp *FilePusher) Push(ctx context.Context, f *os.File, opts ...store.PushOption) (err error) {
 	commiter, ok := fp.p.(store.Commiter)
-	if ok {
-		defer flushCommits(ctx, commiter)
+
+	var amender store.CommitAmender
+	if ok && fp.Amend != "" {
+		if amender, ok = fp.p.(store.CommitAmender); !ok {
+			return fmt.Errorf("store does not support amend")
+		}
 	}
 
+	// The commits are recorded once, before any local file is cleaned, or
+	// when the push returns without cleaning.
+	committed := false
+	recordCommits := func() error {
+		if committed {
+			return nil
+		}
+
+		committed = true
+
+		if amender != nil {
+			if err := amender.AmendCommits(ctx, fp.Amend, fp.Message); err != nil {
+				return fmt.Errorf("failed to amend commit: %w", err)
+			}
+
+			return nil
+		}
+
+		if err := flushCommits(ctx, commiter); err != nil {
+			return fmt.Errorf("failed to flush commits: %w", err)
+		}
+
+		return nil
+	}
+
+	defer func() {
+		if commitErr := recordCommits(); commitErr != nil {
+			err = errors.Join(err, commitErr)
+		}
+	}()
+
 	// Get the files in the directory.
-	f, err := os.Open(f.Name())
+	f, err = os.Open(f.Name())
 	if err != nil {
 		return fmt.Errorf("failed to open directory: %w", err)
 	}
@@ -97,32 +297,142 @@ func (fp *FilePusher) Push(ctx context.Context, f *os.File, opts ...store.PushOp
 		return nil
 	}
 
+	// Only the files that were pushed, and confirmed durable if the store
+	// can verify them, are cleaned.
+	confirmed := map[string]bool{}
+	verifier, verify := fp.p.(store.Verifier)
+
 	defer func() {
-		if err := Clean(entities); err != nil {
-			panic(err)
+		if commitErr := recordCommits(); commitErr != nil {
+			err = errors.Join(err, commitErr)
+		}
+
+		// Only delete the local files once all of them have been pushed and
+		// committed.
+		if err != nil {
+			return
 		}
+
+		cleaned := onlyConfirmed(entities, confirmed)
+
+		if fp.ConfirmClean != nil && !fp.ConfirmClean(countVisible(cleaned)) {
+			return
+		}
+
+		cleanErr := CleanDir(f.Name(), cleaned)
+		if cleanErr == nil {
+			return
+		}
+
+		if fp.OnCleanError != nil {
+			fp.OnCleanError(cleanErr)
+
+			return
+		}
+
+		err = fmt.Errorf("pushed files but failed to clean: %w", cleanErr)
 	}()
 
+	// The files of a grouped push are committed even if it fails part way
+	// through, so that the files it wrote can be reverted.
+	var grouped []string
+	if fp.GroupCommits {
+		defer func() { commitGroup(ctx, commiter, fp.message(), grouped) }()
+	}
+
+	batch := fp.Batch
+	if batch == "" {
+		batch = NewBatchID()
+	}
+
+	opts = append(opts, store.WithPushBatch(batch, fp.BatchLabel))
+
+	mergedOpts := store.PushOptions{}
+	for _, fn := range opts {
+		fn(&mergedOpts)
+	}
+
+	observer := store.Observe(mergedOpts.Observer)
+
+	var (
+		files  int
+		pushed int64
+	)
+
+	names := make(map[string]bool, len(entities))
+	for _, entry := range entities {
+		names[entry.Name()] = true
+	}
+
 	for _, entry := range entities {
 		if entry.IsDir() {
 			continue
 		}
 
-		fileID, err := fp.PushFromInfo(ctx, entry, opts...)
+		// Sidecars are pushed as the tags of their companion file.
+		if osutil.IsSidecar(entry.Name(), names) {
+			continue
+		}
+
+		// Hidden files are skipped by pushFromPath.
+		visible := entry.Name()[0] != '.'
+		storedName := transformName(entry.Name(), fp.NameTransformer)
+
+		if visible {
+			observer.OnFileStart(storedName)
+		}
+
+		fileID, err := fp.pushFromPath(ctx, filepath.Join(f.Name(), entry.Name()), opts...)
+		if errors.Is(err, ErrSkipFile) {
+			observer.OnFileDone(storedName, 0)
+
+			if err := fp.addProgress(); err != nil {
+				return err
+			}
+
+			continue
+		}
+
 		if err != nil {
-			return fmt.Errorf("failed to push file: %w", err)
+			err = fmt.Errorf("failed to push file: %w", err)
+			observer.OnError(storedName, err)
+
+			return err
 		}
 
-		if commiter != nil {
-			commit(ctx, commiter, "push", fileID)
+		switch {
+		case verify && fileID != "":
+			if err := fp.verify(ctx, verifier, fileID, filepath.Join(f.Name(), entry.Name()), opts); err != nil {
+				err = fmt.Errorf("failed to confirm push: %w", err)
+				observer.OnError(storedName, err)
+
+				return err
+			}
+
+			confirmed[entry.Name()] = true
+		case !verify:
+			confirmed[entry.Name()] = true
+		}
+
+		if visible {
+			observer.OnFileDone(storedName, entry.Size())
+			files, pushed = files+1, pushed+entry.Size()
 		}
 
-		if fp.ProgressTracker != nil {
-			if err := fp.ProgressTracker.Add(1); err != nil {
-				return fmt.Errorf("failed to add to progress tracker: %w", err)
+		if fp.GroupCommits {
+			if fileID != "" {
+				grouped = append(grouped, fileID)
 			}
+		} else if commiter != nil {
+			commit(ctx, commiter, fp.message(), fileID)
+		}
+
+		if err := fp.addProgress(); err != nil {
+			return err
 		}
 	}
 
+	observer.OnBatchDone(files, pushed)
+
 	return nil
 }
@@ -0,0 +1,322 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// namePusher records the names of the pushed files.
+type namePusher struct {
+	names []string
+}
+
+func (p *namePusher) Push(_ context.Context, name string, _ io.ReadSeeker, _ ...store.PushOption) (string, error) {
+	p.names = append(p.names, name)
+
+	return "", nil
+}
+
+func TestFilePusherNameTransformer(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "My Photo.JPG"), []byte("data"), 0o600))
+
+	pusher := &namePusher{}
+
+	fp := NewFilePusher(pusher)
+	fp.ConfirmClean = func(int) bool { return false }
+	fp.OnTagError = func(string, error) {}
+	fp.NameTransformer = func(name string) string {
+		return strings.ToLower(strings.ReplaceAll(name, " ", ""))
+	}
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	require.NoError(t, fp.Push(context.Background(), f))
+	assert.Equal(t, []string{filepath.Join(dir, "myphoto.jpg")}, pusher.names)
+}
+
+// eventObserver records the events it is told of.
+type eventObserver struct {
+	store.NopObserver
+
+	events []string
+}
+
+func (o *eventObserver) OnFileStart(name string) {
+	o.events = append(o.events, "start "+name)
+}
+
+func (o *eventObserver) OnFileDone(name string, bytes int64) {
+	o.events = append(o.events, fmt.Sprintf("done %s %d", name, bytes))
+}
+
+func (o *eventObserver) OnBatchDone(files int, bytes int64) {
+	o.events = append(o.events, fmt.Sprintf("batch %d %d", files, bytes))
+}
+
+func TestFilePusherObserver(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "photo.jpg"), []byte("data"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("data"), 0o600))
+
+	fp := NewFilePusher(&namePusher{})
+	fp.ConfirmClean = func(int) bool { return false }
+	fp.OnTagError = func(string, error) {}
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	observer := &eventObserver{}
+
+	require.NoError(t, fp.Push(context.Background(), f, store.WithPushObserver(observer)))
+	assert.Equal(t, []string{"start photo.jpg", "done photo.jpg 4", "batch 1 4"}, observer.events)
+}
+
+// commitPusher names each pushed file after itself and records the commits
+// added for them, failing to flush them with flushErr.
+type commitPusher struct {
+	namePusher
+
+	commits  []*store.Commit
+	flushErr error
+}
+
+func (p *commitPusher) Push(ctx context.Context, name string, r io.ReadSeeker, opts ...store.PushOption) (string, error) {
+	_, err := p.namePusher.Push(ctx, name, r, opts...)
+
+	return filepath.Base(name), err
+}
+
+func (p *commitPusher) AddCommit(_ context.Context, commit *store.Commit) {
+	p.commits = append(p.commits, commit)
+}
+
+func (p *commitPusher) FlushCommits(context.Context) error {
+	return p.flushErr
+}
+
+func TestFilePusherFlushError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("data"), 0o600))
+
+	fp := NewFilePusher(&commitPusher{flushErr: errors.New("primary stepped down")})
+	fp.OnTagError = func(string, error) {}
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	err = fp.Push(context.Background(), f)
+	assert.ErrorContains(t, err, "primary stepped down")
+
+	// The file is kept, since its commit was not recorded.
+	assert.FileExists(t, filepath.Join(dir, "a.jpg"))
+}
+
+func TestFilePusherGroupCommits(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o600))
+	}
+
+	pusher := &commitPusher{}
+
+	fp := NewFilePusher(pusher)
+	fp.ConfirmClean = func(int) bool { return false }
+	fp.OnTagError = func(string, error) {}
+	fp.GroupCommits = true
+	fp.Message = "initial import"
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	require.NoError(t, fp.Push(context.Background(), f))
+	require.Len(t, pusher.commits, 1)
+
+	assert.ElementsMatch(t, []string{"a.jpg", "b.jpg"}, pusher.commits[0].FileIDs)
+	assert.Equal(t, "initial import", pusher.commits[0].Message)
+}
+
+// amendPusher records the commits amended with the added ones.
+type amendPusher struct {
+	commitPusher
+
+	amended map[string][]*store.Commit
+}
+
+func (p *amendPusher) FlushCommits(context.Context) error {
+	return fmt.Errorf("commits flushed instead of amended")
+}
+
+func (p *amendPusher) AmendCommits(_ context.Context, sha, _ string) error {
+	p.amended = map[string][]*store.Commit{sha: p.commits}
+
+	return nil
+}
+
+func TestFilePusherAmend(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("data"), 0o600))
+
+	pusher := &amendPusher{}
+
+	fp := NewFilePusher(pusher)
+	fp.ConfirmClean = func(int) bool { return false }
+	fp.OnTagError = func(string, error) {}
+	fp.Amend = "sha"
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	require.NoError(t, fp.Push(context.Background(), f))
+	require.Len(t, pusher.amended["sha"], 1)
+
+	assert.Equal(t, "a.jpg", pusher.amended["sha"][0].FileID)
+}
+
+// verifyPusher names each pushed file after itself and fails to verify the
+// files named in unverified, or whose digest is not that of "data".
+type verifyPusher struct {
+	commitPusher
+
+	unverified map[string]bool
+	verified   []string
+}
+
+func (p *verifyPusher) VerifyPush(_ context.Context, id string, want store.Digest, _ ...store.PushOption) error {
+	if p.unverified[id] {
+		return fmt.Errorf("%s is not durable", id)
+	}
+
+	sum := sha256.Sum256([]byte("data"))
+	if want != (store.Digest{Size: 4, SHA256: hex.EncodeToString(sum[:])}) {
+		return fmt.Errorf("%s does not match", id)
+	}
+
+	p.verified = append(p.verified, id)
+
+	return nil
+}
+
+func TestFilePusherVerify(t *testing.T) {
+	t.Parallel()
+
+	push := func(t *testing.T, pusher *verifyPusher) (string, error) {
+		t.Helper()
+
+		dir := t.TempDir()
+		for _, name := range []string{"a.jpg", "b.jpg"} {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o600))
+		}
+
+		require.NoError(t, osutil.WriteSidecarTags(filepath.Join(dir, "a.jpg"), "x"))
+
+		fp := NewFilePusher(pusher)
+		fp.OnTagError = func(string, error) {}
+
+		f, err := os.Open(dir)
+		require.NoError(t, err)
+
+		defer f.Close()
+
+		return dir, fp.Push(context.Background(), f)
+	}
+
+	t.Run("confirmed files are cleaned", func(t *testing.T) {
+		t.Parallel()
+
+		pusher := &verifyPusher{}
+
+		dir, err := push(t, pusher)
+		require.NoError(t, err)
+
+		assert.ElementsMatch(t, []string{"a.jpg", "b.jpg"}, pusher.verified)
+		assert.NoFileExists(t, filepath.Join(dir, "a.jpg"))
+		assert.NoFileExists(t, filepath.Join(dir, "a.jpg"+osutil.SidecarExt))
+		assert.NoFileExists(t, filepath.Join(dir, "b.jpg"))
+	})
+
+	t.Run("unconfirmed push cleans nothing", func(t *testing.T) {
+		t.Parallel()
+
+		pusher := &verifyPusher{unverified: map[string]bool{"b.jpg": true}}
+
+		dir, err := push(t, pusher)
+		assert.ErrorContains(t, err, "b.jpg is not durable")
+
+		assert.FileExists(t, filepath.Join(dir, "a.jpg"))
+		assert.FileExists(t, filepath.Join(dir, "a.jpg"+osutil.SidecarExt))
+		assert.FileExists(t, filepath.Join(dir, "b.jpg"))
+	})
+}
+
+func TestOnlyConfirmed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.jpg", "a.jpg" + osutil.SidecarExt, "b.jpg", "b.jpg" + osutil.SidecarExt} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o600))
+	}
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	entities, err := f.Readdir(-1)
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range onlyConfirmed(entities, map[string]bool{"a.jpg": true}) {
+		names = append(names, entry.Name())
+	}
+
+	assert.ElementsMatch(t, []string{"a.jpg", "a.jpg" + osutil.SidecarExt}, names)
+}
@@ -0,0 +1,27 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import "github.com/prestonvasquez/diskhop/internal/filter"
+
+// FilterSyntaxError describes an invalid filter expression and, when it can
+// be located, the byte offset of the problem.
+type FilterSyntaxError = filter.SyntaxError
+
+// ValidateFilter checks a pull filter expression without running a query. An
+// invalid expression is reported as a *FilterSyntaxError.
+func ValidateFilter(expr string) error {
+	return filter.ValidateFilter(expr)
+}
@@ -5,15 +5,21 @@ go 1.23
 require (
 	github.com/Knetic/govaluate v3.0.0+incompatible
 	github.com/google/uuid v1.6.0
+	github.com/hanwen/go-fuse/v2 v2.11.0
 	github.com/pkg/xattr v0.4.10
 	github.com/stretchr/testify v1.9.0
+	github.com/zalando/go-keyring v0.2.6
+	golang.org/x/crypto v0.24.0
 	gopkg.in/yaml.v2 v2.4.0
 	howett.net/plist v1.0.1
 )
 
 require (
+	al.essio.dev/pkg/shellescape v1.5.1 // indirect
+	github.com/danieljoos/wincred v1.2.2 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.22.0 // indirect
+	golang.org/x/sys v0.28.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,81 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrSkipFile is returned by a FileHook to leave the file out of the push or
+// the pull.
+var ErrSkipFile = errors.New("skip file")
+
+// FileHook processes a local file of a push or a pull, such as to strip the
+// EXIF data of a photo before it is pushed or to re-encode a video after it is
+// pulled. The file is open for reading and writing, at its start, and is
+// pushed or kept as the hook leaves it. Returning ErrSkipFile leaves the file
+// out: a file skipped by a push is neither pushed nor cleaned, and a file
+// skipped by a pull is deleted. Any other error fails the push or pull.
+type FileHook func(ctx context.Context, file *os.File) error
+
+// runPrePush calls the hook with the file at path, which is then pushed as the
+// hook left it.
+func runPrePush(ctx context.Context, hook FileHook, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open file for pre-push hook: %w", err)
+	}
+
+	defer func() { _ = file.Close() }()
+
+	if err := hook(ctx, file); err != nil {
+		if errors.Is(err, ErrSkipFile) {
+			return err
+		}
+
+		return fmt.Errorf("pre-push hook failed: %w", err)
+	}
+
+	return nil
+}
+
+// runPostPull calls the hook with the pulled file. If the hook skips the
+// file, it is securely deleted, and ErrSkipFile is returned once it is gone.
+func runPostPull(ctx context.Context, hook FileHook, file *os.File) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek pulled file: %w", err)
+	}
+
+	err := hook(ctx, file)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, ErrSkipFile) {
+		return fmt.Errorf("post-pull hook failed: %w", err)
+	}
+
+	_ = file.Close()
+
+	if delErr := secureDeleteWithRetry(file.Name()); delErr != nil {
+		return fmt.Errorf("failed to delete skipped file: %w", delErr)
+	}
+
+	return err
+}
@@ -0,0 +1,166 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dataPusher records the contents of the pushed files by base name.
+type dataPusher struct {
+	data map[string]string
+}
+
+func (p *dataPusher) Push(_ context.Context, name string, r io.ReadSeeker, _ ...store.PushOption) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	p.data[filepath.Base(name)] = string(data)
+
+	return "", nil
+}
+
+func TestFilePusherPrePush(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("data"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.raw"), []byte("data"), 0o600))
+	require.NoError(t, osutil.WriteSidecarTags(filepath.Join(dir, "b.raw"), "x"))
+
+	pusher := &dataPusher{data: map[string]string{}}
+
+	fp := NewFilePusher(pusher)
+	fp.OnTagError = func(string, error) {}
+	fp.PrePush = func(_ context.Context, file *os.File) error {
+		if filepath.Ext(file.Name()) == ".raw" {
+			return ErrSkipFile
+		}
+
+		_, err := file.WriteString("DATA")
+
+		return err
+	}
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	observer := &eventObserver{}
+
+	require.NoError(t, fp.Push(context.Background(), f, store.WithPushObserver(observer)))
+
+	assert.Equal(t, map[string]string{"a.jpg": "DATA"}, pusher.data)
+	assert.ElementsMatch(t, []string{
+		"start a.jpg", "done a.jpg 4",
+		"start b.raw", "done b.raw 0",
+		"batch 1 4",
+	}, observer.events)
+
+	// The skipped file and its sidecar are not cleaned.
+	assert.NoFileExists(t, filepath.Join(dir, "a.jpg"))
+	assert.FileExists(t, filepath.Join(dir, "b.raw"))
+	assert.FileExists(t, filepath.Join(dir, "b.raw"+osutil.SidecarExt))
+}
+
+func TestFilePusherPrePushError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("data"), 0o600))
+
+	errHook := errors.New("no thumbnail")
+
+	fp := NewFilePusher(&dataPusher{data: map[string]string{}})
+	fp.OnTagError = func(string, error) {}
+	fp.PrePush = func(context.Context, *os.File) error { return errHook }
+
+	f, err := os.Open(dir)
+	require.NoError(t, err)
+
+	defer f.Close()
+
+	assert.ErrorIs(t, fp.Push(context.Background(), f), errHook)
+	assert.FileExists(t, filepath.Join(dir, "a.jpg"))
+}
+
+func TestRunPostPull(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	open := func(t *testing.T, name string) *os.File {
+		t.Helper()
+
+		file, err := os.Create(filepath.Join(dir, name))
+		require.NoError(t, err)
+
+		t.Cleanup(func() { _ = file.Close() })
+
+		_, err = file.WriteString("data")
+		require.NoError(t, err)
+
+		return file
+	}
+
+	t.Run("file is read from its start", func(t *testing.T) {
+		file := open(t, "a.jpg")
+
+		var data []byte
+
+		require.NoError(t, runPostPull(ctx, func(_ context.Context, file *os.File) (err error) {
+			data, err = io.ReadAll(file)
+
+			return err
+		}, file))
+
+		assert.Equal(t, "data", string(data))
+		assert.FileExists(t, file.Name())
+	})
+
+	t.Run("skipped file is deleted", func(t *testing.T) {
+		file := open(t, "b.jpg")
+
+		err := runPostPull(ctx, func(context.Context, *os.File) error { return ErrSkipFile }, file)
+
+		assert.ErrorIs(t, err, ErrSkipFile)
+		assert.NoFileExists(t, file.Name())
+	})
+
+	t.Run("error is returned", func(t *testing.T) {
+		file := open(t, "c.jpg")
+
+		errHook := errors.New("re-encode failed")
+
+		err := runPostPull(ctx, func(context.Context, *os.File) error { return errHook }, file)
+
+		assert.ErrorIs(t, err, errHook)
+		assert.FileExists(t, file.Name())
+	})
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package exif reads the camera, capture time and location that a JPEG image
+// records in its EXIF data.
+package exif
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNoExif is returned by Read when the image has no EXIF data.
+var ErrNoExif = errors.New("no EXIF data")
+
+// Info is what an image records about how it was taken. Fields the image
+// does not record are left zero.
+type Info struct {
+	Make  string    // Manufacturer of the camera
+	Model string    // Model of the camera
+	Taken time.Time // When the image was taken, in the camera's local time
+
+	HasGPS    bool    // Whether Latitude and Longitude were recorded
+	Latitude  float64 // Degrees north, negative for south
+	Longitude float64 // Degrees east, negative for west
+}
+
+// Tags of the TIFF structure that EXIF data is stored in.
+const (
+	tagMake             = 0x010f
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+)
+
+// Types of the values of TIFF entries.
+const (
+	typeASCII    = 2
+	typeShort    = 3
+	typeLong     = 4
+	typeRational = 5
+)
+
+// dateLayout is the layout of the dates in EXIF data.
+const dateLayout = "2006:01:02 15:04:05"
+
+// Read reads the EXIF data of the JPEG image in r. It returns ErrNoExif if r
+// is not a JPEG image or has no EXIF data.
+func Read(r io.Reader) (*Info, error) {
+	data, err := findExif(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTIFF(data)
+}
+
+// findExif returns the TIFF structure of the APP1 segment of the JPEG image
+// that holds its EXIF data. Only the segments before the image data are read.
+func findExif(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xff, 0xd8} {
+		return nil, ErrNoExif
+	}
+
+	for {
+		marker, err := readMarker(r)
+		if err != nil {
+			return nil, ErrNoExif
+		}
+
+		// The image data starts at the start of scan, and no EXIF data
+		// follows it.
+		if marker == 0xda || marker == 0xd9 {
+			return nil, ErrNoExif
+		}
+
+		var size uint16
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil || size < 2 {
+			return nil, ErrNoExif
+		}
+
+		segment := make([]byte, size-2)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, ErrNoExif
+		}
+
+		if data, ok := bytes.CutPrefix(segment, []byte("Exif\x00\x00")); marker == 0xe1 && ok {
+			return data, nil
+		}
+	}
+}
+
+// readMarker returns the next marker of the JPEG image, skipping the fill
+// bytes before it.
+func readMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if b != 0xff {
+		return 0, ErrNoExif
+	}
+
+	for b == 0xff {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+	}
+
+	return b, nil
+}
+
+// tiff reads the entries of the IFDs of a TIFF structure.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// entry is an entry of an IFD.
+type entry struct {
+	typ   uint16
+	count uint32
+	value []byte // The values of the entry, wherever they are stored
+}
+
+// parseTIFF reads the EXIF data from the TIFF structure.
+func parseTIFF(data []byte) (*Info, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("truncated EXIF header")
+	}
+
+	t := &tiff{data: data}
+
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid EXIF byte order %q", data[:2])
+	}
+
+	if t.order.Uint16(data[2:]) != 42 {
+		return nil, fmt.Errorf("invalid EXIF header")
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{
+		Make:  t.ascii(ifd0[tagMake]),
+		Model: t.ascii(ifd0[tagModel]),
+		Taken: parseDate(t.ascii(ifd0[tagDateTime])),
+	}
+
+	// The time the image was taken is preferred to the time the file was
+	// last changed.
+	if e, ok := ifd0[tagExifIFD]; ok {
+		exifIFD, err := t.ifd(t.long(e))
+		if err != nil {
+			return nil, err
+		}
+
+		if taken := parseDate(t.ascii(exifIFD[tagDateTimeOriginal])); !taken.IsZero() {
+			info.Taken = taken
+		}
+	}
+
+	if e, ok := ifd0[tagGPSIFD]; ok {
+		gpsIFD, err := t.ifd(t.long(e))
+		if err != nil {
+			return nil, err
+		}
+
+		lat, latOK := t.degrees(gpsIFD[tagGPSLatitude], t.ascii(gpsIFD[tagGPSLatitudeRef]), "S")
+		lon, lonOK := t.degrees(gpsIFD[tagGPSLongitude], t.ascii(gpsIFD[tagGPSLongitudeRef]), "W")
+
+		if latOK && lonOK {
+			info.HasGPS, info.Latitude, info.Longitude = true, lat, lon
+		}
+	}
+
+	return info, nil
+}
+
+// ifd returns the entries of the IFD at the offset, by tag.
+func (t *tiff) ifd(offset uint32) (map[uint16]entry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("IFD offset %d out of range", offset)
+	}
+
+	n := int(t.order.Uint16(t.data[offset:]))
+	start := int(offset) + 2
+
+	if start+n*12 > len(t.data) {
+		return nil, fmt.Errorf("truncated IFD at offset %d", offset)
+	}
+
+	entries := make(map[uint16]entry, n)
+
+	for i := 0; i < n; i++ {
+		raw := t.data[start+i*12 : start+(i+1)*12]
+
+		e := entry{typ: t.order.Uint16(raw[2:]), count: t.order.Uint32(raw[4:])}
+
+		size := uint64(e.count) * uint64(typeSize(e.typ))
+		if size <= 4 {
+			e.value = raw[8 : 8+size]
+		} else if off := uint64(t.order.Uint32(raw[8:])); off+size <= uint64(len(t.data)) {
+			e.value = t.data[off : off+size]
+		}
+
+		entries[t.order.Uint16(raw)] = e
+	}
+
+	return entries, nil
+}
+
+// typeSize returns the size in bytes of a value of the type, or zero if the
+// type is not read.
+func typeSize(typ uint16) int {
+	switch typ {
+	case typeASCII:
+		return 1
+	case typeShort:
+		return 2
+	case typeLong:
+		return 4
+	case typeRational:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// ascii returns the string value of the entry, without its terminating NUL
+// and padding.
+func (t *tiff) ascii(e entry) string {
+	if e.typ != typeASCII {
+		return ""
+	}
+
+	s, _, _ := strings.Cut(string(e.value), "\x00")
+
+	return strings.TrimSpace(s)
+}
+
+// long returns the first value of the entry as an offset.
+func (t *tiff) long(e entry) uint32 {
+	switch {
+	case e.typ == typeLong && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	case e.typ == typeShort && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	default:
+		return 0
+	}
+}
+
+// degrees returns the coordinate of the entry, whose values are the degrees,
+// minutes and seconds, negated if ref is neg.
+func (t *tiff) degrees(e entry, ref, neg string) (float64, bool) {
+	if e.typ != typeRational || len(e.value) < 24 {
+		return 0, false
+	}
+
+	var parts [3]float64
+
+	for i := range parts {
+		num := t.order.Uint32(e.value[i*8:])
+		den := t.order.Uint32(e.value[i*8+4:])
+
+		if den == 0 {
+			return 0, false
+		}
+
+		parts[i] = float64(num) / float64(den)
+	}
+
+	deg := parts[0] + parts[1]/60 + parts[2]/3600
+	if strings.EqualFold(ref, neg) {
+		deg = -deg
+	}
+
+	return deg, true
+}
+
+// parseDate parses a date of EXIF data, returning the zero time if it is not
+// valid.
+func parseDate(s string) time.Time {
+	taken, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return taken
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testEntry is an entry of an IFD built by buildJPEG.
+type testEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+func asciiEntry(tag uint16, s string) testEntry {
+	return testEntry{tag: tag, typ: typeASCII, count: uint32(len(s) + 1), value: append([]byte(s), 0)}
+}
+
+func rationalsEntry(order binary.AppendByteOrder, tag uint16, vals ...uint32) testEntry {
+	value := make([]byte, 0, len(vals)*4)
+	for _, v := range vals {
+		value = order.AppendUint32(value, v)
+	}
+
+	return testEntry{tag: tag, typ: typeRational, count: uint32(len(vals) / 2), value: value}
+}
+
+// buildJPEG returns a JPEG image, without image data, whose EXIF data holds
+// the IFDs. The Exif and GPS IFDs are linked from IFD0 if they are not nil.
+func buildJPEG(order binary.AppendByteOrder, ifd0, exifIFD, gpsIFD []testEntry) []byte {
+	ifdSize := func(entries []testEntry) int { return 2 + 12*len(entries) + 4 }
+
+	ifds := [][]testEntry{ifd0}
+	links := []uint16{}
+
+	for _, link := range []struct {
+		tag     uint16
+		entries []testEntry
+	}{{tagExifIFD, exifIFD}, {tagGPSIFD, gpsIFD}} {
+		if link.entries != nil {
+			ifd0 = append(ifd0, testEntry{tag: link.tag, typ: typeLong, count: 1})
+			ifds = append(ifds, link.entries)
+			links = append(links, link.tag)
+		}
+	}
+
+	ifds[0] = ifd0
+
+	// The IFDs follow the header, and the values that do not fit in their
+	// entries follow the IFDs.
+	offsets := make([]int, len(ifds))
+	next := 8
+
+	for i, ifd := range ifds {
+		offsets[i] = next
+		next += ifdSize(ifd)
+	}
+
+	for i, tag := range links {
+		for j := range ifd0 {
+			if ifd0[j].tag == tag {
+				ifd0[j].value = order.AppendUint32(nil, uint32(offsets[i+1]))
+			}
+		}
+	}
+
+	var head, tail []byte
+	if order == binary.LittleEndian {
+		head = []byte("II")
+	} else {
+		head = []byte("MM")
+	}
+
+	head = order.AppendUint16(head, 42)
+	head = order.AppendUint32(head, 8)
+
+	for _, ifd := range ifds {
+		head = order.AppendUint16(head, uint16(len(ifd)))
+
+		for _, e := range ifd {
+			head = order.AppendUint16(head, e.tag)
+			head = order.AppendUint16(head, e.typ)
+			head = order.AppendUint32(head, e.count)
+
+			if len(e.value) <= 4 {
+				head = append(head, e.value...)
+				head = append(head, make([]byte, 4-len(e.value))...)
+
+				continue
+			}
+
+			head = order.AppendUint32(head, uint32(next+len(tail)))
+			tail = append(tail, e.value...)
+		}
+
+		head = order.AppendUint32(head, 0)
+	}
+
+	app1 := append([]byte("Exif\x00\x00"), append(head, tail...)...)
+
+	jpeg := []byte{0xff, 0xd8}
+
+	// A JFIF segment comes first, as it does in most cameras' files.
+	jfif := []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")
+	jpeg = append(jpeg, 0xff, 0xe0)
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(len(jfif)+2))
+	jpeg = append(jpeg, jfif...)
+
+	jpeg = append(jpeg, 0xff, 0xe1)
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(len(app1)+2))
+	jpeg = append(jpeg, app1...)
+
+	return append(jpeg, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9)
+}
+
+func TestRead(t *testing.T) {
+	t.Parallel()
+
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		t.Run(order.String(), func(t *testing.T) {
+			t.Parallel()
+
+			jpeg := buildJPEG(order,
+				[]testEntry{
+					asciiEntry(tagMake, "Canon"),
+					asciiEntry(tagModel, "EOS R5"),
+					asciiEntry(tagDateTime, "2024:07:01 09:00:00"),
+				},
+				[]testEntry{asciiEntry(tagDateTimeOriginal, "2024:06:30 18:45:10")},
+				[]testEntry{
+					asciiEntry(tagGPSLatitudeRef, "N"),
+					rationalsEntry(order, tagGPSLatitude, 37, 1, 46, 1, 30, 1),
+					asciiEntry(tagGPSLongitudeRef, "W"),
+					rationalsEntry(order, tagGPSLongitude, 122, 1, 25, 1, 9, 1),
+				},
+			)
+
+			info, err := Read(bytes.NewReader(jpeg))
+			require.NoError(t, err)
+
+			assert.Equal(t, "Canon", info.Make)
+			assert.Equal(t, "EOS R5", info.Model)
+			assert.Equal(t, time.Date(2024, 6, 30, 18, 45, 10, 0, time.UTC), info.Taken)
+			assert.True(t, info.HasGPS)
+			assert.InDelta(t, 37.775, info.Latitude, 1e-9)
+			assert.InDelta(t, -122.419166, info.Longitude, 1e-6)
+		})
+	}
+}
+
+func TestReadWithoutExifIFD(t *testing.T) {
+	t.Parallel()
+
+	jpeg := buildJPEG(binary.BigEndian,
+		[]testEntry{asciiEntry(tagModel, "Pixel 8"), asciiEntry(tagDateTime, "2023:01:02 03:04:05")},
+		nil, nil)
+
+	info, err := Read(bytes.NewReader(jpeg))
+	require.NoError(t, err)
+
+	assert.Empty(t, info.Make)
+	assert.Equal(t, "Pixel 8", info.Model)
+	assert.Equal(t, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), info.Taken)
+	assert.False(t, info.HasGPS)
+}
+
+func TestReadNoExif(t *testing.T) {
+	t.Parallel()
+
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"png":       []byte("\x89PNG\r\n\x1a\n"),
+		"jpeg only": {0xff, 0xd8, 0xff, 0xda, 0x00, 0x02, 0xff, 0xd9},
+		"truncated": {0xff, 0xd8, 0xff, 0xe1, 0x10},
+	} {
+		_, err := Read(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrNoExif, name)
+	}
+}
+
+func TestReadInvalidTIFF(t *testing.T) {
+	t.Parallel()
+
+	app1 := []byte("Exif\x00\x00XX\x00\x2a\x00\x00\x00\x08")
+
+	jpeg := []byte{0xff, 0xd8, 0xff, 0xe1}
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(len(app1)+2))
+	jpeg = append(jpeg, app1...)
+
+	_, err := Read(bytes.NewReader(jpeg))
+	assert.ErrorContains(t, err, "byte order")
+}
@@ -14,13 +14,23 @@
 
 package filter
 
-import "github.com/Knetic/govaluate"
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
 
 type Document struct {
 	EncodedName string
 	Name        string
 	Tags        []string
 	Size        int64
+	Batch       string // ID of the push that wrote the document
+	Label       string // Label of the push that wrote the document
 }
 
 func FilterDocuments(expression string, documents []Document) ([]Document, error) {
@@ -41,14 +51,37 @@ func FilterDocuments(expression string, documents []Document) ([]Document, error
 	return filteredDocs, nil
 }
 
+// tagArgs returns the tag arguments of a tag function, checking that each is
+// a string before any is matched so that a document without tags still
+// rejects them.
+func tagArgs(args []interface{}) ([]string, error) {
+	tags := make([]string, len(args))
+
+	for i, arg := range args {
+		tag, ok := arg.(string)
+		if !ok {
+			return nil, fmt.Errorf("tag must be a string, got %T", arg)
+		}
+
+		tags[i] = tag
+	}
+
+	return tags, nil
+}
+
 func (doc Document) HasAllTags(args ...interface{}) (interface{}, error) {
+	tags, err := tagArgs(args)
+	if err != nil {
+		return false, err
+	}
+
 	tagSet := make(map[string]bool)
 	for _, tag := range doc.Tags {
 		tagSet[tag] = true
 	}
 
-	for _, arg := range args {
-		if !tagSet[arg.(string)] {
+	for _, tag := range tags {
+		if !tagSet[tag] {
 			return false, nil
 		}
 	}
@@ -57,13 +90,18 @@ func (doc Document) HasAllTags(args ...interface{}) (interface{}, error) {
 }
 
 func (doc Document) HasNoTags(args ...interface{}) (interface{}, error) {
+	tags, err := tagArgs(args)
+	if err != nil {
+		return false, err
+	}
+
 	tagSet := make(map[string]bool)
 	for _, tag := range doc.Tags {
 		tagSet[tag] = true
 	}
 
-	for _, arg := range args {
-		if tagSet[arg.(string)] {
+	for _, tag := range tags {
+		if tagSet[tag] {
 			return false, nil
 		}
 	}
@@ -72,13 +110,39 @@ func (doc Document) HasNoTags(args ...interface{}) (interface{}, error) {
 }
 
 func (doc Document) HasTag(args ...interface{}) (interface{}, error) {
+	tags, err := tagArgs(args)
+	if err != nil {
+		return false, err
+	}
+
 	tagSet := make(map[string]bool)
 	for _, tag := range doc.Tags {
 		tagSet[tag] = true
 	}
 
+	for _, tag := range tags {
+		if tagSet[tag] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// InBatch reports whether the document was written by any of the pushes,
+// each given by its batch ID or label.
+func (doc Document) InBatch(args ...interface{}) (interface{}, error) {
 	for _, arg := range args {
-		if tagSet[arg.(string)] {
+		batch, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("batch must be a string, got %T", arg)
+		}
+
+		if batch == "" {
+			continue
+		}
+
+		if batch == doc.Batch || batch == doc.Label {
 			return true, nil
 		}
 	}
@@ -86,6 +150,134 @@ func (doc Document) HasTag(args ...interface{}) (interface{}, error) {
 	return false, nil
 }
 
+// MatchesGlob reports whether the name matches any of the glob patterns, as
+// interpreted by path.Match. Patterns without a separator are matched against
+// the base name, so that "*.jpg" selects JPEGs in any directory.
+func (doc Document) MatchesGlob(args ...interface{}) (interface{}, error) {
+	return doc.matchGlob(false, args...)
+}
+
+// MatchesGlobFold is MatchesGlob ignoring case.
+func (doc Document) MatchesGlobFold(args ...interface{}) (interface{}, error) {
+	return doc.matchGlob(true, args...)
+}
+
+func (doc Document) matchGlob(fold bool, args ...interface{}) (interface{}, error) {
+	name := doc.Name
+	if fold {
+		name = strings.ToLower(name)
+	}
+
+	for _, arg := range args {
+		pattern, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("glob pattern must be a string, got %T", arg)
+		}
+
+		if fold {
+			pattern = strings.ToLower(pattern)
+		}
+
+		match, err := MatchGlob(pattern, name)
+		if err != nil {
+			return false, err
+		}
+
+		if match {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// MatchGlob reports whether the name matches the glob pattern, as interpreted
+// by path.Match. A pattern without a separator is matched against the base
+// name, as in MatchesGlob.
+func MatchGlob(pattern, name string) (bool, error) {
+	target := filepath.ToSlash(name)
+	if !strings.Contains(pattern, "/") {
+		target = path.Base(target)
+	}
+
+	match, err := path.Match(pattern, target)
+	if err != nil {
+		return false, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+
+	return match, nil
+}
+
+// HasExt reports whether the name has any of the extensions, ignoring case.
+// An extension may be given with or without its leading dot, and may span
+// several dots, as in "tar.gz". A name that is only an extension, such as
+// ".bashrc", has none.
+func (doc Document) HasExt(args ...interface{}) (interface{}, error) {
+	base := strings.ToLower(path.Base(filepath.ToSlash(doc.Name)))
+
+	for _, arg := range args {
+		ext, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("extension must be a string, got %T", arg)
+		}
+
+		ext = strings.TrimPrefix(ext, ".")
+		if ext == "" {
+			continue
+		}
+
+		suffix := "." + strings.ToLower(ext)
+		if len(base) > len(suffix) && strings.HasSuffix(base, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// MatchesRegexFold reports whether the name matches any of the regular
+// expressions, ignoring case.
+func (doc Document) MatchesRegexFold(args ...interface{}) (interface{}, error) {
+	for _, arg := range args {
+		pattern, ok := arg.(string)
+		if !ok {
+			return false, fmt.Errorf("regular expression must be a string, got %T", arg)
+		}
+
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+		}
+
+		if re.MatchString(doc.Name) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Between reports whether a size lies within an inclusive range. It takes the
+// size followed by the lower and upper bounds, each either a number of bytes
+// or a size string such as "10MB".
+func Between(args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return false, fmt.Errorf("between requires 3 arguments, got %d", len(args))
+	}
+
+	sizes := make([]int64, len(args))
+	for i, arg := range args {
+		size, err := toSize(arg)
+		if err != nil {
+			return false, err
+		}
+
+		sizes[i] = size
+	}
+
+	return sizes[1] <= sizes[0] && sizes[0] <= sizes[2], nil
+}
+
 // evaluateExpression takes a string expression and evaluates it against the document
 func evaluateExpression(expString string, doc Document) (bool, error) {
 	if expString == "" {
@@ -109,6 +301,17 @@ func evaluateExpression(expString string, doc Document) (bool, error) {
 		"ti":           doc.HasAllTags,
 		"noTag":        doc.HasNoTags,
 		"nt":           doc.HasNoTags,
+		"glob":         doc.MatchesGlob,
+		"g":            doc.MatchesGlob,
+		"iglob":        doc.MatchesGlobFold,
+		"ig":           doc.MatchesGlobFold,
+		"imatch":       doc.MatchesRegexFold,
+		"im":           doc.MatchesRegexFold,
+		"ext":          doc.HasExt,
+		"e":            doc.HasExt,
+		"between":      Between,
+		"batch":        doc.InBatch,
+		"b":            doc.InBatch,
 	}
 
 	expression, err := govaluate.NewEvaluableExpressionWithFunctions(expString, functions)
@@ -123,5 +326,10 @@ func evaluateExpression(expString string, doc Document) (bool, error) {
 	}
 
 	// Convert the result to a boolean value
-	return result.(bool), nil
+	match, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must evaluate to a boolean, got %T", result)
+	}
+
+	return match, nil
 }
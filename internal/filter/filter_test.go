@@ -150,6 +150,25 @@ func TestFilterDocuments(t *testing.T) {
 				{EncodedName: "1234", Name: "Document1", Tags: []string{"tag1", "important"}, Size: 1},
 			},
 		},
+		{
+			name:   "size between numbers",
+			filter: "between(s, 1, 10)",
+			expected: []Document{
+				{EncodedName: "1234", Name: "Document1", Tags: []string{"tag1", "important"}, Size: 1},
+			},
+		},
+		{
+			name:   "size between units",
+			filter: "between(size, '0B', '1KB') && t('important')",
+			expected: []Document{
+				{EncodedName: "1234", Name: "Document1", Tags: []string{"tag1", "important"}, Size: 1},
+			},
+		},
+		{
+			name:     "size outside range",
+			filter:   "between(s, '1KiB', '1MB')",
+			expected: []Document{},
+		},
 		{
 			name:   "filter by inclusive tags",
 			filter: "ti('tag1', 'important')",
@@ -172,3 +191,213 @@ func TestFilterDocuments(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterDocumentsNameMatching(t *testing.T) {
+	docs := []Document{
+		{EncodedName: "1", Name: "photos/Beach.JPG"},
+		{EncodedName: "2", Name: "photos/city.jpg"},
+		{EncodedName: "3", Name: "notes/todo.txt"},
+		{EncodedName: "4", Name: "jpg-notes.txt"},
+	}
+
+	testCases := []struct {
+		name     string
+		filter   string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "glob matches base name",
+			filter:   "glob('*.jpg')",
+			expected: []string{"2"},
+		},
+		{
+			name:     "glob is anchored",
+			filter:   "g('jpg*')",
+			expected: []string{"4"},
+		},
+		{
+			name:     "glob with separator matches full name",
+			filter:   "glob('notes/*')",
+			expected: []string{"3"},
+		},
+		{
+			name:     "case-insensitive glob",
+			filter:   "iglob('*.jpg')",
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "case-insensitive exact name",
+			filter:   "ig('photos/beach.jpg')",
+			expected: []string{"1"},
+		},
+		{
+			name:     "case-insensitive regex",
+			filter:   "imatch('beach|CITY')",
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "any of several patterns",
+			filter:   "glob('*.txt', '*.JPG')",
+			expected: []string{"1", "3", "4"},
+		},
+		{
+			name:    "invalid glob",
+			filter:  "glob('[')",
+			wantErr: true,
+		},
+		{
+			name:    "invalid regex",
+			filter:  "im('(')",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := FilterDocuments(tc.filter, docs)
+			if tc.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			got := make([]string, 0, len(result))
+			for _, doc := range result {
+				got = append(got, doc.EncodedName)
+			}
+
+			assert.ElementsMatch(t, tc.expected, got)
+		})
+	}
+}
+
+func TestFilterDocumentsExt(t *testing.T) {
+	docs := []Document{
+		{EncodedName: "1", Name: "photos/Beach.JPG"},
+		{EncodedName: "2", Name: "photos/city.png"},
+		{EncodedName: "3", Name: "backups/home.tar.gz"},
+		{EncodedName: "4", Name: "notes/jpg.txt"},
+		{EncodedName: "5", Name: ".jpg"},
+	}
+
+	testCases := []struct {
+		name     string
+		filter   string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "any of several extensions",
+			filter:   "ext('jpg', 'png')",
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "case-insensitive",
+			filter:   "e('JpG')",
+			expected: []string{"1"},
+		},
+		{
+			name:     "leading dot",
+			filter:   "ext('.txt')",
+			expected: []string{"4"},
+		},
+		{
+			name:     "several dots",
+			filter:   "ext('tar.gz')",
+			expected: []string{"3"},
+		},
+		{
+			name:     "last extension of several",
+			filter:   "ext('gz')",
+			expected: []string{"3"},
+		},
+		{
+			name:     "combined with another function",
+			filter:   "ext('jpg', 'png') && !imatch('city')",
+			expected: []string{"1"},
+		},
+		{
+			name:     "empty extension matches nothing",
+			filter:   "ext('')",
+			expected: []string{},
+		},
+		{
+			name:    "extension must be a string",
+			filter:  "ext(1)",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := FilterDocuments(tc.filter, docs)
+			if tc.wantErr {
+				assert.Error(t, err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			got := make([]string, 0, len(result))
+			for _, doc := range result {
+				got = append(got, doc.EncodedName)
+			}
+
+			assert.ElementsMatch(t, tc.expected, got)
+		})
+	}
+}
+
+func TestFilterDocumentsBatch(t *testing.T) {
+	docs := []Document{
+		{EncodedName: "1", Batch: "b1", Label: "import 2024-06 from camera"},
+		{EncodedName: "2", Batch: "b1", Label: "import 2024-06 from camera"},
+		{EncodedName: "3", Batch: "b2"},
+		{EncodedName: "4"},
+	}
+
+	testCases := []struct {
+		name     string
+		filter   string
+		expected []string
+	}{
+		{
+			name:     "by ID",
+			filter:   "batch('b2')",
+			expected: []string{"3"},
+		},
+		{
+			name:     "by label",
+			filter:   "b('import 2024-06 from camera')",
+			expected: []string{"1", "2"},
+		},
+		{
+			name:     "any of several batches",
+			filter:   "batch('b1', 'b2')",
+			expected: []string{"1", "2", "3"},
+		},
+		{
+			name:     "empty batch matches nothing",
+			filter:   "batch('')",
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := FilterDocuments(tc.filter, docs)
+			require.NoError(t, err)
+
+			got := make([]string, 0, len(result))
+			for _, doc := range result {
+				got = append(got, doc.EncodedName)
+			}
+
+			assert.ElementsMatch(t, tc.expected, got)
+		})
+	}
+}
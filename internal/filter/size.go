@@ -0,0 +1,81 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// sizeUnits maps a size suffix to its number of bytes. Decimal suffixes are
+// powers of 1000 and binary ("i") suffixes are powers of 1024.
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// ParseSize parses a human-readable size such as "10MB", "1.5 GiB" or "512"
+// into a number of bytes. Units are case-insensitive.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !unicode.IsDigit(r) && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	num, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", s, unit)
+	}
+
+	return int64(value * multiplier), nil
+}
+
+// toSize converts a filter argument, either a number of bytes or a size
+// string, into a number of bytes.
+func toSize(arg interface{}) (int64, error) {
+	switch v := arg.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		return ParseSize(v)
+	default:
+		return 0, fmt.Errorf("size must be a number or string, got %T", arg)
+	}
+}
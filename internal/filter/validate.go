@@ -0,0 +1,126 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SyntaxError describes an invalid filter expression.
+type SyntaxError struct {
+	Expr string // The expression
+	Pos  int    // Byte offset of the error in Expr, or -1 if unknown
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("invalid filter: %s", e.Msg)
+	}
+
+	return fmt.Sprintf("invalid filter at position %d: %s", e.Pos, e.Msg)
+}
+
+// ValidateFilter checks that expr is a valid filter by compiling it and
+// evaluating it against an empty document, without running a query. Errors
+// are returned as a *SyntaxError.
+func ValidateFilter(expr string) error {
+	if _, err := evaluateExpression(expr, Document{}); err != nil {
+		return &SyntaxError{Expr: expr, Pos: errorPos(expr, err.Error()), Msg: err.Error()}
+	}
+
+	return nil
+}
+
+var (
+	undefinedFunctionRE = regexp.MustCompile(`^Undefined function (\S+)`)
+	quotedTokenRE       = regexp.MustCompile(`'([^']+)'`)
+)
+
+// errorPos makes a best effort to locate the error described by msg in expr,
+// returning -1 if it cannot.
+func errorPos(expr, msg string) int {
+	switch {
+	case msg == "Unbalanced parenthesis":
+		return unbalancedParenPos(expr)
+	case msg == "Unclosed string literal":
+		return unclosedQuotePos(expr)
+	case msg == "Unexpected end of expression":
+		return len(expr)
+	}
+
+	if m := undefinedFunctionRE.FindStringSubmatch(msg); m != nil {
+		return strings.Index(expr, m[1]+"(")
+	}
+
+	if m := quotedTokenRE.FindStringSubmatch(msg); m != nil {
+		return strings.Index(expr, m[1])
+	}
+
+	return -1
+}
+
+// unbalancedParenPos returns the offset of the first unmatched closing
+// parenthesis, or else of the last unmatched opening one.
+func unbalancedParenPos(expr string) int {
+	var (
+		open    []int
+		inQuote bool
+	)
+
+	for i, r := range expr {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '(':
+			open = append(open, i)
+		case r == ')':
+			if len(open) == 0 {
+				return i
+			}
+
+			open = open[:len(open)-1]
+		}
+	}
+
+	if len(open) > 0 {
+		return open[len(open)-1]
+	}
+
+	return -1
+}
+
+// unclosedQuotePos returns the offset of the quote opening an unterminated
+// string literal.
+func unclosedQuotePos(expr string) int {
+	pos := -1
+
+	for i, r := range expr {
+		if r != '\'' {
+			continue
+		}
+
+		if pos < 0 {
+			pos = i
+		} else {
+			pos = -1
+		}
+	}
+
+	return pos
+}
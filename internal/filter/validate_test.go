@@ -0,0 +1,60 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr bool
+		wantPos int
+	}{
+		{name: "empty", expr: ""},
+		{name: "valid", expr: "t('a') && glob('*.jpg') && between(s, '1MB', '10MB')"},
+		{name: "unclosed paren", expr: "t('a') && (s > 1", wantErr: true, wantPos: 10},
+		{name: "extra paren", expr: "(s > 1))", wantErr: true, wantPos: 7},
+		{name: "unclosed string", expr: "n == 'a' || n == 'b", wantErr: true, wantPos: 17},
+		{name: "trailing operator", expr: "n == 'a' &&", wantErr: true, wantPos: 11},
+		{name: "undefined function", expr: "s > 1 && foo('a')", wantErr: true, wantPos: 9},
+		{name: "invalid token", expr: "n === 'a'", wantErr: true, wantPos: 2},
+		{name: "unknown parameter", expr: "n == x", wantErr: true, wantPos: 5},
+		{name: "not a boolean", expr: "s + 1", wantErr: true, wantPos: -1},
+		{name: "tag not a string", expr: "t(1)", wantErr: true, wantPos: -1},
+		{name: "inclusive tag not a string", expr: "ti('a', 1)", wantErr: true, wantPos: -1},
+		{name: "excluded tag not a string", expr: "nt(1)", wantErr: true, wantPos: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFilter(tt.expr)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+
+				return
+			}
+
+			var syntaxErr *SyntaxError
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.wantPos, syntaxErr.Pos)
+		})
+	}
+}
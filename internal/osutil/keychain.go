@@ -0,0 +1,57 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osutil
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keychainAccount is the account that secrets are stored under in the
+// keychain.
+const keychainAccount = "diskhop"
+
+// ReadSecret returns the secret stored under the service in the keychain of
+// the current operating system: the macOS Keychain, the Secret Service on
+// Linux or the Windows Credential Manager.
+func ReadSecret(service string) (string, error) {
+	secret, err := keyring.Get(service, keychainAccount)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("no secret %q in keychain", service)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %q from keychain: %w", service, err)
+	}
+
+	if secret == "" {
+		return "", fmt.Errorf("no secret %q in keychain", service)
+	}
+
+	return secret, nil
+}
+
+// WriteSecret stores the secret under the service in the keychain of the
+// current operating system, replacing the one stored there if any. The secret
+// is never passed on a command line, where other processes could read it.
+func WriteSecret(service, secret string) error {
+	if err := keyring.Set(service, keychainAccount, secret); err != nil {
+		return fmt.Errorf("failed to write secret %q to keychain: %w", service, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+func TestSecret(t *testing.T) {
+	keyring.MockInit()
+
+	_, err := ReadSecret("diskhop-test")
+	assert.ErrorContains(t, err, "no secret")
+
+	require.NoError(t, WriteSecret("diskhop-test", "first"))
+	require.NoError(t, WriteSecret("diskhop-test", "second"))
+
+	secret, err := ReadSecret("diskhop-test")
+	require.NoError(t, err)
+	assert.Equal(t, "second", secret)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osutil
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// SidecarExt is the extension of a sidecar file holding the tags of the file
+// it is named after, e.g. "foo.txt.tags" for "foo.txt". Sidecars are used on
+// filesystems that do not support extended attributes.
+const SidecarExt = ".tags"
+
+// SidecarPath returns the path of the sidecar tag file for filePath.
+func SidecarPath(filePath string) string {
+	return filePath + SidecarExt
+}
+
+// IsSidecar reports whether name is the sidecar of a file in names.
+func IsSidecar(name string, names map[string]bool) bool {
+	base, ok := strings.CutSuffix(name, SidecarExt)
+
+	return ok && names[base]
+}
+
+// ReadSidecarTags returns the tags in the sidecar of filePath, one per line.
+// It returns nil if there is no sidecar.
+func ReadSidecarTags(filePath string) ([]string, error) {
+	file, err := os.Open(SidecarPath(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sidecar: %w", err)
+	}
+
+	defer file.Close()
+
+	var tags []string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if tag := strings.TrimSpace(scanner.Text()); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sidecar: %w", err)
+	}
+
+	return tags, nil
+}
+
+// WriteSidecarTags writes tags to the sidecar of filePath, one per line.
+func WriteSidecarTags(filePath string, tags ...string) error {
+	content := strings.Join(tags, "\n") + "\n"
+
+	if err := os.WriteFile(SidecarPath(filePath), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write sidecar: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSidecarTags(t *testing.T) {
+	t.Parallel()
+
+	filePath := filepath.Join(t.TempDir(), "foo.txt")
+
+	tags, err := ReadSidecarTags(filePath)
+	require.NoError(t, err)
+	assert.Nil(t, tags, "missing sidecar should have no tags")
+
+	require.NoError(t, WriteSidecarTags(filePath, "tag1", "tag2"))
+
+	tags, err = ReadSidecarTags(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag1", "tag2"}, tags)
+
+	// Blank lines and surrounding whitespace are ignored.
+	require.NoError(t, os.WriteFile(SidecarPath(filePath), []byte(" tag1 \n\ntag2\n"), 0o600))
+
+	tags, err = ReadSidecarTags(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"tag1", "tag2"}, tags)
+}
+
+func TestIsSidecar(t *testing.T) {
+	t.Parallel()
+
+	names := map[string]bool{"foo.txt": true, "foo.txt.tags": true, "bar.tags": true}
+
+	assert.True(t, IsSidecar("foo.txt.tags", names))
+	assert.False(t, IsSidecar("bar.tags", names), "no companion file")
+	assert.False(t, IsSidecar("foo.txt", names))
+}
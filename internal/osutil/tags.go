@@ -15,8 +15,9 @@
 package osutil
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"runtime"
@@ -30,6 +31,22 @@ var ErrFileNotExists = fmt.Errorf("file does not exist")
 
 const darwinAttrListTag = "com.apple.metadata:_kMDItemUserTags"
 
+// windowsTagStream is the NTFS alternate data stream that holds the tags of a
+// file on Windows, named like the extended attribute used on Linux.
+const windowsTagStream = "user.tags"
+
+// FinderColors maps the names of the macOS Finder tag colors to the index that
+// Finder stores with a tag of that color.
+var FinderColors = map[string]int{
+	"gray":   1,
+	"green":  2,
+	"purple": 3,
+	"blue":   4,
+	"yellow": 5,
+	"red":    6,
+	"orange": 7,
+}
+
 // GetTags returns a list of file tags for the current operating system.
 func GetTags(file *os.File) ([]string, error) {
 	if file == nil {
@@ -41,6 +58,8 @@ func GetTags(file *os.File) ([]string, error) {
 		return getDarwinTags(file.Name())
 	case "linux":
 		return getLinuxTags(file.Name())
+	case "windows":
+		return getWindowsTags(file.Name())
 	default:
 		return nil, fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 	}
@@ -48,15 +67,24 @@ func GetTags(file *os.File) ([]string, error) {
 
 // SetTags sets a list of tags for a file on the current operating system.
 func SetTags(file *os.File, tags ...string) error {
+	return SetColoredTags(file, nil, tags...)
+}
+
+// SetColoredTags sets a list of tags for a file like SetTags, giving each tag
+// in colors the Finder color index it maps to. Colors are only recorded on
+// macOS.
+func SetColoredTags(file *os.File, colors map[string]int, tags ...string) error {
 	if file == nil {
 		return ErrFileNotExists
 	}
 
 	switch runtime.GOOS {
 	case "darwin":
-		return setDarwinTags(file.Name(), tags...)
+		return setDarwinTags(file.Name(), colors, tags...)
 	case "linux":
 		return setLinuxTags(file.Name(), tags...)
+	case "windows":
+		return setWindowsTags(file.Name(), tags...)
 	default:
 		return fmt.Errorf("unsupported operating system: %s", runtime.GOOS)
 	}
@@ -97,11 +125,22 @@ func getDarwinTags(filePath string) ([]string, error) {
 	return toReturn, nil
 }
 
-// setDarwinTags sets tags for a file on macOS.
-func setDarwinTags(filePath string, tags ...string) error {
+// darwinTag returns the entry of the tag in the macOS tag list, which is the
+// tag followed by a newline and its color index if it has a color.
+func darwinTag(tag string, colors map[string]int) string {
+	if color := colors[tag]; color > 0 {
+		return fmt.Sprintf("%s\n%d", tag, color)
+	}
+
+	return tag
+}
+
+// setDarwinTags sets tags for a file on macOS, with the Finder color indices
+// of the tags in colors.
+func setDarwinTags(filePath string, colors map[string]int, tags ...string) error {
 	var plistArrayElements string
 	for _, tag := range tags {
-		plistArrayElements += fmt.Sprintf("<string>%s</string>", tag)
+		plistArrayElements += fmt.Sprintf("<string>%s</string>", darwinTag(tag, colors))
 	}
 
 	plistArray := fmt.Sprintf("<array>%s</array>", plistArrayElements)
@@ -120,64 +159,66 @@ func setDarwinTags(filePath string, tags ...string) error {
 	return cmd.Run()
 }
 
-// hasLinuxTags checks if the file has the 'user.tags' extended attribute.
-func hasLinuxTags(filePath string) (bool, error) {
-	// Use `getfattr` to list all extended attributes
-	cmd := exec.Command("getfattr", "-d", filePath)
+// linuxAttrTags is the extended attribute that holds the tags of a file on
+// Linux, as a comma-separated list.
+const linuxAttrTags = "user.tags"
 
-	var out, stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
+// getLinuxTags retrieves tags from a file on Linux using extended attributes.
+func getLinuxTags(filePath string) ([]string, error) {
+	value, err := xattr.Get(filePath, linuxAttrTags)
+	if errors.Is(err, xattr.ENOATTR) {
+		return nil, nil
+	}
 
-	if err := cmd.Run(); err != nil {
-		return false, fmt.Errorf("error checking extended attributes: %v, stderr: %s", err, stderr.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
 	}
 
-	// Check if the output contains the 'user.tags' attribute
-	return strings.Contains(out.String(), "user.tags"), nil
+	return splitTags(string(value)), nil
 }
 
-// getLinuxTags retrieves tags from a file on Linux using extended attributes.
-func getLinuxTags(filePath string) ([]string, error) {
-	// First, check if the file has the 'user.tags' attribute
-	hasTags, err := hasLinuxTags(filePath)
-	if err != nil {
-		return nil, err
-	}
-	if !hasTags {
-		// If the file doesn't have the 'user.tags' attribute, return nil
-		return nil, nil
+// setLinuxTags sets tags for a file on Linux using extended attributes.
+func setLinuxTags(filePath string, tags ...string) error {
+	if err := xattr.Set(filePath, linuxAttrTags, []byte(strings.Join(tags, ","))); err != nil {
+		return fmt.Errorf("failed to set tags: %w", err)
 	}
 
-	// Use `getfattr` to retrieve the extended attribute with the tags
-	cmd := exec.Command("getfattr", "-n", "user.tags", "--only-values", filePath)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = os.Stderr
+	return nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, err
+// splitTags splits a comma-separated list of tags, as stored on Linux and
+// Windows.
+func splitTags(s string) []string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
 	}
 
-	if out.String() == "" {
+	return strings.Split(s, ",")
+}
+
+// getWindowsTags retrieves tags from a file on Windows, which are stored in an
+// alternate data stream of the file.
+func getWindowsTags(filePath string) ([]string, error) {
+	data, err := os.ReadFile(filePath + ":" + windowsTagStream)
+	if errors.Is(err, fs.ErrNotExist) {
 		return nil, nil
 	}
 
-	// Split the retrieved tag string into individual tags
-	tags := strings.Split(strings.TrimSpace(out.String()), ",")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag stream: %w", err)
+	}
 
-	return tags, nil
+	return splitTags(string(data)), nil
 }
 
-// setLinuxTags sets tags for a file on Linux using extended attributes.
-func setLinuxTags(filePath string, tags ...string) error {
-	// Join tags into a single string, separated by commas
-	tagString := strings.Join(tags, ",")
-
-	// Use `setfattr` to set the extended attribute with the tags
-	cmd := exec.Command("setfattr", "-n", "user.tags", "-v", tagString, filePath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// setWindowsTags sets tags for a file on Windows in an alternate data stream
+// of the file. The file system must support alternate data streams, as NTFS
+// does.
+func setWindowsTags(filePath string, tags ...string) error {
+	if err := os.WriteFile(filePath+":"+windowsTagStream, []byte(strings.Join(tags, ",")), 0o600); err != nil {
+		return fmt.Errorf("failed to write tag stream: %w", err)
+	}
 
-	return cmd.Run()
+	return nil
 }
@@ -91,3 +91,19 @@ func TestSetTags(t *testing.T) {
 		})
 	}
 }
+
+func TestDarwinTag(t *testing.T) {
+	colors := map[string]int{"important": FinderColors["red"], "later": 0}
+
+	assert.Equal(t, "important\n6", darwinTag("important", colors))
+	assert.Equal(t, "later", darwinTag("later", colors))
+	assert.Equal(t, "other", darwinTag("other", colors))
+	assert.Equal(t, "other", darwinTag("other", nil))
+}
+
+func TestSplitTags(t *testing.T) {
+	assert.Nil(t, splitTags(""))
+	assert.Nil(t, splitTags(" \n"))
+	assert.Equal(t, []string{"tag1"}, splitTags("tag1\n"))
+	assert.Equal(t, []string{"tag1", "tag2"}, splitTags("tag1,tag2"))
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streamutil
+
+import (
+	"hash"
+	"io"
+)
+
+// Middleware wraps a reader to act on the bytes read through it.
+type Middleware func(r io.Reader) io.Reader
+
+// Chain returns r wrapped by the middlewares, the first of which reads from r
+// directly. Nil middlewares are skipped.
+func Chain(r io.Reader, mws ...Middleware) io.Reader {
+	for _, mw := range mws {
+		if mw != nil {
+			r = mw(r)
+		}
+	}
+
+	return r
+}
+
+// Progress reports the number of bytes of each read to fn. An error from fn
+// is returned by the read, if the read itself did not fail.
+func Progress(fn func(n int) error) Middleware {
+	return func(r io.Reader) io.Reader {
+		return &progressReader{r: r, fn: fn}
+	}
+}
+
+type progressReader struct {
+	r  io.Reader
+	fn func(int) error
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		if fnErr := pr.fn(n); fnErr != nil && err == nil {
+			err = fnErr
+		}
+	}
+
+	return n, err
+}
+
+// Hash writes the bytes read to h, so that h holds the hash of the stream once
+// it has been read to the end.
+func Hash(h hash.Hash) Middleware {
+	return func(r io.Reader) io.Reader {
+		return io.TeeReader(r, h)
+	}
+}
+
+// Builder collects the middlewares applied to the streams of push, pull and
+// migrate. The zero value applies none.
+type Builder struct {
+	mws []Middleware
+}
+
+// NewBuilder returns a builder with no middlewares.
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+// Use adds the middleware, applied after those added before it.
+func (b *Builder) Use(mw Middleware) *Builder {
+	if mw != nil {
+		b.mws = append(b.mws, mw)
+	}
+
+	return b
+}
+
+// Progress adds a Progress middleware.
+func (b *Builder) Progress(fn func(n int) error) *Builder {
+	return b.Use(Progress(fn))
+}
+
+// Hash adds a Hash middleware.
+func (b *Builder) Hash(h hash.Hash) *Builder {
+	return b.Use(Hash(h))
+}
+
+// Wrap returns r wrapped by the middlewares of the builder.
+func (b *Builder) Wrap(r io.Reader) io.Reader {
+	return Chain(r, b.mws...)
+}
+
+// Copy copies src to dst through the middlewares of the builder.
+func (b *Builder) Copy(dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, b.Wrap(src))
+}
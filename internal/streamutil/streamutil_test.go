@@ -0,0 +1,57 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streamutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	data := strings.Repeat("diskhop", 1000)
+
+	progress := 0
+	h := sha256.New()
+
+	var dst bytes.Buffer
+
+	n, err := NewBuilder().
+		Progress(func(n int) error { progress += n; return nil }).
+		Hash(h).
+		Copy(&dst, strings.NewReader(data))
+	require.NoError(t, err)
+
+	sum := sha256.Sum256([]byte(data))
+
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, len(data), progress)
+	assert.Equal(t, sum[:], h.Sum(nil))
+	assert.Equal(t, data, dst.String())
+}
+
+func TestProgressError(t *testing.T) {
+	errStop := errors.New("stop")
+
+	r := Chain(strings.NewReader("data"), Progress(func(int) error { return errStop }))
+
+	_, err := r.Read(make([]byte, 4))
+	assert.ErrorIs(t, err, errStop)
+}
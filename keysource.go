@@ -0,0 +1,243 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+)
+
+// The key of a repository is referenced by its keyFile, whose scheme selects
+// the source that the key is resolved from:
+//
+//	path or file:<path>  the file at the path
+//	env:<name>           the environment variable, base64-encoded
+//	stdin:               standard input, until EOF, for one key at most
+//	keychain:<service>   the OS keychain, base64-encoded
+//	kms:<path>           the file at the path, encrypted by AWS KMS
+//
+// A reference with any other scheme is a path.
+const (
+	FileKeyScheme     = "file:"
+	EnvKeyScheme      = "env:"
+	StdinKeyScheme    = "stdin:"
+	KeychainKeyScheme = "keychain:"
+	KMSKeyScheme      = "kms:"
+)
+
+// ErrInsecureKeyFile indicates that a key file can be accessed by users other
+// than its owner.
+var ErrInsecureKeyFile = errors.New("key file is accessible by other users")
+
+// KeySource is where the key of a repository is resolved from.
+type KeySource interface {
+	Resolve(ctx context.Context) ([]byte, error)
+}
+
+// FileKeySource is the path of a file holding the key.
+type FileKeySource string
+
+// Resolve reads the key from the file.
+func (path FileKeySource) Resolve(context.Context) ([]byte, error) {
+	key, err := os.ReadFile(string(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	return key, nil
+}
+
+// CheckPermissions returns ErrInsecureKeyFile if users other than the owner
+// have any permission on the file, as ssh refuses such private keys. Windows
+// has no such permission bits, so the file always passes there.
+func (path FileKeySource) CheckPermissions() error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	info, err := os.Stat(string(path))
+	if err != nil {
+		return fmt.Errorf("failed to stat key file: %w", err)
+	}
+
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return fmt.Errorf("%w: %s has mode %04o", ErrInsecureKeyFile, string(path), perm)
+	}
+
+	return nil
+}
+
+// EnvKeySource is the name of an environment variable holding the key
+// base64-encoded.
+type EnvKeySource string
+
+// Resolve reads the key from the environment variable.
+func (name EnvKeySource) Resolve(context.Context) ([]byte, error) {
+	encoded, ok := os.LookupEnv(string(name))
+	if !ok {
+		return nil, fmt.Errorf("key variable %s is not set", string(name))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key from %s: %w", string(name), err)
+	}
+
+	return key, nil
+}
+
+// StdinKeySource reads the key from standard input, so that a command that
+// resolves it cannot prompt for anything else.
+type StdinKeySource struct{}
+
+// Resolve reads the key from standard input until EOF, trimming the newline
+// that a pipe such as echo ends it with.
+func (StdinKeySource) Resolve(context.Context) ([]byte, error) {
+	return readStdinKey(os.Stdin)
+}
+
+func readStdinKey(r io.Reader) ([]byte, error) {
+	key, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key from stdin: %w", err)
+	}
+
+	key = bytes.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("no key on stdin")
+	}
+
+	return key, nil
+}
+
+// KeychainKeySource is the service that the key is stored under in the
+// keychain of the operating system: the macOS Keychain, the Linux Secret
+// Service or the Windows Credential Manager. The keychain holds the key
+// base64-encoded.
+type KeychainKeySource string
+
+// Resolve reads the key from the keychain.
+func (service KeychainKeySource) Resolve(context.Context) ([]byte, error) {
+	secret, err := osutil.ReadSecret(string(service))
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key from keychain: %w", err)
+	}
+
+	return key, nil
+}
+
+// StoreKey stores the key in the keychain, replacing the one stored under the
+// service if any.
+func (service KeychainKeySource) StoreKey(key []byte) error {
+	return osutil.WriteSecret(string(service), base64.StdEncoding.EncodeToString(key))
+}
+
+// KMSKeySource is the path of a file holding the key encrypted by AWS KMS. It
+// is decrypted with the AWS CLI, using its configured credentials and region.
+type KMSKeySource string
+
+// Resolve decrypts the key in the file with KMS.
+func (path KMSKeySource) Resolve(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "aws", "kms", "decrypt",
+		"--ciphertext-blob", "fileb://"+string(path),
+		"--query", "Plaintext",
+		"--output", "text")
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to decrypt key with KMS: %v, stderr: %s", err, stderr.String())
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode key from KMS: %w", err)
+	}
+
+	return key, nil
+}
+
+// ParseKeySource returns the source that the key reference selects by its
+// scheme. It returns nil if ref is empty.
+func ParseKeySource(ref string) KeySource {
+	if ref == "" {
+		return nil
+	}
+
+	scheme, rest, ok := strings.Cut(ref, ":")
+	if !ok {
+		return FileKeySource(ref)
+	}
+
+	switch scheme + ":" {
+	case FileKeyScheme:
+		return FileKeySource(rest)
+	case EnvKeyScheme:
+		return EnvKeySource(rest)
+	case StdinKeyScheme:
+		return StdinKeySource{}
+	case KeychainKeyScheme:
+		return KeychainKeySource(rest)
+	case KMSKeyScheme:
+		return KMSKeySource(rest)
+	default:
+		return FileKeySource(ref)
+	}
+}
+
+// CheckKeySources returns an error if more than one of the refs reads its key
+// from standard input, which is read until EOF and so only holds one.
+func CheckKeySources(refs ...string) error {
+	var stdin []string
+	for _, ref := range refs {
+		if _, ok := ParseKeySource(ref).(StdinKeySource); ok {
+			stdin = append(stdin, ref)
+		}
+	}
+
+	if len(stdin) > 1 {
+		return fmt.Errorf("%d keys are read from stdin, which holds only one", len(stdin))
+	}
+
+	return nil
+}
+
+// ResolveKey resolves the key that ref references, returning nil if ref is
+// empty.
+func ResolveKey(ctx context.Context, ref string) ([]byte, error) {
+	source := ParseKeySource(ref)
+	if source == nil {
+		return nil, nil
+	}
+
+	return source.Resolve(ctx)
+}
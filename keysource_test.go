@@ -0,0 +1,109 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeySource(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		ref  string
+		want KeySource
+	}{
+		{ref: "", want: nil},
+		{ref: "/keys/diskhop.key", want: FileKeySource("/keys/diskhop.key")},
+		{ref: "file:/keys/diskhop.key", want: FileKeySource("/keys/diskhop.key")},
+		{ref: "env:DISKHOP_KEY", want: EnvKeySource("DISKHOP_KEY")},
+		{ref: "stdin:", want: StdinKeySource{}},
+		{ref: "keychain:diskhop", want: KeychainKeySource("diskhop")},
+		{ref: "kms:/keys/diskhop.key.enc", want: KMSKeySource("/keys/diskhop.key.enc")},
+		{ref: `C:\keys\diskhop.key`, want: FileKeySource(`C:\keys\diskhop.key`)},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, ParseKeySource(test.ref), test.ref)
+	}
+}
+
+func TestFileKeySource(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("secret"), 0o600))
+
+	key, err := ResolveKey(context.Background(), path)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("secret"), key)
+}
+
+func TestEnvKeySource(t *testing.T) {
+	t.Setenv("DISKHOP_TEST_KEY", "c2VjcmV0\n")
+
+	key, err := ResolveKey(context.Background(), "env:DISKHOP_TEST_KEY")
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("secret"), key)
+
+	_, err = ResolveKey(context.Background(), "env:DISKHOP_TEST_KEY_UNSET")
+	assert.Error(t, err)
+}
+
+func TestReadStdinKey(t *testing.T) {
+	t.Parallel()
+
+	key, err := readStdinKey(strings.NewReader("secret\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("secret"), key)
+
+	_, err = readStdinKey(strings.NewReader(" \n"))
+	assert.ErrorContains(t, err, "no key on stdin")
+}
+
+func TestCheckKeySources(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, CheckKeySources("stdin:", "env:DISKHOP_KEY", ""))
+	assert.Error(t, CheckKeySources("stdin:", "keychain:diskhop", "stdin:"))
+}
+
+func TestFileKeySourceCheckPermissions(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not checked on windows")
+	}
+
+	path := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(path, []byte("secret"), 0o600))
+
+	assert.NoError(t, FileKeySource(path).CheckPermissions())
+
+	require.NoError(t, os.Chmod(path, 0o644))
+
+	assert.ErrorIs(t, FileKeySource(path).CheckPermissions(), ErrInsecureKeyFile)
+}
@@ -0,0 +1,141 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+)
+
+// MaskMapName is the name of the file written by a masked pull that holds the
+// encrypted mapping from masked file names to their real names.
+const MaskMapName = ".diskhop-mask"
+
+// maskMap maps the masked name of a pulled file to its real name.
+type maskMap map[string]string
+
+// readMaskMap opens and decodes the mask map in dir. It returns an empty map
+// if the directory has none.
+func readMaskMap(ctx context.Context, dir string, o dcrypto.Opener) (maskMap, error) {
+	m := maskMap{}
+	if err := readSealedJSON(ctx, filepath.Join(dir, MaskMapName), o, &m); err != nil {
+		return nil, fmt.Errorf("failed to read mask map: %w", err)
+	}
+
+	return m, nil
+}
+
+// writeMaskMap encrypts the mask map into dir, removing the file if the map
+// is empty.
+func writeMaskMap(ctx context.Context, dir string, s dcrypto.Sealer, m maskMap) error {
+	var v any
+	if len(m) > 0 {
+		v = m
+	}
+
+	if err := writeSealedJSON(ctx, filepath.Join(dir, MaskMapName), s, v); err != nil {
+		return fmt.Errorf("failed to write mask map: %w", err)
+	}
+
+	return nil
+}
+
+// recordMasks adds the masked names of a pull to the mask map in dir, keeping
+// the entries of earlier pulls.
+func recordMasks(ctx context.Context, dir string, so dcrypto.SealOpener, masks maskMap) error {
+	m, err := readMaskMap(ctx, dir, so)
+	if err != nil {
+		return err
+	}
+
+	for masked, name := range masks {
+		m[masked] = name
+	}
+
+	return writeMaskMap(ctx, dir, so, m)
+}
+
+// Unmask renames the files in dir that were masked by a pull back to their
+// real names, along with their sidecar tag files. Entries whose masked file
+// is gone are dropped, and files whose real name is already taken are left
+// masked. It returns the number of files renamed.
+func Unmask(ctx context.Context, dir string, so dcrypto.SealOpener) (int, error) {
+	m, err := readMaskMap(ctx, dir, so)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		renamed int
+		errs    []error
+	)
+
+	for masked, name := range m {
+		maskedPath := filepath.Join(dir, masked)
+		if _, err := os.Stat(maskedPath); errors.Is(err, fs.ErrNotExist) {
+			delete(m, masked)
+
+			continue
+		}
+
+		namePath := filepath.Join(dir, name)
+		if _, err := os.Stat(namePath); err == nil {
+			errs = append(errs, fmt.Errorf("cannot unmask %s: %s already exists", masked, name))
+
+			continue
+		}
+
+		if err := renameMasked(maskedPath, namePath); err != nil {
+			errs = append(errs, fmt.Errorf("failed to unmask %s: %w", masked, err))
+
+			continue
+		}
+
+		delete(m, masked)
+		renamed++
+	}
+
+	if err := writeMaskMap(ctx, dir, so, m); err != nil {
+		errs = append(errs, err)
+	}
+
+	return renamed, errors.Join(errs...)
+}
+
+// renameMasked moves a masked file and its sidecar, if any, to their real
+// path.
+func renameMasked(maskedPath, namePath string) error {
+	if err := os.MkdirAll(filepath.Dir(namePath), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := os.Rename(maskedPath, namePath); err != nil {
+		return err
+	}
+
+	err := os.Rename(osutil.SidecarPath(maskedPath), osutil.SidecarPath(namePath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to rename sidecar: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainSealOpener leaves data unencrypted.
+type plainSealOpener struct{}
+
+func (plainSealOpener) Seal(_ context.Context, plaintext []byte) ([]byte, error) {
+	return append([]byte(nil), plaintext...), nil
+}
+
+func (plainSealOpener) Open(_ context.Context, ciphertext []byte) ([]byte, error) {
+	return append([]byte(nil), ciphertext...), nil
+}
+
+func TestUnmask(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	for _, name := range []string{"m1.txt", "m1.txt.tags", "m2.txt", "taken.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+
+	masks := maskMap{
+		"m1.txt":   "sub/real.txt",
+		"m2.txt":   "taken.txt",
+		"gone.txt": "gone-real.txt",
+	}
+	require.NoError(t, recordMasks(ctx, dir, plainSealOpener{}, masks))
+
+	n, err := Unmask(ctx, dir, plainSealOpener{})
+	assert.Error(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.FileExists(t, filepath.Join(dir, "sub", "real.txt"))
+	assert.FileExists(t, filepath.Join(dir, "sub", "real.txt.tags"))
+	assert.FileExists(t, filepath.Join(dir, "m2.txt"))
+
+	// Only the file whose real name was taken remains masked.
+	remaining, err := readMaskMap(ctx, dir, plainSealOpener{})
+	require.NoError(t, err)
+	assert.Equal(t, maskMap{"m2.txt": "taken.txt"}, remaining)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "taken.txt")))
+
+	n, err = Unmask(ctx, dir, plainSealOpener{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoFileExists(t, filepath.Join(dir, MaskMapName))
+}
@@ -0,0 +1,299 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// ErrUnknownStore indicates that no store is registered for the scheme of a
+// connection string.
+var ErrUnknownStore = errors.New("unknown store")
+
+// Closer is implemented by the backends of a Store that hold a connection.
+type Closer interface {
+	Close(ctx context.Context) error
+}
+
+// A StoreOpener connects to the store that the connection string of cfg
+// points at. A read-only store may serve reads that are slightly stale, so it
+// must only be used by operations that do not push.
+type StoreOpener func(ctx context.Context, cfg Config, readOnly bool) (*Store, error)
+
+// storeBackend is a store registered for a scheme.
+type storeBackend struct {
+	open     StoreOpener
+	validate func(connString string) error
+	ping     func(ctx context.Context, connString string) error
+}
+
+// A StoreOption configures a store registered with RegisterStore.
+type StoreOption func(*storeBackend)
+
+// WithConnStringValidator checks the connection strings of the store without
+// connecting to it, so that ValidateConnString catches a malformed one.
+func WithConnStringValidator(validate func(connString string) error) StoreOption {
+	return func(b *storeBackend) {
+		b.validate = validate
+	}
+}
+
+// WithPinger checks that the store at a connection string responds, for
+// PingStore.
+func WithPinger(ping func(ctx context.Context, connString string) error) StoreOption {
+	return func(b *storeBackend) {
+		b.ping = ping
+	}
+}
+
+var (
+	storesMu sync.RWMutex
+	stores   = map[string]storeBackend{}
+)
+
+// RegisterStore makes the store opener available to OpenStore for connection
+// strings with the scheme, such as "mongodb". Backends register themselves
+// when they are imported, so a program opens a backend by importing it for its
+// side effects:
+//
+//	import _ "github.com/prestonvasquez/diskhop/store/mongodop"
+func RegisterStore(scheme string, open StoreOpener, opts ...StoreOption) {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if _, ok := stores[scheme]; ok {
+		panic("diskhop: store registered twice for scheme " + scheme)
+	}
+
+	backend := storeBackend{open: open}
+	for _, opt := range opts {
+		opt(&backend)
+	}
+
+	stores[scheme] = backend
+}
+
+// lookupStore returns the store registered for the scheme of connString.
+func lookupStore(connString string) (storeBackend, error) {
+	// The connection string is not parsed as a URL, since the error would
+	// hold the credentials in it.
+	scheme, _, ok := strings.Cut(connString, "://")
+
+	storesMu.RLock()
+	defer storesMu.RUnlock()
+
+	if backend, found := stores[scheme]; ok && found {
+		return backend, nil
+	}
+
+	schemes := make([]string, 0, len(stores))
+	for scheme := range stores {
+		schemes = append(schemes, scheme+"://")
+	}
+
+	sort.Strings(schemes)
+
+	expected := strings.Join(schemes, " or ")
+
+	if !ok {
+		// Without a scheme the credentials cannot be told apart to be
+		// redacted, so the connection string is left out.
+		return storeBackend{}, fmt.Errorf("%w for a connection string without a scheme, expected one starting with %s",
+			ErrUnknownStore, expected)
+	}
+
+	return storeBackend{}, fmt.Errorf("%w for %s, expected a connection string starting with %s",
+		ErrUnknownStore, RedactConnString(connString), expected)
+}
+
+// ValidateConnString checks that a store is registered for the scheme of
+// connString and, if the store can tell without connecting, that connString
+// is well formed.
+func ValidateConnString(connString string) error {
+	backend, err := lookupStore(connString)
+	if err != nil {
+		return err
+	}
+
+	if backend.validate == nil {
+		return nil
+	}
+
+	if err := backend.validate(connString); err != nil {
+		return RedactError(err, connString)
+	}
+
+	return nil
+}
+
+// PingStore checks that the store at connString responds, if its store can
+// be pinged.
+func PingStore(ctx context.Context, connString string) error {
+	backend, err := lookupStore(connString)
+	if err != nil {
+		return err
+	}
+
+	if backend.ping == nil {
+		return nil
+	}
+
+	if err := backend.ping(ctx, connString); err != nil {
+		return fmt.Errorf("failed to reach store at %s: %w",
+			RedactConnString(connString), RedactError(err, connString))
+	}
+
+	return nil
+}
+
+// OpenStore connects to the store of the repository with the config.
+func OpenStore(ctx context.Context, cfg Config) (*Store, error) {
+	return openStore(ctx, cfg, false)
+}
+
+// OpenReadStore is like OpenStore, but applies the read preference of the
+// config, so it must only be used by operations that do not push.
+func OpenReadStore(ctx context.Context, cfg Config) (*Store, error) {
+	return openStore(ctx, cfg, true)
+}
+
+func openStore(ctx context.Context, cfg Config, readOnly bool) (*Store, error) {
+	backend, err := lookupStore(cfg.ConnString)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := backend.open(ctx, cfg, readOnly)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to store at %s: %w",
+			RedactConnString(cfg.ConnString), RedactError(err, cfg.ConnString))
+	}
+
+	return s, nil
+}
+
+// Close disconnects from the store, if its backend holds a connection.
+func (s *Store) Close(ctx context.Context) error {
+	if s.Closer == nil {
+		return nil
+	}
+
+	return s.Closer.Close(ctx)
+}
+
+// LoadKey resolves the key that ref references, returning nil if ref is empty.
+// A key file that users other than its owner can access is refused with
+// ErrInsecureKeyFile, unless the config allows insecure key files.
+func LoadKey(ctx context.Context, cfg Config, ref string) ([]byte, error) {
+	if path, ok := ParseKeySource(ref).(FileKeySource); ok && !cfg.InsecureKeyFile {
+		if err := path.CheckPermissions(); errors.Is(err, ErrInsecureKeyFile) {
+			return nil, err
+		}
+	}
+
+	return ResolveKey(ctx, ref)
+}
+
+// LoadSealOpener returns the seal opener for the files of the repository with
+// the config: one for its recipients if it has any, one for its key if it has
+// that, and nil otherwise.
+func LoadSealOpener(ctx context.Context, cfg Config, mgr dcrypto.IVManagerGetter) (dcrypto.SealOpener, error) {
+	if len(cfg.Recipients) > 0 {
+		return loadRecipients(ctx, cfg)
+	}
+
+	key, err := LoadKey(ctx, cfg, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	if key == nil {
+		return nil, nil
+	}
+
+	// The cipher keeps its own copy of the key.
+	defer dcrypto.Zero(key)
+
+	so, err := NewSealOpener(mgr, key, cfg.Cipher, cfg.NonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create seal opener: %w", err)
+	}
+
+	return so, nil
+}
+
+// LoadMetadataSealOpener returns the seal opener for the names and metadata
+// of the repository with the config if it has a separate metadata key, and
+// nil otherwise.
+func LoadMetadataSealOpener(ctx context.Context, cfg Config, mgr dcrypto.IVManagerGetter) (dcrypto.SealOpener, error) {
+	key, err := LoadKey(ctx, cfg, cfg.MetadataKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata key: %w", err)
+	}
+
+	if key == nil {
+		return nil, nil
+	}
+
+	// The cipher keeps its own copy of the key.
+	defer dcrypto.Zero(key)
+
+	so, err := NewSealOpener(mgr, key, cfg.Cipher, cfg.NonceSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metadata seal opener: %w", err)
+	}
+
+	return so, nil
+}
+
+// loadRecipients returns the seal opener for the recipients of a shared
+// bucket, which opens with the identity of the user.
+func loadRecipients(ctx context.Context, cfg Config) (dcrypto.SealOpener, error) {
+	if cfg.IdentityFile == "" {
+		return nil, fmt.Errorf("recipients require an identity file")
+	}
+
+	identity, err := LoadKey(ctx, cfg, cfg.IdentityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	defer dcrypto.Zero(identity)
+
+	recipients := make([][]byte, 0, len(cfg.Recipients))
+	for _, path := range cfg.Recipients {
+		pub, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recipient: %w", err)
+		}
+
+		recipients = append(recipients, pub)
+	}
+
+	so, err := NewRecipients(identity, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recipients seal opener: %w", err)
+	}
+
+	return so, nil
+}
@@ -0,0 +1,434 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+)
+
+// ErrNotDiskhop indicates that a directory is not a diskhop repository.
+var ErrNotDiskhop = errors.New("not a diskhop repository")
+
+// Store bundles the remote capabilities used by the repository-level
+// operations. Capabilities that a backend does not support may be nil.
+type Store struct {
+	Pusher    store.Pusher
+	Puller    store.Puller
+	Reverter  store.Reverter
+	Upgrader  store.Upgrader
+	Rewrapper store.Rewrapper
+	Stater    store.Stater
+	Checker   store.Checker
+	Logger    store.CommitLogger
+	Resetter  store.Resetter
+	Remover   store.Remover
+	Pruner    store.Pruner
+	Excluder  store.Excluder
+	IVMgr     dcrypto.IVManagerGetter
+	Closer    Closer
+}
+
+// NewAESGCM returns a SealOpener that encrypts data with AES-GCM using the
+// given key, registering every nonce with the IV manager.
+func NewAESGCM(mgr dcrypto.IVManagerGetter, key []byte) (dcrypto.SealOpener, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new AES cipher: %w", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new GCM cipher: %w", err)
+	}
+
+	return dcrypto.NewAEAD(mgr, aesgcm), nil
+}
+
+// Push uploads the files in the repository at cfg.CurDir to the store of the
+// config, sealing them with its keys, and securely deletes the local copies.
+func Push(ctx context.Context, cfg Config, opts ...store.PushOption) (err error) {
+	if !IsDiskhopRepository(cfg.CurDir) {
+		return ErrNotDiskhop
+	}
+
+	s, err := OpenStore(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open store: %w", err)
+	}
+
+	defer func() { err = errors.Join(err, s.Close(ctx)) }()
+
+	so, mso, err := loadSealOpeners(ctx, cfg, s.IVMgr)
+	if err != nil {
+		return err
+	}
+
+	sealOpts := []store.PushOption{}
+	if so != nil {
+		sealOpts = append(sealOpts, store.WithPushSealOpener(so))
+	}
+
+	if mso != nil {
+		sealOpts = append(sealOpts, store.WithPushMetadataSealOpener(mso))
+	}
+
+	return PushFiles(ctx, cfg, NewFilePusher(s.Pusher), append(sealOpts, opts...)...)
+}
+
+// PushFiles is like Push, but pushes with fp, such as one that asks before
+// deleting the local copies, and seals with the seal openers in opts.
+func PushFiles(ctx context.Context, cfg Config, fp *FilePusher, opts ...store.PushOption) error {
+	if !IsDiskhopRepository(cfg.CurDir) {
+		return ErrNotDiskhop
+	}
+
+	dir, err := os.Open(cfg.CurDir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+
+	defer func() { _ = dir.Close() }()
+
+	if err := fp.Push(ctx, dir, opts...); err != nil {
+		return fmt.Errorf("failed to push: %w", err)
+	}
+
+	return nil
+}
+
+// Pull securely deletes the files in the repository at cfg.CurDir and then
+// downloads the files selected by opts from the store of the config into it,
+// opening them with its keys.
+func Pull(ctx context.Context, cfg Config, opts ...store.PullOption) (_ *store.PullDescription, err error) {
+	if !IsDiskhopRepository(cfg.CurDir) {
+		return nil, ErrNotDiskhop
+	}
+
+	s, err := OpenReadStore(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	defer func() { err = errors.Join(err, s.Close(ctx)) }()
+
+	so, mso, err := loadSealOpeners(ctx, cfg, s.IVMgr)
+	if err != nil {
+		return nil, err
+	}
+
+	sealOpts := []store.PullOption{}
+	if so != nil {
+		sealOpts = append(sealOpts, store.WithPullSealOpener(so))
+	}
+
+	if mso != nil {
+		sealOpts = append(sealOpts, store.WithPullMetadataSealOpener(mso))
+	}
+
+	return PullFiles(ctx, cfg, NewFilePuller(s.Puller), append(sealOpts, opts...)...)
+}
+
+// PullFiles is like Pull, but pulls with fp, such as one that keeps local
+// tags, and opens with the seal openers in opts. If fp keeps local tags, the
+// tags of the deleted files are recorded in the tag cache first.
+func PullFiles(ctx context.Context, cfg Config, fp *FilePuller, opts ...store.PullOption) (*store.PullDescription, error) {
+	if !IsDiskhopRepository(cfg.CurDir) {
+		return nil, ErrNotDiskhop
+	}
+
+	fp.Dir = cfg.CurDir
+
+	if fp.TagMerge != "" {
+		mergedOpts := store.PullOptions{}
+		for _, opt := range opts {
+			opt(&mergedOpts)
+		}
+
+		so := mergedOpts.SealOpenerForMetadata()
+		if so == nil {
+			return nil, fmt.Errorf("keeping local tags requires encryption")
+		}
+
+		if err := SnapshotTags(ctx, cfg.CurDir, so); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := CleanRepository(cfg); err != nil {
+		return nil, err
+	}
+
+	desc, err := fp.Pull(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pull: %w", err)
+	}
+
+	return desc, nil
+}
+
+// Checkout securely deletes the files in the repository at cfg.CurDir and
+// then downloads the files as they were right after the push recorded by the
+// commit sha, including the versions that later pushes replaced.
+func Checkout(ctx context.Context, cfg Config, fp *FilePuller, sha string, opts ...store.PullOption) (*store.PullDescription, error) {
+	opts = append(opts, store.WithPullCommit(sha))
+
+	desc, err := PullFiles(ctx, cfg, fp, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checkout %s: %w", sha, err)
+	}
+
+	return desc, nil
+}
+
+// PullSingle writes the one file selected by opts to w, leaving the
+// repository untouched. It fails with store.ErrNotSingleMatch if the selection
+// matches zero or several files.
+func PullSingle(ctx context.Context, fp *FilePuller, w io.Writer, opts ...store.PullOption) error {
+	fp.Output = w
+
+	opts = append(opts, store.WithPullSingle())
+	if _, err := fp.Pull(ctx, opts...); err != nil {
+		return fmt.Errorf("failed to pull: %w", err)
+	}
+
+	return nil
+}
+
+// loadSealOpeners returns the seal openers for the files and for the
+// metadata of the repository with the config. See LoadSealOpener and
+// LoadMetadataSealOpener.
+func loadSealOpeners(ctx context.Context, cfg Config, mgr dcrypto.IVManagerGetter) (so, mso dcrypto.SealOpener, err error) {
+	if so, err = LoadSealOpener(ctx, cfg, mgr); err != nil {
+		return nil, nil, err
+	}
+
+	if mso, err = LoadMetadataSealOpener(ctx, cfg, mgr); err != nil {
+		return nil, nil, err
+	}
+
+	return so, mso, nil
+}
+
+// CleanRepository securely deletes the non-hidden files in the repository at
+// cfg.CurDir.
+func CleanRepository(cfg Config) error {
+	if !IsDiskhopRepository(cfg.CurDir) {
+		return ErrNotDiskhop
+	}
+
+	dir, err := os.Open(cfg.CurDir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory: %w", err)
+	}
+
+	defer func() { _ = dir.Close() }()
+
+	entities, err := dir.Readdir(-1)
+	if err != nil {
+		return fmt.Errorf("failed to read directory contents: %w", err)
+	}
+
+	if err := CleanDir(cfg.CurDir, entities); err != nil {
+		return fmt.Errorf("failed to clean directory: %w", err)
+	}
+
+	return nil
+}
+
+// Revert undoes the push recorded by the commit sha, restoring the files it
+// replaced.
+func Revert(ctx context.Context, s Store, sha string) error {
+	if s.Reverter == nil {
+		return fmt.Errorf("store does not support revert")
+	}
+
+	if err := s.Reverter.Revert(ctx, sha); err != nil {
+		return fmt.Errorf("failed to revert: %w", err)
+	}
+
+	return nil
+}
+
+// Reset deletes every file of the branch of the store, leaving it empty.
+func Reset(ctx context.Context, s Store) error {
+	if s.Resetter == nil {
+		return fmt.Errorf("store does not support reset")
+	}
+
+	if err := s.Resetter.Reset(ctx); err != nil {
+		return fmt.Errorf("failed to reset: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveOlderThan deletes the files of the branch of the store pushed before
+// the time, returning the number of files deleted.
+func RemoveOlderThan(ctx context.Context, s Store, before time.Time) (int, error) {
+	if s.Remover == nil {
+		return 0, fmt.Errorf("store does not support removing files")
+	}
+
+	n, err := s.Remover.RemoveOlderThan(ctx, before)
+	if err != nil {
+		return n, fmt.Errorf("failed to remove files: %w", err)
+	}
+
+	return n, nil
+}
+
+// DescribeRemoveOlderThan lists the files that RemoveOlderThan would delete,
+// decrypting their names with opener if it is set.
+func DescribeRemoveOlderThan(ctx context.Context, s Store, before time.Time, opener dcrypto.Opener) ([]store.RemovedFile, error) {
+	if s.Remover == nil {
+		return nil, fmt.Errorf("store does not support removing files")
+	}
+
+	files, err := s.Remover.DescribeRemoveOlderThan(ctx, before, opener)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe removal: %w", err)
+	}
+
+	return files, nil
+}
+
+// Prune deletes the files and versions of the branch of the store that the
+// policy does not keep, returning the number deleted.
+func Prune(ctx context.Context, s Store, policy store.RetentionPolicy) (int, error) {
+	if s.Pruner == nil {
+		return 0, fmt.Errorf("store does not support prune")
+	}
+
+	n, err := s.Pruner.Prune(ctx, policy)
+	if err != nil {
+		return n, fmt.Errorf("failed to prune: %w", err)
+	}
+
+	return n, nil
+}
+
+// DescribePrune lists the files and versions that Prune would delete,
+// decrypting their names with opener if it is set.
+func DescribePrune(ctx context.Context, s Store, policy store.RetentionPolicy, opener dcrypto.Opener) ([]store.PrunedFile, error) {
+	if s.Pruner == nil {
+		return nil, fmt.Errorf("store does not support prune")
+	}
+
+	files, err := s.Pruner.DescribePrune(ctx, policy, opener)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe prune: %w", err)
+	}
+
+	return files, nil
+}
+
+// ExcludePolicy returns the glob patterns of the names of the files that
+// pulls of the store leave out.
+func ExcludePolicy(ctx context.Context, s Store) ([]string, error) {
+	if s.Excluder == nil {
+		return nil, fmt.Errorf("store does not support exclude policies")
+	}
+
+	patterns, err := s.Excluder.ExcludePolicy(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exclude policy: %w", err)
+	}
+
+	return patterns, nil
+}
+
+// SetExcludePolicy replaces the glob patterns of the names of the files that
+// pulls of the store leave out.
+func SetExcludePolicy(ctx context.Context, s Store, patterns []string) error {
+	if s.Excluder == nil {
+		return fmt.Errorf("store does not support exclude policies")
+	}
+
+	if err := s.Excluder.SetExcludePolicy(ctx, patterns); err != nil {
+		return fmt.Errorf("failed to set exclude policy: %w", err)
+	}
+
+	return nil
+}
+
+// Log returns the commits of the store, newest first, at most limit of them if
+// limit is positive.
+func Log(ctx context.Context, s Store, limit int) ([]store.Commit, error) {
+	if s.Logger == nil {
+		return nil, fmt.Errorf("store does not support log")
+	}
+
+	commits, err := s.Logger.Log(ctx, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %w", err)
+	}
+
+	return commits, nil
+}
+
+// DescribeRevert lists the files that reverting the commit sha would delete,
+// decrypting their names with opener if it is set.
+func DescribeRevert(ctx context.Context, s Store, sha string, opener dcrypto.Opener) ([]store.RevertedFile, error) {
+	if s.Reverter == nil {
+		return nil, fmt.Errorf("store does not support revert")
+	}
+
+	files, err := s.Reverter.DescribeRevert(ctx, sha, opener)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe revert: %w", err)
+	}
+
+	return files, nil
+}
+
+// Rewrap rewraps the data keys of everything sealed on the remote host with
+// rw, returning the number of files rewrapped.
+func Rewrap(ctx context.Context, s Store, rw dcrypto.Rewrapper) (int, error) {
+	if s.Rewrapper == nil {
+		return 0, fmt.Errorf("store does not support rewrapping")
+	}
+
+	n, err := s.Rewrapper.Rewrap(ctx, rw)
+	if err != nil {
+		return n, fmt.Errorf("failed to rewrap: %w", err)
+	}
+
+	return n, nil
+}
+
+// Upgrade migrates the remote host to the newest format version, returning
+// the versions before and after the migration.
+func Upgrade(ctx context.Context, s Store, so dcrypto.SealOpener) (int, int, error) {
+	if s.Upgrader == nil {
+		return 0, 0, fmt.Errorf("store does not support upgrade")
+	}
+
+	from, to, err := s.Upgrader.Upgrade(ctx, so)
+	if err != nil {
+		return from, to, fmt.Errorf("failed to upgrade: %w", err)
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// NewRecipients returns a SealOpener for a bucket shared by the owners of the
+// PEM-encoded RSA public keys in recipients, which opens with the PEM-encoded
+// private key identity. The public key of identity is a recipient too, so
+// that what is sealed can be opened again.
+func NewRecipients(identity []byte, recipients ...[]byte) (*dcrypto.Recipients, error) {
+	priv, err := parseRSAPrivateKey(identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity: %w", err)
+	}
+
+	so := &dcrypto.Recipients{Identity: priv}
+
+	self, err := dcrypto.KeyID(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	included := false
+
+	for i, data := range recipients {
+		pub, err := parseRSAPublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse recipient %d: %w", i, err)
+		}
+
+		id, err := dcrypto.KeyID(pub)
+		if err != nil {
+			return nil, err
+		}
+
+		included = included || bytes.Equal(id, self)
+
+		so.Recipients = append(so.Recipients, pub)
+	}
+
+	if !included {
+		so.Recipients = append(so.Recipients, &priv.PublicKey)
+	}
+
+	return so, nil
+}
+
+// parseRSAPublicKey parses a PEM-encoded RSA public key in PKIX or PKCS #1
+// form.
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is a %T, not an RSA key", key)
+	}
+
+	return pub, nil
+}
+
+// parseRSAPrivateKey parses a PEM-encoded RSA private key in PKCS #8 or
+// PKCS #1 form.
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is a %T, not an RSA key", key)
+	}
+
+	return priv, nil
+}
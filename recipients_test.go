@@ -0,0 +1,61 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRecipients(t *testing.T) {
+	t.Parallel()
+
+	alice, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	bob, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	identity := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(alice)})
+
+	der, err := x509.MarshalPKIXPublicKey(&bob.PublicKey)
+	require.NoError(t, err)
+
+	recipient := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	so, err := NewRecipients(identity, recipient)
+	require.NoError(t, err)
+
+	// Alice is added as a recipient of her own messages.
+	assert.Len(t, so.Recipients, 2)
+
+	ciphertext, err := so.Seal(context.Background(), []byte("shared"))
+	require.NoError(t, err)
+
+	plaintext, err := so.Open(context.Background(), ciphertext)
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("shared"), plaintext)
+
+	_, err = NewRecipients(identity, []byte("not a key"))
+	assert.Error(t, err)
+}
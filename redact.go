@@ -0,0 +1,91 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redactedPassword replaces the password of a connection string for display.
+const redactedPassword = "xxxxx"
+
+// RedactConnString masks the password in the userinfo of a connection string
+// so that it can be displayed safely.
+func RedactConnString(connString string) string {
+	if uri, err := url.Parse(connString); err == nil {
+		return uri.Redacted()
+	}
+
+	// Connection strings that net/url cannot parse, such as those with
+	// several hosts and ports, are masked by hand: the userinfo is everything
+	// between the scheme and the last "@" before the hosts.
+	schemeEnd := strings.Index(connString, "://")
+	if schemeEnd < 0 {
+		return connString
+	}
+
+	rest := connString[schemeEnd+len("://"):]
+
+	hostsEnd := strings.IndexAny(rest, "/?")
+	if hostsEnd < 0 {
+		hostsEnd = len(rest)
+	}
+
+	at := strings.LastIndex(rest[:hostsEnd], "@")
+	if at < 0 {
+		return connString
+	}
+
+	user, _, hasPassword := strings.Cut(rest[:at], ":")
+	if !hasPassword {
+		return connString
+	}
+
+	return connString[:schemeEnd+len("://")] + user + ":" + redactedPassword + rest[at:]
+}
+
+// RedactError masks the password of the connection string wherever it
+// appears in the message of err, such as when a driver echoes the URI back.
+// The original error is kept in the chain for errors.Is and errors.As.
+func RedactError(err error, connString string) error {
+	if err == nil {
+		return nil
+	}
+
+	uri, parseErr := url.Parse(connString)
+	if parseErr != nil || uri.User == nil {
+		return err
+	}
+
+	password, ok := uri.User.Password()
+	if !ok || password == "" || !strings.Contains(err.Error(), password) {
+		return err
+	}
+
+	return &redactedError{
+		msg: strings.ReplaceAll(err.Error(), password, redactedPassword),
+		err: err,
+	}
+}
+
+// redactedError is an error whose message has had credentials removed.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
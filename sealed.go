@@ -0,0 +1,78 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// readSealedJSON opens the file at path and decodes it into v. It leaves v
+// untouched if the file does not exist.
+func readSealedJSON(ctx context.Context, path string, o dcrypto.Opener, v any) error {
+	ciphertext, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := o.Open(ctx, ciphertext)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	defer dcrypto.Zero(plaintext)
+
+	if err := json.Unmarshal(plaintext, v); err != nil {
+		return fmt.Errorf("failed to decode: %w", err)
+	}
+
+	return nil
+}
+
+// writeSealedJSON encodes v and encrypts it into the file at path. A nil v
+// removes the file.
+func writeSealedJSON(ctx context.Context, path string, s dcrypto.Sealer, v any) error {
+	if v == nil {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	}
+
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode: %w", err)
+	}
+
+	defer dcrypto.Zero(plaintext)
+
+	ciphertext, err := s.Seal(ctx, plaintext)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	return os.WriteFile(path, ciphertext, 0o600)
+}
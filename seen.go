@@ -0,0 +1,74 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// SeenStateName is the name of the file that holds the encrypted names of the
+// files pulled without repetition, by key.
+const SeenStateName = ".diskhop-seen"
+
+// seenState maps a key, usually the branch, to the names of the files pulled
+// under it.
+type seenState map[string][]string
+
+// readSeenState opens and decodes the seen state in dir. It returns an empty
+// state if the directory has none.
+func readSeenState(ctx context.Context, dir string, o dcrypto.Opener) (seenState, error) {
+	state := seenState{}
+	if err := readSealedJSON(ctx, filepath.Join(dir, SeenStateName), o, &state); err != nil {
+		return nil, fmt.Errorf("failed to read seen state: %w", err)
+	}
+
+	return state, nil
+}
+
+// recordSeen adds the names pulled under key to the seen state in dir. If
+// any of them had been seen, the remote started the sample over, so they
+// replace the names seen before.
+func recordSeen(ctx context.Context, dir string, so dcrypto.SealOpener, key string, pulled []string) error {
+	state, err := readSeenState(ctx, dir, so)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(state[key]))
+	for _, name := range state[key] {
+		seen[name] = true
+	}
+
+	names := state[key]
+	for _, name := range pulled {
+		if seen[name] {
+			names = nil
+
+			break
+		}
+	}
+
+	state[key] = append(names, pulled...)
+
+	if err := writeSealedJSON(ctx, filepath.Join(dir, SeenStateName), so, state); err != nil {
+		return fmt.Errorf("failed to write seen state: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSeen(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		key    string
+		pulled []string
+		want   seenState
+	}{
+		{
+			name:   "first pull",
+			key:    "main",
+			pulled: []string{"a", "b"},
+			want:   seenState{"main": {"a", "b"}},
+		},
+		{
+			name:   "unseen files are added",
+			key:    "main",
+			pulled: []string{"c"},
+			want:   seenState{"main": {"a", "b", "c"}},
+		},
+		{
+			name:   "keys are independent",
+			key:    "dev",
+			pulled: []string{"a"},
+			want:   seenState{"main": {"a", "b", "c"}, "dev": {"a"}},
+		},
+		{
+			name:   "seen files start over",
+			key:    "main",
+			pulled: []string{"d", "a"},
+			want:   seenState{"main": {"d", "a"}, "dev": {"a"}},
+		},
+	}
+
+	// The cases build on each other, so they run in order.
+	for _, tt := range tests {
+		require.NoError(t, recordSeen(ctx, dir, plainSealOpener{}, tt.key, tt.pulled), tt.name)
+
+		got, err := readSeenState(ctx, dir, plainSealOpener{})
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+	}
+}
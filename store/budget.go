@@ -0,0 +1,85 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBudget bounds the bytes of the files that pulls hold in memory at
+// once. A single MemoryBudget is shared by every worker of a pull, so that the
+// memory it uses stays bounded whatever the number of workers or the sizes of
+// the files. A nil MemoryBudget places no bound.
+type MemoryBudget struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	changed chan struct{} // Closed when bytes are released
+}
+
+// NewMemoryBudget returns a MemoryBudget of limit bytes. If limit is less than
+// 1, NewMemoryBudget returns nil.
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	if limit < 1 {
+		return nil
+	}
+
+	return &MemoryBudget{limit: limit, changed: make(chan struct{})}
+}
+
+// Acquire blocks until n bytes fit in the budget or the context is done. A
+// request larger than the whole budget is granted once nothing else is held,
+// so that a file larger than the budget is still pulled, alone.
+func (b *MemoryBudget) Acquire(ctx context.Context, n int64) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+
+		if b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+
+			return nil
+		}
+
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Release returns n bytes acquired with Acquire, waking the waiting requests.
+func (b *MemoryBudget) Release(n int64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.used -= n
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
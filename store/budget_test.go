@@ -0,0 +1,77 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil budget is unbounded", func(t *testing.T) {
+		t.Parallel()
+
+		var b *MemoryBudget
+
+		require.NoError(t, b.Acquire(context.Background(), 1<<40))
+		b.Release(1 << 40)
+
+		assert.Nil(t, NewMemoryBudget(0))
+	})
+
+	t.Run("blocks over the limit", func(t *testing.T) {
+		t.Parallel()
+
+		b := NewMemoryBudget(10)
+		require.NoError(t, b.Acquire(context.Background(), 6))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, b.Acquire(ctx, 5), context.DeadlineExceeded)
+		require.NoError(t, b.Acquire(context.Background(), 4))
+
+		acquired := make(chan error, 1)
+		go func() { acquired <- b.Acquire(context.Background(), 5) }()
+
+		b.Release(6)
+		require.NoError(t, <-acquired)
+	})
+
+	t.Run("grants a request over the limit alone", func(t *testing.T) {
+		t.Parallel()
+
+		b := NewMemoryBudget(10)
+		require.NoError(t, b.Acquire(context.Background(), 1))
+
+		acquired := make(chan error, 1)
+		go func() { acquired <- b.Acquire(context.Background(), 20) }()
+
+		select {
+		case <-acquired:
+			t.Fatal("request over the limit granted while bytes are held")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		b.Release(1)
+		require.NoError(t, <-acquired)
+	})
+}
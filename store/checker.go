@@ -0,0 +1,60 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import "context"
+
+// Kinds of inconsistency found by a Checker.
+const (
+	IssueUnnamedFile    = "unnamed-file"    // A file without a name
+	IssueOrphanedName   = "orphaned-name"   // A name without a file
+	IssueDanglingCommit = "dangling-commit" // A commit of a file that is gone
+	IssueOrphanedChunks = "orphaned-chunks" // Chunks without a file
+	IssueReusedIV       = "reused-iv"       // An IV recorded more than once
+	IssueWrongRefCount  = "wrong-refcount"  // A reference count that does not match the links
+)
+
+// Issue is an inconsistency between the collections of a remote host.
+type Issue struct {
+	Kind   string
+	ID     string // Identifier of the affected object
+	Detail string
+	Fixed  bool // The issue was repaired
+}
+
+// CheckReport lists the issues found by a consistency check.
+type CheckReport struct {
+	Issues []Issue
+}
+
+// Unfixed returns the number of issues that were not repaired.
+func (r *CheckReport) Unfixed() int {
+	n := 0
+
+	for _, issue := range r.Issues {
+		if !issue.Fixed {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Checker is an interface that defines the behavior of checking the
+// consistency of a remote host and, if fix is true, repairing the issues
+// that can be repaired without losing data.
+type Checker interface {
+	Check(ctx context.Context, fix bool) (*CheckReport, error)
+}
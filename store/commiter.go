@@ -18,6 +18,8 @@ import (
 	"context"
 	"crypto/sha1"
 	"encoding/hex"
+	"slices"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -26,6 +28,81 @@ type Commit struct {
 	SHA       string `json:"uuid",bson:"uuid"`
 	Namespace string `json:"namespace",bson:"namespace"`
 	FileID    string `json:"fileId",bson:"fileId"`
+
+	// Previous is the file ID of the version that the commit replaced, if
+	// any, which reverting the commit restores.
+	Previous string `json:"previous,omitempty" bson:"previous,omitempty"`
+
+	// FileIDs and Replaced are set instead of FileID and Previous by a
+	// commit that groups the files of a whole push, so that they are reverted
+	// as a unit. Replaced maps each file ID to that of the version it
+	// replaced, if any.
+	FileIDs  []string          `json:"fileIds,omitempty" bson:"fileids,omitempty"`
+	Replaced map[string]string `json:"replaced,omitempty" bson:"replaced,omitempty"`
+
+	Message string    `json:"message,omitempty" bson:"message,omitempty"` // Describes the push
+	Time    time.Time `json:"time,omitempty" bson:"time,omitempty"`       // When the file was pushed
+}
+
+// Files returns the IDs of the files written by the commit.
+func (c *Commit) Files() []string {
+	if len(c.FileIDs) > 0 {
+		return c.FileIDs
+	}
+
+	return []string{c.FileID}
+}
+
+// PreviousOf returns the ID of the version replaced by the file with the ID
+// written by the commit, if any.
+func (c *Commit) PreviousOf(fileID string) string {
+	if len(c.FileIDs) > 0 {
+		return c.Replaced[fileID]
+	}
+
+	if fileID == c.FileID {
+		return c.Previous
+	}
+
+	return ""
+}
+
+// Amend folds the files written by next into the commit, so that reverting
+// it reverts them too. A file of next that replaced a file of the commit takes
+// its place, and restores on revert what that file replaced.
+func (c *Commit) Amend(next *Commit) {
+	if len(c.FileIDs) == 0 {
+		c.FileIDs = []string{c.FileID}
+		if c.Previous != "" {
+			c.Replaced = map[string]string{c.FileID: c.Previous}
+		}
+
+		c.FileID, c.Previous = "", ""
+	}
+
+	for _, fileID := range next.Files() {
+		previous := next.PreviousOf(fileID)
+
+		if i := slices.Index(c.FileIDs, previous); previous != "" && i >= 0 {
+			c.FileIDs = slices.Delete(c.FileIDs, i, i+1)
+
+			amended := previous
+			previous = c.Replaced[amended]
+			delete(c.Replaced, amended)
+		}
+
+		c.FileIDs = append(c.FileIDs, fileID)
+
+		if previous == "" {
+			continue
+		}
+
+		if c.Replaced == nil {
+			c.Replaced = make(map[string]string)
+		}
+
+		c.Replaced[fileID] = previous
+	}
 }
 
 // Commiter is an interface that defines the behavior of committing.
@@ -34,6 +111,21 @@ type Commiter interface {
 	FlushCommits(context.Context) error
 }
 
+// CommitAmender is an interface that defines the behavior of amending a
+// commit rather than adding new ones.
+type CommitAmender interface {
+	// AmendCommits folds the added commits into the commit sha instead of
+	// writing them, replacing its message if msg is set.
+	AmendCommits(ctx context.Context, sha, msg string) error
+}
+
+// CommitLogger is an interface that defines the behavior of listing commits.
+type CommitLogger interface {
+	// Log returns the commits of the store, newest first, at most limit of
+	// them if limit is positive.
+	Log(ctx context.Context, limit int) ([]Commit, error)
+}
+
 // NewSHA generates a new SHA-1 hash based on a name.
 func NewSHA(name string) string {
 	// Generate a new UUID
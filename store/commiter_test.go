@@ -0,0 +1,50 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitFiles(t *testing.T) {
+	single := &Commit{FileID: "a", Previous: "a0"}
+
+	assert.Equal(t, []string{"a"}, single.Files())
+	assert.Equal(t, "a0", single.PreviousOf("a"))
+	assert.Empty(t, single.PreviousOf("b"))
+
+	grouped := &Commit{FileIDs: []string{"a", "b"}, Replaced: map[string]string{"b": "b0"}}
+
+	assert.Equal(t, []string{"a", "b"}, grouped.Files())
+	assert.Empty(t, grouped.PreviousOf("a"))
+	assert.Equal(t, "b0", grouped.PreviousOf("b"))
+}
+
+func TestCommitAmend(t *testing.T) {
+	commit := &Commit{SHA: "sha", FileID: "a", Previous: "a0"}
+
+	commit.Amend(&Commit{FileID: "b"})
+	commit.Amend(&Commit{FileIDs: []string{"a2", "c"}, Replaced: map[string]string{"a2": "a", "c": "c0"}})
+
+	assert.Equal(t, "sha", commit.SHA)
+	assert.Empty(t, commit.FileID)
+	assert.Equal(t, []string{"b", "a2", "c"}, commit.Files())
+	assert.Equal(t, "a0", commit.PreviousOf("a2"))
+	assert.Equal(t, "c0", commit.PreviousOf("c"))
+	assert.Empty(t, commit.PreviousOf("b"))
+	assert.Empty(t, commit.PreviousOf("a"))
+}
@@ -16,24 +16,43 @@ package store
 
 import (
 	"errors"
+	"io"
 	"time"
 )
 
 type Metadata struct {
-	Tags []string `bson:"tags,omitempty"` // Tags associated with the document
+	Tags      []string `bson:"tags,omitempty"`      // Tags associated with the document
+	SHA256    string   `bson:"sha256,omitempty"`    // Hex-encoded hash of the plaintext
+	Size      int64    `bson:"size,omitempty"`      // Size of the plaintext
+	ChunkSize int      `bson:"chunkSize,omitempty"` // Chunk size if sealed as a stream
+	Batch     string   `bson:"batch,omitempty"`     // ID of the push run that wrote the data
+	Label     string   `bson:"label,omitempty"`     // Label of the push run that wrote the data
 }
 
 // Document is the data structure that is either pulled from a remote host or
 // that must be constructed to push to a remote host. Note that this structure
 // contains only descriptive information of the document, not the contents.
 type Document struct {
-	ID          []byte    // Unique identifier
-	Size        int64     // Size of the document
-	UploadDate  time.Time // When the document was uploaded
-	Filename    string    // Name of the file
-	Metadata    Metadata  // Contextual data
-	ContentType string    // Type of data
-	Data        []byte    // Data
+	ID          []byte        // Unique identifier
+	Size        int64         // Size of the document
+	UploadDate  time.Time     // When the document was uploaded
+	Filename    string        // Name of the file
+	RealName    string        // Real name of the file when Filename is masked
+	Metadata    Metadata      // Contextual data
+	ContentType string        // Type of data
+	Data        []byte        // Data
+	Body        io.ReadCloser // Streamed data, set instead of Data for large files
+	Offset      int64         // Bytes of the file before Body, when a download is resumed
+	Sealed      *Sealed       // Stored form of the name and metadata, set by a raw pull
+}
+
+// Sealed is the encrypted name and metadata of a file as the store holds them,
+// so that a file can be copied between stores without the key.
+type Sealed struct {
+	Name     []byte // Encrypted name
+	Metadata []byte // Encrypted metadata, in the encoding of the store
+
+	NonceSize int // Size of the nonce that begins each ciphertext
 }
 
 // DocumentBuffer manages a dynamically-sized buffer of Documents.
@@ -0,0 +1,33 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import "errors"
+
+// Errors describing the kind of a failure on the remote host, so that callers
+// can branch on it with errors.Is. Stores wrap their errors with these where
+// they can tell the kind apart.
+var (
+	// ErrNotFound is returned when a requested object does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrUnauthorized is returned when the credentials are rejected or lack
+	// the permissions for an operation.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrUnavailable is returned when the remote host cannot be reached or
+	// timed out. Operations failing with it may succeed if retried.
+	ErrUnavailable = errors.New("store unavailable")
+)
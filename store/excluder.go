@@ -0,0 +1,31 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import "context"
+
+// Excluder is an interface that defines the behavior of the exclude policy of
+// a remote host: glob patterns, shared by every client, of the names of the
+// files that pulls leave out unless WithPullIncludeExcluded is set. A pattern
+// without a separator is matched against the base name of a file, so that
+// "*.raw" excludes raw files in any directory.
+type Excluder interface {
+	// ExcludePolicy returns the patterns of the exclude policy.
+	ExcludePolicy(ctx context.Context) ([]string, error)
+
+	// SetExcludePolicy replaces the patterns of the exclude policy. No
+	// patterns clears it.
+	SetExcludePolicy(ctx context.Context, patterns []string) error
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import "context"
+
+// Limiter bounds the number of concurrent operations against a remote host. A
+// single Limiter can be shared by push, pull, and migrate so that the total
+// number of in-flight streams never exceeds the configured ceiling. A nil
+// Limiter places no bound on concurrency.
+type Limiter struct {
+	sem chan struct{}
+}
+
+// NewLimiter returns a Limiter that allows at most n concurrent operations. If
+// n is less than 1, NewLimiter returns nil.
+func NewLimiter(n int) *Limiter {
+	if n < 1 {
+		return nil
+	}
+
+	return &Limiter{sem: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is available or the context is done.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot acquired with Acquire.
+func (l *Limiter) Release() {
+	if l == nil {
+		return
+	}
+
+	<-l.sem
+}
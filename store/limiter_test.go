@@ -0,0 +1,63 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil limiter is unbounded", func(t *testing.T) {
+		t.Parallel()
+
+		var l *Limiter
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, l.Acquire(context.Background()))
+		}
+
+		l.Release()
+	})
+
+	t.Run("non-positive size is unbounded", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, NewLimiter(0))
+		assert.Nil(t, NewLimiter(-1))
+	})
+
+	t.Run("blocks at capacity", func(t *testing.T) {
+		t.Parallel()
+
+		l := NewLimiter(1)
+		require.NoError(t, l.Acquire(context.Background()))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := l.Acquire(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		l.Release()
+		require.NoError(t, l.Acquire(context.Background()))
+	})
+}
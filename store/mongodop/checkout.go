@@ -0,0 +1,292 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// The state of the bucket as of a commit is resolved from the upload dates of
+// the files and the retirement dates of their versions: it is every file
+// uploaded by the time the last file of the commit was, unless it had been
+// replaced by then. Versions pruned by the retention policy and files deleted
+// by a revert cannot be recovered, so a checkout that would miss pruned files
+// fails with errStatePruned naming them.
+
+// errUnknownCommit is returned when no commit has the SHA.
+var errUnknownCommit = errors.New("no commit has the SHA")
+
+// errStatePruned is returned when checking out a commit some of whose files
+// are no longer kept.
+var errStatePruned = errors.New("the versions of files in it have been pruned")
+
+// commitTime returns when the last of the files written by the commits with
+// the SHA was uploaded.
+func (s *Store) commitTime(ctx context.Context, sha string) (time.Time, error) {
+	cur, err := s.commitsColl.Find(ctx, bson.D{{Key: "sha", Value: sha}})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to find commits: %w", err)
+	}
+
+	var commits []store.Commit
+	if err := cur.All(ctx, &commits); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode commits: %w", err)
+	}
+
+	if len(commits) == 0 {
+		return time.Time{}, fmt.Errorf("failed to resolve %s: %w", sha, errUnknownCommit)
+	}
+
+	names := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		names = append(names, commit.Files()...)
+	}
+
+	filter := bson.D{{Key: "filename", Value: bson.D{{Key: "$in", Value: names}}}}
+
+	var at time.Time
+	for _, coll := range []*mongo.Collection{s.nameIndex.coll, versionsColl(s.nameIndex.coll)} {
+		files, err := findGridFSFiles(ctx, coll, filter)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		for _, file := range files {
+			if file.UploadDate.After(at) {
+				at = file.UploadDate
+			}
+		}
+	}
+
+	if at.IsZero() {
+		return time.Time{}, fmt.Errorf("failed to resolve %s: the files it wrote were pruned", sha)
+	}
+
+	return at, nil
+}
+
+// filesAt returns the files in the bucket as they were at the time.
+func (s *Store) filesAt(ctx context.Context, at time.Time) ([]gridfs.File, error) {
+	uploaded := bson.E{Key: "uploadDate", Value: bson.D{{Key: "$lte", Value: at}}}
+
+	current, err := findGridFSFiles(ctx, s.nameIndex.coll, bson.D{uploaded})
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := findGridFSFiles(ctx, versionsColl(s.nameIndex.coll), bson.D{
+		uploaded,
+		{Key: retiredAtKey, Value: bson.D{{Key: "$gt", Value: at}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return latestVersions(s.nameIndex, append(current, versions...))
+}
+
+// latestVersions returns the newest of the files with each decrypted name. A
+// version is retired only after the file that replaces it is uploaded, so both
+// can appear to be in the bucket at the time of the upload.
+func latestVersions(nidx *nameIndex, files []gridfs.File) ([]gridfs.File, error) {
+	latest := make(map[string]gridfs.File, len(files))
+	for _, file := range files {
+		name, ok := nidx.hexName.get(file.Name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("ID not found for file name %s", file.Name)
+		}
+
+		if prev, ok := latest[name]; ok && !file.UploadDate.After(prev.UploadDate) {
+			continue
+		}
+
+		latest[name] = file
+	}
+
+	out := make([]gridfs.File, 0, len(latest))
+	for _, file := range latest {
+		out = append(out, file)
+	}
+
+	return out, nil
+}
+
+// commitFiles returns the files as of the commit in opts, under its prefix.
+func (s *Store) commitFiles(ctx context.Context, opts store.PullOptions) ([]gridfs.File, error) {
+	at, err := s.commitTime(ctx, opts.Commit)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.filesAt(ctx, at)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkState(ctx, opts, files); err != nil {
+		return nil, err
+	}
+
+	selected := files[:0]
+	for _, file := range files {
+		name, _ := s.nameIndex.hexName.get(file.Name)
+		if _, ok := trimPrefix(opts.Prefix, name); ok {
+			selected = append(selected, file)
+		}
+	}
+
+	return selected, nil
+}
+
+// checkState returns an error naming the files under the prefix of opts that
+// were in the bucket as of the commit but are missing from the files found
+// for it.
+func (s *Store) checkState(ctx context.Context, opts store.PullOptions, files []gridfs.File) error {
+	cur, err := s.commitsColl.Find(ctx, bson.D{{Key: "namespace", Value: s.bucketName}})
+	if err != nil {
+		return fmt.Errorf("failed to find commits: %w", err)
+	}
+
+	var commits []store.Commit
+	if err := cur.All(ctx, &commits); err != nil {
+		return fmt.Errorf("failed to decode commits: %w", err)
+	}
+
+	var at time.Time
+	for _, commit := range commits {
+		if commit.SHA == opts.Commit && commit.Time.After(at) {
+			at = commit.Time
+		}
+	}
+
+	missing := prunedFiles(s.nameIndex.hexName, commits, at, files)
+
+	var names []string
+	for _, name := range missing {
+		if trimmed, ok := trimPrefix(opts.Prefix, name); ok {
+			names = append(names, trimmed)
+		} else if !strings.Contains(name, "/") {
+			// A file whose name is lost is reported by its hex name.
+			names = append(names, name)
+		}
+	}
+
+	if len(names) > 0 {
+		return fmt.Errorf("failed to check out %s: %w: %s", opts.Commit, errStatePruned, strings.Join(names, ", "))
+	}
+
+	return nil
+}
+
+// prunedFiles returns the names of the files written by the commits up to the
+// time that had not been replaced by then, but are not among the files. A
+// file that no longer has a decrypted name is named by that of the file that
+// replaced it, or else by its hex name. The names are sorted.
+func prunedFiles(hn *hexName, commits []store.Commit, at time.Time, files []gridfs.File) []string {
+	var (
+		written    []string
+		replaced   = make(map[string]bool)
+		replacedBy = make(map[string]string)
+	)
+
+	for _, commit := range commits {
+		later := commit.Time.After(at)
+
+		for _, fileID := range commit.Files() {
+			if previous := commit.PreviousOf(fileID); previous != "" {
+				replacedBy[previous] = fileID
+				replaced[previous] = replaced[previous] || !later
+			}
+
+			if !later {
+				written = append(written, fileID)
+			}
+		}
+	}
+
+	found := make(map[string]bool, 2*len(files))
+	for _, file := range files {
+		found[file.Name] = true
+
+		if name, _ := hn.get(file.Name); name != "" {
+			found[name] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	missing := []string{}
+
+	for _, fileID := range written {
+		if replaced[fileID] || found[fileID] {
+			continue
+		}
+
+		name := fileID
+		for next := fileID; next != ""; next = replacedBy[next] {
+			if decrypted, _ := hn.get(next); decrypted != "" {
+				name = decrypted
+
+				break
+			}
+		}
+
+		if !found[name] && !seen[name] {
+			seen[name] = true
+			missing = append(missing, name)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// findGridFSFiles returns the files documents in coll that match the filter.
+func findGridFSFiles(ctx context.Context, coll *mongo.Collection, filter bson.D) ([]gridfs.File, error) {
+	cur, err := coll.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files in %s: %w", coll.Name(), err)
+	}
+
+	var files []gridfs.File
+	if err := cur.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files in %s: %w", coll.Name(), err)
+	}
+
+	return files, nil
+}
+
+// indexedMetadata returns the metadata of the file from the name index, if the
+// index holds this version of the file rather than a newer one.
+func indexedMetadata(nidx *nameIndex, file gridfs.File) (*gridfsMetadata, bool) {
+	name, _ := nidx.hexName.get(file.Name)
+
+	doc, gfsMeta, ok := nidx.nameDoc.get(name)
+	if !ok || gfsMeta == nil || doc.Name != file.Name {
+		return nil, false
+	}
+
+	return gfsMeta, true
+}
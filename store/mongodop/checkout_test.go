@@ -0,0 +1,95 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestLatestVersions(t *testing.T) {
+	nidx := &nameIndex{hexName: &hexName{}, nameDoc: &nameDoc{}}
+	nidx.hexName.add("old", "a.jpg")
+	nidx.hexName.add("new", "a.jpg")
+	nidx.hexName.add("other", "b.jpg")
+
+	now := time.Now()
+
+	files, err := latestVersions(nidx, []gridfs.File{
+		{Name: "new", UploadDate: now},
+		{Name: "old", UploadDate: now.Add(-time.Hour)},
+		{Name: "other", UploadDate: now.Add(-2 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+
+	assert.ElementsMatch(t, []string{"new", "other"}, names)
+
+	_, err = latestVersions(nidx, []gridfs.File{{Name: "unknown"}})
+	assert.Error(t, err)
+}
+
+func TestPrunedFiles(t *testing.T) {
+	hn := &hexName{}
+	hn.add("a2", "/a.jpg")
+	hn.add("c1", "/c.jpg")
+
+	at := time.Now()
+
+	commits := []store.Commit{
+		{FileIDs: []string{"a1", "b1", "c1"}, Time: at.Add(-time.Hour)},
+		// The version of a.jpg as of the commit was pruned after a2
+		// replaced it, and d1 replaced b1 before the commit.
+		{FileIDs: []string{"d1"}, Replaced: map[string]string{"d1": "b1"}, Time: at},
+		{FileIDs: []string{"a2"}, Replaced: map[string]string{"a2": "a1"}, Time: at.Add(time.Hour)},
+	}
+
+	tests := []struct {
+		name  string
+		files []gridfs.File
+		want  []string
+	}{
+		{
+			name:  "every file is kept",
+			files: []gridfs.File{{Name: "a1"}, {Name: "c1"}, {Name: "d1"}},
+			want:  []string{},
+		},
+		{
+			name:  "named by the file that replaced it",
+			files: []gridfs.File{{Name: "c1"}, {Name: "d1"}},
+			want:  []string{"/a.jpg"},
+		},
+		{
+			name:  "named by its hex name",
+			files: []gridfs.File{{Name: "a1"}, {Name: "c1"}},
+			want:  []string{"d1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, prunedFiles(hn, commits, at, tt.files))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+//
+// Copyright 2024 Preston Vasquez
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// DefaultWriteConcern is the write concern used when none is configured.
+// Pushes are acknowledged by a majority so that a failover cannot lose them.
+const DefaultWriteConcern = "majority"
+
+// ParseWriteConcern parses a write concern of "majority" or a positive number
+// of acknowledging nodes. An empty string selects DefaultWriteConcern.
+// Unacknowledged writes are rejected: a lost initialization vector could be
+// reused, and a lost chunk would corrupt a file.
+func ParseWriteConcern(s string) (*writeconcern.WriteConcern, error) {
+	if s == "" {
+		s = DefaultWriteConcern
+	}
+
+	if s == "majority" {
+		return writeconcern.Majority(), nil
+	}
+
+	w, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid write concern %q: must be \"majority\" or a number of nodes", s)
+	}
+
+	if w < 1 {
+		return nil, fmt.Errorf("invalid write concern %q: unacknowledged writes are not supported", s)
+	}
+
+	return &writeconcern.WriteConcern{W: w}, nil
+}
+
+// ParseReadPreference parses a read preference mode such as "primary" or
+// "secondaryPreferred". An empty string selects the primary.
+func ParseReadPreference(s string) (*readpref.ReadPref, error) {
+	if s == "" {
+		return readpref.Primary(), nil
+	}
+
+	mode, err := readpref.ModeFromString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read preference %q: %w", s, err)
+	}
+
+	rp, err := readpref.New(mode)
+	if err != nil {
+		return nil, fmt.Errorf("invalid read preference %q: %w", s, err)
+	}
+
+	return rp, nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A push with dedup stores a file whose contents the bucket already holds as
+// a link: a files document without chunks of its own, whose metadata holds
+// the ID of the files document that the chunks were uploaded under. The ID is
+// kept in the clear beside the encrypted metadata so that a delete can find,
+// without the key, the chunks whose reference count it releases. See refs.go.
+// The server learns which files share their contents, but not what they are.
+//
+// The duplicates are found by the content hashes in the name index, which are
+// only known once the metadata is decrypted, so no hash is stored in the
+// clear.
+
+// blobKey is the field of the metadata that holds the ID of the chunks of a
+// link.
+const blobKey = "blob"
+
+// blobID returns the ID of the chunks that the file with the metadata links
+// to, if it is a link.
+func blobID(meta bson.Raw) (primitive.ObjectID, bool) {
+	val, err := meta.LookupErr(blobKey)
+	if err != nil {
+		return primitive.NilObjectID, false
+	}
+
+	return val.ObjectIDOK()
+}
+
+// dataID returns the ID that the chunks holding the data of the file are
+// stored under.
+func dataID(file gridfs.File) interface{} {
+	if id, ok := blobID(file.Metadata); ok {
+		return id
+	}
+
+	return file.ID
+}
+
+// openData opens the data of the file, reading the chunks it links to if it
+// is a link. The files document of those chunks may be gone, so they are read
+// directly.
+func openData(ctx context.Context, bucket *gridfs.Bucket, file gridfs.File) (io.ReadCloser, error) {
+	if _, ok := blobID(file.Metadata); !ok {
+		return bucket.OpenDownloadStream(file.ID)
+	}
+
+	return openDownloadAt(ctx, bucket, file, 0)
+}
+
+// withBlob returns the metadata with a link to the chunks with the ID.
+func withBlob(meta bson.Raw, id primitive.ObjectID) (bson.Raw, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(meta, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	doc = append(doc, bson.E{Key: blobKey, Value: id})
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	return raw, nil
+}
+
+// withoutBlob returns the metadata without a link, for a copy of the file
+// that holds its data itself.
+func withoutBlob(meta bson.Raw) (bson.Raw, error) {
+	if _, ok := blobID(meta); !ok {
+		return meta, nil
+	}
+
+	var doc bson.D
+	if err := bson.Unmarshal(meta, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+
+	kept := doc[:0]
+	for _, elem := range doc {
+		if elem.Key != blobKey {
+			kept = append(kept, elem)
+		}
+	}
+
+	raw, err := bson.Marshal(kept)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+
+	return raw, nil
+}
+
+// hashContents returns the hex-encoded SHA-256 of the contents of r, leaving r
+// at its start.
+func hashContents(r io.ReadSeeker) (string, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek to start of file: %w", err)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek to start of file: %w", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// pushLink stores the contents of r, with the metadata, as a link named
+// filename to the chunks of a file of the bucket with the same contents,
+// returning its files document. It returns nil, without storing anything, if
+// dedup is not enabled or no such file is found, so that the contents are
+// uploaded instead.
+func (p *Pusher) pushLink(
+	ctx context.Context,
+	filename string,
+	r io.ReadSeeker,
+	length int64,
+	meta *gridfsMetadata,
+	opts store.PushOptions,
+) (*gridfs.File, error) {
+	if !opts.Dedup {
+		return nil, nil
+	}
+
+	sum, err := hashContents(r)
+	if err != nil {
+		return nil, err
+	}
+
+	indexed, ok := p.nameIndex.nameDoc.findHash(sum)
+	if !ok {
+		return nil, nil
+	}
+
+	files := p.bucket.GetFilesCollection()
+
+	// The name index may be behind the bucket, so the file is read back
+	// rather than trusted.
+	var blob gridfs.File
+	if err := files.FindOne(ctx, bson.D{{Key: "_id", Value: indexed.ID}}).Decode(&blob); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to find file to link to: %w", err)
+	}
+
+	blobMeta, err := decryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), blob.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Diskhop.Size = length
+	meta.Diskhop.SHA256 = sum
+	meta.Diskhop.ChunkSize = blobMeta.Diskhop.ChunkSize
+
+	encryptedMeta, err := encryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt metadata: %w", err)
+	}
+
+	target := dataID(blob).(primitive.ObjectID)
+
+	encryptedMeta, err = withBlob(encryptedMeta, target)
+	if err != nil {
+		return nil, err
+	}
+
+	// The chunks are pinned before the link is inserted, so that a push
+	// replacing the file they belong to keeps them. It may have deleted them
+	// before they were pinned, in which case the contents are uploaded after
+	// all.
+	if err := pinChunks(ctx, p.bucket, target); err != nil {
+		return nil, err
+	}
+
+	n, err := p.bucket.GetChunksCollection().CountDocuments(ctx, bson.D{{Key: "files_id", Value: target}}, options.Count().SetLimit(1))
+	if err != nil {
+		err = fmt.Errorf("failed to find chunks to link to: %w", err)
+
+		return nil, errors.Join(err, unpinChunks(ctx, p.bucket, target))
+	}
+
+	if n == 0 && blob.Length > 0 {
+		return nil, unpinChunks(ctx, p.bucket, target)
+	}
+
+	id := primitive.NewObjectID()
+
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "length", Value: blob.Length},
+		{Key: "chunkSize", Value: blob.ChunkSize},
+		{Key: "uploadDate", Value: time.Now()},
+		{Key: "filename", Value: filename},
+		{Key: "metadata", Value: encryptedMeta},
+	}
+
+	if _, err := files.InsertOne(ctx, doc); err != nil {
+		err = fmt.Errorf("failed to insert link: %w", err)
+
+		return nil, errors.Join(err, unpinChunks(ctx, p.bucket, target))
+	}
+
+	return &gridfs.File{ID: id, Name: filename, Length: length, Metadata: encryptedMeta}, nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestBlobMetadata(t *testing.T) {
+	t.Parallel()
+
+	meta, err := bson.Marshal(bson.D{{Key: metadataKey, Value: primitive.Binary{Data: []byte("sealed")}}})
+	require.NoError(t, err)
+
+	fileID, blob := primitive.NewObjectID(), primitive.NewObjectID()
+
+	_, ok := blobID(meta)
+	assert.False(t, ok)
+	assert.Equal(t, fileID, dataID(gridfs.File{ID: fileID, Metadata: meta}))
+
+	linked, err := withBlob(meta, blob)
+	require.NoError(t, err)
+
+	got, ok := blobID(linked)
+	require.True(t, ok)
+
+	assert.Equal(t, blob, got)
+	assert.Equal(t, blob, dataID(gridfs.File{ID: fileID, Metadata: linked}))
+
+	unlinked, err := withoutBlob(linked)
+	require.NoError(t, err)
+
+	assert.Equal(t, bson.Raw(meta), unlinked)
+}
+
+func TestNameDocFindHash(t *testing.T) {
+	t.Parallel()
+
+	nd := &nameDoc{}
+
+	file := &gridfs.File{ID: primitive.NewObjectID()}
+	nd.add("a.txt", file, &gridfsMetadata{Diskhop: store.Metadata{SHA256: "abc"}})
+
+	got, ok := nd.findHash("abc")
+	require.True(t, ok)
+	assert.Same(t, file, got)
+
+	_, ok = nd.findHash("def")
+	assert.False(t, ok)
+
+	// A file replaced with other contents no longer has the hash.
+	nd.add("a.txt", &gridfs.File{ID: primitive.NewObjectID()}, &gridfsMetadata{Diskhop: store.Metadata{SHA256: "def"}})
+
+	_, ok = nd.findHash("abc")
+	assert.False(t, ok)
+}
@@ -0,0 +1,181 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// chunkReader reads the data of a GridFS file from one of its chunks on, so
+// that a download can start part way through a file without reading what
+// comes before.
+type chunkReader struct {
+	ctx       context.Context
+	cur       *mongo.Cursor
+	next      int32  // Index of the next chunk expected
+	remaining int64  // Bytes of the file left to read
+	buf       []byte // Unread data of the current chunk
+}
+
+// openDownloadAt opens the data of the file from the byte at offset. The data
+// of a link are read from the chunks it links to.
+func openDownloadAt(ctx context.Context, bucket *gridfs.Bucket, file gridfs.File, offset int64) (io.ReadCloser, error) {
+	if file.ChunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d for file %s", file.ChunkSize, file.Name)
+	}
+
+	chunk := offset / int64(file.ChunkSize)
+
+	filter := bson.D{
+		{Key: "files_id", Value: dataID(file)},
+		{Key: "n", Value: bson.D{{Key: "$gte", Value: chunk}}},
+	}
+
+	cur, err := bucket.GetChunksCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "n", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chunks: %w", err)
+	}
+
+	cr := &chunkReader{
+		ctx:       ctx,
+		cur:       cur,
+		next:      int32(chunk),
+		remaining: file.Length - chunk*int64(file.ChunkSize),
+	}
+
+	if _, err := io.CopyN(io.Discard, cr, offset-chunk*int64(file.ChunkSize)); err != nil {
+		_ = cr.Close()
+
+		return nil, fmt.Errorf("failed to seek to offset %d: %w", offset, err)
+	}
+
+	return cr, nil
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.buf) == 0 {
+		if !cr.cur.Next(cr.ctx) {
+			if err := cr.cur.Err(); err != nil {
+				return 0, fmt.Errorf("failed to read chunk %d: %w", cr.next, err)
+			}
+
+			if cr.remaining > 0 {
+				return 0, fmt.Errorf("file is missing chunk %d: %w", cr.next, io.ErrUnexpectedEOF)
+			}
+
+			return 0, io.EOF
+		}
+
+		var chunk struct {
+			N    int32  `bson:"n"`
+			Data []byte `bson:"data"`
+		}
+
+		if err := cr.cur.Decode(&chunk); err != nil {
+			return 0, fmt.Errorf("failed to decode chunk %d: %w", cr.next, err)
+		}
+
+		if chunk.N != cr.next {
+			return 0, fmt.Errorf("file is missing chunk %d", cr.next)
+		}
+
+		cr.next++
+		cr.buf = chunk.Data
+	}
+
+	n := copy(p, cr.buf)
+	cr.buf = cr.buf[n:]
+	cr.remaining -= int64(n)
+
+	return n, nil
+}
+
+func (cr *chunkReader) Close() error {
+	return cr.cur.Close(cr.ctx)
+}
+
+// resumeOffset returns the offset from which the download of the file with
+// the name resumes, or zero if it starts from the beginning. Only files sealed
+// as a stream resume, since the others are small enough to pull whole.
+func resumeOffset(opts store.PullOptions, name string, gfsMeta *gridfsMetadata) int64 {
+	if opts.Resume == nil || opts.MaskName || opts.ContentFilter != nil || gfsMeta.Diskhop.ChunkSize == 0 {
+		return 0
+	}
+
+	if _, ok := opts.SealOpener.(dcrypto.StreamResumer); !ok {
+		return 0
+	}
+
+	// A partial file that is as large as the file is restarted, since it
+	// cannot be told apart from one that holds something else.
+	offset := opts.Resume(name)
+	if offset <= 0 || offset >= gfsMeta.Diskhop.Size {
+		return 0
+	}
+
+	return offset
+}
+
+// resumeDownload decrypts the file sealed as a stream from the plaintext byte
+// at offset to w.
+func resumeDownload(
+	ctx context.Context,
+	bucket *gridfs.Bucket,
+	file gridfs.File,
+	resumer dcrypto.StreamResumer,
+	w io.Writer,
+	offset int64,
+) error {
+	r, err := openDownloadAt(ctx, bucket, file, 0)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, resumer.StreamHeaderSize())
+	_, err = io.ReadFull(r, header)
+
+	_ = r.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to read stream header: %w", err)
+	}
+
+	point, err := resumer.StreamResumePoint(header, offset)
+	if err != nil {
+		return err
+	}
+
+	r, err = openDownloadAt(ctx, bucket, file, point)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = r.Close() }()
+
+	if err := resumer.ResumeStream(ctx, w, header, r, offset); err != nil {
+		return fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/auth"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Server error codes for rejected credentials and missing permissions.
+const (
+	codeUnauthorized         = 13
+	codeAuthenticationFailed = 18
+)
+
+// transientRetryPolicy retries the operations that fail with a transient
+// error, five times in all, waiting 250ms before the first retry.
+var transientRetryPolicy = store.RetryPolicy{
+	Attempts:  5,
+	Delay:     250 * time.Millisecond,
+	Retryable: isTransient,
+}
+
+// isTransient reports whether err is likely to succeed if retried, such as a
+// network error or a primary stepdown.
+func isTransient(err error) bool {
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+
+	var serverErr mongo.ServerError
+
+	return errors.As(err, &serverErr) && serverErr.HasErrorLabel("RetryableWriteError")
+}
+
+// classifyError wraps err with the store error for its kind. Errors of an
+// unknown kind, and errors that are already classified, are returned as is.
+func classifyError(err error) error {
+	if err == nil ||
+		errors.Is(err, store.ErrNotFound) ||
+		errors.Is(err, store.ErrUnauthorized) ||
+		errors.Is(err, store.ErrUnavailable) {
+		return err
+	}
+
+	kind := errorKind(err)
+	if kind == nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// errorKind returns the store error describing err, or nil if unknown.
+func errorKind(err error) error {
+	var (
+		authErr      *auth.Error
+		serverErr    mongo.ServerError
+		selectionErr topology.ServerSelectionError
+	)
+
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, gridfs.ErrFileNotFound):
+		return store.ErrNotFound
+	case errors.As(err, &authErr):
+		return store.ErrUnauthorized
+	case errors.As(err, &serverErr) &&
+		(serverErr.HasErrorCode(codeUnauthorized) || serverErr.HasErrorCode(codeAuthenticationFailed)):
+		return store.ErrUnauthorized
+	case isTransient(err), errors.As(err, &selectionErr):
+		return store.ErrUnavailable
+	}
+
+	return nil
+}
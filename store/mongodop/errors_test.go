@@ -0,0 +1,91 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "no documents",
+			err:  fmt.Errorf("failed to load: %w", mongo.ErrNoDocuments),
+			want: store.ErrNotFound,
+		},
+		{
+			name: "gridfs file not found",
+			err:  gridfs.ErrFileNotFound,
+			want: store.ErrNotFound,
+		},
+		{
+			name: "authentication failed",
+			err:  mongo.CommandError{Code: codeAuthenticationFailed, Message: "auth failed"},
+			want: store.ErrUnauthorized,
+		},
+		{
+			name: "not authorized",
+			err:  mongo.CommandError{Code: codeUnauthorized, Message: "not authorized"},
+			want: store.ErrUnauthorized,
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("failed to find: %w", context.DeadlineExceeded),
+			want: store.ErrUnavailable,
+		},
+		{
+			name: "retryable write",
+			err:  mongo.CommandError{Code: 91, Labels: []string{"RetryableWriteError"}},
+			want: store.ErrUnavailable,
+		},
+		{
+			name: "unknown",
+			err:  errors.New("boom"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyError(tt.err)
+
+			assert.ErrorContains(t, got, tt.err.Error())
+
+			if tt.want == nil {
+				assert.Equal(t, tt.err, got)
+
+				return
+			}
+
+			assert.ErrorIs(t, got, tt.want)
+
+			// Classifying twice does not wrap again.
+			assert.Equal(t, got, classifyError(got))
+		})
+	}
+
+	assert.Nil(t, classifyError(nil))
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prestonvasquez/diskhop/internal/filter"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var _ store.Excluder = &Store{}
+
+// ExcludePolicy returns the glob patterns of the names of the files that
+// pulls of the bucket leave out, as recorded in its settings when the store
+// was connected.
+func (s *Store) ExcludePolicy(context.Context) ([]string, error) {
+	return s.settings.ExcludePatterns, nil
+}
+
+// SetExcludePolicy records the glob patterns of the names of the files that
+// pulls of the bucket leave out in its settings, so that every client of the
+// bucket honors them.
+func (s *Store) SetExcludePolicy(ctx context.Context, patterns []string) error {
+	if err := ValidateExcludePatterns(patterns); err != nil {
+		return err
+	}
+
+	if patterns == nil {
+		patterns = []string{}
+	}
+
+	if err := s.settingsStore.set(ctx, bson.D{{Key: "excludePatterns", Value: patterns}}); err != nil {
+		return fmt.Errorf("failed to record exclude policy: %w", err)
+	}
+
+	s.settings.ExcludePatterns = patterns
+
+	return nil
+}
+
+// ValidateExcludePatterns returns an error if a pattern of an exclude policy
+// is empty or not a valid glob pattern.
+func ValidateExcludePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("exclude pattern must not be empty")
+		}
+
+		if _, err := filter.MatchGlob(pattern, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateExcludePatterns(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, ValidateExcludePatterns(nil))
+	assert.NoError(t, ValidateExcludePatterns([]string{"*.raw", "video/*"}))
+	assert.Error(t, ValidateExcludePatterns([]string{""}))
+	assert.Error(t, ValidateExcludePatterns([]string{"*.raw", "[a"}))
+}
+
+func TestExcludedByPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := []string{"*.raw", "video/*"}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "a.raw", want: true},
+		{name: "photos/2024/a.raw", want: true},
+		{name: "video/clip.mp4", want: true},
+		{name: "photos/video/clip.mp4", want: false},
+		{name: "a.jpg", want: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, excludedByPolicy(policy, tt.name), tt.name)
+	}
+
+	assert.False(t, excludedByPolicy(nil, "a.raw"))
+}
@@ -0,0 +1,503 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// orphanGracePeriod is how old orphaned chunks must be before a check
+// removes them, since an upload in progress writes its chunks before its
+// files document.
+const orphanGracePeriod = time.Hour
+
+// Check reports the inconsistencies between the files, chunks, names,
+// commits, reference counts and IVs of the bucket. If fix is true, it removes
+// orphaned names and chunks and dangling commits, and corrects the reference
+// counts. Files without a name and reused IVs are
+// only reported, since repairing them would lose data or cannot be done.
+func (s *Store) Check(ctx context.Context, fix bool) (_ *store.CheckReport, err error) {
+	defer func() { err = classifyError(err) }()
+
+	report := &store.CheckReport{}
+
+	fileIDs, fileNames, links, err := s.checkFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []func(context.Context, *store.CheckReport, bool) error{
+		func(ctx context.Context, r *store.CheckReport, fix bool) error {
+			return s.checkNames(ctx, r, fix, fileNames)
+		},
+		func(ctx context.Context, r *store.CheckReport, fix bool) error {
+			return s.checkCommits(ctx, r, fix, fileNames)
+		},
+		func(ctx context.Context, r *store.CheckReport, fix bool) error {
+			return s.checkChunks(ctx, r, fix, fileIDs)
+		},
+		func(ctx context.Context, r *store.CheckReport, fix bool) error {
+			return s.checkRefs(ctx, r, fix, links)
+		},
+		s.checkIVs,
+	}
+
+	for _, check := range checks {
+		if err := check(ctx, report, fix); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// checkFiles returns the IDs and names of the files in the bucket, including
+// the versions kept for reverts, and the number of links to each ID that
+// links share.
+func (s *Store) checkFiles(ctx context.Context) (map[primitive.ObjectID]bool, map[string]bool, map[primitive.ObjectID]int64, error) {
+	ids := make(map[primitive.ObjectID]bool)
+	names := make(map[string]bool)
+	links := make(map[primitive.ObjectID]int64)
+
+	for _, coll := range []*mongo.Collection{s.nameIndex.coll, versionsColl(s.nameIndex.coll)} {
+		if err := collectFiles(ctx, coll, ids, names, links); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	return ids, names, links, nil
+}
+
+// collectFiles adds the IDs and names of the files documents in coll to ids
+// and names, and counts their links in links.
+func collectFiles(
+	ctx context.Context,
+	coll *mongo.Collection,
+	ids map[primitive.ObjectID]bool,
+	names map[string]bool,
+	links map[primitive.ObjectID]int64,
+) error {
+	cur, err := coll.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to find files: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var file struct {
+			ID       primitive.ObjectID `bson:"_id"`
+			Filename string             `bson:"filename"`
+			Metadata bson.Raw           `bson:"metadata"`
+		}
+
+		if err := cur.Decode(&file); err != nil {
+			return fmt.Errorf("failed to decode file: %w", err)
+		}
+
+		ids[file.ID] = true
+		names[file.Filename] = true
+
+		// The chunks that a link shares belong to it too.
+		if blob, ok := blobID(file.Metadata); ok {
+			ids[blob] = true
+			links[blob]++
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("failed to read files: %w", err)
+	}
+
+	return nil
+}
+
+// checkNames reports the files of the bucket that have no name and the names
+// that belong to no file. Names are shared by every bucket in the database,
+// so a name is only orphaned if no bucket has its file.
+func (s *Store) checkNames(ctx context.Context, report *store.CheckReport, fix bool, fileNames map[string]bool) error {
+	allFileNames, err := s.allFileNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	cur, err := s.nameIndex.nameColl.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to find names: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	names := make(map[string]bool)
+	orphans := []primitive.ObjectID{}
+
+	for cur.Next(ctx) {
+		var name struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+
+		if err := cur.Decode(&name); err != nil {
+			return fmt.Errorf("failed to decode name: %w", err)
+		}
+
+		names[name.ID.Hex()] = true
+
+		if !allFileNames[name.ID.Hex()] {
+			orphans = append(orphans, name.ID)
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("failed to read names: %w", err)
+	}
+
+	for fileName := range fileNames {
+		if !names[fileName] && s.nameIndex.storesNames() {
+			report.Issues = append(report.Issues, store.Issue{
+				Kind:   store.IssueUnnamedFile,
+				ID:     fileName,
+				Detail: "file cannot be pulled without its name",
+			})
+		}
+	}
+
+	for _, id := range orphans {
+		issue := store.Issue{Kind: store.IssueOrphanedName, ID: id.Hex()}
+
+		if fix {
+			if _, err := s.nameIndex.nameColl.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}}); err != nil {
+				return fmt.Errorf("failed to delete orphaned name %s: %w", id.Hex(), err)
+			}
+
+			issue.Fixed = true
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return nil
+}
+
+// allFileNames returns the names of the files, and of their versions, in
+// every bucket of the database.
+func (s *Store) allFileNames(ctx context.Context) (map[string]bool, error) {
+	database := s.nameIndex.coll.Database()
+
+	collNames, err := database.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+
+	names := make(map[string]bool)
+
+	for _, collName := range collNames {
+		if !strings.HasSuffix(collName, filesSuffix) && !strings.HasSuffix(collName, versionsSuffix) {
+			continue
+		}
+
+		values, err := database.Collection(collName).Distinct(ctx, "filename", bson.D{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files of %s: %w", collName, err)
+		}
+
+		for _, value := range values {
+			if name, ok := value.(string); ok {
+				names[name] = true
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// checkCommits reports the commits of the bucket whose file is gone.
+func (s *Store) checkCommits(ctx context.Context, report *store.CheckReport, fix bool, fileNames map[string]bool) error {
+	cur, err := s.commitsColl.Find(ctx, bson.D{{Key: "namespace", Value: s.bucketName}})
+	if err != nil {
+		return fmt.Errorf("failed to find commits: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var commit struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			store.Commit `bson:",inline"`
+		}
+
+		if err := cur.Decode(&commit); err != nil {
+			return fmt.Errorf("failed to decode commit: %w", err)
+		}
+
+		var missing []string
+		for _, fileID := range commit.Files() {
+			if !fileNames[fileID] {
+				missing = append(missing, fileID)
+			}
+		}
+
+		if len(missing) == 0 {
+			continue
+		}
+
+		for _, fileID := range missing {
+			issue := store.Issue{
+				Kind:   store.IssueDanglingCommit,
+				ID:     commit.SHA,
+				Detail: fmt.Sprintf("file %s is missing", fileID),
+				Fixed:  fix,
+			}
+
+			report.Issues = append(report.Issues, issue)
+		}
+
+		if fix {
+			if err := s.dropCommitFiles(ctx, commit.ID, &commit.Commit, missing); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("failed to read commits: %w", err)
+	}
+
+	return nil
+}
+
+// dropCommitFiles removes the missing files from the commit with the ID, and
+// deletes the commit once none of its files are left.
+func (s *Store) dropCommitFiles(ctx context.Context, id primitive.ObjectID, commit *store.Commit, missing []string) error {
+	if len(missing) == len(commit.Files()) {
+		if _, err := s.commitsColl.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}}); err != nil {
+			return fmt.Errorf("failed to delete dangling commit %s: %w", commit.SHA, err)
+		}
+
+		return nil
+	}
+
+	unset := bson.D{}
+	for _, fileID := range missing {
+		unset = append(unset, bson.E{Key: "replaced." + fileID, Value: ""})
+	}
+
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{{Key: "fileids", Value: bson.D{{Key: "$in", Value: missing}}}}},
+		{Key: "$unset", Value: unset},
+	}
+
+	if _, err := s.commitsColl.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update); err != nil {
+		return fmt.Errorf("failed to update dangling commit %s: %w", commit.SHA, err)
+	}
+
+	return nil
+}
+
+// checkChunks reports the chunks of the bucket that belong to no file.
+func (s *Store) checkChunks(ctx context.Context, report *store.CheckReport, fix bool, fileIDs map[primitive.ObjectID]bool) error {
+	chunks := s.bucket.GetChunksCollection()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$files_id"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "newest", Value: bson.D{{Key: "$max", Value: "$_id"}}},
+		}}},
+	}
+
+	cur, err := chunks.Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate chunks: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var group struct {
+			FileID primitive.ObjectID `bson:"_id"`
+			Count  int64              `bson:"count"`
+			Newest primitive.ObjectID `bson:"newest"`
+		}
+
+		if err := cur.Decode(&group); err != nil {
+			return fmt.Errorf("failed to decode chunks: %w", err)
+		}
+
+		if fileIDs[group.FileID] {
+			continue
+		}
+
+		issue := store.Issue{
+			Kind:   store.IssueOrphanedChunks,
+			ID:     group.FileID.Hex(),
+			Detail: fmt.Sprintf("%d chunks", group.Count),
+		}
+
+		// Recent chunks may belong to an upload that is still running.
+		if fix && time.Since(group.Newest.Timestamp()) >= orphanGracePeriod {
+			if _, err := chunks.DeleteMany(ctx, bson.D{{Key: "files_id", Value: group.FileID}}); err != nil {
+				return fmt.Errorf("failed to delete orphaned chunks of %s: %w", group.FileID.Hex(), err)
+			}
+
+			issue.Fixed = true
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("failed to read chunks: %w", err)
+	}
+
+	return nil
+}
+
+// checkRefs reports the reference counts that do not match the number of
+// links to the chunks they count.
+func (s *Store) checkRefs(ctx context.Context, report *store.CheckReport, fix bool, links map[primitive.ObjectID]int64) error {
+	refs := refsColl(s.nameIndex.coll)
+
+	cur, err := refs.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to find reference counts: %w", err)
+	}
+
+	counts := make(map[primitive.ObjectID]int64)
+
+	for cur.Next(ctx) {
+		var ref struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Count int64              `bson:"count"`
+		}
+
+		if err := cur.Decode(&ref); err != nil {
+			_ = cur.Close(ctx)
+
+			return fmt.Errorf("failed to decode reference count: %w", err)
+		}
+
+		counts[ref.ID] = ref.Count
+	}
+
+	if err := cur.Close(ctx); err != nil {
+		return fmt.Errorf("failed to read reference counts: %w", err)
+	}
+
+	ids := make(map[primitive.ObjectID]bool, len(counts)+len(links))
+	for id := range counts {
+		ids[id] = true
+	}
+
+	for id := range links {
+		ids[id] = true
+	}
+
+	for id := range ids {
+		if counts[id] == links[id] {
+			continue
+		}
+
+		issue := store.Issue{
+			Kind:   store.IssueWrongRefCount,
+			ID:     id.Hex(),
+			Detail: fmt.Sprintf("counted %d links, found %d", counts[id], links[id]),
+		}
+
+		if fix {
+			if err := setRefCount(ctx, refs, id, links[id]); err != nil {
+				return err
+			}
+
+			issue.Fixed = true
+		}
+
+		report.Issues = append(report.Issues, issue)
+	}
+
+	return nil
+}
+
+// setRefCount sets the reference count of the chunks with the ID, removing it
+// if it is zero.
+func setRefCount(ctx context.Context, refs *mongo.Collection, id primitive.ObjectID, count int64) error {
+	filter := bson.D{{Key: "_id", Value: id}}
+
+	if count == 0 {
+		if _, err := refs.DeleteOne(ctx, filter); err != nil {
+			return fmt.Errorf("failed to remove reference count of %s: %w", id.Hex(), err)
+		}
+
+		return nil
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "count", Value: count}}}}
+	if _, err := refs.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to set reference count of %s: %w", id.Hex(), err)
+	}
+
+	return nil
+}
+
+// checkIVs reports IVs that were recorded more than once, which means that a
+// nonce may have been reused.
+func (s *Store) checkIVs(ctx context.Context, report *store.CheckReport, _ bool) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$ivector"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+	}
+
+	cur, err := s.ivPusher.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate IVs: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var group struct {
+			IV    []byte `bson:"_id"`
+			Count int64  `bson:"count"`
+		}
+
+		if err := cur.Decode(&group); err != nil {
+			return fmt.Errorf("failed to decode IVs: %w", err)
+		}
+
+		report.Issues = append(report.Issues, store.Issue{
+			Kind:   store.IssueReusedIV,
+			ID:     hex.EncodeToString(group.IV),
+			Detail: fmt.Sprintf("recorded %d times", group.Count),
+		})
+	}
+
+	if err := cur.Err(); err != nil {
+		return fmt.Errorf("failed to read IVs: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The files copied by a migration are recorded in the migrations collection
+// of the target bucket, so that a migration that was interrupted resumes
+// where it stopped when it is run again, rather than copying every file
+// again. A file is recorded once its copy in the target is complete, and the
+// record is removed once the migration has no more use for it: when the file
+// is deleted from the source, or when every file matching the filter of a
+// filtered migration has been copied.
+
+const migrationsSuffix = ".migrations"
+
+// migrationsColl returns the collection that records the files migrated into
+// the bucket with the files collection.
+func migrationsColl(files *mongo.Collection) *mongo.Collection {
+	name := strings.TrimSuffix(files.Name(), filesSuffix) + migrationsSuffix
+
+	return files.Database().Collection(name)
+}
+
+// migration records a file copied into the target bucket.
+type migration struct {
+	ID     migrationKey `bson:"_id"`
+	Copy   interface{}  `bson:"copy"`             // ID of the copy in the target
+	Filter string       `bson:"filter,omitempty"` // Filter of the migration that copied it
+}
+
+// migrationKey identifies a migrated file by its source.
+type migrationKey struct {
+	Source string      `bson:"source"` // Name of the source bucket
+	File   interface{} `bson:"file"`   // ID of the file in the source
+}
+
+func (up *Migrator) migrationKey(file gridfs.File) migrationKey {
+	return migrationKey{Source: up.srcBucketName, File: file.ID}
+}
+
+// migratedCopy returns the ID of the copy of the file in the target bucket, if
+// an earlier migration that was interrupted completed one.
+func (up *Migrator) migratedCopy(ctx context.Context, file gridfs.File) (interface{}, bool, error) {
+	var rec migration
+
+	err := up.migrations.FindOne(ctx, bson.D{{Key: "_id", Value: up.migrationKey(file)}}).Decode(&rec)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find migration of %q: %w", file.Name, err)
+	}
+
+	// The copy may have been deleted from the target since.
+	n, err := up.targetBucket.GetFilesCollection().CountDocuments(ctx, bson.D{{Key: "_id", Value: rec.Copy}}, options.Count().SetLimit(1))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find copy of %q: %w", file.Name, err)
+	}
+
+	return rec.Copy, n > 0, nil
+}
+
+// recordMigrated records that the file was copied into the target bucket as
+// the file with the ID copyID by the migration with the filter.
+func (up *Migrator) recordMigrated(ctx context.Context, file gridfs.File, copyID interface{}, filter string) error {
+	rec := migration{ID: up.migrationKey(file), Copy: copyID, Filter: filter}
+
+	_, err := up.migrations.ReplaceOne(ctx, bson.D{{Key: "_id", Value: rec.ID}}, rec, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record migration of %q: %w", file.Name, err)
+	}
+
+	return nil
+}
+
+// forgetMigrated removes the record of the migration of the file.
+func (up *Migrator) forgetMigrated(ctx context.Context, file gridfs.File) error {
+	if _, err := up.migrations.DeleteOne(ctx, bson.D{{Key: "_id", Value: up.migrationKey(file)}}); err != nil {
+		return fmt.Errorf("failed to remove migration of %q: %w", file.Name, err)
+	}
+
+	return nil
+}
+
+// forgetFilter removes the records of the files copied from the source bucket
+// by the migration with the filter.
+func (up *Migrator) forgetFilter(ctx context.Context, filter string) error {
+	query := bson.D{
+		{Key: "_id.source", Value: up.srcBucketName},
+		{Key: "filter", Value: filter},
+	}
+
+	if _, err := up.migrations.DeleteMany(ctx, query); err != nil {
+		return fmt.Errorf("failed to remove migration of %q: %w", filter, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestMigrationRecord(t *testing.T) {
+	t.Parallel()
+
+	up := &Migrator{srcBucketName: "photos"}
+
+	file := gridfs.File{ID: primitive.NewObjectID(), Name: "beach.jpg"}
+
+	raw, err := bson.Marshal(migration{ID: up.migrationKey(file), Copy: file.ID, Filter: "tag('beach')"})
+	require.NoError(t, err)
+
+	// forgetFilter matches the records of a migration by these fields.
+	assert.Equal(t, "photos", bson.Raw(raw).Lookup("_id", "source").StringValue())
+	assert.Equal(t, "tag('beach')", bson.Raw(raw).Lookup("filter").StringValue())
+
+	var rec migration
+	require.NoError(t, bson.Unmarshal(raw, &rec))
+
+	assert.Equal(t, file.ID, rec.ID.File)
+	assert.Equal(t, file.ID, rec.Copy)
+}
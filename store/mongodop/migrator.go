@@ -16,13 +16,16 @@ package mongodop
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math"
+	"time"
 
+	"github.com/prestonvasquez/diskhop/internal/streamutil"
 	"github.com/prestonvasquez/diskhop/store"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -39,12 +42,20 @@ type Migrator struct {
 	srcBucketName    string
 	targetBucketName string
 	targetNameColl   *mongo.Collection
+	migrations       *mongo.Collection
 }
 
 var _ store.Pusher = &Migrator{}
 
 // ConnectMigrator connects to the MongoDB server and returns a new Migrator.
-func ConnectMigrator(ctx context.Context, connStr string, db, srcB, targB string) (*Migrator, error) {
+func ConnectMigrator(ctx context.Context, connStr string, db, srcB, targB string, connectOpts ...ConnectOption) (_ *Migrator, err error) {
+	defer func() { err = classifyError(err) }()
+
+	copts := ConnectOptions{}
+	for _, fn := range connectOpts {
+		fn(&copts)
+	}
+
 	opts := options.Client().ApplyURI(connStr)
 
 	client, err := mongo.Connect(ctx, opts)
@@ -57,18 +68,20 @@ func ConnectMigrator(ctx context.Context, connStr string, db, srcB, targB string
 		return nil, fmt.Errorf("failed to ping MongoDB server: %w", err)
 	}
 
-	fileColl := client.Database(db).Collection(srcB + "." + "files")
-	nameColl := client.Database(db).Collection(DefaultNameCollectionName)
+	database := copts.database(client, db)
+
+	fileColl := database.Collection(srcB + "." + "files")
+	nameColl := database.Collection(DefaultNameCollectionName)
 
 	srcBucket, err := gridfs.NewBucket(
-		client.Database(db),
+		database,
 		options.GridFSBucket().SetName(srcB))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bucket: %w", err)
 	}
 
 	targetBucket, err := gridfs.NewBucket(
-		client.Database(db),
+		database,
 		options.GridFSBucket().SetName(targB))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bucket: %w", err)
@@ -82,156 +95,397 @@ func ConnectMigrator(ctx context.Context, connStr string, db, srcB, targB string
 		targetBucket:     targetBucket,
 		targetBucketName: targB,
 		srcBucketName:    srcB,
-		targetNameColl:   client.Database(db).Collection(DefaultNameCollectionName),
+		targetNameColl:   database.Collection(DefaultNameCollectionName),
+		migrations:       migrationsColl(targetBucket.GetFilesCollection()),
 	}
 
 	return pusher, nil
 }
 
-func migrateByFileID(up *Migrator, id interface{}) error {
+// SourceBucketName returns the name of the bucket the files are migrated from.
+func (up *Migrator) SourceBucketName() string {
+	return up.srcBucketName
+}
+
+// TargetBucketName returns the name of the bucket the files are migrated to.
+func (up *Migrator) TargetBucketName() string {
+	return up.targetBucketName
+}
+
+// DatabaseName returns the name of the database that holds both buckets.
+func (up *Migrator) DatabaseName() string {
+	return up.database
+}
+
+func migrateByFileID(ctx context.Context, up *Migrator, file gridfs.File) error {
+	id := file.ID
+
 	// If nothing has changed, then we use an aggregation pipeline to
 	// move the data from the source to the target.
 	pipeline := mongo.Pipeline{
 		// Match the document
-		bson.D{{"$match", bson.D{{"_id", id}}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "_id", Value: id}}}},
 		// Add the document to the target collection
-		bson.D{{"$merge", bson.D{{"into", up.targetBucketName + "." + "files"}, {"whenMatched", "merge"}}}},
+		bson.D{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: up.targetBucketName + "." + "files"},
+			{Key: "whenMatched", Value: "merge"},
+		}}},
 	}
 
 	// Merge File into the target
 	srcFileColl := up.client.Database(up.database).Collection(up.srcBucketName + "." + "files")
 
-	_, err := srcFileColl.Aggregate(context.TODO(), pipeline)
-	if err != nil {
-		log.Fatal("Error moving file:", err)
+	if _, err := srcFileColl.Aggregate(ctx, pipeline); err != nil {
+		return fmt.Errorf("failed to move file: %w", err)
 	}
 
 	// Merge chunks into the target
 	//
-	// Define the aggregation pipeline to move chunks
+	// Define the aggregation pipeline to move chunks. A link brings a copy
+	// of the chunks it links to.
 	chunksPipeline := mongo.Pipeline{
 		// Match the chunks for the given file ID
-		bson.D{{"$match", bson.D{{"files_id", id}}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "files_id", Value: dataID(file)}}}},
 		// Merge the chunks into the target collection
-		bson.D{{"$merge", bson.D{{"into", up.targetBucketName + "." + "chunks"}, {"whenMatched", "merge"}}}},
+		bson.D{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: up.targetBucketName + "." + "chunks"},
+			{Key: "whenMatched", Value: "merge"},
+		}}},
 	}
 
 	srcChunksColl := up.client.Database(up.database).Collection(up.srcBucketName + "." + "chunks")
 
-	// Execute the aggregation pipeline for the chunks
-	_, err = srcChunksColl.Aggregate(context.TODO(), chunksPipeline)
-	if err != nil {
-		return fmt.Errorf("Error moving chunks:", err)
+	// Execute the aggregation pipeline for the chunks. If only some of the
+	// chunks were merged, remove the copy from the target so that it does not
+	// hold a truncated file.
+	if _, err := srcChunksColl.Aggregate(ctx, chunksPipeline); err != nil {
+		err = fmt.Errorf("failed to move chunks: %w", err)
+
+		if delErr := deleteFile(ctx, up.targetBucket, file); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+
+		return err
+	}
+
+	// A link copied into the target links to the copy of its chunks there.
+	if blob, ok := blobID(file.Metadata); ok {
+		if err := pinChunks(ctx, up.targetBucket, blob); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// PushEnc migrates the file with the given name from the source bucket to the
-// target bucket.
+// Push migrates the file with the given name from the source bucket to the
+// target bucket, or every file matching the filter of the options if it is
+// set. A migration that was interrupted, such as by cancelling ctx, resumes
+// from the files it had not yet copied when it is run again.
 func (up *Migrator) Push(
 	ctx context.Context,
 	name string,
 	r io.ReadSeeker,
 	opts ...store.PushOption,
-) (string, error) {
+) (_ string, err error) {
+	defer func() { err = classifyError(err) }()
+
 	mergedOpts := store.PushOptions{}
 	for _, fn := range opts {
 		fn(&mergedOpts)
 	}
 
-	if err := loadNameIndex(ctx, &up.nameIndex, mergedOpts.SealOpener); err != nil {
+	if err := mergedOpts.Limiter.Acquire(ctx); err != nil {
+		return "", fmt.Errorf("failed to acquire migration slot: %w", err)
+	}
+
+	defer mergedOpts.Limiter.Release()
+
+	if err := loadNameIndex(ctx, &up.nameIndex, mergedOpts.SealOpenerForMetadata()); err != nil {
 		return "", fmt.Errorf("failed to load name index: %w", err)
 	}
 
 	// Merge filtered data.
 	if mergedOpts.Filter != "" {
-		// Get the ids for the name.
-		pullOpts := store.PullOptions{
-			SampleSize: math.MaxInt,
-			Filter:     mergedOpts.Filter,
-		}
+		return "", up.migrateFiltered(ctx, mergedOpts)
+	}
 
-		files, err := findFiles(ctx, &up.nameIndex, up.srcBucket, pullOpts)
+	// Get the file id for the name.
+	doc, meta, ok := up.nameIndex.nameDoc.get(name)
+	if !ok && mergedOpts.Filter == "" {
+		return "", fmt.Errorf("file not found: %s", name)
+	}
+
+	// A file copied by a migration that was interrupted before deleting it
+	// from the source is not copied again.
+	copyID, copied, err := up.migratedCopy(ctx, *doc)
+	if err != nil {
+		return "", err
+	}
+
+	if !copied {
+		copyID, err = up.copyFile(ctx, name, doc, meta, r, mergedOpts)
 		if err != nil {
-			return "", fmt.Errorf("failed to find files: %w", err)
+			return "", err
 		}
 
-		ids := make([]interface{}, len(files))
-		for i, f := range files {
-			ids[i] = f.ID
+		if err := up.recordMigrated(ctx, *doc, copyID, ""); err != nil {
+			return "", err
 		}
+	}
 
-		for _, id := range ids {
-			// TODO: Can this be variadic? I.e. pass a slice of ids rather than a
-			// single id at a time?
-			if err := migrateByFileID(up, id); err != nil {
-				return "", fmt.Errorf("failed to migrate by file ID: %w", err)
-			}
-		}
+	// Delete the file from source database.
+	err = deleteFile(ctx, up.srcBucket, *doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete file from source bucket: %w", err)
+	}
 
-		// Return nothing because there are probably a bunch of IDs.
-		return "", nil
+	if err := up.forgetMigrated(ctx, *doc); err != nil {
+		return "", err
 	}
 
-	// Get the file id for the name.
-	doc, meta, ok := up.nameIndex.nameDoc.get(name)
-	if !ok && mergedOpts.Filter == "" {
-		return "", fmt.Errorf("file not found: %s", name)
+	return "", nil
+}
+
+// migrateFiltered merges the files matching the filter of opts into the
+// target bucket, skipping those that a run of the same migration that was
+// interrupted already copied. The observer of opts is told of each file, since
+// the server copies them without reporting their bytes.
+func (up *Migrator) migrateFiltered(ctx context.Context, opts store.PushOptions) error {
+	// Get the ids for the name.
+	pullOpts := store.PullOptions{
+		SampleSize: math.MaxInt,
+		Filter:     opts.Filter,
 	}
 
-	changed, err := dataChanged(ctx, &up.nameIndex, name, r, mergedOpts)
+	// Every file is migrated, whatever the exclude policy of the source.
+	files, _, err := findFiles(ctx, &up.nameIndex, up.srcBucket, nil, pullOpts)
+	if err != nil {
+		return fmt.Errorf("failed to find files: %w", err)
+	}
 
-	// Merge file ID.
-	if !changed && err == nil {
-		if err := migrateByFileID(up, doc.ID); err != nil {
-			return "", err
-		}
-	} else {
+	observer := store.Observe(opts.Observer)
 
-		meta.addTags(mergedOpts.Tags...)
+	var (
+		migrated int
+		bytes    int64
+	)
 
-		// Add new tags and encrypt the metadata.
-		encryptedMeta, err := encryptGridFSMetadata(ctx, mergedOpts.SealOpener, meta)
-		if err != nil {
-			return "", fmt.Errorf("failed to encrypt metadata: %w", err)
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("migration interrupted: %w", err)
 		}
 
-		// Download the file from source database.
-		stream, err := up.srcBucket.OpenDownloadStream(doc.ID)
+		_, copied, err := up.migratedCopy(ctx, file)
 		if err != nil {
-			return "", fmt.Errorf("failed to open download stream: %w", err)
+			return err
 		}
 
-		data := make([]byte, doc.Length)
-		_, err = stream.Read(data)
-		if err != nil {
-			return "", fmt.Errorf("failed to read data from stream: %w", err)
+		if copied {
+			continue
 		}
 
-		stream.Close()
+		observer.OnFileStart(file.Name)
 
-		gfsOpts := options.GridFSUpload().SetMetadata(encryptedMeta)
-
-		// Upload the file to target database.
-		uploadStream, err := up.targetBucket.OpenUploadStream(doc.Name, gfsOpts)
+		// TODO: Can this be variadic? I.e. pass a slice of ids rather than a
+		// single id at a time?
+		err = store.RetryWithPolicy(ctx, transientRetryPolicy, func() error {
+			return migrateByFileID(ctx, up, file)
+		})
 		if err != nil {
-			return "", fmt.Errorf("failed to open upload stream: %w", err)
+			err = fmt.Errorf("failed to migrate by file ID: %w", err)
+			observer.OnError(file.Name, err)
+
+			return err
+		}
+
+		if err := up.recordMigrated(ctx, file, file.ID, opts.Filter); err != nil {
+			return err
 		}
 
-		_, err = uploadStream.Write(data)
+		observer.OnFileDone(file.Name, file.Length)
+		migrated, bytes = migrated+1, bytes+file.Length
+	}
+
+	observer.OnBatchDone(migrated, bytes)
+
+	// The migration is complete, so there is nothing left to resume.
+	return up.forgetFilter(ctx, opts.Filter)
+}
+
+// copyFile copies the file with the name into the target bucket, returning
+// the ID of the copy. The data is copied as it is, since the buckets share the
+// key that seals it, and only the metadata is sealed again with the new tags:
+//
+//   - A file whose data and tags have not changed is merged by the server
+//     under its ID, files document and all.
+//   - Any other file is copied by the server under a new ID, with a files
+//     document holding the new metadata.
+//   - If the server cannot run that copy, such as a server older than 4.2
+//     without $merge, the data is streamed through the client instead.
+func (up *Migrator) copyFile(
+	ctx context.Context,
+	name string,
+	doc *gridfs.File,
+	meta *gridfsMetadata,
+	r io.ReadSeeker,
+	opts store.PushOptions,
+) (interface{}, error) {
+	changed, err := dataChanged(ctx, &up.nameIndex, name, r, opts)
+
+	// Merge file ID.
+	if !changed && err == nil {
+		err := store.RetryWithPolicy(ctx, transientRetryPolicy, func() error {
+			return migrateByFileID(ctx, up, *doc)
+		})
 		if err != nil {
-			return "", fmt.Errorf("failed to write data to stream: %w", err)
+			return nil, err
 		}
 
-		uploadStream.Close()
+		return doc.ID, nil
 	}
 
-	// Delete the file from source database.
-	err = up.srcBucket.Delete(doc.ID)
+	meta.addTags(opts.Tags...)
+
+	// Add new tags and encrypt the metadata.
+	encryptedMeta, err := encryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), meta)
 	if err != nil {
-		return "", fmt.Errorf("failed to delete file from source bucket: %w", err)
+		return nil, fmt.Errorf("failed to encrypt metadata: %w", err)
 	}
 
-	return "", nil
+	// A failed copy deletes what it copied, so it can be made again.
+	var id primitive.ObjectID
+
+	err = store.RetryWithPolicy(ctx, transientRetryPolicy, func() error {
+		id, err = copyByFileID(ctx, up, *doc, encryptedMeta)
+
+		return err
+	})
+
+	var cmdErr mongo.CommandError
+	if err == nil || !errors.As(err, &cmdErr) {
+		return id, err
+	}
+
+	return up.streamFile(ctx, name, doc, encryptedMeta, opts)
+}
+
+// copyByFileID copies the data of the file into the target bucket on the
+// server, under a new files document with the metadata, returning its ID. The
+// copy holds its own chunks, even if the file is a link.
+func copyByFileID(ctx context.Context, up *Migrator, file gridfs.File, meta bson.Raw) (primitive.ObjectID, error) {
+	id := primitive.NewObjectID()
+
+	// The chunks are given the new file ID, and new IDs of their own by
+	// $merge.
+	chunksPipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "files_id", Value: dataID(file)}}}},
+		bson.D{{Key: "$unset", Value: "_id"}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "files_id", Value: id}}}},
+		bson.D{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: up.targetBucketName + "." + "chunks"},
+			{Key: "whenMatched", Value: "fail"},
+		}}},
+	}
+
+	srcChunksColl := up.client.Database(up.database).Collection(up.srcBucketName + "." + "chunks")
+
+	if _, err := srcChunksColl.Aggregate(ctx, chunksPipeline); err != nil {
+		err = fmt.Errorf("failed to copy chunks: %w", err)
+
+		return id, errors.Join(err, deleteCopiedChunks(ctx, up, id))
+	}
+
+	doc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "length", Value: file.Length},
+		{Key: "chunkSize", Value: file.ChunkSize},
+		{Key: "uploadDate", Value: time.Now()},
+		{Key: "filename", Value: file.Name},
+		{Key: "metadata", Value: meta},
+	}
+
+	if _, err := up.targetBucket.GetFilesCollection().InsertOne(ctx, doc); err != nil {
+		err = fmt.Errorf("failed to insert copy: %w", err)
+
+		return id, errors.Join(err, deleteCopiedChunks(ctx, up, id))
+	}
+
+	return id, nil
+}
+
+// deleteCopiedChunks deletes the chunks of a copy that failed from the target
+// bucket.
+func deleteCopiedChunks(ctx context.Context, up *Migrator, id primitive.ObjectID) error {
+	if _, err := up.targetBucket.GetChunksCollection().DeleteMany(ctx, bson.D{{Key: "files_id", Value: id}}); err != nil {
+		return fmt.Errorf("failed to remove the chunks of copy %q: %w", id.Hex(), err)
+	}
+
+	return nil
+}
+
+// streamFile copies the data of the file into the target bucket through the
+// client, under a new files document with the metadata, returning its ID. Its
+// bytes are reported to the observer of opts as they are copied.
+//
+// The data is streamed from the download to the upload, so that a large file
+// is never held in memory. Unlike the server copies of copyFile, which are
+// retried, a failed stream is aborted, since nothing is kept to replay it;
+// running the migration again copies the file from the start.
+func (up *Migrator) streamFile(
+	ctx context.Context,
+	name string,
+	doc *gridfs.File,
+	encryptedMeta bson.Raw,
+	opts store.PushOptions,
+) (interface{}, error) {
+	// Download the file from source database.
+	stream, err := openData(ctx, up.srcBucket, *doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open download stream: %w", err)
+	}
+
+	defer func() { _ = stream.Close() }()
+
+	gfsOpts := options.GridFSUpload().SetMetadata(encryptedMeta)
+
+	// Upload the file to target database.
+	uploadStream, err := up.targetBucket.OpenUploadStream(doc.Name, gfsOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload stream: %w", err)
+	}
+
+	progress, _ := opts.Observer.(store.ProgressObserver)
+
+	// Cancelling ctx fails the next read, which aborts the copy.
+	streams := streamutil.NewBuilder().Progress(func(n int) error {
+		if progress != nil {
+			progress.OnFileProgress(name, int64(n))
+		}
+
+		return ctx.Err()
+	})
+
+	if _, err := streams.Copy(uploadStream, stream); err != nil {
+		err = fmt.Errorf("failed to copy data to stream: %w", err)
+
+		// Abort removes the chunks that were already written.
+		if abortErr := uploadStream.Abort(); abortErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to abort upload: %w", abortErr))
+		}
+
+		return nil, err
+	}
+
+	if err := uploadStream.Close(); err != nil {
+		err = fmt.Errorf("failed to close upload stream: %w", err)
+
+		if delErr := deletePartialUpload(ctx, up.targetBucket, uploadStream.FileID); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+
+		return nil, err
+	}
+
+	return uploadStream.FileID, nil
 }
@@ -0,0 +1,302 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/exp/test"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newMockMigrator returns a migrator from the "src" bucket to the "dst"
+// bucket of the mock deployment.
+func newMockMigrator(mt *mtest.T) *Migrator {
+	mt.Helper()
+
+	src, err := gridfs.NewBucket(mt.DB, options.GridFSBucket().SetName("src"))
+	require.NoError(mt, err)
+
+	dst, err := gridfs.NewBucket(mt.DB, options.GridFSBucket().SetName("dst"))
+	require.NoError(mt, err)
+
+	return &Migrator{
+		client:           mt.Client,
+		database:         mt.DB.Name(),
+		srcBucket:        src,
+		targetBucket:     dst,
+		srcBucketName:    "src",
+		targetBucketName: "dst",
+	}
+}
+
+// progressRecorder is a store.ProgressObserver that sums the bytes reported
+// for each file.
+type progressRecorder struct {
+	store.NopObserver
+
+	mu    sync.Mutex
+	bytes map[string]int64
+	onN   func()
+}
+
+func (r *progressRecorder) OnFileProgress(name string, n int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.bytes == nil {
+		r.bytes = make(map[string]int64)
+	}
+
+	r.bytes[name] += n
+
+	if r.onN != nil {
+		r.onN()
+	}
+}
+
+// mockSourceFile returns the responses that download "0123456789" as a.txt
+// from the source bucket in chunks of 4 bytes, and its files document.
+func mockSourceFile(mt *mtest.T) (gridfs.File, []bson.D) {
+	mt.Helper()
+
+	id := primitive.NewObjectID()
+	file := gridfs.File{ID: id, Name: "a.txt", Length: 10, ChunkSize: 4}
+
+	chunk := func(n int32, data string) bson.D {
+		return bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "files_id", Value: id},
+			{Key: "n", Value: n},
+			{Key: "data", Value: primitive.Binary{Data: []byte(data)}},
+		}
+	}
+
+	responses := []bson.D{
+		mtest.CreateCursorResponse(0, mt.DB.Name()+".src.files", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: id},
+			{Key: "length", Value: int64(10)},
+			{Key: "chunkSize", Value: int32(4)},
+			{Key: "uploadDate", Value: time.Now()},
+			{Key: "filename", Value: "a.txt"},
+		}),
+		mtest.CreateCursorResponse(0, mt.DB.Name()+".src.chunks", mtest.FirstBatch,
+			chunk(0, "0123"), chunk(1, "4567"), chunk(2, "89")),
+		// The target bucket holds files, so its indexes are not created.
+		mtest.CreateCursorResponse(0, mt.DB.Name()+".dst.files", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: primitive.NewObjectID()}}),
+	}
+
+	return file, responses
+}
+
+func TestCopyByFileID(t *testing.T) {
+	mt := newMockTest(t)
+
+	meta, err := bson.Marshal(bson.D{{Key: metadataKey, Value: "sealed"}})
+	require.NoError(t, err)
+
+	mt.Run("copies the chunks under a new ID", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".src.chunks", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+		)
+
+		file := gridfs.File{ID: primitive.NewObjectID(), Name: "a.txt", Length: 10, ChunkSize: 4}
+
+		id, err := copyByFileID(context.Background(), newMockMigrator(mt), file, meta)
+		require.NoError(mt, err)
+
+		aggregates := sentCommands(mt, "aggregate", "src.chunks")
+		require.Len(mt, aggregates, 1)
+
+		stages, err := aggregates[0].Lookup("pipeline").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, stages, 4)
+
+		assert.Equal(mt, file.ID, stages[0].Document().Lookup("$match", "files_id").ObjectID())
+		assert.Equal(mt, id, stages[2].Document().Lookup("$set", "files_id").ObjectID())
+		assert.Equal(mt, "dst.chunks", stages[3].Document().Lookup("$merge", "into").StringValue())
+
+		files := insertedDocuments(mt, "dst.files")
+		require.Len(mt, files, 1)
+
+		assert.Equal(mt, id, files[0].Lookup("_id").ObjectID())
+		assert.Equal(mt, "a.txt", files[0].Lookup("filename").StringValue())
+		assert.Equal(mt, int64(10), files[0].Lookup("length").Int64())
+		assert.Equal(mt, "sealed", files[0].Lookup("metadata", metadataKey).StringValue())
+	})
+
+	mt.Run("deletes the copied chunks when the insert fails", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".src.chunks", mtest.FirstBatch),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad value"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 3}),
+		)
+
+		file := gridfs.File{ID: primitive.NewObjectID(), Name: "a.txt", Length: 10, ChunkSize: 4}
+
+		id, err := copyByFileID(context.Background(), newMockMigrator(mt), file, meta)
+		assert.ErrorContains(mt, err, "bad value")
+
+		deletes := sentCommands(mt, "delete", "dst.chunks")
+		require.Len(mt, deletes, 1)
+
+		filter := deletes[0].Lookup("deletes").Array().Index(0).Value().Document().Lookup("q")
+		assert.Equal(mt, id, filter.Document().Lookup("files_id").ObjectID())
+	})
+}
+
+func TestStreamFile(t *testing.T) {
+	mt := newMockTest(t)
+
+	meta, err := bson.Marshal(bson.D{{Key: metadataKey, Value: "sealed"}})
+	require.NoError(t, err)
+
+	mt.Run("reports the bytes it copies", func(mt *mtest.T) {
+		file, responses := mockSourceFile(mt)
+
+		mt.AddMockResponses(append(responses,
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)...)
+
+		progress := &progressRecorder{}
+
+		id, err := newMockMigrator(mt).streamFile(context.Background(), "a.txt", &file, meta,
+			store.PushOptions{Observer: progress})
+		require.NoError(mt, err)
+
+		assert.Equal(mt, map[string]int64{"a.txt": 10}, progress.bytes)
+
+		var data []byte
+		for _, chunk := range insertedDocuments(mt, "dst.chunks") {
+			assert.Equal(mt, id, chunk.Lookup("files_id").ObjectID())
+
+			_, chunkData := chunk.Lookup("data").Binary()
+			data = append(data, chunkData...)
+		}
+
+		assert.Equal(mt, "0123456789", string(data))
+
+		files := insertedDocuments(mt, "dst.files")
+		require.Len(mt, files, 1)
+		assert.Equal(mt, "sealed", files[0].Lookup("metadata", metadataKey).StringValue())
+	})
+
+	mt.Run("aborts when cancelled", func(mt *mtest.T) {
+		file, responses := mockSourceFile(mt)
+
+		mt.AddMockResponses(append(responses, mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}))...)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		progress := &progressRecorder{onN: cancel}
+
+		_, err := newMockMigrator(mt).streamFile(ctx, "a.txt", &file, meta, store.PushOptions{Observer: progress})
+		assert.ErrorIs(mt, err, context.Canceled)
+
+		assert.Empty(mt, insertedDocuments(mt, "dst.files"))
+		assert.Len(mt, sentCommands(mt, "delete", "dst.chunks"), 1, "the upload is aborted")
+	})
+}
+
+func TestCopyFile(t *testing.T) {
+	mt := newMockTest(t)
+
+	block, err := aes.NewCipher([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	opts := store.PushOptions{SealOpener: dcrypto.NewAEAD(&test.MockIVManager{}, aesgcm)}
+
+	// newMigrator returns a migrator whose index holds the file with
+	// contents other than those pushed, so that it is copied under a new ID.
+	newMigrator := func(mt *mtest.T, file gridfs.File) (*Migrator, *gridfsMetadata) {
+		up := newMockMigrator(mt)
+
+		meta := &gridfsMetadata{Diskhop: store.Metadata{SHA256: "stale"}}
+
+		up.nameIndex = nameIndex{hexName: &hexName{}, nameDoc: &nameDoc{}}
+		up.nameIndex.nameDoc.add("a.txt", &file, meta)
+
+		return up, meta
+	}
+
+	mt.Run("retries a transient failure", func(mt *mtest.T) {
+		interrupted := mtest.CommandError{Code: 11600, Message: "interrupted", Labels: []string{"RetryableWriteError"}}
+
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(interrupted),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".src.chunks", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+		)
+
+		file := gridfs.File{ID: primitive.NewObjectID(), Name: "a.txt", Length: 10, ChunkSize: 4}
+		up, meta := newMigrator(mt, file)
+
+		id, err := up.copyFile(context.Background(), "a.txt", &file, meta, strings.NewReader("0123456789"), opts)
+		require.NoError(mt, err)
+
+		assert.Len(mt, sentCommands(mt, "aggregate", "src.chunks"), 2)
+
+		files := insertedDocuments(mt, "dst.files")
+		require.Len(mt, files, 1)
+		assert.Equal(mt, id, files[0].Lookup("_id").ObjectID())
+	})
+
+	mt.Run("streams a file the server cannot copy", func(mt *mtest.T) {
+		file, responses := mockSourceFile(mt)
+		up, meta := newMigrator(mt, file)
+
+		// A server without $merge rejects the pipeline.
+		noMerge := mtest.CommandError{Code: 40324, Message: "Unrecognized pipeline stage name: '$merge'"}
+
+		mt.AddMockResponses(append([]bson.D{
+			mtest.CreateCommandErrorResponse(noMerge),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+		}, append(responses,
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)...)...)
+
+		id, err := up.copyFile(context.Background(), "a.txt", &file, meta, strings.NewReader("0123456789"), opts)
+		require.NoError(mt, err)
+
+		assert.Len(mt, sentCommands(mt, "aggregate", "src.chunks"), 1, "a rejected pipeline is not retried")
+
+		files := insertedDocuments(mt, "dst.files")
+		require.Len(mt, files, 1)
+		assert.Equal(mt, id, files[0].Lookup("_id").ObjectID())
+	})
+}
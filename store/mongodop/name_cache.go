@@ -0,0 +1,288 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	// The pure Go SQLite driver, registered as "sqlite".
+	_ "modernc.org/sqlite"
+)
+
+// Loading the name index downloads every name of the name collection. A name
+// cache keeps the names between connections, under the version of the name
+// collection they were loaded at. The names are cached sealed, as they are in
+// the name collection, so the cache holds nothing that the remote does not. Every push
+// that adds a name records a new version once the name is in, so a cache
+// loaded before it is missed and filled again. The names of deleted files are
+// left in the cache, where nothing looks them up.
+
+// NameCache keeps the sealed names of the name collection, by the hex of the
+// ID of their name document.
+type NameCache interface {
+	// Load returns the names cached at the version, and false if the cache
+	// holds none or holds another version.
+	Load(ctx context.Context, version string) (map[string][]byte, bool, error)
+
+	// Store replaces the cached names with those of the version.
+	Store(ctx context.Context, version string, names map[string][]byte) error
+}
+
+// WithNameCache loads the names of the name collection from the cache while
+// it holds the current version, rather than from the remote.
+func WithNameCache(cache NameCache) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.NameCache = cache
+	}
+}
+
+// namesVersion returns the version of the name collection, recording one if
+// it has none. A read-only index records none, and returns an empty version.
+func (nidx *nameIndex) namesVersion(ctx context.Context) (string, error) {
+	settings, err := loadNameSettings(ctx, nidx.settingsColl)
+	if err != nil {
+		return "", err
+	}
+
+	if settings.Version != "" || nidx.readOnly {
+		return settings.Version, nil
+	}
+
+	// Another client may record a version first, in which case its version
+	// is used.
+	filter := bson.D{
+		{Key: "_id", Value: nameSettingsID},
+		{Key: "version", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "version", Value: primitive.NewObjectID().Hex()}}}}
+
+	_, err = nidx.settingsColl.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return "", fmt.Errorf("failed to record name version: %w", err)
+	}
+
+	if settings, err = loadNameSettings(ctx, nidx.settingsColl); err != nil {
+		return "", err
+	}
+
+	return settings.Version, nil
+}
+
+// touchNames records a new version of the name collection. It is called once
+// a name is added, so that a cache loaded before cannot hold the version.
+func (nidx *nameIndex) touchNames(ctx context.Context) error {
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "version", Value: primitive.NewObjectID().Hex()}}}}
+
+	_, err := nidx.settingsColl.UpdateOne(ctx, bson.D{{Key: "_id", Value: nameSettingsID}}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to record name version: %w", err)
+	}
+
+	return nil
+}
+
+// loadCachedHexName loads the names of the name collection from the cache of
+// the index, falling back to the remote when it misses. The version is read
+// before the names, so that names added while they are loaded make the cache
+// stale rather than incomplete.
+func loadCachedHexName(ctx context.Context, nidx *nameIndex, opener dcrypto.Opener) (*hexName, error) {
+	if nidx.cache == nil {
+		return loadHexName(ctx, opener, nidx.nameColl)
+	}
+
+	version, err := nidx.namesVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == "" {
+		return loadHexName(ctx, opener, nidx.nameColl)
+	}
+
+	// The cache only saves work, so a cache that cannot be read or written
+	// is missed rather than failing the load.
+	if sealed, ok, err := nidx.cache.Load(ctx, version); err == nil && ok {
+		return openNames(ctx, opener, sealed)
+	}
+
+	sealed, err := loadSealedNames(ctx, nidx.nameColl)
+	if err != nil {
+		return nil, err
+	}
+
+	hn, err := openNames(ctx, opener, sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = nidx.cache.Store(ctx, version, sealed)
+
+	return hn, nil
+}
+
+// SQLiteNameCache is a NameCache kept in a SQLite database file.
+type SQLiteNameCache struct {
+	db *sql.DB
+}
+
+var (
+	_ NameCache = (*SQLiteNameCache)(nil)
+	_ io.Closer = (*SQLiteNameCache)(nil)
+)
+
+const sqliteNameSchema = `
+CREATE TABLE IF NOT EXISTS names (hex TEXT PRIMARY KEY, name BLOB NOT NULL);
+CREATE TABLE IF NOT EXISTS version (id INTEGER PRIMARY KEY CHECK (id = 0), version TEXT NOT NULL);
+`
+
+// NewSQLiteNameCache returns a name cache kept in the SQLite database at
+// path, creating it if it does not exist.
+func NewSQLiteNameCache(ctx context.Context, path string) (*SQLiteNameCache, error) {
+	// The file is created before it is opened, so that it is only readable
+	// by its owner.
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create name cache: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create name cache: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open name cache: %w", err)
+	}
+
+	// A single connection serializes the writes of the cache.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, sqliteNameSchema); err != nil {
+		_ = db.Close()
+
+		return nil, fmt.Errorf("failed to create name cache schema: %w", err)
+	}
+
+	return &SQLiteNameCache{db: db}, nil
+}
+
+// Load returns the names cached at the version.
+func (c *SQLiteNameCache) Load(ctx context.Context, version string) (map[string][]byte, bool, error) {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin name cache transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	var cached string
+
+	err = tx.QueryRowContext(ctx, "SELECT version FROM version WHERE id = 0").Scan(&cached)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read name cache version: %w", err)
+	}
+
+	if cached != version {
+		return nil, false, nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT hex, name FROM names")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read name cache: %w", err)
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	names := map[string][]byte{}
+
+	for rows.Next() {
+		var (
+			id   string
+			name []byte
+		)
+
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, false, fmt.Errorf("failed to read name cache row: %w", err)
+		}
+
+		names[id] = name
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to read name cache: %w", err)
+	}
+
+	return names, true, nil
+}
+
+// Store replaces the cached names with those of the version.
+func (c *SQLiteNameCache) Store(ctx context.Context, version string, names map[string][]byte) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin name cache transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback() }()
+
+	for _, stmt := range []string{"DELETE FROM names", "DELETE FROM version"} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to clear name cache: %w", err)
+		}
+	}
+
+	insert, err := tx.PrepareContext(ctx, "INSERT INTO names (hex, name) VALUES (?, ?)")
+	if err != nil {
+		return fmt.Errorf("failed to prepare name cache insert: %w", err)
+	}
+
+	defer func() { _ = insert.Close() }()
+
+	for id, name := range names {
+		if _, err := insert.ExecContext(ctx, id, name); err != nil {
+			return fmt.Errorf("failed to cache name of %s: %w", id, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO version (id, version) VALUES (0, ?)", version); err != nil {
+		return fmt.Errorf("failed to cache name version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit name cache: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the database of the cache.
+func (c *SQLiteNameCache) Close() error {
+	return c.db.Close()
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/exp/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSQLiteNameCache(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "names.db")
+
+	cache, err := NewSQLiteNameCache(ctx, path)
+	require.NoError(t, err)
+
+	defer func() { require.NoError(t, cache.Close()) }()
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "the cache must be private")
+
+	_, ok, err := cache.Load(ctx, "v1")
+	require.NoError(t, err)
+	assert.False(t, ok, "an empty cache should miss")
+
+	names := map[string][]byte{
+		"66f1a0000000000000000001": []byte("photos/beach.jpg"),
+		"66f1a0000000000000000002": []byte("it's | odd'); DROP TABLE names; --\n\x00name"),
+	}
+
+	for i := 0; i < 1000; i++ {
+		names[fmt.Sprintf("%024x", i+16)] = []byte(fmt.Sprintf("bulk/%d", i))
+	}
+
+	require.NoError(t, cache.Store(ctx, "v1", names))
+
+	got, ok, err := cache.Load(ctx, "v1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, names, got)
+
+	_, ok, err = cache.Load(ctx, "v2")
+	require.NoError(t, err)
+	assert.False(t, ok, "another version should miss")
+
+	// Storing a version replaces the names of the last one.
+	require.NoError(t, cache.Store(ctx, "v2", map[string][]byte{"66f1a0000000000000000003": []byte("new.txt")}))
+
+	got, ok, err = cache.Load(ctx, "v2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, map[string][]byte{"66f1a0000000000000000003": []byte("new.txt")}, got)
+}
+
+// mapNameCache is a NameCache held in memory.
+type mapNameCache struct {
+	version string
+	names   map[string][]byte
+}
+
+func (c *mapNameCache) Load(_ context.Context, version string) (map[string][]byte, bool, error) {
+	return c.names, c.names != nil && c.version == version, nil
+}
+
+func (c *mapNameCache) Store(_ context.Context, version string, names map[string][]byte) error {
+	c.version, c.names = version, names
+
+	return nil
+}
+
+func TestLoadCachedHexNameSealed(t *testing.T) {
+	mt := newMockTest(t)
+
+	block, err := aes.NewCipher([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	so := dcrypto.NewAEAD(&test.MockIVManager{}, aesgcm)
+
+	mt.Run("caches the names sealed", func(mt *mtest.T) {
+		ctx := context.Background()
+		id := primitive.NewObjectID()
+
+		sealed, err := so.Seal(ctx, []byte("photos/beach.jpg"))
+		require.NoError(mt, err)
+
+		settings := bson.D{{Key: "_id", Value: nameSettingsID}, {Key: "version", Value: "v1"}}
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".settings", mtest.FirstBatch, settings),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".names", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: id},
+				{Key: "data", Value: primitive.Binary{Data: sealed}},
+			}),
+			// The second load is served by the cache.
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".settings", mtest.FirstBatch, settings),
+		)
+
+		cache := &mapNameCache{}
+		nidx := &nameIndex{
+			nameColl:     mt.DB.Collection("names"),
+			settingsColl: mt.DB.Collection("settings"),
+			cache:        cache,
+		}
+
+		for i := 0; i < 2; i++ {
+			hn, err := loadCachedHexName(ctx, nidx, so)
+			require.NoError(mt, err)
+			assert.Equal(mt, map[string]string{id.Hex(): "photos/beach.jpg"}, hn.hexToName)
+		}
+
+		assert.Len(mt, sentCommands(mt, "find", "names"), 1)
+
+		require.Contains(mt, cache.names, id.Hex())
+		assert.Equal(mt, sealed, cache.names[id.Hex()])
+		assert.False(mt, bytes.Contains(cache.names[id.Hex()], []byte("beach")), "the cached name must be sealed")
+	})
+}
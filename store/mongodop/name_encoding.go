@@ -0,0 +1,302 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// NameEncodingObjectID names each file in GridFS with the hex of an
+	// ObjectID that keys its encrypted name in the name collection, so that
+	// finding a file by name loads and decrypts the whole name collection.
+	NameEncodingObjectID = "objectid"
+
+	// NameEncodingCiphertext names each file in GridFS with the base64 of its
+	// encrypted name, so that a file can be found by decrypting the names of
+	// the bucket one at a time until it matches.
+	NameEncodingCiphertext = "ciphertext"
+)
+
+// ErrNameEncodingMismatch is returned by Connect when the name encoding
+// configured on the client does not match the one the bucket was written
+// with.
+var ErrNameEncodingMismatch = errors.New("name encoding does not match the bucket")
+
+// WithNameEncoding sets how the names of the files are stored in GridFS. The
+// encoding of a bucket can only be chosen while it holds no files.
+func WithNameEncoding(encoding string) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.NameEncoding = encoding
+	}
+}
+
+// ValidateNameEncoding returns an error if encoding is not a supported name
+// encoding. An empty encoding uses that of the bucket.
+func ValidateNameEncoding(encoding string) error {
+	switch encoding {
+	case "", NameEncodingObjectID, NameEncodingCiphertext:
+		return nil
+	}
+
+	return fmt.Errorf("unknown name encoding %q, expected %q or %q",
+		encoding, NameEncodingObjectID, NameEncodingCiphertext)
+}
+
+// encodeName returns the GridFS filename of a file with the encrypted name,
+// using id for the ObjectID encoding.
+func encodeName(encoding string, id primitive.ObjectID, encName []byte) string {
+	if encoding == NameEncodingCiphertext {
+		return base64.RawURLEncoding.EncodeToString(encName)
+	}
+
+	return id.Hex()
+}
+
+// uploadNamePrefix starts the filenames that files encoded by their ciphertext
+// are uploaded under, until they are published under their name. It is not in
+// the alphabet of the encoding, so an upload in progress is never listed.
+const uploadNamePrefix = "."
+
+// uploadName returns the filename that the file with the ID and GridFS
+// filename is uploaded under. Names encoded by ObjectID are only readable once
+// their encrypted name is published, so the file is uploaded under its own.
+func uploadName(encoding string, id primitive.ObjectID, filename string) string {
+	if encoding == NameEncodingCiphertext {
+		return uploadNamePrefix + id.Hex()
+	}
+
+	return filename
+}
+
+// isUploadName reports whether filename is that of an upload in progress.
+func isUploadName(filename string) bool {
+	return strings.HasPrefix(filename, uploadNamePrefix)
+}
+
+// publishName names the upload with the ID filename, if it was uploaded under
+// another name.
+func publishName(ctx context.Context, files *mongo.Collection, id primitive.ObjectID, uploadedAs, filename string) error {
+	if uploadedAs == filename {
+		return nil
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "filename", Value: filename}}}}
+	if _, err := files.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("failed to name the upload: %w", err)
+	}
+
+	return nil
+}
+
+// decodeName returns the encrypted name held by a ciphertext filename.
+func decodeName(filename string) ([]byte, error) {
+	encName, err := base64.RawURLEncoding.DecodeString(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode file name %s: %w", filename, err)
+	}
+
+	return encName, nil
+}
+
+// storesNames reports whether the encrypted names are kept in the name
+// collection, rather than in the filenames themselves.
+func (nidx *nameIndex) storesNames() bool {
+	return nidx.encoding != NameEncodingCiphertext
+}
+
+// deleteName deletes the encrypted name of the file with the GridFS filename
+// from the name collection, if it is kept there.
+func (nidx *nameIndex) deleteName(ctx context.Context, filename string) error {
+	if !nidx.storesNames() {
+		return nil
+	}
+
+	nameID, err := primitive.ObjectIDFromHex(filename)
+	if err != nil {
+		return fmt.Errorf("failed to convert file name to object ID: %w", err)
+	}
+
+	if _, err := nidx.nameColl.DeleteOne(ctx, bson.D{{Key: "_id", Value: nameID}}); err != nil {
+		return fmt.Errorf("failed to delete file name: %w", err)
+	}
+
+	return nil
+}
+
+// loadCiphertextNames decrypts the filenames of the files, and of their
+// versions, in coll.
+func loadCiphertextNames(ctx context.Context, opener dcrypto.Opener, coll *mongo.Collection) (*hexName, error) {
+	hn := &hexName{hexToName: make(map[string]string)}
+
+	for _, c := range []*mongo.Collection{coll, versionsColl(coll)} {
+		opts := options.Find().SetProjection(bson.D{{Key: "filename", Value: 1}})
+
+		cur, err := c.Find(ctx, bson.D{}, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find files: %w", err)
+		}
+
+		for cur.Next(ctx) {
+			var file struct {
+				Name string `bson:"filename"`
+			}
+
+			if err := cur.Decode(&file); err != nil {
+				return nil, fmt.Errorf("failed to decode file: %w", err)
+			}
+
+			if isUploadName(file.Name) {
+				continue
+			}
+
+			name, err := openName(ctx, opener, file.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			hn.add(file.Name, name)
+		}
+
+		if err := cur.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read files: %w", err)
+		}
+	}
+
+	return hn, nil
+}
+
+// openName decrypts a ciphertext filename.
+func openName(ctx context.Context, opener dcrypto.Opener, filename string) (string, error) {
+	encName, err := decodeName(filename)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := opener.Open(ctx, encName)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt name: %w", err)
+	}
+
+	return string(name), nil
+}
+
+// lookupNames adds the files with the decrypted names to the name index by
+// decrypting the filenames of the bucket until every name is found, without
+// loading the rest of the index. Names that are not found are left out.
+func lookupNames(ctx context.Context, nidx *nameIndex, opener dcrypto.Opener, names []string) error {
+	if nidx.hexName == nil {
+		nidx.hexName, nidx.nameDoc, nidx.partial = &hexName{}, &nameDoc{}, true
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, _, ok := nidx.nameDoc.get(name); !ok {
+			wanted[name] = true
+		}
+	}
+
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	cur, err := nidx.coll.Find(ctx, bson.D{})
+	if err != nil {
+		return fmt.Errorf("failed to find files: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	for len(wanted) > 0 && cur.Next(ctx) {
+		file := gridfs.File{}
+		if err := cur.Decode(&file); err != nil {
+			return fmt.Errorf("failed to decode file: %w", err)
+		}
+
+		name, err := openName(ctx, opener, file.Name)
+		if err != nil {
+			return err
+		}
+
+		if !wanted[name] {
+			continue
+		}
+
+		metadata, err := decryptGridFSMetadata(ctx, opener, file.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt metadata of %s: %w", name, err)
+		}
+
+		nidx.hexName.add(file.Name, name)
+		nidx.nameDoc.add(name, &file, metadata)
+
+		delete(wanted, name)
+	}
+
+	return cur.Err()
+}
+
+// checkNameEncoding compares the name encoding recorded for the bucket against
+// the one the client is configured with. A bucket that holds no files takes
+// the encoding of the client, which is recorded unless the store is
+// read-only.
+func (s *Store) checkNameEncoding(ctx context.Context, encoding string) error {
+	current := s.settings.NameEncoding
+	if current == "" {
+		current = NameEncodingObjectID
+	}
+
+	if encoding == "" || encoding == current {
+		s.nameIndex.encoding = current
+
+		return nil
+	}
+
+	n, err := s.nameIndex.coll.CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+	if err != nil {
+		return fmt.Errorf("failed to count files: %w", err)
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%w: bucket %q uses %q, client is configured for %q",
+			ErrNameEncodingMismatch, s.bucketName, current, encoding)
+	}
+
+	if s.settingsStore.readOnly {
+		s.nameIndex.encoding = encoding
+
+		return nil
+	}
+
+	if err := s.settingsStore.set(ctx, bson.D{{Key: "nameEncoding", Value: encoding}}); err != nil {
+		return fmt.Errorf("failed to record name encoding: %w", err)
+	}
+
+	s.settings.NameEncoding = encoding
+	s.nameIndex.encoding = encoding
+
+	return nil
+}
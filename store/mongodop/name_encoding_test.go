@@ -0,0 +1,98 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestEncodeName(t *testing.T) {
+	id := primitive.NewObjectID()
+	encName := []byte{0x00, 0xfb, 0xff, 0x10, 0x2f}
+
+	assert.Equal(t, id.Hex(), encodeName("", id, encName))
+	assert.Equal(t, id.Hex(), encodeName(NameEncodingObjectID, id, encName))
+
+	filename := encodeName(NameEncodingCiphertext, id, encName)
+	assert.NotContains(t, filename, "/", "filenames must not look like paths")
+
+	decoded, err := decodeName(filename)
+	require.NoError(t, err)
+	assert.Equal(t, encName, decoded)
+
+	_, err = decodeName(id.Hex() + "!")
+	assert.Error(t, err)
+}
+
+func TestUploadName(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	assert.Equal(t, id.Hex(), uploadName(NameEncodingObjectID, id, id.Hex()))
+	assert.False(t, isUploadName(id.Hex()))
+
+	filename := encodeName(NameEncodingCiphertext, id, []byte{0x00, 0xfb, 0xff})
+	assert.False(t, isUploadName(filename))
+
+	uploading := uploadName(NameEncodingCiphertext, id, filename)
+	assert.True(t, isUploadName(uploading))
+
+	_, err := decodeName(uploading)
+	assert.Error(t, err, "an upload in progress must not be taken for a name")
+}
+
+func TestPublishCiphertextName(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("renames the upload", func(mt *mtest.T) {
+		bucket, err := gridfs.NewBucket(mt.DB)
+		require.NoError(mt, err)
+
+		p := &Pusher{bucket: bucket, nameIndex: &nameIndex{encoding: NameEncodingCiphertext}}
+
+		id := primitive.NewObjectID()
+		filename := encodeName(NameEncodingCiphertext, id, []byte("name"))
+
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		err = p.publish(context.Background(), nil, id, primitive.NilObjectID, uploadName(NameEncodingCiphertext, id, filename), filename, "")
+		require.NoError(mt, err)
+
+		updates := sentCommands(mt, "update", "fs.files")
+		require.Len(mt, updates, 1)
+
+		update, err := updates[0].Lookup("updates").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, update, 1)
+
+		assert.Equal(mt, id, update[0].Document().Lookup("q", "_id").ObjectID())
+		assert.Equal(mt, filename, update[0].Document().Lookup("u", "$set", "filename").StringValue())
+	})
+}
+
+func TestValidateNameEncoding(t *testing.T) {
+	for _, encoding := range []string{"", NameEncodingObjectID, NameEncodingCiphertext} {
+		assert.NoError(t, ValidateNameEncoding(encoding))
+	}
+
+	assert.Error(t, ValidateNameEncoding("base64"))
+}
@@ -39,19 +39,30 @@ type hexName struct {
 
 // loadHexName loads the hexName map from the database.
 func loadHexName(ctx context.Context, opener dcrypto.Opener, coll *mongo.Collection) (*hexName, error) {
-	hn := &hexName{
-		hexToName: make(map[string]string),
+	sealed, err := loadSealedNames(ctx, coll)
+	if err != nil {
+		return nil, err
 	}
 
+	return openNames(ctx, opener, sealed)
+}
+
+// loadSealedNames returns the sealed names of the name collection, by the hex
+// of the ID of their name document.
+func loadSealedNames(ctx context.Context, coll *mongo.Collection) (map[string][]byte, error) {
+	sealed := make(map[string][]byte)
+
 	cur, err := coll.Find(ctx, bson.D{})
 	if errors.Is(err, mongo.ErrNilDocument) {
-		return hn, nil
+		return sealed, nil
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
+	defer func() { _ = cur.Close(ctx) }()
+
 	type nameDoc struct {
 		ID   primitive.ObjectID `bson:"_id"`
 		Data primitive.Binary
@@ -63,12 +74,30 @@ func loadHexName(ctx context.Context, opener dcrypto.Opener, coll *mongo.Collect
 			return nil, fmt.Errorf("failed to decode document: %w", err)
 		}
 
-		actualName, err := opener.Open(ctx, doc.Data.Data)
+		sealed[doc.ID.Hex()] = doc.Data.Data
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read names: %w", err)
+	}
+
+	return sealed, nil
+}
+
+// openNames opens the sealed names, by the hex of the ID of their name
+// document.
+func openNames(ctx context.Context, opener dcrypto.Opener, sealed map[string][]byte) (*hexName, error) {
+	hn := &hexName{
+		hexToName: make(map[string]string, len(sealed)),
+	}
+
+	for hex, data := range sealed {
+		actualName, err := opener.Open(ctx, data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decrypt name: %w", err)
 		}
 
-		hn.add(doc.ID.Hex(), string(actualName))
+		hn.add(hex, string(actualName))
 	}
 
 	return hn, nil
@@ -94,6 +123,7 @@ func (hn *hexName) get(hex string) (string, bool) {
 type nameDoc struct {
 	nameToDoc      map[string]*gridfs.File    // decrypted name -> document
 	nameToMetadata map[string]*gridfsMetadata //  decrypted name -> metadata
+	hashToName     map[string]string          // content hash -> decrypted name
 }
 
 // loadNameDoc loads the nameDoc map from the database.
@@ -118,6 +148,10 @@ func loadNameDoc(ctx context.Context, opener dcrypto.Opener, coll *mongo.Collect
 			return nil, fmt.Errorf("failed to decode document: %w", err)
 		}
 
+		if isUploadName(file.Name) {
+			continue
+		}
+
 		fileName, ok := hexName.get(file.Name)
 		if !ok {
 			return nil, fmt.Errorf("ID not found for file name %s", file.Name)
@@ -140,6 +174,29 @@ func (nd *nameDoc) add(name string, doc *gridfs.File, metadata *gridfsMetadata)
 
 	nd.nameToDoc[name] = doc
 	nd.nameToMetadata[name] = metadata
+
+	if metadata != nil && metadata.Diskhop.SHA256 != "" {
+		if nd.hashToName == nil {
+			nd.hashToName = make(map[string]string)
+		}
+
+		nd.hashToName[metadata.Diskhop.SHA256] = name
+	}
+}
+
+// findHash returns a file whose contents have the hex-encoded SHA-256 hash.
+// A file replaced since it was indexed is not found.
+func (nd *nameDoc) findHash(sum string) (*gridfs.File, bool) {
+	if nd == nil {
+		return nil, false
+	}
+
+	doc, meta, ok := nd.get(nd.hashToName[sum])
+	if !ok || meta == nil || meta.Diskhop.SHA256 != sum {
+		return nil, false
+	}
+
+	return doc, true
 }
 
 func (nd *nameDoc) get(name string) (*gridfs.File, *gridfsMetadata, bool) {
@@ -168,16 +225,47 @@ type nameIndex struct {
 
 	coll     *mongo.Collection
 	nameColl *mongo.Collection
+
+	// encoding is the name encoding of the bucket, and partial is set when
+	// only some of the names have been looked up.
+	encoding string
+	partial  bool
+
+	// shards is the number of shards of the name collection, whose names
+	// are hashed with shardKey. loadedShards holds the shards looked up into
+	// a partial index, and loadedUnsharded whether the names without a
+	// shard are in it.
+	shards          int
+	shardKey        []byte
+	settingsColl    *mongo.Collection
+	loadedShards    map[int32]bool
+	loadedUnsharded bool
+
+	// cache holds the decrypted names between connections, if set.
+	cache NameCache
+
+	// readOnly is set when the index must not write to the deployment.
+	readOnly bool
 }
 
 func loadNameIndex(ctx context.Context, nidx *nameIndex, opener dcrypto.Opener) error {
-	if nidx.hexName != nil {
+	if nidx.hexName != nil && !nidx.partial {
 		return nil
 	}
 
+	if nidx.partial {
+		nidx.nameDoc, nidx.partial = nil, false
+		nidx.loadedShards = nil
+	}
+
 	var err error
 
-	nidx.hexName, err = loadHexName(ctx, opener, nidx.nameColl)
+	if nidx.storesNames() {
+		nidx.hexName, err = loadCachedHexName(ctx, nidx, opener)
+	} else {
+		nidx.hexName, err = loadCiphertextNames(ctx, opener, nidx.coll)
+	}
+
 	if err != nil {
 		return fmt.Errorf("failed to load hexName: %w", err)
 	}
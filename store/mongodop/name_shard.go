@@ -0,0 +1,378 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The name collection is shared by every bucket of the database, and loading
+// the name index reads all of it. A sharded name collection splits the names
+// into a fixed number of shards by a keyed hash of the name, so that a push or
+// a pull by name reads only the shards of the names it needs. The key is
+// sealed with the metadata key, so the shards do not reveal which files share
+// a prefix or a name.
+//
+// Names written before the collection was sharded, or by clients that copy
+// raw data, have no shard and are read along with the first shard looked up.
+// Operations that filter or list every file still load the whole index.
+
+const (
+	// nameSettingsID is the ID of the settings document of the name
+	// collection, which is shared by the buckets of the database.
+	nameSettingsID = ".names"
+
+	// shardField is the field of a name document that holds its shard.
+	shardField = "shard"
+
+	// shardKeySize is the size in bytes of the key that names are hashed
+	// with.
+	shardKeySize = 32
+
+	// MaxNameShards is the largest number of shards the name collection can
+	// be split into.
+	MaxNameShards = 1 << 16
+)
+
+// ErrNameShardsMismatch is returned by Connect when the number of name shards
+// configured on the client does not match the one the name collection was
+// split into.
+var ErrNameShardsMismatch = errors.New("name shards do not match the name collection")
+
+// WithNameShards splits the name collection into n shards, so that pushes and
+// pulls by name load only the names they need. The number of shards of a
+// database can only be chosen once.
+func WithNameShards(n int) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.NameShards = n
+	}
+}
+
+// ValidateNameShards returns an error if n is not a supported number of name
+// shards. Zero uses that of the name collection.
+func ValidateNameShards(n int) error {
+	if n < 0 || n > MaxNameShards {
+		return fmt.Errorf("invalid number of name shards %d, expected 0 to %d", n, MaxNameShards)
+	}
+
+	return nil
+}
+
+// nameSettings is the settings document of the name collection.
+type nameSettings struct {
+	Shards  int    `bson:"shards,omitempty"`
+	Key     []byte `bson:"key,omitempty"`     // Sealed with the metadata key
+	Version string `bson:"version,omitempty"` // Changed whenever a name is added
+}
+
+// loadNameSettings returns the settings of the name collection, which are
+// empty if it has never been sharded.
+func loadNameSettings(ctx context.Context, coll *mongo.Collection) (nameSettings, error) {
+	var settings nameSettings
+
+	err := coll.FindOne(ctx, bson.D{{Key: "_id", Value: nameSettingsID}}).Decode(&settings)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return settings, fmt.Errorf("failed to load name settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// checkNameShards compares the number of shards recorded for the name
+// collection against the one the client is configured with. The first client
+// configured with shards records them, and the names already in the
+// collection are read along with every shard.
+func (s *Store) checkNameShards(ctx context.Context, shards int) error {
+	nidx := s.nameIndex
+
+	settings, err := loadNameSettings(ctx, nidx.settingsColl)
+	if err != nil {
+		return err
+	}
+
+	// A read-only client reads the names as they are sharded.
+	if shards == 0 || shards == settings.Shards || (nidx.readOnly && settings.Shards == 0) {
+		nidx.shards = settings.Shards
+
+		return nil
+	}
+
+	if settings.Shards != 0 {
+		return fmt.Errorf("%w: the name collection of database %q has %d shards, client is configured for %d",
+			ErrNameShardsMismatch, s.bucket.GetFilesCollection().Database().Name(), settings.Shards, shards)
+	}
+
+	index := mongo.IndexModel{Keys: bson.D{{Key: shardField, Value: 1}}}
+	if _, err := nidx.nameColl.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("failed to index name shards: %w", err)
+	}
+
+	// Another client may record its shards first, in which case the insert
+	// conflicts with its settings.
+	filter := bson.D{
+		{Key: "_id", Value: nameSettingsID},
+		{Key: "shards", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "shards", Value: shards}}}}
+
+	_, err = nidx.settingsColl.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: the name collection was sharded by another client", ErrNameShardsMismatch)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to record name shards: %w", err)
+	}
+
+	nidx.shards = shards
+
+	return nil
+}
+
+// sharded reports whether the names are split into shards.
+func (nidx *nameIndex) sharded() bool {
+	return nidx.shards > 0 && nidx.storesNames()
+}
+
+// loadShardKey returns the key that names are hashed into shards with,
+// generating it the first time the collection is used.
+func (nidx *nameIndex) loadShardKey(ctx context.Context, so dcrypto.SealOpener) ([]byte, error) {
+	if nidx.shardKey != nil {
+		return nidx.shardKey, nil
+	}
+
+	if so == nil {
+		return nil, errors.New("a sharded name collection requires encryption")
+	}
+
+	settings, err := loadNameSettings(ctx, nidx.settingsColl)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(settings.Key) == 0 {
+		key := make([]byte, shardKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate shard key: %w", err)
+		}
+
+		sealed, err := so.Seal(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to seal shard key: %w", err)
+		}
+
+		// Another client may record a key first, in which case its key is
+		// used.
+		filter := bson.D{
+			{Key: "_id", Value: nameSettingsID},
+			{Key: "key", Value: bson.D{{Key: "$exists", Value: false}}},
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "key", Value: sealed}}}}
+		if _, err := nidx.settingsColl.UpdateOne(ctx, filter, update); err != nil {
+			return nil, fmt.Errorf("failed to record shard key: %w", err)
+		}
+
+		if settings, err = loadNameSettings(ctx, nidx.settingsColl); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := so.Open(ctx, settings.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shard key: %w", err)
+	}
+
+	nidx.shardKey = key
+
+	return key, nil
+}
+
+// shardOf returns the shard of the name out of n.
+func shardOf(key []byte, name string, n int) int32 {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+
+	return int32(binary.BigEndian.Uint32(mac.Sum(nil)) % uint32(n))
+}
+
+// newNameDoc returns the document of the name collection that holds the
+// encrypted name, with the shard of the name if the collection is sharded.
+func (nidx *nameIndex) newNameDoc(
+	ctx context.Context,
+	so dcrypto.SealOpener,
+	id primitive.ObjectID,
+	name string,
+	encName []byte,
+) (bson.D, error) {
+	doc := bson.D{{Key: "_id", Value: id}, {Key: "data", Value: encName}}
+	if !nidx.sharded() {
+		return doc, nil
+	}
+
+	key, err := nidx.loadShardKey(ctx, so)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(doc, bson.E{Key: shardField, Value: shardOf(key, name, nidx.shards)}), nil
+}
+
+// lookupShards adds the files of the shards holding the names to the name
+// index, without loading the other shards.
+func lookupShards(ctx context.Context, nidx *nameIndex, so dcrypto.SealOpener, names []string) error {
+	if nidx.hexName != nil && !nidx.partial {
+		return nil
+	}
+
+	if nidx.hexName == nil {
+		nidx.hexName, nidx.partial = &hexName{}, true
+		nidx.nameDoc = &nameDoc{
+			nameToDoc:      make(map[string]*gridfs.File),
+			nameToMetadata: make(map[string]*gridfsMetadata),
+		}
+
+		nidx.loadedShards = nil
+	}
+
+	if nidx.loadedShards == nil {
+		nidx.loadedShards, nidx.loadedUnsharded = map[int32]bool{}, false
+	}
+
+	key, err := nidx.loadShardKey(ctx, so)
+	if err != nil {
+		return err
+	}
+
+	var shards []int32
+
+	for _, name := range names {
+		shard := shardOf(key, name, nidx.shards)
+		if !nidx.loadedShards[shard] && !slices.Contains(shards, shard) {
+			shards = append(shards, shard)
+		}
+	}
+
+	if len(shards) == 0 {
+		return nil
+	}
+
+	filter := bson.D{{Key: shardField, Value: bson.D{{Key: "$in", Value: shards}}}}
+	if !nidx.loadedUnsharded {
+		filter = bson.D{{Key: "$or", Value: bson.A{
+			filter,
+			bson.D{{Key: shardField, Value: bson.D{{Key: "$exists", Value: false}}}},
+		}}}
+	}
+
+	hexes, err := lookupNameDocs(ctx, nidx, so, filter)
+	if err != nil {
+		return err
+	}
+
+	if err := lookupFiles(ctx, nidx, so, hexes); err != nil {
+		return err
+	}
+
+	for _, shard := range shards {
+		nidx.loadedShards[shard] = true
+	}
+
+	nidx.loadedUnsharded = true
+
+	return nil
+}
+
+// lookupNameDocs adds the names of the documents of the name collection
+// matching the filter to the name index, returning their hexes.
+func lookupNameDocs(ctx context.Context, nidx *nameIndex, opener dcrypto.Opener, filter bson.D) ([]string, error) {
+	cur, err := nidx.nameColl.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find names: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	var hexes []string
+
+	for cur.Next(ctx) {
+		var doc struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Data primitive.Binary   `bson:"data"`
+		}
+
+		if err := cur.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode name: %w", err)
+		}
+
+		name, err := opener.Open(ctx, doc.Data.Data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt name: %w", err)
+		}
+
+		nidx.hexName.add(doc.ID.Hex(), string(name))
+		hexes = append(hexes, doc.ID.Hex())
+	}
+
+	return hexes, cur.Err()
+}
+
+// lookupFiles adds the files of the bucket with the GridFS filenames to the
+// name index. The names of the other buckets of the database are not in it.
+func lookupFiles(ctx context.Context, nidx *nameIndex, opener dcrypto.Opener, hexes []string) error {
+	if len(hexes) == 0 {
+		return nil
+	}
+
+	cur, err := nidx.coll.Find(ctx, bson.D{{Key: "filename", Value: bson.D{{Key: "$in", Value: hexes}}}})
+	if err != nil {
+		return fmt.Errorf("failed to find files: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		file := gridfs.File{}
+		if err := cur.Decode(&file); err != nil {
+			return fmt.Errorf("failed to decode file: %w", err)
+		}
+
+		name := nidx.hexName.hexToName[file.Name]
+
+		metadata, err := decryptGridFSMetadata(ctx, opener, file.Metadata)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt metadata of %s: %w", name, err)
+		}
+
+		nidx.nameDoc.add(name, &file, metadata)
+	}
+
+	return cur.Err()
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestShardOf(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	seen := map[int32]bool{}
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("photos/%04d.jpg", i)
+
+		shard := shardOf(key, name, 8)
+		require.GreaterOrEqual(t, shard, int32(0))
+		require.Less(t, shard, int32(8))
+		require.Equal(t, shard, shardOf(key, name, 8), "shards must be stable")
+
+		seen[shard] = true
+	}
+
+	assert.Len(t, seen, 8, "names should spread over every shard")
+
+	other := []byte("fedcba9876543210fedcba9876543210")
+
+	moved := 0
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("photos/%04d.jpg", i)
+		if shardOf(key, name, 8) != shardOf(other, name, 8) {
+			moved++
+		}
+	}
+
+	assert.Positive(t, moved, "the shard should depend on the key")
+}
+
+func TestValidateNameShards(t *testing.T) {
+	for _, n := range []int{0, 1, 64, MaxNameShards} {
+		assert.NoError(t, ValidateNameShards(n))
+	}
+
+	assert.Error(t, ValidateNameShards(-1))
+	assert.Error(t, ValidateNameShards(MaxNameShards+1))
+}
+
+func TestNewNameDoc(t *testing.T) {
+	id := primitive.NewObjectID()
+	encName := []byte("sealed")
+
+	nidx := &nameIndex{}
+
+	doc, err := nidx.newNameDoc(context.Background(), nil, id, "a.txt", encName)
+	require.NoError(t, err)
+	assert.Equal(t, bson.D{{Key: "_id", Value: id}, {Key: "data", Value: encName}}, doc)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	nidx = &nameIndex{shards: 16, shardKey: key}
+
+	doc, err = nidx.newNameDoc(context.Background(), nil, id, "a.txt", encName)
+	require.NoError(t, err)
+	assert.Equal(t, bson.E{Key: shardField, Value: shardOf(key, "a.txt", 16)}, doc[len(doc)-1])
+
+	// Names encoded in the filenames are not in the name collection.
+	nidx.encoding = NameEncodingCiphertext
+	assert.False(t, nidx.sharded())
+}
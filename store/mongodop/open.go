@@ -0,0 +1,134 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/prestonvasquez/diskhop"
+)
+
+// NameCacheName is the name of the file in the repository that caches the
+// sealed names of the remote, when the nameCache option is set.
+const NameCacheName = ".diskhop-names"
+
+func init() {
+	for _, scheme := range []string{"mongodb", "mongodb+srv"} {
+		diskhop.RegisterStore(scheme, openStore,
+			diskhop.WithConnStringValidator(ValidateConnString),
+			diskhop.WithPinger(Ping))
+	}
+}
+
+// openStore connects to the store of the repository with the config.
+func openStore(ctx context.Context, cfg diskhop.Config, readOnly bool) (*diskhop.Store, error) {
+	db := cfg.DB
+	if db == "" {
+		db = DefaultDBName
+	}
+
+	connectOpts, err := ConfigConnectOptions(cfg, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.NameCache {
+		cache, err := NewSQLiteNameCache(ctx, filepath.Join(cfg.CurDir, NameCacheName))
+		if err != nil {
+			return nil, err
+		}
+
+		connectOpts = append(connectOpts, WithNameCache(cache))
+	}
+
+	mdb, err := Connect(ctx, cfg.ConnString, db, cfg.CurrentBranch, connectOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &diskhop.Store{
+		Pusher:    mdb,
+		Reverter:  mdb,
+		Upgrader:  mdb,
+		Rewrapper: mdb,
+		Stater:    mdb,
+		Checker:   mdb,
+		Logger:    mdb,
+		Resetter:  mdb,
+		Remover:   mdb,
+		Pruner:    mdb,
+		Excluder:  mdb,
+		Puller:    mdb,
+		IVMgr:     mdb,
+		Closer:    mdb,
+	}
+
+	return s, nil
+}
+
+// ConfigConnectOptions returns the options for connecting to the store of the
+// repository with the config. The cipher is only checked when client-side
+// encryption is configured, and the read preference is only applied to
+// read-only connections, which do not write to the deployment.
+func ConfigConnectOptions(cfg diskhop.Config, readOnly bool) ([]ConnectOption, error) {
+	wc, err := ParseWriteConcern(cfg.WriteConcern)
+	if err != nil {
+		return nil, err
+	}
+
+	rp, err := ParseReadPreference(cfg.ReadPreference)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := VersionPolicy{Enabled: cfg.Versioning, Keep: cfg.KeepVersions}
+	if cfg.VersionMaxAge != "" {
+		versions.MaxAge, err = time.ParseDuration(cfg.VersionMaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version max age %q: %w", cfg.VersionMaxAge, err)
+		}
+	}
+
+	connectOpts := []ConnectOption{
+		WithWriteConcern(wc),
+		WithVersionPolicy(versions),
+		WithNameEncoding(cfg.NameEncoding),
+		WithNameShards(cfg.NameShards),
+	}
+
+	if readOnly {
+		connectOpts = append(connectOpts, WithReadPreference(rp), WithReadOnly())
+	}
+
+	if cfg.KeyFile != "" {
+		connectOpts = append(connectOpts, WithCipher(diskhop.NormalizeCipher(cfg.Cipher, cfg.NonceSize)))
+	}
+
+	// Only a configured temp directory spills uploads, since spilling writes
+	// every large file to disk once more.
+	if cfg.TempDir != "" {
+		dir, err := diskhop.TempDir(cfg.TempDir)
+		if err != nil {
+			return nil, err
+		}
+
+		connectOpts = append(connectOpts, WithSpillDir(dir))
+	}
+
+	return connectOpts, nil
+}
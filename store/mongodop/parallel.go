@@ -0,0 +1,245 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// parallelDownloadThreshold is the size from which a file is downloaded
+	// as ranges of chunks at once, when the pull asks for it. Smaller files
+	// are read through one stream, which costs fewer round trips.
+	parallelDownloadThreshold = 64 << 20
+
+	// chunksPerRange is the number of chunks fetched by one query of a
+	// parallel download, about 4MiB with the default chunk size.
+	chunksPerRange = 16
+)
+
+// errHashMismatch is returned when the plaintext of a downloaded file does not
+// have the hash recorded in its metadata.
+var errHashMismatch = errors.New("downloaded file does not match its hash")
+
+// downloadsInParallel reports whether the file is downloaded as ranges of
+// chunks at once.
+func downloadsInParallel(opts store.PullOptions, file gridfs.File) bool {
+	return opts.ParallelChunks > 1 && file.Length >= parallelDownloadThreshold && file.ChunkSize > 0
+}
+
+// chunkRange is the data of the chunks of a range, or why they could not be
+// read.
+type chunkRange struct {
+	data []byte
+	err  error
+}
+
+// parallelReader reads the data of a file assembled from ranges of its chunks
+// that are fetched at once.
+type parallelReader struct {
+	*io.PipeReader
+
+	cancel context.CancelFunc
+}
+
+func (pr *parallelReader) Close() error {
+	pr.cancel()
+
+	return pr.PipeReader.Close()
+}
+
+// openParallel opens the data of the file, fetching up to workers ranges of
+// its chunks at once and assembling them in order. At most workers ranges are
+// held in memory, so a slow reader stalls the fetching.
+func openParallel(ctx context.Context, bucket *gridfs.Bucket, file gridfs.File, workers int) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+
+	chunkSize := int64(file.ChunkSize)
+	chunks := (file.Length + chunkSize - 1) / chunkSize
+	ranges := int((chunks + chunksPerRange - 1) / chunksPerRange)
+
+	// Each range is sent on its own channel, buffered so that a fetch never
+	// waits for the ranges before it to be written.
+	results := make([]chan chunkRange, ranges)
+	for i := range results {
+		results[i] = make(chan chunkRange, 1)
+	}
+
+	slots := make(chan struct{}, workers)
+
+	go func() {
+		for i := 0; i < ranges; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			start := int64(i) * chunksPerRange
+			end := min(start+chunksPerRange, chunks)
+
+			go func(i int) {
+				var data []byte
+
+				err := store.RetryWithPolicy(ctx, transientRetryPolicy, func() error {
+					var err error
+					data, err = fetchRange(ctx, bucket, file, start, end)
+
+					return err
+				})
+
+				results[i] <- chunkRange{data: data, err: err}
+			}(i)
+		}
+	}()
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		for i := 0; i < ranges; i++ {
+			var r chunkRange
+
+			select {
+			case r = <-results[i]:
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+
+				return
+			}
+
+			if r.err != nil {
+				pw.CloseWithError(r.err)
+
+				return
+			}
+
+			if _, err := pw.Write(r.data); err != nil {
+				return
+			}
+
+			<-slots
+		}
+
+		pw.Close()
+	}()
+
+	return &parallelReader{PipeReader: pr, cancel: cancel}
+}
+
+// fetchRange returns the data of the chunks of the file from start up to end,
+// failing if one is missing or has the wrong size.
+func fetchRange(ctx context.Context, bucket *gridfs.Bucket, file gridfs.File, start, end int64) ([]byte, error) {
+	filter := bson.D{
+		{Key: "files_id", Value: dataID(file)},
+		{Key: "n", Value: bson.D{{Key: "$gte", Value: start}, {Key: "$lt", Value: end}}},
+	}
+
+	cur, err := bucket.GetChunksCollection().Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "n", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find chunks: %w", err)
+	}
+
+	defer func() { _ = cur.Close(ctx) }()
+
+	chunkSize := int64(file.ChunkSize)
+	size := min(end*chunkSize, file.Length) - start*chunkSize
+
+	data := make([]byte, 0, size)
+	next := start
+
+	for cur.Next(ctx) {
+		var chunk struct {
+			N    int64  `bson:"n"`
+			Data []byte `bson:"data"`
+		}
+
+		if err := cur.Decode(&chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk %d: %w", next, err)
+		}
+
+		if chunk.N != next {
+			return nil, fmt.Errorf("file is missing chunk %d", next)
+		}
+
+		data = append(data, chunk.Data...)
+		next++
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chunk %d: %w", next, err)
+	}
+
+	if next != end || int64(len(data)) != size {
+		return nil, fmt.Errorf("file is missing chunk %d: %w", next, io.ErrUnexpectedEOF)
+	}
+
+	return data, nil
+}
+
+// hashWriter writes to w, hashing what it writes.
+type hashWriter struct {
+	w    io.Writer
+	hash hash.Hash
+}
+
+func newHashWriter(w io.Writer) *hashWriter {
+	return &hashWriter{w: w, hash: sha256.New()}
+}
+
+func (hw *hashWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.hash.Write(p[:n])
+
+	return n, err
+}
+
+// check returns errHashMismatch unless the bytes written have the hex-encoded
+// SHA-256 want.
+func (hw *hashWriter) check(want string) error {
+	return checkHash(hw.hash.Sum(nil), want)
+}
+
+// checkData returns errHashMismatch unless the data have the hex-encoded
+// SHA-256 want.
+func checkData(data []byte, want string) error {
+	sum := sha256.Sum256(data)
+
+	return checkHash(sum[:], want)
+}
+
+// checkHash returns errHashMismatch unless the sum is the hex-encoded SHA-256
+// want. Files pushed before their hash was recorded are not checked.
+func checkHash(sum []byte, want string) error {
+	if want == "" {
+		return nil
+	}
+
+	if got := hex.EncodeToString(sum); got != want {
+		return fmt.Errorf("%w: expected %s, got %s", errHashMismatch, want, got)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestDownloadsInParallel(t *testing.T) {
+	t.Parallel()
+
+	large := gridfs.File{Length: parallelDownloadThreshold, ChunkSize: gridfs.DefaultChunkSize}
+	small := gridfs.File{Length: parallelDownloadThreshold - 1, ChunkSize: gridfs.DefaultChunkSize}
+
+	assert.True(t, downloadsInParallel(store.PullOptions{ParallelChunks: 4}, large))
+	assert.False(t, downloadsInParallel(store.PullOptions{ParallelChunks: 4}, small))
+	assert.False(t, downloadsInParallel(store.PullOptions{ParallelChunks: 1}, large))
+	assert.False(t, downloadsInParallel(store.PullOptions{}, large))
+}
+
+func TestHashWriter(t *testing.T) {
+	t.Parallel()
+
+	sum := sha256.Sum256([]byte("data"))
+	want := hex.EncodeToString(sum[:])
+
+	var buf bytes.Buffer
+
+	hw := newHashWriter(&buf)
+
+	_, err := hw.Write([]byte("da"))
+	require.NoError(t, err)
+
+	_, err = hw.Write([]byte("ta"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "data", buf.String())
+	assert.NoError(t, hw.check(want))
+	assert.ErrorIs(t, hw.check(hex.EncodeToString(make([]byte, sha256.Size))), errHashMismatch)
+
+	assert.NoError(t, checkData([]byte("data"), want))
+	assert.NoError(t, checkData([]byte("atad"), ""))
+	assert.ErrorIs(t, checkData([]byte("atad"), want), errHashMismatch)
+}
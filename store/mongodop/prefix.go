@@ -0,0 +1,55 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"path"
+	"strings"
+)
+
+// The names of files are encrypted, so a prefix cannot be matched by the
+// server. Instead, it is matched against the decrypted names of the name
+// index, and only the files within it are queried for.
+//
+// Files pushed without a prefix are stored under their absolute paths, while
+// the names of files pushed under a prefix are rooted at it, so that the two
+// never collide and a pull without a prefix leaves the prefixed files out.
+
+// withPrefix returns the stored name of a file pushed under prefix. The name is
+// rooted at the prefix, so that it is restored exactly when pulled.
+func withPrefix(prefix, name string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "/" + strings.TrimPrefix(name, "/")
+}
+
+// trimPrefix returns the name of the stored file relative to prefix, and
+// whether the file lies under it.
+func trimPrefix(prefix, stored string) (string, bool) {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return stored, path.IsAbs(stored)
+	}
+
+	name, ok := strings.CutPrefix(stored, prefix+"/")
+	if !ok {
+		return "", false
+	}
+
+	return "/" + name, true
+}
@@ -0,0 +1,55 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		file   string
+		stored string
+	}{
+		{name: "no prefix", file: "/repo/a.jpg", stored: "/repo/a.jpg"},
+		{name: "prefix", prefix: "photos/2024", file: "/repo/a.jpg", stored: "photos/2024/repo/a.jpg"},
+		{name: "trailing slash", prefix: "photos/2024/", file: "/repo/a.jpg", stored: "photos/2024/repo/a.jpg"},
+		{name: "leading slash", prefix: "/photos", file: "/repo/a.jpg", stored: "photos/repo/a.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := withPrefix(tt.prefix, tt.file)
+			assert.Equal(t, tt.stored, stored)
+
+			name, ok := trimPrefix(tt.prefix, stored)
+			assert.True(t, ok)
+			assert.Equal(t, tt.file, name)
+		})
+	}
+
+	_, ok := trimPrefix("photos/2024", "photos/2024-old/repo/a.jpg")
+	assert.False(t, ok, "a prefix only matches whole path segments")
+
+	_, ok = trimPrefix("photos", "/repo/a.jpg")
+	assert.False(t, ok)
+
+	_, ok = trimPrefix("", "photos/repo/a.jpg")
+	assert.False(t, ok, "a pull without a prefix leaves the prefixed files out")
+}
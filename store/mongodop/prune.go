@@ -0,0 +1,231 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ store.Pruner = &Store{}
+
+// Reasons that a retention policy deletes a file or version.
+const (
+	pruneReasonVersionsDisabled = "versions are not kept"
+	pruneReasonVersionCount     = "beyond the versions kept per file"
+	pruneReasonVersionAge       = "replaced longer ago than the version max age"
+	pruneReasonAge              = "pushed longer ago than the max age"
+	pruneReasonSize             = "oldest file over the max size"
+	pruneReasonPrunedFile       = "version of a pruned file"
+)
+
+// prunedTarget is a file or version that a retention policy deletes.
+type prunedTarget struct {
+	removeTarget
+	version bool
+	reason  string
+}
+
+// planRetention returns the files and versions that the policy deletes, as of
+// now. The files are sorted oldest first, and the versions by line, most
+// recently replaced first.
+func planRetention(policy store.RetentionPolicy, now time.Time, files, versions []removeTarget) []prunedTarget {
+	var (
+		plan   []prunedTarget
+		pruned = make(map[primitive.ObjectID]bool)
+		byLine = make(map[string][]removeTarget)
+		size   int64
+	)
+
+	for _, file := range files {
+		size += file.Length
+	}
+
+	for _, version := range versions {
+		size += version.Length
+		byLine[version.Line] = append(byLine[version.Line], version)
+	}
+
+	prune := func(target removeTarget, version bool, reason string) {
+		if pruned[target.ID] {
+			return
+		}
+
+		pruned[target.ID] = true
+		size -= target.Length
+		plan = append(plan, prunedTarget{removeTarget: target, version: version, reason: reason})
+	}
+
+	// The versions of a file that is deleted have nothing to be restored
+	// over, so they are deleted with it.
+	pruneFile := func(file removeTarget, reason string) {
+		prune(file, false, reason)
+
+		if file.Line == "" {
+			return
+		}
+
+		for _, version := range byLine[file.Line] {
+			prune(version, true, pruneReasonPrunedFile)
+		}
+	}
+
+	kept := make(map[string]int)
+
+	for _, version := range versions {
+		switch {
+		case policy.KeepVersions < 0:
+			prune(version, true, pruneReasonVersionsDisabled)
+		case policy.KeepVersions > 0 && kept[version.Line] >= policy.KeepVersions:
+			prune(version, true, pruneReasonVersionCount)
+		case policy.VersionMaxAge > 0 && version.RetiredAt.Before(now.Add(-policy.VersionMaxAge)):
+			prune(version, true, pruneReasonVersionAge)
+		default:
+			kept[version.Line]++
+		}
+	}
+
+	if policy.MaxAge > 0 {
+		for _, file := range files {
+			if file.UploadDate.Before(now.Add(-policy.MaxAge)) {
+				pruneFile(file, pruneReasonAge)
+			}
+		}
+	}
+
+	if policy.MaxSize > 0 {
+		for _, file := range files {
+			if size <= policy.MaxSize {
+				break
+			}
+
+			pruneFile(file, pruneReasonSize)
+		}
+	}
+
+	return plan
+}
+
+// planPrune finds the files and versions of the bucket that the policy
+// deletes.
+func (s *Store) planPrune(ctx context.Context, policy store.RetentionPolicy) ([]prunedTarget, error) {
+	cur, err := s.nameIndex.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "uploadDate", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files: %w", err)
+	}
+
+	var files []removeTarget
+	if err := cur.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files: %w", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: lineKey, Value: 1}, {Key: retiredAtKey, Value: -1}}).
+		SetProjection(bson.D{{Key: "metadata", Value: 0}})
+
+	cur, err = versionsColl(s.nameIndex.coll).Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find versions: %w", err)
+	}
+
+	var versions []removeTarget
+	if err := cur.All(ctx, &versions); err != nil {
+		return nil, fmt.Errorf("failed to decode versions: %w", err)
+	}
+
+	return planRetention(policy, time.Now(), files, versions), nil
+}
+
+// DescribePrune lists the files and versions that Prune would delete.
+func (s *Store) DescribePrune(
+	ctx context.Context,
+	policy store.RetentionPolicy,
+	opener dcrypto.Opener,
+) (_ []store.PrunedFile, err error) {
+	defer func() { err = classifyError(err) }()
+
+	plan, err := s.planPrune(ctx, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	if opener != nil {
+		if err := loadNameIndex(ctx, s.nameIndex, opener); err != nil {
+			return nil, fmt.Errorf("failed to load name index: %w", err)
+		}
+	}
+
+	pruned := make([]store.PrunedFile, 0, len(plan))
+	for _, target := range plan {
+		pf := store.PrunedFile{
+			ID:         target.ID.Hex(),
+			Version:    target.version,
+			Size:       target.Length,
+			UploadDate: target.UploadDate,
+			Reason:     target.reason,
+		}
+
+		if opener != nil {
+			pf.Name, _ = s.nameIndex.hexName.get(target.Name)
+		}
+
+		pruned = append(pruned, pf)
+	}
+
+	return pruned, nil
+}
+
+// Prune deletes the files and versions of the bucket that the policy does not
+// keep. Chunks that other files link to are kept.
+func (s *Store) Prune(ctx context.Context, policy store.RetentionPolicy) (_ int, err error) {
+	defer func() { err = classifyError(err) }()
+
+	plan, err := s.planPrune(ctx, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	names := make([]string, 0, len(plan))
+
+	for _, target := range plan {
+		if target.version {
+			err = s.deleteVersion(ctx, target.ID, target.Name)
+		} else {
+			err = s.deleteCurrent(ctx, target.removeTarget)
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		names = append(names, target.Name)
+	}
+
+	if err := s.forgetCommits(ctx, names); err != nil {
+		return 0, err
+	}
+
+	// The name index no longer matches the bucket.
+	s.nameIndex.hexName, s.nameIndex.nameDoc = nil, nil
+
+	return len(plan), nil
+}
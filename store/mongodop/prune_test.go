@@ -0,0 +1,120 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlanRetention(t *testing.T) {
+	now := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+
+	file := func(name, line string, length int64, age time.Duration) removeTarget {
+		return removeTarget{
+			ID:         primitive.NewObjectID(),
+			Name:       name,
+			Line:       line,
+			Length:     length,
+			UploadDate: now.Add(-age),
+		}
+	}
+
+	version := func(name, line string, length int64, retired time.Duration) removeTarget {
+		v := file(name, line, length, retired+day)
+		v.RetiredAt = now.Add(-retired)
+
+		return v
+	}
+
+	// Files oldest first, versions by line and most recently replaced first.
+	files := []removeTarget{
+		file("old", "", 100, 200*day),
+		file("mid", "l1", 100, 50*day),
+		file("new", "", 100, day),
+	}
+
+	versions := []removeTarget{
+		version("mid-v2", "l1", 10, 60*day),
+		version("mid-v1", "l1", 10, 100*day),
+	}
+
+	pruned := func(policy store.RetentionPolicy) map[string]string {
+		reasons := map[string]string{}
+		for _, target := range planRetention(policy, now, files, versions) {
+			reasons[target.Name] = target.reason
+		}
+
+		return reasons
+	}
+
+	tests := []struct {
+		name   string
+		policy store.RetentionPolicy
+		want   map[string]string
+	}{
+		{
+			name:   "empty policy keeps everything",
+			policy: store.RetentionPolicy{},
+			want:   map[string]string{},
+		},
+		{
+			name:   "versions disabled",
+			policy: store.RetentionPolicy{KeepVersions: -1},
+			want:   map[string]string{"mid-v2": pruneReasonVersionsDisabled, "mid-v1": pruneReasonVersionsDisabled},
+		},
+		{
+			name:   "newest versions kept",
+			policy: store.RetentionPolicy{KeepVersions: 1},
+			want:   map[string]string{"mid-v1": pruneReasonVersionCount},
+		},
+		{
+			name:   "old versions",
+			policy: store.RetentionPolicy{VersionMaxAge: 90 * day},
+			want:   map[string]string{"mid-v1": pruneReasonVersionAge},
+		},
+		{
+			name:   "old files take their versions",
+			policy: store.RetentionPolicy{MaxAge: 30 * day},
+			want: map[string]string{
+				"old":    pruneReasonAge,
+				"mid":    pruneReasonAge,
+				"mid-v2": pruneReasonPrunedFile,
+				"mid-v1": pruneReasonPrunedFile,
+			},
+		},
+		{
+			name:   "oldest files over the size",
+			policy: store.RetentionPolicy{MaxSize: 250},
+			want:   map[string]string{"old": pruneReasonSize},
+		},
+		{
+			name:   "size counts the versions pruned first",
+			policy: store.RetentionPolicy{KeepVersions: -1, MaxSize: 300},
+			want:   map[string]string{"mid-v2": pruneReasonVersionsDisabled, "mid-v1": pruneReasonVersionsDisabled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, pruned(tt.policy))
+		})
+	}
+}
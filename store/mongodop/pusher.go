@@ -17,34 +17,81 @@ package mongodop
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"sync"
 
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/internal/streamutil"
 	"github.com/prestonvasquez/diskhop/store"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// streamSealThreshold is the file size at which pushes switch from sealing a
+// file whole to sealing it as a stream.
+const streamSealThreshold = 64 << 20
+
 type Pusher struct {
 	bucket    *gridfs.Bucket
 	nameIndex *nameIndex
+	chunkSize int32
+
+	// client and transactions are set when the deployment supports
+	// transactions, so that a push lands atomically.
+	client       *mongo.Client
+	transactions bool
+
+	indexesEnsured bool
+
+	// spillDir, if set, holds the spilled copies of bodies that cannot seek.
+	spillDir string
+
+	// ivPusher records the nonces of files pushed raw.
+	ivPusher *IVPusher
+
+	// versions is how many of the versions replaced by pushes are kept.
+	versions     VersionPolicy
+	versionsAged bool
+
+	// replaced maps the hex names of pushed files to those of the versions
+	// they replaced, until their commits are added.
+	replaced   map[string]string
+	replacedMu sync.Mutex
 }
 
 var _ store.Pusher = &Pusher{}
 
 // Push pushes an object to the store.
-func (p *Pusher) Push(ctx context.Context, name string, r io.ReadSeeker, opts ...store.PushOption) (string, error) {
+func (p *Pusher) Push(ctx context.Context, name string, r io.ReadSeeker, opts ...store.PushOption) (_ string, err error) {
+	defer func() { err = classifyError(err) }()
+
 	mergedOpts := store.PushOptions{}
 	for _, fn := range opts {
 		fn(&mergedOpts)
 	}
 
+	if err := mergedOpts.Limiter.Acquire(ctx); err != nil {
+		return "", fmt.Errorf("failed to acquire upload slot: %w", err)
+	}
+
+	defer mergedOpts.Limiter.Release()
+
+	// A pre-encrypted object is stored as it is.
+	if mergedOpts.Sealed != nil {
+		return p.pushRaw(ctx, name, r, mergedOpts)
+	}
+
 	// If the seal opener is set, push an encrypted object.
 	if mergedOpts.SealOpener != nil {
-		return p.pushEncrypted(ctx, name, r, mergedOpts)
+		return p.pushEncrypted(ctx, withPrefix(mergedOpts.Prefix, name), r, mergedOpts)
 	}
 
 	panic("not implemented")
@@ -60,16 +107,19 @@ func (p *Pusher) pushEncryptedTagChange(
 	r io.ReadSeeker,
 	opts store.PushOptions,
 ) (string, error) {
-	if err := loadNameIndex(ctx, p.nameIndex, opts.SealOpener); err != nil {
-		return "", fmt.Errorf("failed to load name index: %w", err)
-	}
-
 	// Encrypt the metadata.
-	encGfsMeta, err := encryptGridFSMetadata(ctx, opts.SealOpener, meta)
+	encGfsMeta, err := encryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), meta)
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt metadata: %w", err)
 	}
 
+	// A link keeps linking to its data.
+	if blob, ok := blobID(originalFile.Metadata); ok {
+		if encGfsMeta, err = withBlob(encGfsMeta, blob); err != nil {
+			return "", err
+		}
+	}
+
 	// Update the metadata.
 	updateOptions := options.Update().SetUpsert(true)
 	updateDoc := bson.D{{Key: "$set", Value: bson.D{{Key: "metadata", Value: encGfsMeta}}}}
@@ -79,7 +129,7 @@ func (p *Pusher) pushEncryptedTagChange(
 		return "", fmt.Errorf("failed to update metadata: %w", err)
 	}
 
-	return originalFile.ID.(primitive.ObjectID).Hex(), nil
+	return originalFile.Name, nil
 }
 
 // encryptedExistsPush pushes an encrypted object that already exists in the
@@ -91,24 +141,16 @@ func (p *Pusher) pushEncryptedChange(
 	r io.ReadSeeker,
 	opts store.PushOptions,
 ) (string, error) {
-	if err := loadNameIndex(ctx, p.nameIndex, opts.SealOpener); err != nil {
-		return "", fmt.Errorf("failed to load name index: %w", err)
-	}
-
-	length, err := r.Seek(0, io.SeekEnd)
+	noDataChange, err := sameContents(meta, r)
 	if err != nil {
-		return "", fmt.Errorf("failed to seek to end of file: %w", err)
+		return "", err
 	}
 
-	// TODO: this is expedient for beta, but it's not a great way to check if
-	// the file has changed. What if the file is the same size but the contents
-	// are different?
-	noDataChange := originalFile.Length-28 == length
 	noTagChange := !meta.addTags(opts.Tags...)
 
 	// If absolutely nothing has changed, do nothing.
 	if noDataChange && noTagChange {
-		return originalFile.ID.(primitive.ObjectID).Hex(), nil
+		return originalFile.Name, nil
 	}
 
 	// If there is just a tag change, update the metadata.
@@ -126,12 +168,32 @@ func (p *Pusher) pushEncrypted(
 	r io.ReadSeeker,
 	opts store.PushOptions,
 ) (string, error) {
-	if err := loadNameIndex(ctx, p.nameIndex, opts.SealOpener); err != nil {
+	// Duplicates are found by their hash anywhere in the bucket, so only a
+	// push without dedup can look up the shard of its name alone.
+	var err error
+	if p.nameIndex.sharded() && !opts.Dedup {
+		err = lookupShards(ctx, p.nameIndex, opts.SealOpenerForMetadata(), []string{name})
+	} else {
+		err = loadNameIndex(ctx, p.nameIndex, opts.SealOpenerForMetadata())
+	}
+
+	if err != nil {
 		return "", fmt.Errorf("failed to load name index: %w", err)
 	}
 
 	originalFile, meta, ok := p.nameIndex.nameDoc.get(name)
 
+	if ok && opts.SkipExisting {
+		exists, err := existsRemotely(meta, r, opts)
+		if err != nil {
+			return "", err
+		}
+
+		if exists {
+			return originalFile.Name, nil
+		}
+	}
+
 	newMeta := meta == nil
 	if newMeta {
 		meta = newGridFSMetadata(opts.Tags)
@@ -158,77 +220,333 @@ func (p *Pusher) pushEncrypted(
 		meta.addTags(opts.Tags...)
 	}
 
-	// Read and seal the bytes.
-	byts, err := io.ReadAll(r)
+	length, err := r.Seek(0, io.SeekEnd)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
+		return "", fmt.Errorf("failed to seek to end of file: %w", err)
 	}
 
-	ciphertext, err := opts.SealOpener.Seal(ctx, byts)
-	if err != nil {
-		return "", fmt.Errorf("failed to encrypt file: %w", err)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("failed to seek to start of file: %w", err)
 	}
 
-	// Add new tags and encrypt the metadata.
-	encryptedMeta, err := encryptGridFSMetadata(ctx, opts.SealOpener, meta)
+	// The batch is that of the push that last wrote the data, so a change to
+	// the tags alone leaves it as it was.
+	if opts.Batch != "" {
+		meta.Diskhop.Batch = opts.Batch
+		meta.Diskhop.Label = opts.Label
+	}
+
+	newObjectID := primitive.NewObjectID()
+
+	// Encrypt the file name.
+	encFileName, err := opts.SealOpenerForMetadata().Seal(ctx, []byte(name))
 	if err != nil {
-		return "", fmt.Errorf("failed to encrypt metadata: %w", err)
+		return "", fmt.Errorf("failed to encrypt file name: %w", err)
 	}
 
-	var (
-		newObjectID = primitive.NewObjectID()
-		gridFSOpts  = options.GridFSUpload()
-	)
+	newIDAsHex := encodeName(p.nameIndex.encoding, newObjectID, encFileName)
 
-	if len(encryptedMeta) > 0 {
-		gridFSOpts.SetMetadata(encryptedMeta)
+	nameDoc, err := p.nameIndex.newNameDoc(ctx, opts.SealOpenerForMetadata(), newObjectID, name, encFileName)
+	if err != nil {
+		return "", err
 	}
 
-	// Perform a full upload.
-	id, err := p.bucket.UploadFromStream(newObjectID.Hex(), bytes.NewReader(ciphertext), gridFSOpts)
+	uploadedAs := uploadName(p.nameIndex.encoding, newObjectID, newIDAsHex)
+
+	// Contents the bucket already holds are linked to rather than uploaded.
+	uploaded, err := p.pushLink(ctx, uploadedAs, r, length, meta, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
+		return "", err
+	}
+
+	linked := uploaded != nil
+
+	if !linked {
+		id, err := p.pushData(ctx, uploadedAs, r, length, meta, opts)
+		if err != nil {
+			return "", err
+		}
+
+		uploaded = &gridfs.File{ID: id, Name: uploadedAs, Length: length}
 	}
 
+	id := uploaded.ID.(primitive.ObjectID)
+
 	if originalFile == nil {
 		originalFile = &gridfs.File{}
 	}
 
-	p.nameIndex.nameDoc.add(name, &gridfs.File{ID: id, Name: newObjectID.Hex(), Length: int64(len(byts))}, meta)
-	p.nameIndex.hexName.add(newObjectID.Hex(), name)
+	oldID, _ := originalFile.ID.(primitive.ObjectID)
+
+	// Publish the upload by naming it and retiring the file it replaces in
+	// one step, so that a failure leaves the bucket as it was.
+	err = p.withTransaction(ctx, func(ctx context.Context) error {
+		return p.publish(ctx, nameDoc, id, oldID, uploadedAs, newIDAsHex, originalFile.Name)
+	})
+	if err != nil {
+		return "", errors.Join(err, p.deleteUpload(ctx, *uploaded, linked))
+	}
+
+	uploaded.Name = newIDAsHex
 
-	newIDAsHex := newObjectID.Hex()
+	p.nameIndex.nameDoc.add(name, uploaded, meta)
+	p.nameIndex.hexName.add(newIDAsHex, name)
 
-	// If the original file exists at this point, it's a duplicate and we
-	// should delete it.
-	if pid, _ := originalFile.ID.(primitive.ObjectID); !pid.IsZero() {
-		if err := p.bucket.Delete(pid); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
-			return newIDAsHex, fmt.Errorf("failed to remove the old data with id %q from bucket: %w", pid, err)
+	if p.nameIndex.storesNames() {
+		if err := p.nameIndex.touchNames(ctx); err != nil {
+			return newIDAsHex, err
 		}
 	}
 
-	if originalFile.Name != "" {
-		originalObjectID, err := primitive.ObjectIDFromHex(originalFile.Name)
-		if err != nil {
-			return newIDAsHex, fmt.Errorf("failed to convert original name to object ID: %w", err)
+	if oldID.IsZero() {
+		return newIDAsHex, nil
+	}
+
+	// Without versioning, the chunks of the replaced file are unreachable
+	// once its files document is gone, unless other files link to them, and
+	// are too many to delete inside the transaction.
+	if p.versions.disabled() {
+		if err := releaseFile(ctx, p.bucket, *originalFile); err != nil {
+			return newIDAsHex, fmt.Errorf("failed to release the old data with id %q: %w", oldID, err)
+		}
+
+		return newIDAsHex, nil
+	}
+
+	// The replaced file is kept as a version, so that reverting this push
+	// restores it, unless the policy prunes it.
+	p.recordReplaced(newIDAsHex, originalFile.Name)
+
+	if err := p.pruneVersions(ctx, id); err != nil {
+		return newIDAsHex, fmt.Errorf("failed to prune versions: %w", err)
+	}
+
+	return newIDAsHex, nil
+}
+
+// pushData seals and uploads the contents of r under filename with the
+// metadata, returning the ID of the upload.
+func (p *Pusher) pushData(
+	ctx context.Context,
+	filename string,
+	r io.ReadSeeker,
+	length int64,
+	meta *gridfsMetadata,
+	opts store.PushOptions,
+) (primitive.ObjectID, error) {
+	hash := sha256.New()
+
+	body, closeBody, err := sealBody(ctx, r, length, meta, hash, opts)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	defer closeBody()
+
+	// Add new tags and encrypt the metadata.
+	encryptedMeta, err := encryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), meta)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to encrypt metadata: %w", err)
+	}
+
+	// Perform a full upload.
+	id, err := p.upload(ctx, filename, body, encryptedMeta)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	// A file sealed as a stream was hashed as it was uploaded. The upload of
+	// a stream is not retried, so the hash covers the file exactly once.
+	if meta.Diskhop.SHA256 == "" {
+		meta.Diskhop.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+		if err := p.updateMetadata(ctx, id, meta, opts); err != nil {
+			return primitive.NilObjectID, errors.Join(err, deletePartialUpload(ctx, p.bucket, id))
 		}
+	}
+
+	return id, nil
+}
+
+// deleteUpload deletes the file that a push failed to publish, which is a
+// link if linked.
+func (p *Pusher) deleteUpload(ctx context.Context, file gridfs.File, linked bool) error {
+	if !linked {
+		return deletePartialUpload(ctx, p.bucket, file.ID)
+	}
+
+	// A link has no chunks of its own, and releases those it links to.
+	return deleteFile(ctx, p.bucket, file)
+}
+
+// existsRemotely reports whether the file with the remote metadata holds the
+// contents of r and the tags of the push, so that it can be skipped without
+// asking the server. Files pushed before their hash was recorded are never
+// skipped. r is left at its start.
+func existsRemotely(meta *gridfsMetadata, r io.ReadSeeker, opts store.PushOptions) (bool, error) {
+	if meta == nil || !sameTags(meta.Diskhop.Tags, opts.Tags) {
+		return false, nil
+	}
+
+	return sameContents(meta, r)
+}
 
-		if _, err := p.nameIndex.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: originalObjectID}}); err != nil {
-			return newIDAsHex, fmt.Errorf("failed to delete old file: %w", err)
+// sameContents reports whether r holds the contents of the file with the
+// remote metadata, by the SHA-256 of the plaintext recorded in it, since an
+// edit may keep the size of a file. r is only hashed if its size matches the
+// recorded one, where there is one. Files pushed before their hash was
+// recorded are taken to have changed; upgrading the bucket records it. r is
+// left at its start.
+func sameContents(meta *gridfsMetadata, r io.ReadSeeker) (bool, error) {
+	if meta == nil || meta.Diskhop.SHA256 == "" {
+		return false, nil
+	}
+
+	length, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false, fmt.Errorf("failed to seek to end of file: %w", err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("failed to seek to start of file: %w", err)
+	}
+
+	if meta.Diskhop.Size > 0 && meta.Diskhop.Size != length {
+		return false, nil
+	}
+
+	sum, err := hashContents(r)
+	if err != nil {
+		return false, err
+	}
+
+	return sum == meta.Diskhop.SHA256, nil
+}
+
+// sameTags reports whether a and b hold the same tags, in any order.
+func sameTags(a, b []string) bool {
+	set := func(tags []string) map[string]bool {
+		m := make(map[string]bool, len(tags))
+		for _, tag := range tags {
+			m[tag] = true
 		}
+
+		return m
 	}
 
-	// Encrypt the file name.
-	encFileName, err := opts.SealOpener.Seal(ctx, []byte(name))
+	as, bs := set(a), set(b)
+	if len(as) != len(bs) {
+		return false
+	}
+
+	for tag := range as {
+		if !bs[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updateMetadata encrypts meta and writes it to the files document with the ID.
+func (p *Pusher) updateMetadata(ctx context.Context, id primitive.ObjectID, meta *gridfsMetadata, opts store.PushOptions) error {
+	encryptedMeta, err := encryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), meta)
 	if err != nil {
-		return newIDAsHex, fmt.Errorf("failed to encrypt file name: %w", err)
+		return fmt.Errorf("failed to encrypt metadata: %w", err)
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "metadata", Value: encryptedMeta}}}}
+	if _, err := p.bucket.GetFilesCollection().UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update); err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
 	}
 
+	return nil
+}
+
+// publish inserts the encrypted name of a new upload or, if it is encoded in
+// the filename newName, renames the upload from uploadedAs to it. If the upload
+// replaces a file, the old one is retired to the versions collection or, if
+// versioning is disabled, its files document and name are removed. Without a
+// transaction, the new name is written first so that a failure part way
+// through leaves the old file in place rather than neither.
+func (p *Pusher) publish(
+	ctx context.Context,
+	nameDoc bson.D,
+	id, oldID primitive.ObjectID,
+	uploadedAs, newName, oldName string,
+) error {
+	files := p.bucket.GetFilesCollection()
+
 	// Insert the encrypted file name into the name collection.
-	idoc := bson.D{{Key: "_id", Value: newObjectID}, {Key: "data", Value: encFileName}}
-	if _, err := p.nameIndex.nameColl.InsertOne(ctx, idoc); err != nil {
-		return newIDAsHex, fmt.Errorf("failed to insert encrypted file name into name collection: %w", err)
+	if p.nameIndex.storesNames() {
+		if _, err := p.nameIndex.nameColl.InsertOne(ctx, nameDoc); err != nil {
+			return fmt.Errorf("failed to insert encrypted file name into name collection: %w", err)
+		}
+	} else if err := publishName(ctx, files, id, uploadedAs, newName); err != nil {
+		return err
 	}
 
-	return newIDAsHex, nil
+	if oldID.IsZero() {
+		return nil
+	}
+
+	if !p.versions.disabled() {
+		return retireVersion(ctx, files, oldID, id, newName)
+	}
+
+	if _, err := files.DeleteOne(ctx, bson.D{{Key: "_id", Value: oldID}}); err != nil {
+		return fmt.Errorf("failed to remove the old file with id %q: %w", oldID, err)
+	}
+
+	return p.nameIndex.deleteName(ctx, oldName)
+}
+
+// sealBody returns the ciphertext of r to upload. Files of at least
+// streamSealThreshold bytes are sealed as a stream in chunks so that they are
+// never held in memory; smaller files are sealed whole. The returned function
+// releases the stream and must be called once the upload is done.
+//
+// The plaintext is written to hash as it is read. The hash of a file sealed
+// whole is recorded in meta, while that of a file sealed as a stream is only
+// known once the upload has read it to the end.
+func sealBody(
+	ctx context.Context,
+	r io.ReadSeeker,
+	length int64,
+	meta *gridfsMetadata,
+	hash hash.Hash,
+	opts store.PushOptions,
+) (io.Reader, func(), error) {
+	meta.Diskhop.Size = length
+	meta.Diskhop.ChunkSize = 0
+	meta.Diskhop.SHA256 = ""
+
+	streams := streamutil.NewBuilder().Hash(hash)
+
+	streamer, canStream := opts.SealOpener.(dcrypto.StreamSealer)
+	if !canStream || length < streamSealThreshold {
+		byts, err := io.ReadAll(streams.Wrap(r))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read file: %w", err)
+		}
+
+		ciphertext, err := opts.SealOpener.Seal(ctx, byts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to encrypt file: %w", err)
+		}
+
+		meta.Diskhop.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+		return bytes.NewReader(ciphertext), func() {}, nil
+	}
+
+	meta.Diskhop.ChunkSize = dcrypto.DefaultStreamChunkSize
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(streamer.SealStream(ctx, pw, streams.Wrap(r), meta.Diskhop.ChunkSize))
+	}()
+
+	return pr, func() { _ = pr.Close() }, nil
 }
@@ -0,0 +1,198 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/exp/test"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestSealBodyHash(t *testing.T) {
+	key := []byte("12345678901234567890123456789012")
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	opts := store.PushOptions{SealOpener: dcrypto.NewAEAD(&test.MockIVManager{}, aesgcm)}
+
+	plaintext := strings.Repeat("diskhop", 1000)
+	sum := sha256.Sum256([]byte(plaintext))
+	want := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		length   int64 // Length reported for the file, which picks how it is sealed
+		streamed bool
+	}{
+		{name: "sealed whole", length: int64(len(plaintext))},
+		{name: "sealed as a stream", length: streamSealThreshold, streamed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := newGridFSMetadata(nil)
+			meta.Diskhop.SHA256 = "stale"
+
+			hash := sha256.New()
+
+			body, closeBody, err := sealBody(context.Background(), strings.NewReader(plaintext), tt.length, meta, hash, opts)
+			require.NoError(t, err)
+
+			defer closeBody()
+
+			if tt.streamed {
+				assert.Empty(t, meta.Diskhop.SHA256, "the hash is only known once the stream is read")
+			} else {
+				assert.Equal(t, want, meta.Diskhop.SHA256)
+			}
+
+			_, err = io.Copy(io.Discard, body)
+			require.NoError(t, err)
+
+			assert.Equal(t, want, hex.EncodeToString(hash.Sum(nil)))
+		})
+	}
+}
+
+func TestExistsRemotely(t *testing.T) {
+	sum := sha256.Sum256([]byte("diskhop"))
+
+	newMeta := func(hash string, tags ...string) *gridfsMetadata {
+		meta := newGridFSMetadata(tags)
+		meta.Diskhop.SHA256 = hash
+
+		return meta
+	}
+
+	tests := []struct {
+		name string
+		meta *gridfsMetadata
+		data string
+		tags []string
+		want bool
+	}{
+		{name: "same contents", meta: newMeta(hex.EncodeToString(sum[:])), data: "diskhop", want: true},
+		{name: "same contents and tags", meta: newMeta(hex.EncodeToString(sum[:]), "a", "b"), data: "diskhop", tags: []string{"b", "a"}, want: true},
+		{name: "different contents", meta: newMeta(hex.EncodeToString(sum[:])), data: "diskhoq"},
+		{name: "different tags", meta: newMeta(hex.EncodeToString(sum[:]), "a"), data: "diskhop", tags: []string{"b"}},
+		{name: "no recorded hash", meta: newMeta(""), data: "diskhop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader(tt.data)
+
+			got, err := existsRemotely(tt.meta, r, store.PushOptions{Tags: tt.tags})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, got)
+
+			offset, err := r.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+
+			assert.Zero(t, offset, "the file is left at its start")
+		})
+	}
+}
+
+func TestSameContents(t *testing.T) {
+	sum := sha256.Sum256([]byte("diskhop"))
+
+	newMeta := func(hash string, size int64) *gridfsMetadata {
+		meta := newGridFSMetadata(nil)
+		meta.Diskhop.SHA256 = hash
+		meta.Diskhop.Size = size
+
+		return meta
+	}
+
+	tests := []struct {
+		name string
+		meta *gridfsMetadata
+		data string
+		want bool
+	}{
+		{name: "same contents", meta: newMeta(hex.EncodeToString(sum[:]), 7), data: "diskhop", want: true},
+		{name: "same contents without size", meta: newMeta(hex.EncodeToString(sum[:]), 0), data: "diskhop", want: true},
+		{name: "same size", meta: newMeta(hex.EncodeToString(sum[:]), 7), data: "pohksid"},
+		{name: "different size", meta: newMeta(hex.EncodeToString(sum[:]), 7), data: "diskhops"},
+		{name: "no recorded hash", meta: newMeta("", 7), data: "diskhop"},
+		{name: "no metadata", data: "diskhop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader(tt.data)
+
+			got, err := sameContents(tt.meta, r)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, got)
+
+			offset, err := r.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+
+			assert.Zero(t, offset, "the file is left at its start")
+		})
+	}
+}
+
+func TestPushEncryptedChange(t *testing.T) {
+	sum := sha256.Sum256([]byte("data"))
+
+	id := primitive.NewObjectID()
+
+	newMeta := func() *gridfsMetadata {
+		meta := newGridFSMetadata(nil)
+		meta.Diskhop.SHA256 = hex.EncodeToString(sum[:])
+		meta.Diskhop.Size = 4
+
+		return meta
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		file := &gridfs.File{ID: id, Name: primitive.NewObjectID().Hex()}
+
+		got, err := (&Pusher{}).pushEncryptedChange(context.Background(), file, newMeta(), strings.NewReader("data"), store.PushOptions{})
+		require.NoError(t, err)
+
+		// The file is verified and committed by its stored name, which is not
+		// the ID of its files document.
+		assert.Equal(t, file.Name, got)
+	})
+
+	t.Run("same size", func(t *testing.T) {
+		_, err := (&Pusher{}).pushEncryptedChange(context.Background(), &gridfs.File{ID: id}, newMeta(), strings.NewReader("atad"), store.PushOptions{})
+
+		assert.ErrorIs(t, err, errFullPushRequired, "a modified file of the same size is uploaded again")
+	})
+}
@@ -0,0 +1,304 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrIVCollision is returned by a raw push of a file sealed with a nonce that
+// is already in use by the store, since a nonce must never be reused with the
+// same key.
+var ErrIVCollision = errors.New("initialization vector is already in use")
+
+// errRawSelection is returned by a raw pull asked to select files, which
+// needs the names and metadata that only the key can decrypt.
+var errRawSelection = errors.New("a raw pull cannot filter, name, prefix or check out files")
+
+// rawPull sends every file of the bucket to buf as it is stored, with its
+// encrypted name and metadata, without decrypting anything. A link is sent
+// with the data it links to, as a file of its own, so a raw push of a second
+// file with the same data fails with ErrIVCollision.
+func (s *Store) rawPull(ctx context.Context, buf store.DocumentBuffer, opts store.PullOptions) (*store.PullDescription, error) {
+	if opts.Filter != "" || len(opts.Names) > 0 || opts.Prefix != "" || opts.Commit != "" || opts.ContentFilter != nil {
+		return nil, errRawSelection
+	}
+
+	files, err := findGridFSFiles(ctx, s.bucket.GetFilesCollection(), bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files: %w", err)
+	}
+
+	if opts.SampleSize > 0 {
+		if files, err = randomSubset(files, opts.SampleSize); err != nil {
+			return nil, fmt.Errorf("failed to sample files: %w", err)
+		}
+	}
+
+	names, err := s.sealedNames(ctx, files)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := s.settings.NonceSize
+	if nonceSize == 0 {
+		nonceSize = dcrypto.DefaultAEADNonceSize
+	}
+
+	desc := &store.PullDescription{Count: len(files)}
+	for _, file := range files {
+		desc.Size += file.Length
+	}
+
+	go func() {
+		if opts.DescribeOnly {
+			return
+		}
+
+		for _, file := range files {
+			meta, err := withoutBlob(file.Metadata)
+			if err != nil {
+				buf.Send(nil, err)
+
+				return
+			}
+
+			stream, err := openData(ctx, s.bucket, file)
+			if err != nil {
+				buf.Send(nil, classifyError(fmt.Errorf("failed to open download stream: %w", err)))
+
+				return
+			}
+
+			buf.Send(&store.Document{
+				Filename:   file.Name,
+				Size:       file.Length,
+				UploadDate: file.UploadDate,
+				Body:       stream,
+				Sealed: &store.Sealed{
+					Name:      names[file.Name],
+					Metadata:  meta,
+					NonceSize: nonceSize,
+				},
+			}, nil)
+		}
+
+		buf.Send(nil, io.EOF)
+	}()
+
+	return desc, nil
+}
+
+// sealedNames returns the encrypted names of the files, keyed by their stored
+// names.
+func (s *Store) sealedNames(ctx context.Context, files []gridfs.File) (map[string][]byte, error) {
+	names := make(map[string][]byte, len(files))
+
+	if !s.nameIndex.storesNames() {
+		for _, file := range files {
+			encName, err := decodeName(file.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			names[file.Name] = encName
+		}
+
+		return names, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(files))
+	for _, file := range files {
+		id, err := primitive.ObjectIDFromHex(file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert file name to object ID: %w", err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	cur, err := s.nameIndex.nameColl.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find file names: %w", err)
+	}
+
+	var docs []struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Data primitive.Binary
+	}
+
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode file names: %w", err)
+	}
+
+	for _, doc := range docs {
+		names[doc.ID.Hex()] = doc.Data.Data
+	}
+
+	return names, nil
+}
+
+// pushRaw stores the ciphertext read from r under the stored name, with the
+// encrypted name and metadata of the push, as a raw pull fetched them. A file
+// that is already stored under the name is left as it is, so that a copy can
+// be repeated. Otherwise the nonces of the file must not be in use by the
+// store, and are recorded as used.
+func (p *Pusher) pushRaw(ctx context.Context, name string, r io.ReadSeeker, opts store.PushOptions) (string, error) {
+	var nameID primitive.ObjectID
+
+	if p.nameIndex.storesNames() {
+		var err error
+
+		nameID, err = primitive.ObjectIDFromHex(name)
+		if err != nil {
+			return "", fmt.Errorf("%w: %q is not stored by ObjectID", ErrNameEncodingMismatch, name)
+		}
+	} else if _, err := decodeName(name); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNameEncodingMismatch, err)
+	}
+
+	filter := bson.D{{Key: "filename", Value: name}}
+
+	n, err := p.bucket.GetFilesCollection().CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return "", fmt.Errorf("failed to count files: %w", err)
+	}
+
+	if n > 0 {
+		return name, nil
+	}
+
+	ivs, err := sealedIVs(r, opts.Sealed)
+	if err != nil {
+		return "", err
+	}
+
+	if err := p.checkIVs(ctx, ivs); err != nil {
+		return "", err
+	}
+
+	uploadedAs := uploadName(p.nameIndex.encoding, primitive.NewObjectID(), name)
+
+	id, err := p.upload(ctx, uploadedAs, r, bson.Raw(opts.Sealed.Metadata))
+	if err != nil {
+		return "", fmt.Errorf("failed to upload file: %w", err)
+	}
+
+	if p.nameIndex.storesNames() {
+		idoc := bson.D{{Key: "_id", Value: nameID}, {Key: "data", Value: opts.Sealed.Name}}
+		if _, err := p.nameIndex.nameColl.InsertOne(ctx, idoc); err != nil {
+			err = fmt.Errorf("failed to insert file name: %w", err)
+
+			return "", errors.Join(err, deletePartialUpload(ctx, p.bucket, id))
+		}
+	} else if err := publishName(ctx, p.bucket.GetFilesCollection(), id, uploadedAs, name); err != nil {
+		return "", errors.Join(err, deletePartialUpload(ctx, p.bucket, id))
+	}
+
+	// The nonces are recorded so that no later seal reuses them.
+	for _, iv := range ivs {
+		if err := p.ivPusher.Push(ctx, iv); err != nil {
+			return "", err
+		}
+	}
+
+	if p.nameIndex.storesNames() {
+		if err := p.nameIndex.touchNames(ctx); err != nil {
+			return name, err
+		}
+	}
+
+	// A name index loaded with the key does not hold the file, so it is
+	// reloaded the next time it is used. The name has no shard, so it is
+	// read along with the next shard looked up.
+	if p.nameIndex.hexName != nil {
+		p.nameIndex.partial = true
+		p.nameIndex.loadedUnsharded = false
+	}
+
+	return name, nil
+}
+
+// sealedIVs returns the nonces that begin the ciphertexts of a sealed file:
+// those of its data, read from the start of r, its name and its metadata. r is
+// left at its start.
+func sealedIVs(r io.ReadSeeker, sealed *store.Sealed) ([][]byte, error) {
+	nonceSize := sealed.NonceSize
+	if nonceSize == 0 {
+		nonceSize = dcrypto.DefaultAEADNonceSize
+	}
+
+	data := make([]byte, nonceSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read nonce of data: %w", err)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to start of file: %w", err)
+	}
+
+	val, err := bson.Raw(sealed.Metadata).LookupErr(metadataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sealed metadata: %w", err)
+	}
+
+	_, meta, ok := val.BinaryOK()
+	if !ok {
+		return nil, fmt.Errorf("sealed metadata %q is not binary", metadataKey)
+	}
+
+	ivs := [][]byte{data}
+
+	for _, ciphertext := range [][]byte{sealed.Name, meta} {
+		if len(ciphertext) < nonceSize {
+			return nil, fmt.Errorf("sealed name or metadata is shorter than the %d byte nonce", nonceSize)
+		}
+
+		ivs = append(ivs, ciphertext[:nonceSize])
+	}
+
+	return ivs, nil
+}
+
+// checkIVs returns ErrIVCollision if any of the nonces is in use by the store
+// or repeats another.
+func (p *Pusher) checkIVs(ctx context.Context, ivs [][]byte) error {
+	seen := make(map[string]bool, len(ivs))
+
+	for _, iv := range ivs {
+		exists, err := p.ivPusher.Exists(ctx, iv)
+		if err != nil {
+			return err
+		}
+
+		if exists || seen[string(iv)] {
+			return fmt.Errorf("%w: %x", ErrIVCollision, iv)
+		}
+
+		seen[string(iv)] = true
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRawPullSelection(t *testing.T) {
+	tests := []struct {
+		name string
+		opts store.PullOptions
+	}{
+		{name: "filter", opts: store.PullOptions{Filter: "tag('a')"}},
+		{name: "names", opts: store.PullOptions{Names: []string{"a.jpg"}}},
+		{name: "prefix", opts: store.PullOptions{Prefix: "photos"}},
+		{name: "commit", opts: store.PullOptions{Commit: "abc"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := store.NewDocumentBuffer()
+			defer buf.Close()
+
+			_, err := (&Store{}).rawPull(context.Background(), buf, tt.opts)
+			assert.ErrorIs(t, err, errRawSelection)
+		})
+	}
+}
+
+func TestSealedIVs(t *testing.T) {
+	meta, err := bson.Marshal(bson.M{metadataKey: primitive.Binary{Data: []byte("mmmmmmmmmmmm-metadata")}})
+	require.NoError(t, err)
+
+	sealed := &store.Sealed{Name: []byte("nnnnnnnnnnnn-name"), Metadata: meta}
+
+	r := bytes.NewReader([]byte("dddddddddddd-data"))
+
+	ivs, err := sealedIVs(r, sealed)
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]byte{[]byte("dddddddddddd"), []byte("nnnnnnnnnnnn"), []byte("mmmmmmmmmmmm")}, ivs)
+	assert.Equal(t, 17, r.Len(), "the data is left at its start")
+
+	_, err = sealedIVs(bytes.NewReader([]byte("short")), sealed)
+	assert.Error(t, err)
+}
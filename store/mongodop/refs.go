@@ -0,0 +1,167 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The chunks that links share are reference counted in the refs collection of
+// the bucket, which holds the number of files and versions linking to the
+// chunks stored under each ID. Chunks are only deleted once their count is
+// zero and the file they were uploaded with is gone, so that replacing,
+// pruning or reverting a file does not delete data that another name still
+// reads.
+
+const refsSuffix = ".refs"
+
+// refsColl returns the collection that counts the links to the chunks of the
+// files in files.
+func refsColl(files *mongo.Collection) *mongo.Collection {
+	name := strings.TrimSuffix(files.Name(), filesSuffix) + refsSuffix
+
+	return files.Database().Collection(name)
+}
+
+// pinChunks counts one more link to the chunks stored under the ID.
+func pinChunks(ctx context.Context, bucket *gridfs.Bucket, id primitive.ObjectID) error {
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: 1}}}}
+
+	_, err := refsColl(bucket.GetFilesCollection()).UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to count link to %q: %w", id.Hex(), err)
+	}
+
+	return nil
+}
+
+// unpinChunks counts one less link to the chunks stored under the ID.
+func unpinChunks(ctx context.Context, bucket *gridfs.Bucket, id primitive.ObjectID) error {
+	refs := refsColl(bucket.GetFilesCollection())
+	filter := bson.D{{Key: "_id", Value: id}}
+
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "count", Value: -1}}}}
+	if _, err := refs.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to release link to %q: %w", id.Hex(), err)
+	}
+
+	// The count is removed once nothing links to the chunks.
+	filter = append(filter, bson.E{Key: "count", Value: bson.D{{Key: "$lte", Value: 0}}})
+	if _, err := refs.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to release link to %q: %w", id.Hex(), err)
+	}
+
+	return nil
+}
+
+// refCount returns the number of links to the chunks stored under the ID.
+func refCount(ctx context.Context, bucket *gridfs.Bucket, id primitive.ObjectID) (int64, error) {
+	var ref struct {
+		Count int64 `bson:"count"`
+	}
+
+	err := refsColl(bucket.GetFilesCollection()).FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&ref)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to find links to %q: %w", id.Hex(), err)
+	}
+
+	return ref.Count, nil
+}
+
+// deleteFile deletes the files document of the file from the bucket and then
+// releases its data. It returns gridfs.ErrFileNotFound if the file is not in
+// the bucket.
+func deleteFile(ctx context.Context, bucket *gridfs.Bucket, file gridfs.File) error {
+	res, err := bucket.GetFilesCollection().DeleteOne(ctx, bson.D{{Key: "_id", Value: file.ID}})
+	if err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return gridfs.ErrFileNotFound
+	}
+
+	return releaseFile(ctx, bucket, file)
+}
+
+// releaseFile deletes the chunks of a file whose files document was deleted
+// unless other files link to them. If the file was a link, the chunks it
+// linked to lose a link, and are deleted if it was the last.
+func releaseFile(ctx context.Context, bucket *gridfs.Bucket, file gridfs.File) error {
+	id, ok := file.ID.(primitive.ObjectID)
+	if !ok {
+		return fmt.Errorf("file ID %v is not an ObjectID", file.ID)
+	}
+
+	if err := releaseChunks(ctx, bucket, id); err != nil {
+		return err
+	}
+
+	blob, ok := blobID(file.Metadata)
+	if !ok {
+		return nil
+	}
+
+	if err := unpinChunks(ctx, bucket, blob); err != nil {
+		return err
+	}
+
+	return releaseChunks(ctx, bucket, blob)
+}
+
+// releaseChunks deletes the chunks stored under the ID, unless links to them
+// are counted or the file or version they were uploaded with is still kept.
+func releaseChunks(ctx context.Context, bucket *gridfs.Bucket, id primitive.ObjectID) error {
+	count, err := refCount(ctx, bucket, id)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	files := bucket.GetFilesCollection()
+
+	for _, coll := range []*mongo.Collection{files, versionsColl(files)} {
+		n, err := coll.CountDocuments(ctx, bson.D{{Key: "_id", Value: id}}, options.Count().SetLimit(1))
+		if err != nil {
+			return fmt.Errorf("failed to find file %q: %w", id.Hex(), err)
+		}
+
+		if n > 0 {
+			return nil
+		}
+	}
+
+	if _, err := bucket.GetChunksCollection().DeleteMany(ctx, bson.D{{Key: "files_id", Value: id}}); err != nil {
+		return fmt.Errorf("failed to remove the data with id %q from bucket: %w", id.Hex(), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ store.Remover = &Store{}
+
+// removeTarget is a file of the bucket that removing old files deletes.
+type removeTarget struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Name       string             `bson:"filename"`
+	Length     int64              `bson:"length"`
+	UploadDate time.Time          `bson:"uploadDate"`
+	Line       string             `bson:"line"`
+	RetiredAt  time.Time          `bson:"retiredAt"` // Set for versions
+	Metadata   bson.Raw           `bson:"metadata"`
+}
+
+// findOlderThan returns the files of the bucket uploaded before the time,
+// oldest first. The dates are compared by the server, so that the rest of the
+// bucket is never read.
+func (s *Store) findOlderThan(ctx context.Context, before time.Time) ([]removeTarget, error) {
+	filter := bson.D{{Key: "uploadDate", Value: bson.D{{Key: "$lt", Value: before}}}}
+	opts := options.Find().SetSort(bson.D{{Key: "uploadDate", Value: 1}})
+
+	cur, err := s.nameIndex.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find files: %w", err)
+	}
+
+	var files []removeTarget
+	if err := cur.All(ctx, &files); err != nil {
+		return nil, fmt.Errorf("failed to decode files: %w", err)
+	}
+
+	return files, nil
+}
+
+// DescribeRemoveOlderThan lists the files that RemoveOlderThan would delete.
+func (s *Store) DescribeRemoveOlderThan(
+	ctx context.Context,
+	before time.Time,
+	opener dcrypto.Opener,
+) (_ []store.RemovedFile, err error) {
+	defer func() { err = classifyError(err) }()
+
+	files, err := s.findOlderThan(ctx, before)
+	if err != nil {
+		return nil, err
+	}
+
+	if opener != nil {
+		if err := loadNameIndex(ctx, s.nameIndex, opener); err != nil {
+			return nil, fmt.Errorf("failed to load name index: %w", err)
+		}
+	}
+
+	removed := make([]store.RemovedFile, 0, len(files))
+	for _, file := range files {
+		rf := store.RemovedFile{ID: file.ID.Hex(), UploadDate: file.UploadDate}
+		if opener != nil {
+			rf.Name, _ = s.nameIndex.hexName.get(file.Name)
+		}
+
+		removed = append(removed, rf)
+	}
+
+	return removed, nil
+}
+
+// RemoveOlderThan deletes the files of the bucket uploaded before the time.
+// The versions a file replaced are deleted with it, since nothing is left to
+// restore them over. Chunks that other files link to are kept.
+func (s *Store) RemoveOlderThan(ctx context.Context, before time.Time) (_ int, err error) {
+	defer func() { err = classifyError(err) }()
+
+	files, err := s.findOlderThan(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := versionsColl(s.nameIndex.coll)
+
+	var names []string
+
+	for _, file := range files {
+		if file.Line != "" {
+			lineNames, err := versions.Distinct(ctx, "filename", bson.D{{Key: lineKey, Value: file.Line}})
+			if err != nil {
+				return 0, fmt.Errorf("failed to find the versions of %q: %w", file.Name, err)
+			}
+
+			for _, name := range lineNames {
+				if name, ok := name.(string); ok {
+					names = append(names, name)
+				}
+			}
+
+			if err := s.deleteVersions(ctx, bson.D{{Key: lineKey, Value: file.Line}}, 0); err != nil {
+				return 0, err
+			}
+		}
+
+		if err := s.deleteCurrent(ctx, file); err != nil {
+			return 0, err
+		}
+
+		names = append(names, file.Name)
+	}
+
+	if err := s.forgetCommits(ctx, names); err != nil {
+		return 0, err
+	}
+
+	// The name index no longer matches the bucket.
+	s.nameIndex.hexName, s.nameIndex.nameDoc = nil, nil
+
+	return len(files), nil
+}
+
+// deleteCurrent deletes the files document, chunks and name of a file of the
+// bucket. A concurrent push may have replaced the file since it was found, in
+// which case only its name is left to delete.
+func (s *Store) deleteCurrent(ctx context.Context, file removeTarget) error {
+	err := deleteFile(ctx, s.bucket, gridfs.File{ID: file.ID, Metadata: file.Metadata})
+	if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return fmt.Errorf("failed to delete %q: %w", file.Name, err)
+	}
+
+	return s.nameIndex.deleteName(ctx, file.Name)
+}
+
+// forgetCommits drops the files with the hex names from the commits of the
+// bucket, deleting the commits left without files.
+func (s *Store) forgetCommits(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	filter := bson.D{
+		{Key: "namespace", Value: s.bucketName},
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "fileid", Value: bson.D{{Key: "$in", Value: names}}}},
+			bson.D{{Key: "fileids", Value: bson.D{{Key: "$in", Value: names}}}},
+		}},
+	}
+
+	cur, err := s.commitsColl.Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to find commits: %w", err)
+	}
+
+	var commits []struct {
+		ID           primitive.ObjectID `bson:"_id"`
+		store.Commit `bson:",inline"`
+	}
+
+	if err := cur.All(ctx, &commits); err != nil {
+		return fmt.Errorf("failed to decode commits: %w", err)
+	}
+
+	removed := make(map[string]bool, len(names))
+	for _, name := range names {
+		removed[name] = true
+	}
+
+	for _, commit := range commits {
+		var gone []string
+		for _, fileID := range commit.Files() {
+			if removed[fileID] {
+				gone = append(gone, fileID)
+			}
+		}
+
+		if err := s.dropCommitFiles(ctx, commit.ID, &commit.Commit, gone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
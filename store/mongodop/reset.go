@@ -0,0 +1,147 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ store.Resetter = &Store{}
+
+// Reset drops the files, chunks, versions and reference counts of the bucket,
+// and deletes their names and the commits of the bucket. The settings of the
+// bucket are kept.
+//
+// The nonces recorded for the bucket are kept as well, since they are shared
+// with the other buckets of the database, and a ciphertext that outlives the
+// bucket, such as in a backup, must never share a nonce with a later seal.
+func (s *Store) Reset(ctx context.Context) (err error) {
+	defer func() { err = classifyError(err) }()
+
+	// The names are found through the files, so they are deleted first.
+	if s.nameIndex.storesNames() {
+		if err := s.deleteBucketNames(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := s.bucket.DropContext(ctx); err != nil {
+		return fmt.Errorf("failed to drop bucket: %w", err)
+	}
+
+	if err := versionsColl(s.nameIndex.coll).Drop(ctx); err != nil {
+		return fmt.Errorf("failed to drop versions: %w", err)
+	}
+
+	if err := refsColl(s.nameIndex.coll).Drop(ctx); err != nil {
+		return fmt.Errorf("failed to drop reference counts: %w", err)
+	}
+
+	if err := migrationsColl(s.nameIndex.coll).Drop(ctx); err != nil {
+		return fmt.Errorf("failed to drop migrations: %w", err)
+	}
+
+	if _, err := s.commitsColl.DeleteMany(ctx, bson.D{{Key: "namespace", Value: s.bucketName}}); err != nil {
+		return fmt.Errorf("failed to delete commits: %w", err)
+	}
+
+	s.commitsMu.Lock()
+	s.commits = nil
+	s.commitsMu.Unlock()
+
+	s.nameIndex.hexName, s.nameIndex.nameDoc, s.nameIndex.partial = nil, nil, false
+	s.indexesEnsured = false
+
+	return nil
+}
+
+// resetNameBatch is the number of names deleted by each delete of a reset.
+const resetNameBatch = 1000
+
+// deleteBucketNames deletes the names of the files and versions of the bucket
+// from the name collection, which is shared with the other buckets. The
+// filenames are read through a cursor and their names deleted in batches, so
+// that no single reply or command has to hold every name of a large bucket.
+func (s *Store) deleteBucketNames(ctx context.Context) error {
+	ids := make([]primitive.ObjectID, 0, resetNameBatch)
+
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+
+		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+		if _, err := s.nameIndex.nameColl.DeleteMany(ctx, filter); err != nil {
+			return fmt.Errorf("failed to delete file names: %w", err)
+		}
+
+		ids = ids[:0]
+
+		return nil
+	}
+
+	for _, coll := range []*mongo.Collection{s.nameIndex.coll, versionsColl(s.nameIndex.coll)} {
+		opts := options.Find().SetProjection(bson.D{{Key: "filename", Value: 1}})
+
+		cur, err := coll.Find(ctx, bson.D{}, opts)
+		if err != nil {
+			return fmt.Errorf("failed to find file names in %s: %w", coll.Name(), err)
+		}
+
+		for cur.Next(ctx) {
+			var file struct {
+				Name string `bson:"filename"`
+			}
+
+			if err := cur.Decode(&file); err != nil {
+				_ = cur.Close(ctx)
+
+				return fmt.Errorf("failed to decode file in %s: %w", coll.Name(), err)
+			}
+
+			// Files without an ObjectID name have no entry to delete.
+			id, err := primitive.ObjectIDFromHex(file.Name)
+			if err != nil {
+				continue
+			}
+
+			ids = append(ids, id)
+
+			if len(ids) == resetNameBatch {
+				if err := flush(); err != nil {
+					_ = cur.Close(ctx)
+
+					return err
+				}
+			}
+		}
+
+		err = cur.Err()
+		_ = cur.Close(ctx)
+
+		if err != nil {
+			return fmt.Errorf("failed to read file names in %s: %w", coll.Name(), err)
+		}
+	}
+
+	return flush()
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDeleteBucketNames(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("deletes the names of the files and versions", func(mt *mtest.T) {
+		file, version := primitive.NewObjectID(), primitive.NewObjectID()
+
+		files := mt.DB.Collection("fs.files")
+		s := &Store{nameIndex: &nameIndex{coll: files, nameColl: mt.DB.Collection(DefaultNameCollectionName)}}
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.files", mtest.FirstBatch,
+				bson.D{{Key: "filename", Value: file.Hex()}},
+				// A ciphertext name has no entry in the name collection.
+				bson.D{{Key: "filename", Value: "AAEC"}},
+			),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.versions", mtest.FirstBatch,
+				bson.D{{Key: "filename", Value: version.Hex()}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}),
+		)
+
+		require.NoError(mt, s.deleteBucketNames(context.Background()))
+
+		assert.Empty(mt, sentCommands(mt, "distinct", "fs.files"))
+
+		deletes := sentCommands(mt, "delete", DefaultNameCollectionName)
+		require.Len(mt, deletes, 1)
+
+		stmts, err := deletes[0].Lookup("deletes").Array().Values()
+		require.NoError(mt, err)
+		require.Len(mt, stmts, 1)
+
+		ids, err := stmts[0].Document().Lookup("q", "_id", "$in").Array().Values()
+		require.NoError(mt, err)
+
+		got := make([]primitive.ObjectID, 0, len(ids))
+		for _, id := range ids {
+			got = append(got, id.ObjectID())
+		}
+
+		assert.Equal(mt, []primitive.ObjectID{file, version}, got)
+	})
+}
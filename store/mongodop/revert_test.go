@@ -0,0 +1,83 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDescribeRevert(t *testing.T) {
+	mt := newMockTest(t)
+
+	newStore := func(mt *mtest.T) *Store {
+		return &Store{
+			commitsColl: mt.DB.Collection("commits"),
+			nameIndex:   &nameIndex{coll: mt.DB.Collection("fs.files")},
+		}
+	}
+
+	mt.Run("lists the files without deleting them", func(mt *mtest.T) {
+		added, replacing := primitive.NewObjectID(), primitive.NewObjectID()
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".commits", mtest.FirstBatch, bson.D{
+				{Key: "sha", Value: "abc"},
+				{Key: "fileids", Value: bson.A{"a", "b"}},
+				{Key: "replaced", Value: bson.D{{Key: "b", Value: "b0"}}},
+			}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.files", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: added}, {Key: "filename", Value: "a"}},
+				bson.D{{Key: "_id", Value: replacing}, {Key: "filename", Value: "b"}},
+			),
+		)
+
+		got, err := newStore(mt).DescribeRevert(context.Background(), "abc", nil)
+		require.NoError(mt, err)
+
+		want := []store.RevertedFile{
+			{ID: added.Hex()},
+			{ID: replacing.Hex(), Restores: true},
+		}
+
+		assert.ElementsMatch(mt, want, got)
+
+		for _, evt := range mt.GetAllStartedEvents() {
+			assert.Equal(mt, "find", evt.CommandName, "a dry run only reads")
+		}
+	})
+
+	mt.Run("refuses a superseded push", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".commits", mtest.FirstBatch, bson.D{
+				{Key: "sha", Value: "abc"},
+				{Key: "fileid", Value: "a"},
+			}),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.files", mtest.FirstBatch),
+			// The file of the push is now a version.
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.versions", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+
+		_, err := newStore(mt).DescribeRevert(context.Background(), "abc", nil)
+		assert.ErrorIs(mt, err, errSuperseded)
+	})
+}
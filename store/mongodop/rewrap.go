@@ -0,0 +1,319 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var _ store.Rewrapper = &Store{}
+
+// rewrapTarget is a files document of the bucket or of its versions.
+type rewrapTarget struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Length    int64              `bson:"length"`
+	ChunkSize int32              `bson:"chunkSize"`
+	Metadata  bson.Raw           `bson:"metadata"`
+}
+
+// Rewrap rewraps the data keys of the names, metadata and data of the files
+// of the bucket and its versions, and of the shard key of the name collection,
+// with rw. Everything is expected to be sealed with envelopes, the names and
+// metadata included. A name encoded in its filename would change with its
+// envelope, and so would the commits that refer to it, so only a bucket that
+// keeps its names in the name collection can be rewrapped.
+//
+// Each value is rewrapped on its own, so a failed rewrap can be run again,
+// after which every value is wrapped for the new recipients.
+func (s *Store) Rewrap(ctx context.Context, rw dcrypto.Rewrapper) (_ int, err error) {
+	defer func() { err = classifyError(err) }()
+
+	if !s.nameIndex.storesNames() {
+		return 0, fmt.Errorf("cannot rewrap a bucket whose names are encoded as %s", s.nameIndex.encoding)
+	}
+
+	files := s.bucket.GetFilesCollection()
+
+	// The chunks are shared by the links to them, so they are rewrapped once
+	// for all of them, after their files documents.
+	data := make(map[primitive.ObjectID]rewrapTarget)
+	count := 0
+
+	for _, coll := range []*mongo.Collection{files, versionsColl(files)} {
+		// The documents are sorted by an ID the rewrap leaves as it is, so
+		// that none is read twice.
+		cur, err := coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+		if err != nil {
+			return count, fmt.Errorf("failed to find files: %w", err)
+		}
+
+		for cur.Next(ctx) {
+			var target rewrapTarget
+			if err := cur.Decode(&target); err != nil {
+				_ = cur.Close(ctx)
+
+				return count, fmt.Errorf("failed to decode file: %w", err)
+			}
+
+			if err := s.rewrapFile(ctx, coll, target, rw); err != nil {
+				_ = cur.Close(ctx)
+
+				return count, err
+			}
+
+			id := target.ID
+			if blob, ok := blobID(target.Metadata); ok {
+				id = blob
+			}
+
+			if _, ok := data[id]; !ok {
+				data[id] = rewrapTarget{ID: id, Length: target.Length, ChunkSize: target.ChunkSize}
+			}
+
+			if coll == files {
+				count++
+			}
+		}
+
+		if err := cur.Close(ctx); err != nil {
+			return count, fmt.Errorf("failed to read files: %w", err)
+		}
+	}
+
+	for _, target := range data {
+		if err := s.rewrapChunks(ctx, target, rw); err != nil {
+			return count, err
+		}
+	}
+
+	if err := s.rewrapShardKey(ctx, rw); err != nil {
+		return count, err
+	}
+
+	// The name index holds the metadata as it was.
+	s.nameIndex.hexName, s.nameIndex.nameDoc = nil, nil
+
+	return count, nil
+}
+
+// rewrapBytes returns the sealed value with its data key rewrapped by rw.
+func rewrapBytes(rw dcrypto.Rewrapper, sealed []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := rw.Rewrap(&buf, bytes.NewReader(sealed)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// rewrapFile rewraps the metadata of the files document in coll, and its
+// name in the name collection.
+func (s *Store) rewrapFile(ctx context.Context, coll *mongo.Collection, target rewrapTarget, rw dcrypto.Rewrapper) error {
+	var meta bson.D
+	if err := bson.Unmarshal(target.Metadata, &meta); err != nil {
+		return fmt.Errorf("failed to unmarshal metadata of %s: %w", target.ID.Hex(), err)
+	}
+
+	for i, elem := range meta {
+		sealed, ok := elem.Value.(primitive.Binary)
+		if elem.Key != metadataKey || !ok {
+			continue
+		}
+
+		rewrapped, err := rewrapBytes(rw, sealed.Data)
+		if err != nil {
+			return fmt.Errorf("failed to rewrap metadata of %s: %w", target.ID.Hex(), err)
+		}
+
+		meta[i].Value = primitive.Binary{Subtype: sealed.Subtype, Data: rewrapped}
+	}
+
+	filter := bson.D{{Key: "_id", Value: target.ID}}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "metadata", Value: meta}}}}
+	if _, err := coll.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to update metadata of %s: %w", target.ID.Hex(), err)
+	}
+
+	var name struct {
+		Data []byte `bson:"data"`
+	}
+
+	err := s.nameIndex.nameColl.FindOne(ctx, filter).Decode(&name)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to find name of %s: %w", target.ID.Hex(), err)
+	}
+
+	rewrapped, err := rewrapBytes(rw, name.Data)
+	if err != nil {
+		return fmt.Errorf("failed to rewrap name of %s: %w", target.ID.Hex(), err)
+	}
+
+	update = bson.D{{Key: "$set", Value: bson.D{{Key: "data", Value: rewrapped}}}}
+	if _, err := s.nameIndex.nameColl.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to update name of %s: %w", target.ID.Hex(), err)
+	}
+
+	return nil
+}
+
+// rewrapChunks rewraps the data held by the chunks with the ID of target. The
+// envelope changes size with the recipients, so the data is written to new
+// chunks, which replace the old ones once all of them are written.
+func (s *Store) rewrapChunks(ctx context.Context, target rewrapTarget, rw dcrypto.Rewrapper) error {
+	if target.Length == 0 {
+		return nil
+	}
+
+	src, err := openDownloadAt(ctx, s.bucket, gridfs.File{ID: target.ID, Length: target.Length, ChunkSize: target.ChunkSize}, 0)
+	if err != nil {
+		return fmt.Errorf("failed to read data of %s: %w", target.ID.Hex(), err)
+	}
+
+	defer src.Close()
+
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		pw.CloseWithError(rw.Rewrap(pw, src))
+	}()
+
+	chunks := s.bucket.GetChunksCollection()
+	tmpID := primitive.NewObjectID()
+
+	length, err := writeChunks(ctx, chunks, tmpID, pr, target.ChunkSize)
+
+	// Stop the rewrap if the chunks failed to be written, before its source
+	// is closed.
+	_ = pr.Close()
+	<-done
+
+	if err != nil {
+		err = fmt.Errorf("failed to rewrap data of %s: %w", target.ID.Hex(), err)
+
+		if _, delErr := chunks.DeleteMany(ctx, bson.D{{Key: "files_id", Value: tmpID}}); delErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to delete rewrapped chunks: %w", delErr))
+		}
+
+		return err
+	}
+
+	files := s.bucket.GetFilesCollection()
+
+	// The files documents of the data, and the links to it, take the length
+	// of the rewrapped data along with it.
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		if _, err := chunks.DeleteMany(ctx, bson.D{{Key: "files_id", Value: target.ID}}); err != nil {
+			return fmt.Errorf("failed to delete chunks of %s: %w", target.ID.Hex(), err)
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "files_id", Value: target.ID}}}}
+		if _, err := chunks.UpdateMany(ctx, bson.D{{Key: "files_id", Value: tmpID}}, update); err != nil {
+			return fmt.Errorf("failed to replace chunks of %s: %w", target.ID.Hex(), err)
+		}
+
+		filter := bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "_id", Value: target.ID}},
+			bson.D{{Key: "metadata." + blobKey, Value: target.ID}},
+		}}}
+
+		update = bson.D{{Key: "$set", Value: bson.D{{Key: "length", Value: length}}}}
+
+		for _, coll := range []*mongo.Collection{files, versionsColl(files)} {
+			if _, err := coll.UpdateMany(ctx, filter, update); err != nil {
+				return fmt.Errorf("failed to update length of %s: %w", target.ID.Hex(), err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// writeChunks writes r to chunks of chunkSize bytes with the files ID,
+// returning the number of bytes written.
+func writeChunks(ctx context.Context, chunks *mongo.Collection, id primitive.ObjectID, r io.Reader, chunkSize int32) (int64, error) {
+	buf := make([]byte, chunkSize)
+
+	var length int64
+
+	for n := int32(0); ; n++ {
+		read, err := io.ReadFull(r, buf)
+		if read > 0 {
+			chunk := bson.D{
+				{Key: "files_id", Value: id},
+				{Key: "n", Value: n},
+				{Key: "data", Value: buf[:read]},
+			}
+
+			if _, err := chunks.InsertOne(ctx, chunk); err != nil {
+				return length, fmt.Errorf("failed to insert chunk %d: %w", n, err)
+			}
+
+			length += int64(read)
+		}
+
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return length, nil
+		}
+
+		if err != nil {
+			return length, err
+		}
+	}
+}
+
+// rewrapShardKey rewraps the key that names are hashed into shards with, if
+// the name collection is sharded.
+func (s *Store) rewrapShardKey(ctx context.Context, rw dcrypto.Rewrapper) error {
+	settings, err := loadNameSettings(ctx, s.nameIndex.settingsColl)
+	if err != nil {
+		return err
+	}
+
+	if len(settings.Key) == 0 {
+		return nil
+	}
+
+	key, err := rewrapBytes(rw, settings.Key)
+	if err != nil {
+		return fmt.Errorf("failed to rewrap shard key: %w", err)
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "key", Value: key}}}}
+	if _, err := s.nameIndex.settingsColl.UpdateOne(ctx, bson.D{{Key: "_id", Value: nameSettingsID}}, update); err != nil {
+		return fmt.Errorf("failed to update shard key: %w", err)
+	}
+
+	return nil
+}
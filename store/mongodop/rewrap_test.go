@@ -0,0 +1,60 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestWriteChunks(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("splits the data into chunks", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+
+		for range 3 {
+			mt.AddMockResponses(mtest.CreateSuccessResponse())
+		}
+
+		length, err := writeChunks(context.Background(), mt.Coll, id, strings.NewReader("0123456789"), 4)
+		require.NoError(mt, err)
+		assert.Equal(mt, int64(10), length)
+
+		chunks := insertedDocuments(mt, mt.Coll.Name())
+		require.Len(mt, chunks, 3)
+
+		for i, want := range []string{"0123", "4567", "89"} {
+			assert.Equal(mt, id, chunks[i].Lookup("files_id").ObjectID())
+			assert.Equal(mt, int32(i), chunks[i].Lookup("n").Int32())
+
+			_, data := chunks[i].Lookup("data").Binary()
+			assert.Equal(mt, want, string(data))
+		}
+	})
+
+	mt.Run("fails with the insert", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+
+		_, err := writeChunks(context.Background(), mt.Coll, primitive.NewObjectID(), strings.NewReader("0123456789"), 4)
+		assert.ErrorContains(mt, err, "failed to insert chunk 0")
+	})
+}
@@ -0,0 +1,194 @@
+//
+// Copyright 2024 Preston Vasquez
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultSettingsCollectionName is the collection holding one settings
+// document per bucket.
+const DefaultSettingsCollectionName = "settings"
+
+const (
+	// FormatVersionLegacy is the layout of buckets created before format
+	// versions were recorded.
+	FormatVersionLegacy = 1
+
+	// FormatVersionContentHash adds a SHA-256 hash of the plaintext to the
+	// metadata of every file.
+	FormatVersionContentHash = 2
+
+	// CurrentFormatVersion is the newest layout this client understands.
+	CurrentFormatVersion = FormatVersionContentHash
+)
+
+var (
+	// ErrCipherMismatch is returned by Connect when the cipher configured on
+	// the client does not match the cipher the bucket was encrypted with.
+	ErrCipherMismatch = errors.New("cipher does not match the bucket")
+
+	// ErrFormatTooNew is returned by Connect when the bucket was written by a
+	// newer client.
+	ErrFormatTooNew = errors.New("bucket format is newer than this client supports")
+)
+
+// Settings is the bucket-level configuration shared by every client of a
+// bucket. It is written the first time a bucket is connected to.
+type Settings struct {
+	Bucket        string    `bson:"_id"`
+	FormatVersion int       `bson:"formatVersion"`
+	Cipher        string    `bson:"cipher,omitempty"`
+	NonceSize     int       `bson:"nonceSize,omitempty"`
+	ChunkSize     int32     `bson:"chunkSize"`
+	CreatedAt     time.Time `bson:"createdAt"`
+	NameEncoding  string    `bson:"nameEncoding,omitempty"` // Defaults to NameEncodingObjectID
+
+	// ExcludePatterns are the glob patterns of the names of the files that
+	// pulls leave out. See store.Excluder.
+	ExcludePatterns []string `bson:"excludePatterns,omitempty"`
+}
+
+// settingsStore reads and writes the settings document for a bucket.
+type settingsStore struct {
+	coll     *mongo.Collection
+	fileColl *mongo.Collection
+	bucket   string
+	readOnly bool // Settings are not written
+}
+
+// load returns the settings for the bucket, writing the defaults if the
+// bucket does not have any yet, unless the store is read-only. A bucket that
+// already holds files but has no settings predates format versions and is
+// marked as legacy.
+func (ss *settingsStore) load(ctx context.Context) (*Settings, error) {
+	s := &Settings{}
+
+	err := ss.coll.FindOne(ctx, bson.D{{Key: "_id", Value: ss.bucket}}).Decode(s)
+	if err == nil {
+		if s.FormatVersion == 0 {
+			s.FormatVersion = FormatVersionLegacy
+		}
+
+		return s, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	fileCount, err := ss.fileColl.CountDocuments(ctx, bson.D{}, options.Count().SetLimit(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to count files: %w", err)
+	}
+
+	formatVersion := CurrentFormatVersion
+	if fileCount > 0 {
+		formatVersion = FormatVersionLegacy
+	}
+
+	if ss.readOnly {
+		return &Settings{FormatVersion: formatVersion, ChunkSize: gridfs.DefaultChunkSize}, nil
+	}
+
+	// Another client may write the settings first, in which case its
+	// settings are returned.
+	defaults := bson.D{{Key: "$setOnInsert", Value: bson.D{
+		{Key: "formatVersion", Value: formatVersion},
+		{Key: "chunkSize", Value: gridfs.DefaultChunkSize},
+		{Key: "createdAt", Value: time.Now().UTC()},
+	}}}
+
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	err = ss.coll.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: ss.bucket}}, defaults, opts).Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	if s.FormatVersion == 0 {
+		s.FormatVersion = FormatVersionLegacy
+	}
+
+	return s, nil
+}
+
+// set updates the given fields of the settings document.
+func (ss *settingsStore) set(ctx context.Context, fields bson.D) error {
+	_, err := ss.coll.UpdateByID(ctx, ss.bucket, bson.D{{Key: "$set", Value: fields}})
+	if err != nil {
+		return fmt.Errorf("failed to update settings: %w", err)
+	}
+
+	return nil
+}
+
+// checkCipher compares the cipher recorded for the bucket against the one the
+// client is configured with. The first encrypted connection to a bucket
+// records its cipher.
+func (s *Store) checkCipher(ctx context.Context, cipher string, nonceSize int) error {
+	if s.settings.Cipher == "" && s.settingsStore.readOnly {
+		return nil
+	}
+
+	if s.settings.Cipher == "" {
+		fields := bson.D{
+			{Key: "cipher", Value: cipher},
+			{Key: "nonceSize", Value: nonceSize},
+		}
+
+		if err := s.settingsStore.set(ctx, fields); err != nil {
+			return fmt.Errorf("failed to record cipher: %w", err)
+		}
+
+		s.settings.Cipher = cipher
+		s.settings.NonceSize = nonceSize
+
+		return nil
+	}
+
+	if s.settings.Cipher != cipher || s.settings.NonceSize != nonceSize {
+		return fmt.Errorf("%w: bucket %q uses %s with a %d-byte nonce, client is configured for %s with a %d-byte nonce",
+			ErrCipherMismatch, s.bucketName, s.settings.Cipher, s.settings.NonceSize, cipher, nonceSize)
+	}
+
+	return nil
+}
+
+// checkFormatVersion returns an error if the bucket was written by a newer
+// client.
+func (s *Store) checkFormatVersion() error {
+	if s.settings.FormatVersion > CurrentFormatVersion {
+		return fmt.Errorf("%w: bucket %q uses format version %d, this client supports up to %d; upgrade diskhop",
+			ErrFormatTooNew, s.bucketName, s.settings.FormatVersion, CurrentFormatVersion)
+	}
+
+	return nil
+}
+
+// Settings returns the settings of the connected bucket.
+func (s *Store) Settings() Settings {
+	return *s.settings
+}
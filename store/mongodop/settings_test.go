@@ -0,0 +1,123 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSettingsLoad(t *testing.T) {
+	mt := newMockTest(t)
+
+	newSettingsStore := func(mt *mtest.T, readOnly bool) *settingsStore {
+		return &settingsStore{
+			coll:     mt.DB.Collection(DefaultSettingsCollectionName),
+			fileColl: mt.DB.Collection("fs.files"),
+			bucket:   "fs",
+			readOnly: readOnly,
+		}
+	}
+
+	// writes returns the names of the write commands that were sent.
+	writes := func(mt *mtest.T) []string {
+		var names []string
+
+		for _, evt := range mt.GetAllStartedEvents() {
+			switch evt.CommandName {
+			case "findAndModify", "update", "insert", "delete":
+				names = append(names, evt.CommandName)
+			}
+		}
+
+		return names
+	}
+
+	mt.Run("existing settings are only read", func(mt *mtest.T) {
+		ns := mt.DB.Name() + "." + DefaultSettingsCollectionName
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: "fs"},
+			{Key: "formatVersion", Value: CurrentFormatVersion},
+			{Key: "chunkSize", Value: int32(1024)},
+		}))
+
+		s, err := newSettingsStore(mt, false).load(context.Background())
+		require.NoError(mt, err)
+
+		assert.Equal(mt, int32(1024), s.ChunkSize)
+		assert.Empty(mt, writes(mt))
+	})
+
+	mt.Run("read-only connections do not write the defaults", func(mt *mtest.T) {
+		ns := mt.DB.Name() + "." + DefaultSettingsCollectionName
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.files", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+
+		s, err := newSettingsStore(mt, true).load(context.Background())
+		require.NoError(mt, err)
+
+		assert.Equal(mt, FormatVersionLegacy, s.FormatVersion)
+		assert.Empty(mt, writes(mt))
+	})
+
+	mt.Run("missing settings are written", func(mt *mtest.T) {
+		ns := mt.DB.Name() + "." + DefaultSettingsCollectionName
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.files", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: bson.D{
+				{Key: "_id", Value: "fs"},
+				{Key: "formatVersion", Value: CurrentFormatVersion},
+				{Key: "chunkSize", Value: int32(1024)},
+			}}),
+		)
+
+		s, err := newSettingsStore(mt, false).load(context.Background())
+		require.NoError(mt, err)
+
+		assert.Equal(mt, CurrentFormatVersion, s.FormatVersion)
+		assert.Equal(mt, []string{"findAndModify"}, writes(mt))
+	})
+}
+
+func TestReadOnlyNameEncoding(t *testing.T) {
+	mt := newMockTest(t)
+
+	mt.Run("an empty bucket takes the encoding without recording it", func(mt *mtest.T) {
+		s := &Store{
+			bucketName:    "fs",
+			settings:      &Settings{},
+			settingsStore: &settingsStore{coll: mt.DB.Collection(DefaultSettingsCollectionName), readOnly: true},
+			nameIndex:     &nameIndex{coll: mt.DB.Collection("fs.files")},
+		}
+
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, mt.DB.Name()+".fs.files", mtest.FirstBatch))
+
+		require.NoError(mt, s.checkNameEncoding(context.Background(), NameEncodingCiphertext))
+
+		assert.Equal(mt, NameEncodingCiphertext, s.nameIndex.encoding)
+		assert.Empty(mt, sentCommands(mt, "update", DefaultSettingsCollectionName))
+	})
+}
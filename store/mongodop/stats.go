@@ -0,0 +1,72 @@
+//
+// Copyright 2024 Preston Vasquez
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Stats returns the number and total stored size of the files in the bucket.
+// Only the files collection is read, so no key is required.
+func (s *Store) Stats(ctx context.Context) (_ *store.Stats, err error) {
+	defer func() { err = classifyError(err) }()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "size", Value: bson.D{{Key: "$sum", Value: "$length"}}},
+		}}},
+	}
+
+	cur, err := s.nameIndex.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate file stats: %w", err)
+	}
+
+	defer cur.Close(ctx)
+
+	stats := &store.Stats{
+		FormatVersion: s.settings.FormatVersion,
+		NameEncoding:  s.nameIndex.encoding,
+	}
+
+	if !cur.Next(ctx) {
+		if err := cur.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read file stats: %w", err)
+		}
+
+		return stats, nil
+	}
+
+	var result struct {
+		Count int64 `bson:"count"`
+		Size  int64 `bson:"size"`
+	}
+
+	if err := cur.Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode file stats: %w", err)
+	}
+
+	stats.FileCount = result.Count
+	stats.TotalSize = result.Size
+
+	return stats, nil
+}
@@ -15,12 +15,17 @@
 package mongodop
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"fmt"
 	"io"
 	"math/big"
+	"path/filepath"
+	"slices"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/prestonvasquez/diskhop/exp/dcrypto"
@@ -31,6 +36,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/gridfs"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 const (
@@ -51,7 +58,12 @@ type Store struct {
 	ivPusher    *IVPusher
 	nameIndex   *nameIndex
 	commits     []*store.Commit
+	commitsMu   sync.Mutex
+	flushMu     sync.Mutex // Serializes flushes, so that each commit is dropped once
 	client      *mongo.Client
+
+	settingsStore *settingsStore
+	settings      *Settings
 }
 
 var (
@@ -60,11 +72,146 @@ var (
 	_ dcrypto.IVManagerGetter = &Store{}
 	_ store.Closer            = &Store{}
 	_ store.Commiter          = &Store{}
+	_ store.CommitAmender     = &Store{}
 	_ store.Reverter          = &Store{}
+	_ store.Upgrader          = &Store{}
+	_ store.Stater            = &Store{}
 )
 
+// ConnectOptions are the options for connecting to a MongoDB store.
+type ConnectOptions struct {
+	// Cipher and NonceSize identify the encryption used by the client. If
+	// Cipher is set, Connect verifies that it matches the bucket.
+	Cipher    string
+	NonceSize int
+
+	WriteConcern   *writeconcern.WriteConcern // Defaults to majority
+	ReadPreference *readpref.ReadPref         // Defaults to primary
+
+	// Versions is whether and how many of the versions replaced by pushes
+	// are kept. Defaults to keeping none.
+	Versions VersionPolicy
+
+	// NameEncoding is how the names of the files are stored in GridFS.
+	// Defaults to the encoding of the bucket.
+	NameEncoding string
+
+	// NameShards is the number of shards the name collection is split into.
+	// Defaults to that of the name collection.
+	NameShards int
+
+	// NameCache keeps the decrypted names between connections. Defaults to
+	// loading them from the remote every time.
+	NameCache NameCache
+
+	// SpillDir is the directory in which bodies that cannot seek, such as
+	// files sealed as a stream, are spilled before they are uploaded, so that
+	// their uploads can resume. Defaults to uploading them once.
+	SpillDir string
+
+	// ReadOnly connects without writing to the deployment, for clients that
+	// do not push. Settings a bucket does not record yet, such as its cipher
+	// and name encoding, are taken from the client rather than recorded.
+	ReadOnly bool
+}
+
+// ConnectOption is a function that configures ConnectOptions.
+type ConnectOption func(*ConnectOptions)
+
+// WithCipher verifies on Connect that the bucket was encrypted with the given
+// cipher and nonce size, recording them if the bucket has no cipher yet.
+func WithCipher(name string, nonceSize int) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.Cipher = name
+		o.NonceSize = nonceSize
+	}
+}
+
+// WithWriteConcern sets the write concern for every write to the store.
+func WithWriteConcern(wc *writeconcern.WriteConcern) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.WriteConcern = wc
+	}
+}
+
+// WithReadPreference sets the read preference for every read from the store.
+// Reading from secondaries may return stale data, so only use a non-primary
+// read preference for connections that do not push, such as pulls.
+func WithReadPreference(rp *readpref.ReadPref) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.ReadPreference = rp
+	}
+}
+
+// WithSpillDir spills the bodies that cannot seek to temporary files in dir
+// before uploading them, so that their uploads resume on transient errors.
+func WithSpillDir(dir string) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.SpillDir = dir
+	}
+}
+
+// WithReadOnly connects without writing to the deployment, so the connection
+// must only be used to read from the store.
+func WithReadOnly() ConnectOption {
+	return func(o *ConnectOptions) {
+		o.ReadOnly = true
+	}
+}
+
+// database returns a handle to the named database with the write concern and
+// read preference applied.
+func (o ConnectOptions) database(client *mongo.Client, name string) *mongo.Database {
+	wc := o.WriteConcern
+	if wc == nil {
+		wc = writeconcern.Majority()
+	}
+
+	dbOpts := options.Database().SetWriteConcern(wc)
+	if o.ReadPreference != nil {
+		dbOpts.SetReadPreference(o.ReadPreference)
+	}
+
+	return client.Database(name, dbOpts)
+}
+
+// ValidateConnString checks that connStr is a well-formed MongoDB connection
+// string, without connecting to the deployment.
+func ValidateConnString(connStr string) error {
+	if err := options.Client().ApplyURI(connStr).Validate(); err != nil {
+		return fmt.Errorf("invalid MongoDB connection string: %w", err)
+	}
+
+	return nil
+}
+
+// Ping connects to the deployment at connStr and checks that it responds.
+func Ping(ctx context.Context, connStr string) (err error) {
+	defer func() { err = classifyError(err) }()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(connStr))
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	defer func() { _ = client.Disconnect(ctx) }()
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("failed to ping MongoDB server: %w", err)
+	}
+
+	return nil
+}
+
 // Connect will establish a connection to a MongoDB database.
-func Connect(ctx context.Context, connStr, db, bucketName string) (*Store, error) {
+func Connect(ctx context.Context, connStr, db, bucketName string, connectOpts ...ConnectOption) (_ *Store, err error) {
+	defer func() { err = classifyError(err) }()
+
+	copts := ConnectOptions{}
+	for _, fn := range connectOpts {
+		fn(&copts)
+	}
+
 	opts := options.Client().ApplyURI(connStr)
 
 	client, err := mongo.Connect(ctx, opts)
@@ -77,32 +224,91 @@ func Connect(ctx context.Context, connStr, db, bucketName string) (*Store, error
 		return nil, fmt.Errorf("failed to ping MongoDB server: %w", err)
 	}
 
+	database := copts.database(client, db)
+
+	fileColl := database.Collection(bucketName + "." + "files")
+
+	settingsStore := &settingsStore{
+		coll:     database.Collection(DefaultSettingsCollectionName),
+		fileColl: fileColl,
+		bucket:   bucketName,
+		readOnly: copts.ReadOnly,
+	}
+
+	settings, err := settingsStore.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	bucket, err := gridfs.NewBucket(
-		client.Database(db),
-		options.GridFSBucket().SetName(bucketName))
+		database,
+		options.GridFSBucket().
+			SetName(bucketName).
+			SetChunkSizeBytes(settings.ChunkSize))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bucket: %w", err)
 	}
 
-	ivPusher := &IVPusher{coll: client.Database(db).Collection("initvectors")}
+	ivPusher := &IVPusher{coll: database.Collection("initvectors")}
 
-	fileColl := client.Database(db).Collection(bucketName + "." + "files")
-	nameColl := client.Database(db).Collection(DefaultNameCollectionName)
-	commitsColl := client.Database(db).Collection("commits")
+	nameColl := database.Collection(DefaultNameCollectionName)
+	commitsColl := database.Collection("commits")
 
-	nameIndex := &nameIndex{coll: fileColl, nameColl: nameColl}
+	nameIndex := &nameIndex{
+		coll:         fileColl,
+		nameColl:     nameColl,
+		settingsColl: settingsStore.coll,
+		cache:        copts.NameCache,
+		readOnly:     copts.ReadOnly,
+	}
+
+	transactions := supportsTransactions(ctx, client)
 
 	mongoStore := &Store{
 		Pusher: Pusher{
-			nameIndex: nameIndex,
-			bucket:    bucket,
+			nameIndex:    nameIndex,
+			bucket:       bucket,
+			chunkSize:    settings.ChunkSize,
+			client:       client,
+			transactions: transactions,
+			versions:     copts.Versions,
+			ivPusher:     ivPusher,
+			spillDir:     copts.SpillDir,
 		},
-		bucket:      bucket,
-		bucketName:  bucketName,
-		commitsColl: commitsColl,
-		ivPusher:    ivPusher,
-		nameIndex:   nameIndex,
-		client:      client,
+		bucket:        bucket,
+		bucketName:    bucketName,
+		commitsColl:   commitsColl,
+		ivPusher:      ivPusher,
+		nameIndex:     nameIndex,
+		client:        client,
+		settingsStore: settingsStore,
+		settings:      settings,
+	}
+
+	if err := mongoStore.checkFormatVersion(); err != nil {
+		return nil, err
+	}
+
+	if copts.Cipher != "" {
+		if err := mongoStore.checkCipher(ctx, copts.Cipher, copts.NonceSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateNameEncoding(copts.NameEncoding); err != nil {
+		return nil, err
+	}
+
+	if err := mongoStore.checkNameEncoding(ctx, copts.NameEncoding); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateNameShards(copts.NameShards); err != nil {
+		return nil, err
+	}
+
+	if err := mongoStore.checkNameShards(ctx, copts.NameShards); err != nil {
+		return nil, err
 	}
 
 	return mongoStore, nil
@@ -132,27 +338,59 @@ func randomSubset(files []gridfs.File, size int) ([]gridfs.File, error) {
 	return chosen, nil
 }
 
+// findFiles selects the files of the pull, filtering and sampling them unless
+// they are named. The files whose names match a pattern of the exclude policy
+// are left out of the selection unless the pull includes them.
 func findFiles(
 	ctx context.Context,
 	nidx *nameIndex,
 	bucket *gridfs.Bucket,
+	policy []string,
 	opts store.PullOptions,
-) ([]gridfs.File, error) {
+) ([]gridfs.File, []store.FileExplanation, error) {
+	if len(opts.Names) > 0 {
+		return findNamedFiles(ctx, nidx, bucket, opts)
+	}
+
+	if opts.IncludeExcluded {
+		policy = nil
+	}
+
 	docs := make([]filter.Document, 0, len(nidx.nameToDoc))
+	candidates := make([]filter.Document, 0, len(nidx.nameToDoc))
+	policyExcluded := map[string]bool{}
+
 	for decryptedFileName, file := range nidx.nameToDoc {
+		name, ok := trimPrefix(opts.Prefix, decryptedFileName)
+		if !ok {
+			continue
+		}
+
 		_, gfsMeta, _ := nidx.nameDoc.get(decryptedFileName)
 
-		docs = append(docs, filter.Document{
+		doc := filter.Document{
 			EncodedName: file.Name,
-			Name:        decryptedFileName,
+			Name:        name,
 			Tags:        gfsMeta.Diskhop.Tags,
 			Size:        file.Length,
-		})
+			Batch:       gfsMeta.Diskhop.Batch,
+			Label:       gfsMeta.Diskhop.Label,
+		}
+
+		docs = append(docs, doc)
+
+		if excludedByPolicy(policy, decryptedFileName) {
+			policyExcluded[doc.EncodedName] = true
+
+			continue
+		}
+
+		candidates = append(candidates, doc)
 	}
 
-	filteredDocs, err := filter.FilterDocuments(opts.Filter, docs)
+	filteredDocs, err := filter.FilterDocuments(opts.Filter, candidates)
 	if err != nil {
-		return nil, fmt.Errorf("failed to filter documents: %w", err)
+		return nil, nil, fmt.Errorf("failed to filter documents: %w", err)
 	}
 
 	filteredNames := make([]string, 0, len(docs))
@@ -160,8 +398,10 @@ func findFiles(
 		filteredNames = append(filteredNames, doc.EncodedName)
 	}
 
-	if len(filteredNames) == 0 && opts.Filter != "" {
-		return nil, nil
+	// Without names to select, every file of the bucket would be found, so
+	// a pull whose files are all filtered or excluded finds none.
+	if len(filteredNames) == 0 && (opts.Filter != "" || opts.Prefix != "" || len(policyExcluded) > 0) {
+		return nil, explainSelection(opts, docs, filteredDocs, policyExcluded, nil, nil), checkSingle(opts, 0)
 	}
 
 	filter := bson.D{}
@@ -171,32 +411,39 @@ func findFiles(
 
 	cur, err := bucket.Find(filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find documents: %w", err)
+		return nil, nil, fmt.Errorf("failed to find documents: %w", err)
 	}
 
 	gfiles := []gridfs.File{}
 	for cur.Next(ctx) {
 		f := gridfs.File{}
 		if err := cur.Decode(&f); err != nil {
-			return nil, fmt.Errorf("failed to decode document: %w", err)
+			return nil, nil, fmt.Errorf("failed to decode document: %w", err)
 		}
 
 		gfiles = append(gfiles, f)
 	}
 
+	if err := checkSingle(opts, len(gfiles)); err != nil {
+		return nil, nil, err
+	}
+
+	gfiles, excluded := excludeFiles(nidx, gfiles, opts.Prefix, opts.Exclude)
+
 	sampleSize := opts.SampleSize
 	if sampleSize == 0 {
 		sampleSize = store.DefaultSampleSize
 	}
 
-	if opts.DescribeOnly {
+	// An explanation shows the sampling that a pull would do.
+	if opts.DescribeOnly && !opts.Explain {
 		sampleSize = len(gfiles)
 	}
 
 	chosen, err := randomSubset(gfiles, sampleSize)
 	// Select a random sample of files.
 	if err != nil {
-		return nil, fmt.Errorf("failed to select random subset of files: %w", err)
+		return nil, nil, fmt.Errorf("failed to select random subset of files: %w", err)
 	}
 
 	// Sort the chosen files from smallest to largest to ensure that the maximum
@@ -206,7 +453,248 @@ func findFiles(
 		return chosen[i].Length < chosen[j].Length
 	})
 
-	return chosen, nil
+	return chosen, explainSelection(opts, docs, filteredDocs, policyExcluded, excluded, chosen), nil
+}
+
+// excludedByPolicy reports whether the name matches a pattern of the exclude
+// policy. The patterns are validated when the policy is set.
+func excludedByPolicy(policy []string, name string) bool {
+	for _, pattern := range policy {
+		if match, _ := filter.MatchGlob(pattern, name); match {
+			return true
+		}
+	}
+
+	return false
+}
+
+// excludeFiles removes the files with the excluded names from files and
+// returns the names it removed. If every file is excluded, it returns all of
+// them, so that sampling without repetition starts over.
+func excludeFiles(
+	nidx *nameIndex,
+	files []gridfs.File,
+	prefix string,
+	exclude []string,
+) ([]gridfs.File, map[string]bool) {
+	if len(exclude) == 0 {
+		return files, nil
+	}
+
+	excludeSet := make(map[string]bool, len(exclude))
+	for _, name := range exclude {
+		excludeSet[name] = true
+	}
+
+	remaining := make([]gridfs.File, 0, len(files))
+	excluded := make(map[string]bool)
+
+	for _, file := range files {
+		name := prefixedName(nidx, prefix, file)
+		if excludeSet[name] {
+			excluded[name] = true
+
+			continue
+		}
+
+		remaining = append(remaining, file)
+	}
+
+	if len(remaining) == 0 {
+		return files, nil
+	}
+
+	return remaining, excluded
+}
+
+// explainSelection returns, if the pull is explained, why each candidate
+// document was or was not chosen. The documents left out by the exclude policy
+// are keyed by their encoded names.
+func explainSelection(
+	opts store.PullOptions,
+	docs, matched []filter.Document,
+	policyExcluded, excluded map[string]bool,
+	chosen []gridfs.File,
+) []store.FileExplanation {
+	if !opts.Explain {
+		return nil
+	}
+
+	matchedSet := make(map[string]bool, len(matched))
+	for _, doc := range matched {
+		matchedSet[doc.EncodedName] = true
+	}
+
+	chosenSet := make(map[string]bool, len(chosen))
+	for _, file := range chosen {
+		chosenSet[file.Name] = true
+	}
+
+	explanations := make([]store.FileExplanation, 0, len(docs))
+	for _, doc := range docs {
+		explanation := store.FileExplanation{
+			Name:    doc.Name,
+			Size:    doc.Size,
+			Matched: matchedSet[doc.EncodedName],
+			Sampled: chosenSet[doc.EncodedName],
+		}
+
+		switch {
+		case policyExcluded[doc.EncodedName]:
+			explanation.Reason = "excluded by policy"
+		case !explanation.Matched:
+			explanation.Reason = "rejected by filter"
+		case excluded[doc.Name]:
+			explanation.Reason = "already pulled"
+		case !explanation.Sampled:
+			explanation.Reason = "not in random sample"
+		default:
+			explanation.Reason = "selected"
+		}
+
+		explanations = append(explanations, explanation)
+	}
+
+	sort.Slice(explanations, func(i, j int) bool {
+		return explanations[i].Name < explanations[j].Name
+	})
+
+	return explanations
+}
+
+// findNamedFiles resolves the files requested by name through the name
+// index, without filtering or sampling.
+func findNamedFiles(
+	ctx context.Context,
+	nidx *nameIndex,
+	bucket *gridfs.Bucket,
+	opts store.PullOptions,
+) ([]gridfs.File, []store.FileExplanation, error) {
+	encodedNames := make([]string, 0, len(opts.Names))
+	for _, name := range opts.Names {
+		file, _, ok := nidx.nameDoc.get(withPrefix(opts.Prefix, name))
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: %s", store.ErrFileNotFound, name)
+		}
+
+		encodedNames = append(encodedNames, file.Name)
+	}
+
+	filter := bson.D{{Key: "filename", Value: bson.D{{Key: "$in", Value: encodedNames}}}}
+
+	cur, err := bucket.Find(filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find documents: %w", err)
+	}
+
+	gfiles := []gridfs.File{}
+	if err := cur.All(ctx, &gfiles); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	if err := checkSingle(opts, len(gfiles)); err != nil {
+		return nil, nil, err
+	}
+
+	sort.Slice(gfiles, func(i, j int) bool {
+		return gfiles[i].Length < gfiles[j].Length
+	})
+
+	var explanations []store.FileExplanation
+	if opts.Explain {
+		for _, file := range gfiles {
+			explanations = append(explanations, store.FileExplanation{
+				Name:    prefixedName(nidx, opts.Prefix, file),
+				Size:    file.Length,
+				Matched: true,
+				Sampled: true,
+				Reason:  "requested by name",
+			})
+		}
+	}
+
+	return gfiles, explanations, nil
+}
+
+// checkSingle returns an error if a single-file pull matched n != 1 files.
+func checkSingle(opts store.PullOptions, n int) error {
+	if opts.Single && n != 1 {
+		return fmt.Errorf("%w: matched %d files", store.ErrNotSingleMatch, n)
+	}
+
+	return nil
+}
+
+// prefixedName returns the decrypted name of the file relative to prefix.
+func prefixedName(nidx *nameIndex, prefix string, file gridfs.File) string {
+	stored, _ := nidx.hexName.get(file.Name)
+	name, _ := trimPrefix(prefix, stored)
+
+	return name
+}
+
+// describeFiles returns a description of each file using the decrypted names,
+// relative to prefix, and metadata from the name index.
+func describeFiles(nidx *nameIndex, prefix string, files []gridfs.File) []store.FileDescription {
+	descs := make([]store.FileDescription, 0, len(files))
+	for _, file := range files {
+		var tags []string
+		if gfsMeta, ok := indexedMetadata(nidx, file); ok {
+			tags = gfsMeta.Diskhop.Tags
+		}
+
+		descs = append(descs, store.FileDescription{
+			Name:       prefixedName(nidx, prefix, file),
+			Size:       file.Length,
+			Tags:       tags,
+			UploadDate: file.UploadDate,
+		})
+	}
+
+	return descs
+}
+
+// pullSize returns the number of bytes in the files once decrypted.
+func pullSize(nidx *nameIndex, files []gridfs.File) int64 {
+	var size int64
+	for _, file := range files {
+		size += fileSize(nidx, file)
+	}
+
+	return size
+}
+
+// fileSize returns the number of bytes in the file once decrypted, using the
+// size of the encrypted file when the plaintext size was not recorded.
+func fileSize(nidx *nameIndex, file gridfs.File) int64 {
+	if gfsMeta, ok := indexedMetadata(nidx, file); ok && gfsMeta.Diskhop.Size > 0 {
+		return gfsMeta.Diskhop.Size
+	}
+
+	return file.Length
+}
+
+// describeSizes summarizes the sizes of the files from the name index, without
+// downloading them.
+func describeSizes(nidx *nameIndex, files []gridfs.File) *store.SizeStats {
+	stats := &store.SizeStats{Files: len(files)}
+	if len(files) == 0 {
+		return stats
+	}
+
+	stats.Min = fileSize(nidx, files[0])
+
+	for _, file := range files {
+		size := fileSize(nidx, file)
+
+		stats.Bytes += size
+		stats.Min = min(stats.Min, size)
+		stats.Max = max(stats.Max, size)
+	}
+
+	stats.Avg = stats.Bytes / int64(len(files))
+
+	return stats
 }
 
 // Close will flush the nameIndex.
@@ -215,16 +703,28 @@ func (s *Store) Close(ctx context.Context) error {
 		return err
 	}
 
+	if closer, ok := s.nameIndex.cache.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("failed to close name cache: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // Pull will retrieve a slice of documents from a remote host.
-func (s *Store) Pull(ctx context.Context, buf store.DocumentBuffer, setters ...store.PullOption) (*store.PullDescription, error) {
+func (s *Store) Pull(ctx context.Context, buf store.DocumentBuffer, setters ...store.PullOption) (_ *store.PullDescription, err error) {
+	defer func() { err = classifyError(err) }()
+
 	opts := store.PullOptions{}
 	for _, fn := range setters {
 		fn(&opts)
 	}
 
+	if opts.Raw {
+		return s.rawPull(ctx, buf, opts)
+	}
+
 	if opts.SealOpener != nil {
 		return s.EncryptedPull(ctx, buf, setters...)
 	}
@@ -234,9 +734,65 @@ func (s *Store) Pull(ctx context.Context, buf store.DocumentBuffer, setters ...s
 	return nil, nil
 }
 
+// maskName returns a random name for a file that keeps the extension of the
+// original name, so that the file type can still be recognized.
+func maskName(name string) string {
+	return uuid.New().String() + filepath.Ext(name)
+}
+
+// budgetedBody is the body of a file held in memory, which releases its bytes
+// from the memory budget once it is closed.
+type budgetedBody struct {
+	*bytes.Reader
+
+	budget *store.MemoryBudget
+	held   int64
+	once   sync.Once
+}
+
+func (b *budgetedBody) Close() error {
+	b.once.Do(func() { b.budget.Release(b.held) })
+
+	return nil
+}
+
 type errorDocument struct {
-	doc store.Document
-	err error
+	doc       store.Document
+	err       error
+	discarded bool // The document was rejected by the content filter
+}
+
+// openFile reads and decrypts the length bytes of a file from stream. Files
+// sealed as a stream are decrypted with opener.
+func openFile(
+	ctx context.Context,
+	opener dcrypto.StreamOpener,
+	streamed bool,
+	stream io.Reader,
+	length int64,
+	opts store.PullOptions,
+) ([]byte, error) {
+	if streamed {
+		buf := bytes.NewBuffer(make([]byte, 0, length))
+		if err := opener.OpenStream(ctx, buf, stream); err != nil {
+			return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(stream, data); err != nil {
+		return nil, fmt.Errorf("failed to read from stream: %w", err)
+	}
+
+	// Decrypt the data.
+	decData, err := opts.SealOpener.Open(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return decData, nil
 }
 
 func encryptedPullWorker(
@@ -246,6 +802,8 @@ func encryptedPullWorker(
 	results chan<- errorDocument,
 	opts store.PullOptions,
 ) {
+	observer := store.Observe(opts.Observer)
+
 	for file := range files {
 		actualName, ok := s.nameIndex.hexName.get(file.Name)
 		if !ok {
@@ -259,40 +817,181 @@ func encryptedPullWorker(
 			s.nameIndex.nameDoc.add(actualName, &file, newGridFSMetadata(nil))
 		}
 
-		docName := actualName
-		if opts.MaskName {
-			docName = uuid.New().String()
+		name, _ := trimPrefix(opts.Prefix, actualName)
+
+		// A version replaced by a later push has metadata of its own.
+		if _, indexed := indexedMetadata(s.nameIndex, file); ok && !indexed {
+			var err error
+
+			gfsMeta, err = decryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), file.Metadata)
+			if err != nil {
+				err = fmt.Errorf("failed to decrypt metadata of %s: %w", actualName, err)
+
+				observer.OnError(name, err)
+				results <- errorDocument{err: err}
+
+				return
+			}
 		}
 
 		doc := &store.Document{
-			Filename: docName,
+			Filename: name,
 			Metadata: gfsMeta.Diskhop,
 		}
 
-		stream, err := s.bucket.OpenDownloadStream(file.ID)
-		if err != nil {
-			results <- errorDocument{err: fmt.Errorf("failed to open download stream: %w", err)}
+		if opts.MaskName {
+			doc.Filename = maskName(name)
+			doc.RealName = name
+		}
 
-			return
+		opener, streamed := opts.SealOpener.(dcrypto.StreamOpener)
+		streamed = streamed && gfsMeta.Diskhop.ChunkSize > 0
+
+		offset := resumeOffset(opts, name, gfsMeta)
+
+		// A file that is not streamed to the consumer is held in memory
+		// whole, as its ciphertext and then its plaintext, until the consumer
+		// is done with it. It waits for room in the memory budget before it
+		// is read.
+		var held int64
+		if offset == 0 && (!streamed || opts.ContentFilter != nil) {
+			held = 2 * file.Length
+
+			if err := opts.MemoryBudget.Acquire(ctx, held); err != nil {
+				results <- errorDocument{err: fmt.Errorf("failed to acquire memory for download: %w", err)}
+
+				return
+			}
 		}
 
-		data := make([]byte, file.Length)
-		if _, err := io.ReadFull(stream, data); err != nil {
-			results <- errorDocument{err: fmt.Errorf("failed to read from stream: %w", err)}
+		if err := opts.Limiter.Acquire(ctx); err != nil {
+			opts.MemoryBudget.Release(held)
+			results <- errorDocument{err: fmt.Errorf("failed to acquire download slot: %w", err)}
 
 			return
 		}
 
-		// Decrypt the data.
-		decData, err := opts.SealOpener.Open(ctx, data)
+		observer.OnFileStart(name)
+
+		// A download interrupted part way through a file sealed as a stream
+		// resumes from the bytes already held locally.
+		if offset > 0 {
+			resumer := opts.SealOpener.(dcrypto.StreamResumer)
+
+			pr, pw := io.Pipe()
+
+			go func() {
+				err := resumeDownload(ctx, s.bucket, file, resumer, pw, offset)
+
+				opts.Limiter.Release()
+
+				pw.CloseWithError(err)
+			}()
+
+			doc.Body = pr
+			doc.Offset = offset
+
+			results <- errorDocument{doc: *doc}
+
+			continue
+		}
+
+		var stream io.ReadCloser
+
+		// A large file may be fetched as ranges of chunks at once, and its
+		// hash is checked once they are assembled and decrypted.
+		parallel := downloadsInParallel(opts, file)
+		if parallel {
+			stream = openParallel(ctx, s.bucket, file, opts.ParallelChunks)
+		} else {
+			err := store.RetryWithPolicy(ctx, transientRetryPolicy, func() error {
+				var err error
+				stream, err = openData(ctx, s.bucket, file)
+
+				return err
+			})
+			if err != nil {
+				opts.Limiter.Release()
+				opts.MemoryBudget.Release(held)
+
+				err = fmt.Errorf("failed to open download stream: %w", err)
+
+				observer.OnError(name, err)
+				results <- errorDocument{err: err}
+
+				return
+			}
+		}
+
+		// Files sealed as a stream are decrypted chunk by chunk as the
+		// consumer reads them, rather than being buffered in memory. A content
+		// filter needs the whole file, so it buffers them instead.
+		if streamed && opts.ContentFilter == nil {
+			pr, pw := io.Pipe()
+
+			go func() {
+				var (
+					w  io.Writer = pw
+					hw *hashWriter
+				)
+
+				if parallel {
+					hw = newHashWriter(pw)
+					w = hw
+				}
+
+				err := opener.OpenStream(ctx, w, stream)
+				if err == nil && hw != nil {
+					err = hw.check(gfsMeta.Diskhop.SHA256)
+				}
+
+				_ = stream.Close()
+				opts.Limiter.Release()
+
+				pw.CloseWithError(err)
+			}()
+
+			doc.Body = pr
+
+			results <- errorDocument{doc: *doc}
+
+			continue
+		}
+
+		decData, err := openFile(ctx, opener, streamed, stream, file.Length, opts)
+		if err == nil && parallel {
+			err = checkData(decData, gfsMeta.Diskhop.SHA256)
+		}
+
+		_ = stream.Close()
+		opts.Limiter.Release()
+
 		if err != nil {
-			results <- errorDocument{err: fmt.Errorf("failed to decrypt data: %w", err)}
+			opts.MemoryBudget.Release(held)
+			observer.OnError(name, err)
+			results <- errorDocument{err: err}
 
 			return
 		}
 
+		// A file rejected by the content filter is done without being
+		// written.
+		if opts.ContentFilter != nil && !opts.ContentFilter(decData) {
+			opts.MemoryBudget.Release(held)
+			observer.OnFileDone(name, 0)
+			results <- errorDocument{discarded: true}
+
+			continue
+		}
+
 		doc.Data = decData
 
+		// The memory of the file is released once the consumer closes it.
+		if opts.MemoryBudget != nil {
+			doc.Data = nil
+			doc.Body = &budgetedBody{Reader: bytes.NewReader(decData), budget: opts.MemoryBudget, held: held}
+		}
+
 		results <- errorDocument{doc: *doc}
 	}
 }
@@ -302,24 +1001,65 @@ func (s *Store) EncryptedPull(
 	ctx context.Context,
 	buf store.DocumentBuffer,
 	setters ...store.PullOption,
-) (*store.PullDescription, error) {
+) (_ *store.PullDescription, err error) {
+	defer func() { err = classifyError(err) }()
+
 	opts := store.PullOptions{}
 	for _, fn := range setters {
 		fn(&opts)
 	}
 
-	if err := loadNameIndex(ctx, s.nameIndex, opts.SealOpener); err != nil {
+	// Files named in a bucket that encodes names in the filenames, or whose
+	// name collection is sharded, are looked up without loading the rest of
+	// the index.
+	if len(opts.Names) > 0 && opts.Commit == "" && (!s.nameIndex.storesNames() || s.nameIndex.sharded()) {
+		names := make([]string, 0, len(opts.Names))
+		for _, name := range opts.Names {
+			names = append(names, withPrefix(opts.Prefix, name))
+		}
+
+		if s.nameIndex.sharded() {
+			err = lookupShards(ctx, s.nameIndex, opts.SealOpenerForMetadata(), names)
+		} else {
+			err = lookupNames(ctx, s.nameIndex, opts.SealOpenerForMetadata(), names)
+		}
+	} else {
+		err = loadNameIndex(ctx, s.nameIndex, opts.SealOpenerForMetadata())
+	}
+
+	if err != nil {
 		return nil, fmt.Errorf("failed to load name index: %w", err)
 	}
 
-	files, err := findFiles(ctx, s.nameIndex, s.bucket, opts)
+	var (
+		files        []gridfs.File
+		explanations []store.FileExplanation
+	)
+
+	if opts.Commit != "" {
+		files, err = s.commitFiles(ctx, opts)
+	} else {
+		files, explanations, err = findFiles(ctx, s.nameIndex, s.bucket, s.settings.ExcludePatterns, opts)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to find files: %w", err)
 	}
 
 	count := len(files)
 
-	desc := &store.PullDescription{Count: count}
+	desc := &store.PullDescription{
+		Count:        count,
+		Size:         pullSize(s.nameIndex, files),
+		Explanations: explanations,
+	}
+	if opts.DescribeFiles {
+		desc.Files = describeFiles(s.nameIndex, opts.Prefix, files)
+	}
+
+	if opts.Stats {
+		desc.Stats = describeSizes(s.nameIndex, files)
+	}
 
 	go func() {
 		if opts.DescribeOnly {
@@ -346,11 +1086,15 @@ func (s *Store) EncryptedPull(
 		for a := 0; a < count; a++ {
 			errDoc := <-results
 			if errDoc.err != nil {
-				buf.Send(nil, errDoc.err)
+				buf.Send(nil, classifyError(errDoc.err))
 
 				continue
 			}
 
+			if errDoc.discarded {
+				continue
+			}
+
 			buf.Send(&errDoc.doc, nil)
 		}
 
@@ -361,27 +1105,180 @@ func (s *Store) EncryptedPull(
 }
 
 func (s *Store) AddCommit(_ context.Context, commit *store.Commit) {
+	s.commitsMu.Lock()
+	defer s.commitsMu.Unlock()
+
 	commit.Namespace = s.bucketName
 
+	if len(commit.FileIDs) == 0 {
+		commit.Previous = s.takeReplaced(commit.FileID)
+	} else {
+		for _, fileID := range commit.FileIDs {
+			previous := s.takeReplaced(fileID)
+			if previous == "" {
+				continue
+			}
+
+			if commit.Replaced == nil {
+				commit.Replaced = make(map[string]string)
+			}
+
+			commit.Replaced[fileID] = previous
+		}
+	}
+
 	s.commits = append(s.commits, commit)
 }
 
-func (s *Store) FlushCommits(ctx context.Context) error {
+// commitBatchSize is the maximum number of commits written in one request.
+const commitBatchSize = 1000
+
+// FlushCommits writes the pending commits in the order they were added, in
+// batches that are dropped from the pending list as each one succeeds. Each
+// commit is upserted on its SHA and file ID, so retrying a flush after a
+// failure does not duplicate the commits that were already written.
+//
+// The commits cannot share a transaction with the files they record, since
+// the GridFS uploads are streamed before the flush and may exceed transaction
+// limits. Instead, commits stay pending until written, so that a retried
+// flush records the files of a failed one.
+func (s *Store) FlushCommits(ctx context.Context) (err error) {
+	defer func() { err = classifyError(err) }()
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	// Pushes keep adding commits while the snapshot is written, and those are
+	// left for the next flush.
+	pending := s.pendingCommits()
+
+	for len(pending) > 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("failed to flush commits: %w", err)
+		}
+
+		batch := pending[:min(len(pending), commitBatchSize)]
+
+		models := make([]mongo.WriteModel, 0, len(batch))
+		for _, commit := range batch {
+			filter := bson.D{
+				{Key: "sha", Value: commit.SHA},
+				{Key: "fileid", Value: commit.FileID},
+			}
+
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(filter).
+				SetUpdate(bson.D{{Key: "$setOnInsert", Value: commit}}).
+				SetUpsert(true))
+		}
+
+		bulkOpts := options.BulkWrite().SetOrdered(true)
+		if _, err := s.commitsColl.BulkWrite(ctx, models, bulkOpts); err != nil {
+			return fmt.Errorf("failed to write commits: %w", err)
+		}
+
+		pending = pending[len(batch):]
+		s.dropCommits(len(batch))
+	}
+
+	return nil
+}
+
+// AmendCommits folds the pending commits into the commit sha of the bucket
+// instead of writing them, replacing its message if msg is set. The commit
+// keeps its SHA and is timed as of the amend.
+func (s *Store) AmendCommits(ctx context.Context, sha, msg string) (err error) {
+	defer func() { err = classifyError(err) }()
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	filter := bson.D{
+		{Key: "namespace", Value: s.bucketName},
+		{Key: "sha", Value: sha},
+	}
+
+	var raw bson.Raw
+	if err := s.commitsColl.FindOne(ctx, filter).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to find commit %q: %w", sha, err)
+	}
+
+	var commit store.Commit
+	if err := bson.Unmarshal(raw, &commit); err != nil {
+		return fmt.Errorf("failed to decode commit %q: %w", sha, err)
+	}
+
+	pending := s.pendingCommits()
+	for _, next := range pending {
+		commit.Amend(next)
+	}
+
+	if msg != "" {
+		commit.Message = msg
+	}
+
+	commit.Time = time.Now().UTC()
+
+	if _, err := s.commitsColl.ReplaceOne(ctx, bson.D{{Key: "_id", Value: raw.Lookup("_id")}}, commit); err != nil {
+		return fmt.Errorf("failed to amend commit %q: %w", sha, err)
+	}
+
+	s.dropCommits(len(pending))
+
+	return nil
+}
+
+// pendingCommits returns a snapshot of the commits that have not been written.
+func (s *Store) pendingCommits() []*store.Commit {
+	s.commitsMu.Lock()
+	defer s.commitsMu.Unlock()
+
+	return slices.Clone(s.commits)
+}
+
+// dropCommits drops the first n pending commits once they have been written.
+func (s *Store) dropCommits(n int) {
+	s.commitsMu.Lock()
+	defer s.commitsMu.Unlock()
+
+	s.commits = s.commits[n:]
 	if len(s.commits) == 0 {
-		return nil
+		s.commits = nil
 	}
+}
+
+// BucketName returns the name of the GridFS bucket the store is bound to,
+// which is the name of the branch.
+func (s *Store) BucketName() string {
+	return s.bucketName
+}
+
+// DatabaseName returns the name of the database that holds the bucket.
+func (s *Store) DatabaseName() string {
+	return s.commitsColl.Database().Name()
+}
 
-	commits := make([]interface{}, 0, len(s.commits))
-	for _, commit := range s.commits {
-		commits = append(commits, commit)
+// Log returns the commits of the bucket, newest first, at most limit of them if
+// limit is positive.
+func (s *Store) Log(ctx context.Context, limit int) (_ []store.Commit, err error) {
+	defer func() { err = classifyError(err) }()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
 	}
 
-	_, err := s.commitsColl.InsertMany(ctx, commits)
+	cur, err := s.commitsColl.Find(ctx, bson.D{{Key: "namespace", Value: s.bucketName}}, opts)
 	if err != nil {
-		return fmt.Errorf("failed to insert commits: %w", err)
+		return nil, fmt.Errorf("failed to find commits: %w", err)
 	}
 
-	return nil
+	var commits []store.Commit
+	if err := cur.All(ctx, &commits); err != nil {
+		return nil, fmt.Errorf("failed to decode commits: %w", err)
+	}
+
+	return commits, nil
 }
 
 // GetIVManager will return an IVManager.
@@ -389,54 +1286,192 @@ func (s *Store) GetIVManager() dcrypto.IVManager {
 	return dcrypto.IVManager{IVPusher: s.ivPusher}
 }
 
-// Revert will revert the store to a previous state.
-func (s *Store) Revert(ctx context.Context, sha string) error {
+// revertTarget is a file deleted by reverting a commit.
+type revertTarget struct {
+	ID       primitive.ObjectID `bson:"_id"`
+	Name     string             `bson:"filename"`
+	Metadata bson.Raw           `bson:"metadata"`
+}
+
+// revertPlan is what reverting a commit changes.
+type revertPlan struct {
+	fileNames []string          // Hex names of the files written by the commits
+	files     []revertTarget    // Files written by the commits that are still in the bucket
+	restores  map[string]string // Hex name of a file to that of the version it replaced
+}
+
+// restoredVersions returns the hex names of the versions that reverting the
+// files restores.
+func (plan *revertPlan) restoredVersions() []string {
+	names := make([]string, 0, len(plan.restores))
+	for _, file := range plan.files {
+		if previous, ok := plan.restores[file.Name]; ok {
+			names = append(names, previous)
+		}
+	}
+
+	return names
+}
+
+// planRevert finds the files written by the commits with the SHA and the
+// versions they replaced. It fails with errSuperseded if one of the files has
+// since been replaced, since reverting it would not restore the bucket.
+func (s *Store) planRevert(ctx context.Context, sha string) (*revertPlan, error) {
 	// Get all of the commits with SHA and collect their "fileID".
 	filter := bson.D{{Key: "sha", Value: sha}}
 
 	commits, err := s.commitsColl.Find(ctx, filter)
 	if err != nil {
-		return fmt.Errorf("failed to find commits: %w", err)
+		return nil, fmt.Errorf("failed to find commits: %w", err)
 	}
 
-	fileNames := make([]string, 0)
+	plan := &revertPlan{restores: make(map[string]string)}
 	for commits.Next(ctx) {
 		commit := store.Commit{}
 		if err := commits.Decode(&commit); err != nil {
-			return fmt.Errorf("failed to decode commit: %w", err)
+			return nil, fmt.Errorf("failed to decode commit: %w", err)
 		}
 
-		fileNames = append(fileNames, commit.FileID)
+		for _, fileID := range commit.Files() {
+			plan.fileNames = append(plan.fileNames, fileID)
+
+			if previous := commit.PreviousOf(fileID); previous != "" {
+				plan.restores[fileID] = previous
+			}
+		}
 	}
 
 	// Get the ids from teh file names.
-	cur, err := s.nameIndex.coll.Find(ctx, bson.D{{Key: "filename", Value: bson.D{{Key: "$in", Value: fileNames}}}})
+	cur, err := s.nameIndex.coll.Find(ctx, bson.D{{Key: "filename", Value: bson.D{{Key: "$in", Value: plan.fileNames}}}})
 	if err != nil {
-		return fmt.Errorf("failed to find file names: %w", err)
+		return nil, fmt.Errorf("failed to find file names: %w", err)
 	}
 
-	fileIDs := []primitive.ObjectID{}
+	current := make(map[string]bool)
 	for cur.Next(ctx) {
-		file := struct {
-			ID primitive.ObjectID `bson:"_id"`
-		}{}
-
+		file := revertTarget{}
 		if err := cur.Decode(&file); err != nil {
-			return fmt.Errorf("failed to decode file: %w", err)
+			return nil, fmt.Errorf("failed to decode file: %w", err)
+		}
+
+		plan.files = append(plan.files, file)
+		current[file.Name] = true
+	}
+
+	for _, name := range plan.fileNames {
+		if current[name] {
+			continue
+		}
+
+		superseded, err := isVersion(ctx, s.nameIndex.coll, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if superseded {
+			return nil, fmt.Errorf("failed to revert %s: %w", sha, errSuperseded)
+		}
+	}
+
+	return plan, nil
+}
+
+// DescribeRevert lists the files that Revert would delete for the SHA.
+func (s *Store) DescribeRevert(
+	ctx context.Context,
+	sha string,
+	opener dcrypto.Opener,
+) (_ []store.RevertedFile, err error) {
+	defer func() { err = classifyError(err) }()
+
+	plan, err := s.planRevert(ctx, sha)
+	if err != nil {
+		return nil, err
+	}
+
+	if opener != nil {
+		if err := loadNameIndex(ctx, s.nameIndex, opener); err != nil {
+			return nil, fmt.Errorf("failed to load name index: %w", err)
+		}
+	}
+
+	reverted := make([]store.RevertedFile, 0, len(plan.files))
+	for _, file := range plan.files {
+		rf := store.RevertedFile{ID: file.ID.Hex(), Restores: plan.restores[file.Name] != ""}
+		if opener != nil {
+			rf.Name, _ = s.nameIndex.hexName.get(file.Name)
 		}
 
-		fileIDs = append(fileIDs, file.ID)
+		reverted = append(reverted, rf)
+	}
+
+	sort.Slice(reverted, func(i, j int) bool {
+		return reverted[i].Name < reverted[j].Name
+	})
+
+	return reverted, nil
+}
+
+// Revert undoes the pushes recorded by the commits with the SHA. The files
+// they wrote are deleted and the versions those files replaced are restored.
+func (s *Store) Revert(ctx context.Context, sha string) (err error) {
+	defer func() { err = classifyError(err) }()
+
+	plan, err := s.planRevert(ctx, sha)
+	if err != nil {
+		return err
+	}
+
+	// Every version is checked before any is restored, so that a version
+	// pruned since the push fails the revert without changing anything.
+	if err := checkVersions(ctx, s.nameIndex.coll, plan.restoredVersions()); err != nil {
+		return fmt.Errorf("failed to revert %s: %w", sha, err)
+	}
+
+	// Restore the replaced versions first, so that a failure part way through
+	// leaves both versions rather than neither.
+	for _, file := range plan.files {
+		previous, ok := plan.restores[file.Name]
+		if !ok {
+			continue
+		}
+
+		if err := restoreVersion(ctx, s.nameIndex.coll, previous); err != nil {
+			return err
+		}
 	}
 
 	// TODO: this is naieve, but it will work for beta.
-	for _, id := range fileIDs {
-		// Delete file by ID
-		err = s.bucket.Delete(id)
+	for _, file := range plan.files {
+		// Delete file by ID, keeping the chunks that other files link to.
+		err = deleteFile(ctx, s.bucket, gridfs.File{ID: file.ID, Metadata: file.Metadata})
 		if err != nil {
 			return fmt.Errorf("failed to delete file by ID: %w", err)
 		}
 	}
 
+	if err := s.deleteNames(ctx, plan.fileNames); err != nil {
+		return err
+	}
+
+	// Delete all of the commits with the given SHA
+	if _, err := s.commitsColl.DeleteMany(ctx, bson.D{{Key: "sha", Value: sha}}); err != nil {
+		return fmt.Errorf("failed to delete commits: %w", err)
+	}
+
+	// The name index no longer matches the bucket.
+	s.nameIndex.hexName, s.nameIndex.nameDoc = nil, nil
+
+	return nil
+}
+
+// deleteNames deletes the encrypted names of the files with the GridFS
+// filenames from the name collection, if they are kept there.
+func (s *Store) deleteNames(ctx context.Context, fileNames []string) error {
+	if !s.nameIndex.storesNames() {
+		return nil
+	}
+
 	// Convert filenaes into object ids
 	fnAsOIDs := make([]primitive.ObjectID, 0, len(fileNames))
 	for _, name := range fileNames {
@@ -453,11 +1488,6 @@ func (s *Store) Revert(ctx context.Context, sha string) error {
 		return fmt.Errorf("failed to delete names: %w", err)
 	}
 
-	// Delete all of the commits with the given SHA
-	if _, err := s.commitsColl.DeleteMany(ctx, bson.D{{Key: "sha", Value: sha}}); err != nil {
-		return fmt.Errorf("failed to delete commits: %w", err)
-	}
-
 	return nil
 }
 
@@ -467,24 +1497,20 @@ var (
 )
 
 func dataChanged(ctx context.Context, nidx *nameIndex, name string, rs io.ReadSeeker, opts store.PushOptions) (bool, error) {
-	if err := loadNameIndex(ctx, nidx, opts.SealOpener); err != nil {
+	if err := loadNameIndex(ctx, nidx, opts.SealOpenerForMetadata()); err != nil {
 		return false, fmt.Errorf("failed to load name index: %w", err)
 	}
 
-	originalFile, meta, ok := nidx.nameDoc.get(name)
+	_, meta, ok := nidx.nameDoc.get(name)
 	if !ok {
 		return false, errFullPushRequired
 	}
 
-	length, err := rs.Seek(0, io.SeekEnd)
+	noDataChange, err := sameContents(meta, rs)
 	if err != nil {
-		return false, fmt.Errorf("failed to seek to end of file: %w", err)
+		return false, err
 	}
 
-	// TODO: this is expedient for beta, but it's not a great way to check if
-	// the file has changed. What if the file is the same size but the contents
-	// are different?
-	noDataChange := originalFile.Length-28 == length
 	noTagChange := !meta.addTags(opts.Tags...)
 
 	// If absolutely nothing has changed, do nothing.
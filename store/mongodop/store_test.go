@@ -0,0 +1,137 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/internal/filter"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestExplainSelection(t *testing.T) {
+	docs := []filter.Document{
+		{EncodedName: "c", Name: "c.txt", Size: 3},
+		{EncodedName: "a", Name: "a.txt", Size: 1},
+		{EncodedName: "b", Name: "b.txt", Size: 2},
+		{EncodedName: "d", Name: "d.txt", Size: 4},
+		{EncodedName: "e", Name: "e.raw", Size: 5},
+	}
+
+	matched := []filter.Document{docs[1], docs[2], docs[3]}
+	policyExcluded := map[string]bool{"e": true}
+	excluded := map[string]bool{"d.txt": true}
+	chosen := []gridfs.File{{Name: "a"}}
+
+	assert.Nil(t, explainSelection(store.PullOptions{}, docs, matched, policyExcluded, excluded, chosen))
+
+	got := explainSelection(store.PullOptions{Explain: true}, docs, matched, policyExcluded, excluded, chosen)
+
+	want := []store.FileExplanation{
+		{Name: "a.txt", Size: 1, Matched: true, Sampled: true, Reason: "selected"},
+		{Name: "b.txt", Size: 2, Matched: true, Reason: "not in random sample"},
+		{Name: "c.txt", Size: 3, Reason: "rejected by filter"},
+		{Name: "d.txt", Size: 4, Matched: true, Reason: "already pulled"},
+		{Name: "e.raw", Size: 5, Reason: "excluded by policy"},
+	}
+
+	assert.Equal(t, want, got)
+}
+
+func TestDescribeSizes(t *testing.T) {
+	nidx := &nameIndex{hexName: &hexName{}, nameDoc: &nameDoc{}}
+
+	files := []gridfs.File{{Name: "a", Length: 12}, {Name: "b", Length: 40}, {Name: "c", Length: 8}}
+
+	// The recorded plaintext size is preferred over the encrypted length.
+	meta := newGridFSMetadata(nil)
+	meta.Diskhop.Size = 20
+
+	nidx.hexName.add("b", "b.txt")
+	nidx.nameDoc.add("b.txt", &files[1], meta)
+
+	assert.Equal(t, &store.SizeStats{Files: 3, Bytes: 40, Min: 8, Max: 20, Avg: 13}, describeSizes(nidx, files))
+	assert.Equal(t, &store.SizeStats{}, describeSizes(nidx, nil))
+}
+
+func TestCommitsConcurrent(t *testing.T) {
+	const pushers, perPusher = 8, 100
+
+	s := &Store{}
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < pushers; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < perPusher; j++ {
+				s.AddCommit(context.Background(), &store.Commit{SHA: "sha", FileID: fmt.Sprintf("%d-%d", i, j)})
+			}
+		}(i)
+	}
+
+	// Flushes drop the commits of their snapshots while the pushes add more.
+	flushed := map[string]bool{}
+
+	for len(flushed) < pushers*perPusher {
+		pending := s.pendingCommits()
+		for _, commit := range pending {
+			require.False(t, flushed[commit.FileID], "commit %s flushed twice", commit.FileID)
+
+			flushed[commit.FileID] = true
+		}
+
+		s.dropCommits(len(pending))
+	}
+
+	wg.Wait()
+
+	assert.Empty(t, s.pendingCommits())
+}
+
+func TestBudgetedBodyReleasesOnce(t *testing.T) {
+	budget := store.NewMemoryBudget(8)
+	require.NoError(t, budget.Acquire(context.Background(), 8))
+
+	body := &budgetedBody{Reader: bytes.NewReader([]byte("data")), budget: budget, held: 8}
+
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+
+	require.NoError(t, body.Close())
+	require.NoError(t, body.Close())
+
+	// Only the bytes of the body were released, so the budget is full again
+	// once they are acquired.
+	require.NoError(t, budget.Acquire(context.Background(), 8))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, budget.Acquire(ctx, 1), context.DeadlineExceeded)
+}
@@ -0,0 +1,191 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDedupRefCount(t *testing.T) {
+	const bucket = "dedup_refcount"
+
+	ctx := context.Background()
+	s, db, so := connectStore(t, bucket)
+
+	files := db.Collection(bucket + ".files")
+	chunks := db.Collection(bucket + ".chunks")
+	refs := db.Collection(bucket + ".refs")
+
+	push := func(name string) primitive.ObjectID {
+		filename, err := s.Push(ctx, name, strings.NewReader("same contents"), store.WithPushSealOpener(so), store.WithPushDedup())
+		require.NoError(t, err)
+
+		// Separate the upload dates, which the server keeps to the millisecond.
+		time.Sleep(10 * time.Millisecond)
+
+		return fileID(t, files, filename)
+	}
+
+	first := push("/repo/a.txt")
+	between := time.Now()
+	second := push("/repo/b.txt")
+
+	chunkCount := func() int64 {
+		t.Helper()
+
+		n, err := chunks.CountDocuments(ctx, bson.D{{Key: "files_id", Value: first}})
+		require.NoError(t, err)
+
+		return n
+	}
+
+	refCount := func() int64 {
+		t.Helper()
+
+		var ref struct {
+			Count int64 `bson:"count"`
+		}
+
+		err := refs.FindOne(ctx, bson.D{{Key: "_id", Value: first}}).Decode(&ref)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0
+		}
+
+		require.NoError(t, err)
+
+		return ref.Count
+	}
+
+	// The second file links to the chunks of the first rather than storing
+	// its own.
+	var link struct {
+		Metadata bson.Raw `bson:"metadata"`
+	}
+
+	require.NoError(t, files.FindOne(ctx, bson.D{{Key: "_id", Value: second}}).Decode(&link))
+
+	blob, ok := link.Metadata.Lookup("blob").ObjectIDOK()
+	require.True(t, ok, "the second file is not a link")
+	assert.Equal(t, first, blob)
+
+	n, err := chunks.CountDocuments(ctx, bson.D{{Key: "files_id", Value: second}})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	assert.Equal(t, int64(1), refCount())
+	assert.Positive(t, chunkCount())
+
+	// Removing the file the chunks were uploaded with keeps them for the link.
+	removed, err := s.RemoveOlderThan(ctx, between)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	assert.Equal(t, int64(1), refCount())
+	assert.Positive(t, chunkCount())
+
+	// Removing the link deletes the chunks that nothing reads any more.
+	removed, err = s.RemoveOlderThan(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	assert.Zero(t, refCount())
+	assert.Zero(t, chunkCount())
+}
+
+func TestCheckRepairsRefCount(t *testing.T) {
+	const bucket = "dedup_fsck"
+
+	ctx := context.Background()
+	s, db, so := connectStore(t, bucket)
+
+	var filenames []string
+	for _, name := range []string{"/repo/a.txt", "/repo/b.txt", "/repo/c.txt"} {
+		filename, err := s.Push(ctx, name, strings.NewReader("same contents"), store.WithPushSealOpener(so), store.WithPushDedup())
+		require.NoError(t, err)
+
+		filenames = append(filenames, filename)
+	}
+
+	firstID := fileID(t, db.Collection(bucket+".files"), filenames[0])
+	refs := db.Collection(bucket + ".refs")
+
+	// Corrupt the count of the two links to the chunks of the first file.
+	filter := bson.D{{Key: "_id", Value: firstID}}
+	_, err := refs.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: bson.D{{Key: "count", Value: 7}}}})
+	require.NoError(t, err)
+
+	report, err := s.Check(ctx, false)
+	require.NoError(t, err)
+
+	wrong := refCountIssues(report)
+	require.Len(t, wrong, 1)
+	assert.Equal(t, firstID.Hex(), wrong[0].ID)
+	assert.False(t, wrong[0].Fixed)
+
+	report, err = s.Check(ctx, true)
+	require.NoError(t, err)
+
+	wrong = refCountIssues(report)
+	require.Len(t, wrong, 1)
+	assert.True(t, wrong[0].Fixed)
+
+	var ref struct {
+		Count int64 `bson:"count"`
+	}
+
+	require.NoError(t, refs.FindOne(ctx, filter).Decode(&ref))
+	assert.Equal(t, int64(2), ref.Count)
+
+	report, err = s.Check(ctx, false)
+	require.NoError(t, err)
+	assert.Empty(t, refCountIssues(report))
+}
+
+// fileID returns the ID of the files document with the filename.
+func fileID(t *testing.T, files *mongo.Collection, filename string) primitive.ObjectID {
+	t.Helper()
+
+	var file struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	err := files.FindOne(context.Background(), bson.D{{Key: "filename", Value: filename}}).Decode(&file)
+	require.NoError(t, err)
+
+	return file.ID
+}
+
+// refCountIssues returns the reference counts that the report found wrong.
+func refCountIssues(report *store.CheckReport) []store.Issue {
+	var issues []store.Issue
+	for _, issue := range report.Issues {
+		if issue.Kind == store.IssueWrongRefCount {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestPushTwiceVerified pushes the same files again through each path that
+// finds them already stored. Every push is verified by the name the store
+// returns, so each path must return the stored name of the file.
+func TestPushTwiceVerified(t *testing.T) {
+	const bucket = "push_twice"
+
+	ctx := context.Background()
+	s, db, so := connectStore(t, bucket)
+
+	push := func(tags []string, opts ...store.PushOption) {
+		t.Helper()
+
+		dir := t.TempDir()
+		for _, name := range []string{"a.txt", "b.txt"} {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data of "+name), 0o600))
+		}
+
+		if len(tags) > 0 {
+			require.NoError(t, osutil.WriteSidecarTags(filepath.Join(dir, "a.txt"), tags...))
+		}
+
+		fp := diskhop.NewFilePusher(s)
+		fp.OnTagError = func(string, error) {}
+
+		f, err := os.Open(dir)
+		require.NoError(t, err)
+
+		defer f.Close()
+
+		require.NoError(t, fp.Push(ctx, f, append(opts, store.WithPushSealOpener(so))...))
+
+		// The files are only cleaned once they are verified.
+		assert.NoFileExists(t, filepath.Join(dir, "a.txt"))
+		assert.NoFileExists(t, filepath.Join(dir, "b.txt"))
+	}
+
+	push(nil)                               // New files
+	push([]string{"beach"})                 // A tag change
+	push(nil, store.WithPushSkipExisting()) // Skipped as existing
+	push(nil)                               // No change at all
+
+	n, err := db.Collection(bucket+".files").CountDocuments(ctx, bson.D{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n, "the files are stored once")
+}
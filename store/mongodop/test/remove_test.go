@@ -0,0 +1,166 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/prestonvasquez/diskhop/store/mongodop"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestRemoveOlderThan(t *testing.T) {
+	const bucket = "remove_older"
+
+	ctx := context.Background()
+	s, db, so := connectStore(t, bucket, mongodop.WithVersionPolicy(mongodop.VersionPolicy{Enabled: true}))
+
+	files := db.Collection(bucket + ".files")
+	chunks := db.Collection(bucket + ".chunks")
+	versions := db.Collection(bucket + ".versions")
+	names := db.Collection(mongodop.DefaultNameCollectionName)
+
+	push := func(name, sha, data string) string {
+		filename, err := s.Push(ctx, name, strings.NewReader(data), store.WithPushSealOpener(so))
+		require.NoError(t, err)
+
+		s.AddCommit(ctx, &store.Commit{SHA: sha, FileID: filename})
+		require.NoError(t, s.FlushCommits(ctx))
+
+		// Separate the upload dates, which the server keeps to the millisecond.
+		time.Sleep(10 * time.Millisecond)
+
+		return filename
+	}
+
+	push("/repo/a.txt", "first", "version 1")
+	old := push("/repo/a.txt", "second", "version 2")
+	between := time.Now()
+	kept := push("/repo/b.txt", "third", "kept")
+
+	oldID := fileID(t, files, old)
+	keptID := fileID(t, files, kept)
+
+	var version struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	require.NoError(t, versions.FindOne(ctx, bson.D{}).Decode(&version), "the first push of a.txt is kept as a version")
+
+	count := func(coll *mongo.Collection, filter bson.D) int64 {
+		t.Helper()
+
+		n, err := coll.CountDocuments(ctx, filter)
+		require.NoError(t, err)
+
+		return n
+	}
+
+	nameCount := func(filename string) int64 {
+		t.Helper()
+
+		id, err := primitive.ObjectIDFromHex(filename)
+		require.NoError(t, err)
+
+		return count(names, bson.D{{Key: "_id", Value: id}})
+	}
+
+	// A dry run lists the file and deletes nothing.
+	described, err := s.DescribeRemoveOlderThan(ctx, between, so)
+	require.NoError(t, err)
+	require.Len(t, described, 1)
+	assert.Equal(t, oldID.Hex(), described[0].ID)
+	assert.Equal(t, "/repo/a.txt", described[0].Name)
+
+	assert.Equal(t, int64(2), count(files, bson.D{}))
+	assert.Equal(t, int64(1), count(versions, bson.D{}))
+	assert.Positive(t, count(chunks, bson.D{{Key: "files_id", Value: oldID}}))
+	assert.Positive(t, count(chunks, bson.D{{Key: "files_id", Value: version.ID}}))
+	assert.Equal(t, int64(1), nameCount(old))
+
+	commits, err := s.Log(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, commits, 3)
+
+	removed, err := s.RemoveOlderThan(ctx, between)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	// The file goes with its chunks, its name, the version it replaced and
+	// the commits of both.
+	assert.Zero(t, count(files, bson.D{{Key: "_id", Value: oldID}}))
+	assert.Zero(t, count(chunks, bson.D{{Key: "files_id", Value: oldID}}))
+	assert.Zero(t, count(versions, bson.D{}))
+	assert.Zero(t, count(chunks, bson.D{{Key: "files_id", Value: version.ID}}))
+	assert.Zero(t, nameCount(old))
+
+	commits, err = s.Log(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, commits, 1)
+	assert.Equal(t, "third", commits[0].SHA)
+
+	// The newer file is untouched.
+	assert.Equal(t, int64(1), count(files, bson.D{{Key: "_id", Value: keptID}}))
+	assert.Positive(t, count(chunks, bson.D{{Key: "files_id", Value: keptID}}))
+	assert.Equal(t, int64(1), nameCount(kept))
+}
+
+func TestRemoveOlderThanKeepsLinkedChunks(t *testing.T) {
+	const bucket = "remove_linked"
+
+	ctx := context.Background()
+	s, db, so := connectStore(t, bucket)
+
+	files := db.Collection(bucket + ".files")
+	chunks := db.Collection(bucket + ".chunks")
+
+	push := func(name string) primitive.ObjectID {
+		filename, err := s.Push(ctx, name, strings.NewReader("same contents"), store.WithPushSealOpener(so), store.WithPushDedup())
+		require.NoError(t, err)
+
+		time.Sleep(10 * time.Millisecond)
+
+		return fileID(t, files, filename)
+	}
+
+	first := push("/repo/a.txt")
+	between := time.Now()
+	link := push("/repo/b.txt")
+
+	removed, err := s.RemoveOlderThan(ctx, between)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	n, err := files.CountDocuments(ctx, bson.D{{Key: "_id", Value: first}})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// The link still reads the chunks uploaded with the removed file.
+	n, err = chunks.CountDocuments(ctx, bson.D{{Key: "files_id", Value: first}})
+	require.NoError(t, err)
+	assert.Positive(t, n)
+
+	n, err = files.CountDocuments(ctx, bson.D{{Key: "_id", Value: link}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
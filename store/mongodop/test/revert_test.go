@@ -0,0 +1,63 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/prestonvasquez/diskhop/store/mongodop"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRevertPrunedVersion(t *testing.T) {
+	const bucket = "revert_pruned"
+
+	ctx := context.Background()
+	s, db, so := connectStore(t, bucket, mongodop.WithVersionPolicy(mongodop.VersionPolicy{Enabled: true}))
+
+	push := func(sha, data string) string {
+		id, err := s.Push(ctx, "/repo/a.txt", strings.NewReader(data), store.WithPushSealOpener(so))
+		require.NoError(t, err)
+
+		s.AddCommit(ctx, &store.Commit{SHA: sha, FileID: id})
+		require.NoError(t, s.FlushCommits(ctx))
+
+		return id
+	}
+
+	push("first", "version 1")
+	second := push("second", "version 2")
+
+	// Prune the version that reverting the second push would restore.
+	_, err := db.Collection(bucket+".versions").DeleteMany(ctx, bson.D{})
+	require.NoError(t, err)
+
+	err = s.Revert(ctx, "second")
+	assert.ErrorContains(t, err, "pruned")
+
+	// The failed revert leaves the bucket and the commit as they were.
+	n, err := db.Collection(bucket+".files").CountDocuments(ctx, bson.D{{Key: "filename", Value: second}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	commits, err := s.Log(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, commits, 2)
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/prestonvasquez/diskhop/store/mongodop"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewrapRecipients(t *testing.T) {
+	const bucket = "rewrap"
+
+	ctx := context.Background()
+	s, _, _ := connectStore(t, bucket)
+
+	alice, bob := newIdentity(t), newIdentity(t)
+
+	sealer, err := diskhop.NewRecipients(alice)
+	require.NoError(t, err)
+
+	// Span several chunks, so that the envelope growing shifts all of them.
+	data := bytes.Repeat([]byte("shared with the team "), 40000)
+
+	for _, name := range []string{"/repo/a.txt", "/repo/b.txt"} {
+		_, err := s.Push(ctx, name, bytes.NewReader(data), store.WithPushSealOpener(sealer), store.WithPushDedup())
+		require.NoError(t, err)
+	}
+
+	bobOpener, err := diskhop.NewRecipients(bob)
+	require.NoError(t, err)
+
+	_, err = pullOne(t, s, "/repo/b.txt", bobOpener)
+	assert.Error(t, err, "bob is not a recipient yet")
+
+	bobPub := publicPEM(t, bob)
+
+	rewrapper, err := diskhop.NewRecipients(alice, bobPub)
+	require.NoError(t, err)
+
+	n, err := s.Rewrap(ctx, rewrapper)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// A fresh connection reads the rewrapped names and metadata too.
+	s, err = mongodop.Connect(ctx, os.Getenv("MONGODB_URI"), "test", bucket)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = s.Close(ctx) })
+
+	for _, name := range []string{"/repo/a.txt", "/repo/b.txt"} {
+		bobOpener, err := diskhop.NewRecipients(bob)
+		require.NoError(t, err)
+
+		got, err := pullOne(t, s, name, bobOpener)
+		require.NoError(t, err)
+		assert.Equal(t, data, got, name)
+	}
+}
+
+// newIdentity returns a PEM-encoded RSA private key.
+func newIdentity(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// publicPEM returns the PEM-encoded public key of the identity.
+func publicPEM(t *testing.T, identity []byte) []byte {
+	t.Helper()
+
+	block, _ := pem.Decode(identity)
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// pullOne pulls the contents of the file with the name, opened with opener.
+func pullOne(t *testing.T, s *mongodop.Store, name string, opener dcrypto.SealOpener) ([]byte, error) {
+	t.Helper()
+
+	buf := store.NewDocumentBuffer()
+
+	_, err := s.Pull(context.Background(), buf, store.WithPullSealOpener(opener), store.WithPullNames(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+
+	for {
+		doc, err := buf.Next()
+		if errors.Is(err, io.EOF) {
+			return data, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if doc.Body == nil {
+			data = append(data, doc.Data...)
+
+			continue
+		}
+
+		body, err := io.ReadAll(doc.Body)
+		_ = doc.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, body...)
+	}
+}
@@ -16,11 +16,14 @@ package test
 
 import (
 	"context"
+	"encoding/hex"
 	"net"
 	"net/url"
 	"os"
 	"testing"
 
+	"github.com/prestonvasquez/diskhop"
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
 	"github.com/prestonvasquez/diskhop/exp/test"
 	"github.com/prestonvasquez/diskhop/store/mongodop"
 	"github.com/stretchr/testify/require"
@@ -37,6 +40,7 @@ func TestMongoE2E(t *testing.T) {
 		NewTestStore:    newTestStore,
 		NewTestMigrator: newTestMigrator,
 		Setup:           setup,
+		Parallel:        os.Getenv("DISKHOP_TEST_PARALLEL") != "",
 	})
 }
 
@@ -54,7 +58,8 @@ func newTestStore(t *testing.T, ctx context.Context, bucketName string) *test.Te
 	require.NoError(t, err, "failed to connect to mongodb")
 
 	// Create a connection to the test server to test diskhop behavior.
-	mstore, err := mongodop.Connect(context.Background(), uri, database, bucketName)
+	mstore, err := mongodop.Connect(context.Background(), uri, database, bucketName,
+		mongodop.WithVersionPolicy(mongodop.VersionPolicy{Enabled: true}))
 	require.NoError(t, err, "failed to connect to mongodb store")
 
 	return &test.TestStore{
@@ -145,3 +150,33 @@ func setup(t *testing.T, ctx context.Context) {
 	err = client.Database(database).Drop(context.Background())
 	require.NoError(t, err, "failed to drop database")
 }
+
+// connectStore connects to the bucket of a freshly dropped test database with
+// opts, returning the store, the database and a seal opener for the bucket.
+func connectStore(t *testing.T, bucketName string, opts ...mongodop.ConnectOption) (*mongodop.Store, *mongo.Database, dcrypto.SealOpener) {
+	t.Helper()
+
+	const database = "test"
+
+	ctx := context.Background()
+	setup(t, ctx)
+
+	uri := os.Getenv("MONGODB_URI")
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err, "failed to connect to mongodb")
+
+	t.Cleanup(func() { _ = client.Disconnect(ctx) })
+
+	mstore, err := mongodop.Connect(ctx, uri, database, bucketName, opts...)
+	require.NoError(t, err, "failed to connect to mongodb store")
+
+	t.Cleanup(func() { _ = mstore.Close(ctx) })
+
+	key, _ := hex.DecodeString("6368616e676520746869732070617373776f726420746f206120736563726574")
+
+	so, err := diskhop.NewAESGCM(mstore, key)
+	require.NoError(t, err, "failed to create seal opener")
+
+	return mstore, client.Database(database), so
+}
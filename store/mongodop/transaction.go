@@ -0,0 +1,70 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// minTransactionWireVersion is the wire version of MongoDB 4.2, the first
+// release with transactions on both replica sets and sharded clusters.
+const minTransactionWireVersion = 8
+
+// supportsTransactions reports whether the deployment behind client can run
+// multi-document transactions, which standalone servers cannot. A deployment
+// that cannot be described, such as one whose user may not run hello, is
+// written to without transactions.
+func supportsTransactions(ctx context.Context, client *mongo.Client) bool {
+	var hello struct {
+		SetName        string `bson:"setName"`
+		Msg            string `bson:"msg"`
+		MaxWireVersion int32  `bson:"maxWireVersion"`
+	}
+
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return false
+	}
+
+	clustered := hello.SetName != "" || hello.Msg == "isdbgrid"
+
+	return clustered && hello.MaxWireVersion >= minTransactionWireVersion
+}
+
+// withTransaction runs fn in a transaction if the deployment supports them,
+// and directly otherwise. fn must do its writes with the context it is given,
+// and may be called again if the transaction is retried.
+func (p *Pusher) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !p.transactions {
+		return fn(ctx)
+	}
+
+	session, err := p.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
+	}
+
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+
+	return err
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSupportsTransactions(t *testing.T) {
+	mt := newMockTest(t)
+
+	tests := []struct {
+		name  string
+		reply bson.D
+		want  bool
+	}{
+		{
+			name:  "replica set",
+			reply: mtest.CreateSuccessResponse(bson.E{Key: "setName", Value: "rs0"}, bson.E{Key: "maxWireVersion", Value: 21}),
+			want:  true,
+		},
+		{
+			name:  "sharded cluster",
+			reply: mtest.CreateSuccessResponse(bson.E{Key: "msg", Value: "isdbgrid"}, bson.E{Key: "maxWireVersion", Value: 21}),
+			want:  true,
+		},
+		{
+			name:  "standalone",
+			reply: mtest.CreateSuccessResponse(bson.E{Key: "maxWireVersion", Value: 21}),
+		},
+		{
+			name:  "replica set before 4.2",
+			reply: mtest.CreateSuccessResponse(bson.E{Key: "setName", Value: "rs0"}, bson.E{Key: "maxWireVersion", Value: 7}),
+		},
+		{
+			name:  "hello fails",
+			reply: mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 13, Message: "unauthorized"}),
+		},
+	}
+
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(tt.reply)
+
+			assert.Equal(mt, tt.want, supportsTransactions(context.Background(), mt.Client))
+		})
+	}
+}
@@ -0,0 +1,136 @@
+//
+// Copyright 2024 Preston Vasquez
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// contentHash returns the hex-encoded SHA-256 hash of the plaintext.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// hashSealed returns the hex-encoded SHA-256 hash of the plaintext of the
+// length bytes sealed in stream. A file sealed as a stream is hashed as it is
+// decrypted, rather than held in memory, while one sealed whole can only be
+// opened whole.
+func hashSealed(ctx context.Context, so dcrypto.SealOpener, meta *gridfsMetadata, stream io.Reader, length int64) (string, error) {
+	if opener, ok := so.(dcrypto.StreamOpener); ok && meta.Diskhop.ChunkSize > 0 {
+		hash := sha256.New()
+		if err := opener.OpenStream(ctx, hash, stream); err != nil {
+			return "", fmt.Errorf("failed to decrypt data: %w", err)
+		}
+
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	plaintext, err := openFile(ctx, nil, false, stream, length, store.PullOptions{SealOpener: so})
+	if err != nil {
+		return "", err
+	}
+
+	return contentHash(plaintext), nil
+}
+
+// Upgrade migrates the bucket forward one format version at a time until it
+// reaches CurrentFormatVersion.
+func (s *Store) Upgrade(ctx context.Context, so dcrypto.SealOpener) (_, _ int, err error) {
+	defer func() { err = classifyError(err) }()
+
+	from := s.settings.FormatVersion
+
+	for s.settings.FormatVersion < CurrentFormatVersion {
+		var err error
+
+		switch s.settings.FormatVersion {
+		case FormatVersionLegacy:
+			err = s.backfillContentHashes(ctx, so)
+		}
+
+		if err != nil {
+			return from, s.settings.FormatVersion, err
+		}
+
+		next := s.settings.FormatVersion + 1
+
+		err = s.settingsStore.set(ctx, bson.D{{Key: "formatVersion", Value: next}})
+		if err != nil {
+			return from, s.settings.FormatVersion, fmt.Errorf("failed to record format version: %w", err)
+		}
+
+		s.settings.FormatVersion = next
+	}
+
+	return from, s.settings.FormatVersion, nil
+}
+
+// backfillContentHashes downloads every file that is missing a content hash
+// and records the hash of its plaintext in the file's metadata.
+func (s *Store) backfillContentHashes(ctx context.Context, so dcrypto.SealOpener) error {
+	if err := loadNameIndex(ctx, s.nameIndex, so); err != nil {
+		return fmt.Errorf("failed to load name index: %w", err)
+	}
+
+	for name, file := range s.nameIndex.nameToDoc {
+		meta := s.nameIndex.nameToMetadata[name]
+		if meta == nil {
+			meta = newGridFSMetadata(nil)
+		}
+
+		if meta.Diskhop.SHA256 != "" {
+			continue
+		}
+
+		stream, err := openData(ctx, s.bucket, *file)
+		if err != nil {
+			return fmt.Errorf("failed to open download stream for %q: %w", name, err)
+		}
+
+		hash, err := hashSealed(ctx, so, meta, stream, file.Length)
+
+		_ = stream.Close()
+
+		if err != nil {
+			return fmt.Errorf("failed to hash %q: %w", name, err)
+		}
+
+		meta.Diskhop.SHA256 = hash
+
+		encMeta, err := encryptGridFSMetadata(ctx, so, meta)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt metadata for %q: %w", name, err)
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "metadata", Value: encMeta}}}}
+		if _, err := s.nameIndex.coll.UpdateByID(ctx, file.ID, update); err != nil {
+			return fmt.Errorf("failed to update metadata for %q: %w", name, err)
+		}
+
+		s.nameIndex.nameToMetadata[name] = meta
+	}
+
+	return nil
+}
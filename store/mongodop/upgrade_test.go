@@ -0,0 +1,69 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/exp/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashContents(t *testing.T) {
+	ctx := context.Background()
+
+	block, err := aes.NewCipher([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	aead := dcrypto.NewAEAD(&test.MockIVManager{}, aesgcm)
+
+	plaintext := strings.Repeat("diskhop", 1000)
+	sum := sha256.Sum256([]byte(plaintext))
+
+	t.Run("sealed whole", func(t *testing.T) {
+		sealed, err := aead.Seal(ctx, []byte(plaintext))
+		require.NoError(t, err)
+
+		got, err := hashSealed(ctx, aead, newGridFSMetadata(nil), bytes.NewReader(sealed), int64(len(sealed)))
+		require.NoError(t, err)
+
+		assert.Equal(t, hex.EncodeToString(sum[:]), got)
+	})
+
+	t.Run("sealed as a stream", func(t *testing.T) {
+		var sealed bytes.Buffer
+		require.NoError(t, aead.SealStream(ctx, &sealed, strings.NewReader(plaintext), 64))
+
+		meta := newGridFSMetadata(nil)
+		meta.Diskhop.ChunkSize = 64
+
+		got, err := hashSealed(ctx, aead, meta, &sealed, int64(sealed.Len()))
+		require.NoError(t, err)
+
+		assert.Equal(t, hex.EncodeToString(sum[:]), got)
+	})
+}
@@ -0,0 +1,241 @@
+//
+// Copyright 2024 Preston Vasquez
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// upload writes body to the bucket as a new file and returns its ID. Bodies
+// that can seek, or that are spilled to a temporary file first, are retried on
+// transient errors, resuming after the chunks that were already written;
+// other bodies are uploaded once. A failed upload never leaves chunks behind.
+func (p *Pusher) upload(ctx context.Context, filename string, body io.Reader, meta bson.Raw) (primitive.ObjectID, error) {
+	id := primitive.NewObjectID()
+
+	if _, ok := body.(io.ReadSeeker); !ok && p.spillDir != "" {
+		spill, err := spillBody(p.spillDir, body)
+		if err != nil {
+			return primitive.NilObjectID, err
+		}
+
+		defer func() {
+			_ = spill.Close()
+			_ = os.Remove(spill.Name())
+		}()
+
+		body = spill
+	}
+
+	var err error
+	if rs, ok := body.(io.ReadSeeker); ok {
+		err = p.uploadResumable(ctx, id, filename, rs, meta)
+	} else {
+		gridFSOpts := options.GridFSUpload()
+		if len(meta) > 0 {
+			gridFSOpts.SetMetadata(meta)
+		}
+
+		err = p.bucket.UploadFromStreamWithID(id, filename, body, gridFSOpts)
+	}
+
+	if err != nil {
+		if delErr := deletePartialUpload(ctx, p.bucket, id); delErr != nil {
+			err = errors.Join(err, delErr)
+		}
+
+		return primitive.NilObjectID, err
+	}
+
+	return id, nil
+}
+
+// spillBody copies body to a temporary file in dir, returning the file at its
+// start.
+func spillBody(dir string, body io.Reader) (*os.File, error) {
+	spill, err := os.CreateTemp(dir, "diskhop-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	if _, err = io.Copy(spill, body); err == nil {
+		_, err = spill.Seek(0, io.SeekStart)
+	}
+
+	if err != nil {
+		_ = spill.Close()
+		_ = os.Remove(spill.Name())
+
+		return nil, fmt.Errorf("failed to spill upload: %w", err)
+	}
+
+	return spill, nil
+}
+
+// deletePartialUpload removes the chunks and, if it was written, the files
+// document of a failed upload.
+func deletePartialUpload(ctx context.Context, bucket *gridfs.Bucket, id interface{}) error {
+	err := bucket.DeleteContext(ctx, id)
+	if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return fmt.Errorf("failed to delete partial upload %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// uploadResumable writes the chunks and files document of a GridFS file
+// directly so that, after a transient failure, the upload resumes from the
+// first chunk that was not written.
+func (p *Pusher) uploadResumable(
+	ctx context.Context,
+	id primitive.ObjectID,
+	filename string,
+	body io.ReadSeeker,
+	meta bson.Raw,
+) error {
+	if err := p.ensureIndexes(ctx); err != nil {
+		return err
+	}
+
+	length, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek to end of upload: %w", err)
+	}
+
+	fileDoc := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "length", Value: length},
+		{Key: "chunkSize", Value: p.chunkSize},
+		{Key: "uploadDate", Value: time.Now().UTC()},
+		{Key: "filename", Value: filename},
+	}
+
+	if len(meta) > 0 {
+		fileDoc = append(fileDoc, bson.E{Key: "metadata", Value: meta})
+	}
+
+	buf := make([]byte, p.chunkSize)
+
+	err = store.RetryWithPolicy(ctx, transientRetryPolicy, func() error {
+		if err := p.writeRemainingChunks(ctx, id, body, buf); err != nil {
+			return err
+		}
+
+		// A retried insert may find the document from an attempt whose
+		// acknowledgement was lost.
+		_, err := p.bucket.GetFilesCollection().InsertOne(ctx, fileDoc)
+		if mongo.IsDuplicateKeyError(err) {
+			return nil
+		}
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+
+	return nil
+}
+
+// writeRemainingChunks writes the chunks of body that are not yet in the
+// chunks collection. Chunks are inserted in order, so the number already
+// stored is the index of the first missing chunk.
+func (p *Pusher) writeRemainingChunks(ctx context.Context, id primitive.ObjectID, body io.ReadSeeker, buf []byte) error {
+	chunks := p.bucket.GetChunksCollection()
+
+	written, err := chunks.CountDocuments(ctx, bson.D{{Key: "files_id", Value: id}})
+	if err != nil {
+		return fmt.Errorf("failed to count written chunks: %w", err)
+	}
+
+	if _, err := body.Seek(written*int64(len(buf)), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek to chunk %d: %w", written, err)
+	}
+
+	for n := written; ; n++ {
+		size, err := io.ReadFull(body, buf)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read chunk %d: %w", n, err)
+		}
+
+		chunk := bson.D{
+			{Key: "_id", Value: primitive.NewObjectID()},
+			{Key: "files_id", Value: id},
+			{Key: "n", Value: int32(n)},
+			{Key: "data", Value: primitive.Binary{Data: buf[:size]}},
+		}
+
+		if _, err := chunks.InsertOne(ctx, chunk); err != nil {
+			return fmt.Errorf("failed to write chunk %d: %w", n, err)
+		}
+
+		if size < len(buf) {
+			return nil
+		}
+	}
+}
+
+// ensureIndexes creates the indexes that the driver creates before the first
+// write to a bucket, since resumable uploads bypass the driver's upload
+// stream.
+func (p *Pusher) ensureIndexes(ctx context.Context) error {
+	if p.indexesEnsured {
+		return nil
+	}
+
+	filesIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "filename", Value: 1}, {Key: "uploadDate", Value: 1}},
+	}
+
+	if _, err := p.bucket.GetFilesCollection().Indexes().CreateOne(ctx, filesIndex); err != nil {
+		return fmt.Errorf("failed to create files index: %w", err)
+	}
+
+	// Removing old files finds them by their upload date alone.
+	dateIndex := mongo.IndexModel{Keys: bson.D{{Key: "uploadDate", Value: 1}}}
+
+	if _, err := p.bucket.GetFilesCollection().Indexes().CreateOne(ctx, dateIndex); err != nil {
+		return fmt.Errorf("failed to create upload date index: %w", err)
+	}
+
+	chunksIndex := mongo.IndexModel{
+		Keys:    bson.D{{Key: "files_id", Value: 1}, {Key: "n", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	if _, err := p.bucket.GetChunksCollection().Indexes().CreateOne(ctx, chunksIndex); err != nil {
+		return fmt.Errorf("failed to create chunks index: %w", err)
+	}
+
+	p.indexesEnsured = true
+
+	return nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// newMockTest returns a test whose client talks to a mock deployment. The
+// driver does not retry writes itself, so that the retries under test are
+// those of the store.
+func newMockTest(t *testing.T) *mtest.T {
+	t.Helper()
+
+	return mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetRetryWrites(false)))
+}
+
+// sentCommands returns the commands with the name run against coll that the
+// mock deployment received.
+func sentCommands(mt *mtest.T, name, coll string) []bson.Raw {
+	mt.Helper()
+
+	var cmds []bson.Raw
+
+	for _, evt := range mt.GetAllStartedEvents() {
+		if evt.CommandName == name && evt.Command.Lookup(name).StringValue() == coll {
+			cmds = append(cmds, evt.Command)
+		}
+	}
+
+	return cmds
+}
+
+// insertedDocuments returns the documents inserted into coll.
+func insertedDocuments(mt *mtest.T, coll string) []bson.Raw {
+	mt.Helper()
+
+	var docs []bson.Raw
+
+	for _, cmd := range sentCommands(mt, "insert", coll) {
+		values, err := cmd.Lookup("documents").Array().Values()
+		require.NoError(mt, err)
+
+		for _, value := range values {
+			docs = append(docs, value.Document())
+		}
+	}
+
+	return docs
+}
+
+func TestUpload(t *testing.T) {
+	mt := newMockTest(t)
+
+	interrupted := mtest.CommandError{Code: 11600, Message: "interrupted", Labels: []string{"RetryableWriteError"}}
+
+	newPusher := func(mt *mtest.T) *Pusher {
+		bucket, err := gridfs.NewBucket(mt.DB)
+		require.NoError(mt, err)
+
+		return &Pusher{bucket: bucket, chunkSize: 4, indexesEnsured: true}
+	}
+
+	mt.Run("resumes after the written chunks", func(mt *mtest.T) {
+		ns := mt.DB.Name() + ".fs.chunks"
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(interrupted),
+			// The retry finds the first chunk written.
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		_, err := newPusher(mt).upload(context.Background(), "a", strings.NewReader("0123456789"), nil)
+		require.NoError(mt, err)
+
+		var chunks []int32
+		for _, chunk := range insertedDocuments(mt, "fs.chunks") {
+			chunks = append(chunks, chunk.Lookup("n").Int32())
+		}
+
+		assert.Equal(mt, []int32{0, 1, 1, 2}, chunks)
+
+		files := insertedDocuments(mt, "fs.files")
+		require.Len(mt, files, 1)
+
+		file := files[0]
+		assert.Equal(mt, int64(10), file.Lookup("length").Int64())
+		assert.Equal(mt, "a", file.Lookup("filename").StringValue())
+	})
+
+	mt.Run("resumes a spilled body", func(mt *mtest.T) {
+		ns := mt.DB.Name() + ".fs.chunks"
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(interrupted),
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+		)
+
+		p := newPusher(mt)
+		p.spillDir = mt.TempDir()
+
+		// A reader that cannot seek, like the pipe of a file sealed as a
+		// stream.
+		body := io.MultiReader(strings.NewReader("0123456789"))
+
+		_, err := p.upload(context.Background(), "a", body, nil)
+		require.NoError(mt, err)
+
+		var chunks []int32
+		for _, chunk := range insertedDocuments(mt, "fs.chunks") {
+			chunks = append(chunks, chunk.Lookup("n").Int32())
+		}
+
+		assert.Equal(mt, []int32{0, 1, 1, 2}, chunks)
+
+		spilled, err := os.ReadDir(p.spillDir)
+		require.NoError(mt, err)
+		assert.Empty(mt, spilled, "the spill file is removed")
+	})
+
+	mt.Run("deletes the chunks of a failed upload", func(mt *mtest.T) {
+		ns := mt.DB.Name() + ".fs.chunks"
+
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, ns, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 2, Message: "bad value"}),
+			// The partial upload has no files document, only chunks.
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		id, err := newPusher(mt).upload(context.Background(), "a", strings.NewReader("0123456789"), nil)
+		assert.ErrorContains(mt, err, "bad value")
+		assert.True(mt, id.IsZero())
+
+		assert.Len(mt, sentCommands(mt, "delete", "fs.files"), 1)
+		assert.Len(mt, sentCommands(mt, "delete", "fs.chunks"), 1, "the written chunk is deleted")
+	})
+}
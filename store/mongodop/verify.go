@@ -0,0 +1,155 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+var _ store.Verifier = &Pusher{}
+
+// errNotDurable is returned when a pushed file cannot be read back with a
+// majority read concern, so that a rollback of the replica set could still
+// lose it.
+var errNotDurable = errors.New("the file is not stored by a majority of the replica set")
+
+// errContentMismatch is returned when a pushed file does not hold the contents
+// that were pushed.
+var errContentMismatch = errors.New("the stored file does not match the pushed file")
+
+// durableRetryPolicy waits for a file written with a weaker write concern to
+// be replicated to a majority, for about six seconds in all.
+var durableRetryPolicy = store.RetryPolicy{
+	Attempts: 6,
+	Delay:    200 * time.Millisecond,
+	Retryable: func(err error) bool {
+		return errors.Is(err, errNotDurable) || isTransient(err)
+	},
+}
+
+// majority returns the collection read from the primary with a majority read
+// concern, which only sees writes that a rollback cannot undo.
+func majority(coll *mongo.Collection) *mongo.Collection {
+	opts := options.Collection().
+		SetReadConcern(readconcern.Majority()).
+		SetReadPreference(readpref.Primary())
+
+	return coll.Database().Collection(coll.Name(), opts)
+}
+
+// VerifyPush reads back the files document with the GridFS filename id, the
+// chunks holding its data and its encrypted name, with a majority read
+// concern. Writes made with a weaker write concern are waited for until they
+// are replicated to a majority. The size and hash recorded in the metadata of
+// the file must be those of want.
+func (p *Pusher) VerifyPush(ctx context.Context, id string, want store.Digest, opts ...store.PushOption) (err error) {
+	defer func() { err = classifyError(err) }()
+
+	var pushOpts store.PushOptions
+	for _, opt := range opts {
+		opt(&pushOpts)
+	}
+
+	files := majority(p.bucket.GetFilesCollection())
+	chunks := majority(p.bucket.GetChunksCollection())
+
+	return store.RetryWithPolicy(ctx, durableRetryPolicy, func() error {
+		var file gridfs.File
+
+		err := files.FindOne(ctx, bson.D{{Key: "filename", Value: id}}).Decode(&file)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("failed to verify %q: %w", id, errNotDurable)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to verify %q: %w", id, err)
+		}
+
+		if err := checkDigest(ctx, file, want, pushOpts); err != nil {
+			return fmt.Errorf("failed to verify %q: %w", id, err)
+		}
+
+		var chunkCount int64
+		if file.ChunkSize > 0 {
+			chunkCount = (file.Length + int64(file.ChunkSize) - 1) / int64(file.ChunkSize)
+		}
+
+		n, err := chunks.CountDocuments(ctx, bson.D{{Key: "files_id", Value: dataID(file)}})
+		if err != nil {
+			return fmt.Errorf("failed to verify the data of %q: %w", id, err)
+		}
+
+		if n < chunkCount {
+			return fmt.Errorf("failed to verify the data of %q, %d of %d chunks are stored: %w", id, n, chunkCount, errNotDurable)
+		}
+
+		if !p.nameIndex.storesNames() {
+			return nil
+		}
+
+		nameID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return fmt.Errorf("failed to convert file name to object ID: %w", err)
+		}
+
+		n, err = majority(p.nameIndex.nameColl).CountDocuments(ctx, bson.D{{Key: "_id", Value: nameID}})
+		if err != nil {
+			return fmt.Errorf("failed to verify the name of %q: %w", id, err)
+		}
+
+		if n == 0 {
+			return fmt.Errorf("failed to verify the name of %q: %w", id, errNotDurable)
+		}
+
+		return nil
+	})
+}
+
+// checkDigest returns errContentMismatch unless the metadata of the file
+// records the size and hash of want. The hash of a file sealed as a stream is
+// recorded after its upload, so a file without one may not be replicated yet.
+func checkDigest(ctx context.Context, file gridfs.File, want store.Digest, opts store.PushOptions) error {
+	meta, err := decryptGridFSMetadata(ctx, opts.SealOpenerForMetadata(), file.Metadata)
+	if err != nil {
+		return err
+	}
+
+	if meta.Diskhop.Size != want.Size {
+		return fmt.Errorf("%d bytes are stored instead of %d: %w", meta.Diskhop.Size, want.Size, errContentMismatch)
+	}
+
+	switch got := meta.Diskhop.SHA256; {
+	case want.SHA256 == "":
+		return nil
+	case got == "":
+		return errNotDurable
+	case got != want.SHA256:
+		return fmt.Errorf("hash %s is stored instead of %s: %w", got, want.SHA256, errContentMismatch)
+	}
+
+	return nil
+}
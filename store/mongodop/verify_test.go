@@ -0,0 +1,93 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/exp/test"
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+func TestCheckDigest(t *testing.T) {
+	t.Parallel()
+
+	block, err := aes.NewCipher([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+
+	aesgcm, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	opts := store.PushOptions{SealOpener: dcrypto.NewAEAD(&test.MockIVManager{}, aesgcm)}
+
+	tests := []struct {
+		name    string
+		stored  store.Metadata
+		want    store.Digest
+		wantErr error
+	}{
+		{
+			name:   "match",
+			stored: store.Metadata{Size: 4, SHA256: "abc"},
+			want:   store.Digest{Size: 4, SHA256: "abc"},
+		},
+		{
+			name:   "no hash wanted",
+			stored: store.Metadata{Size: 4, SHA256: "abc"},
+			want:   store.Digest{Size: 4},
+		},
+		{
+			name:    "size mismatch",
+			stored:  store.Metadata{Size: 3, SHA256: "abc"},
+			want:    store.Digest{Size: 4, SHA256: "abc"},
+			wantErr: errContentMismatch,
+		},
+		{
+			name:    "hash mismatch",
+			stored:  store.Metadata{Size: 4, SHA256: "abd"},
+			want:    store.Digest{Size: 4, SHA256: "abc"},
+			wantErr: errContentMismatch,
+		},
+		{
+			name:    "hash not yet recorded",
+			stored:  store.Metadata{Size: 4},
+			want:    store.Digest{Size: 4, SHA256: "abc"},
+			wantErr: errNotDurable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			meta, err := encryptGridFSMetadata(context.Background(), opts.SealOpener, &gridfsMetadata{Diskhop: tt.stored})
+			require.NoError(t, err)
+
+			err = checkDigest(context.Background(), gridfs.File{Metadata: meta}, tt.want, opts)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
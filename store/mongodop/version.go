@@ -0,0 +1,321 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A push that replaces a file keeps the old version, so that reverting the
+// push can restore it. The files document of the old version is moved from
+// the bucket to its versions collection, which the name index and pulls do
+// not read, while its chunks and encrypted name stay where they are.
+//
+// The versions of a file form a chain: each files document records the line
+// it belongs to, which is the hex name of the first version of the file, and
+// each version records the hex name of the file that replaced it and when.
+
+// errSuperseded is returned when reverting a push whose file was replaced by
+// a later push.
+var errSuperseded = errors.New("the file was replaced by a later push, revert that push first")
+
+// errVersionPruned is returned when reverting a push whose replaced versions
+// have been pruned, since reverting it would lose the files without restoring
+// them.
+var errVersionPruned = errors.New("the versions it restores have been pruned")
+
+const (
+	filesSuffix    = ".files"
+	versionsSuffix = ".versions"
+)
+
+// Fields added to the files documents to chain their versions.
+const (
+	lineKey       = "line"
+	replacedByKey = "replacedBy"
+	retiredAtKey  = "retiredAt"
+)
+
+// VersionPolicy is whether and how many of the versions replaced by pushes are
+// kept. The zero policy keeps none, so that pushes delete the files they
+// replace and reverts cannot restore them.
+type VersionPolicy struct {
+	// Enabled keeps the versions replaced by pushes.
+	Enabled bool
+
+	// Keep is the number of replaced versions kept per file when versioning
+	// is enabled. Zero keeps any number, and a negative number keeps none.
+	Keep int
+
+	// MaxAge, if set, prunes the versions replaced longer ago than it.
+	MaxAge time.Duration
+}
+
+func (vp VersionPolicy) disabled() bool {
+	return !vp.Enabled || vp.Keep < 0
+}
+
+// WithVersionPolicy sets how many of the versions replaced by pushes are kept.
+func WithVersionPolicy(vp VersionPolicy) ConnectOption {
+	return func(o *ConnectOptions) {
+		o.Versions = vp
+	}
+}
+
+// versionsColl returns the collection that keeps the replaced versions of the
+// files in files.
+func versionsColl(files *mongo.Collection) *mongo.Collection {
+	name := strings.TrimSuffix(files.Name(), filesSuffix) + versionsSuffix
+
+	return files.Database().Collection(name)
+}
+
+// retireVersion moves the files document with the ID from files to the
+// versions collection, chaining it to the file with the ID newID and the hex
+// name replacedBy.
+func retireVersion(
+	ctx context.Context,
+	files *mongo.Collection,
+	id, newID primitive.ObjectID,
+	replacedBy string,
+) error {
+	filter := bson.D{{Key: "_id", Value: id}}
+
+	var doc bson.M
+	if err := files.FindOne(ctx, filter).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to find the old file with id %q: %w", id, err)
+	}
+
+	line, _ := doc[lineKey].(string)
+	if line == "" {
+		line, _ = doc["filename"].(string)
+	}
+
+	doc[lineKey] = line
+	doc[replacedByKey] = replacedBy
+	doc[retiredAtKey] = time.Now()
+
+	if _, err := versionsColl(files).InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("failed to keep the old file with id %q: %w", id, err)
+	}
+
+	if _, err := files.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to remove the old file with id %q: %w", id, err)
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: lineKey, Value: line}}}}
+	if _, err := files.UpdateOne(ctx, bson.D{{Key: "_id", Value: newID}}, update); err != nil {
+		return fmt.Errorf("failed to chain the new file with id %q: %w", newID, err)
+	}
+
+	return nil
+}
+
+// restoreVersion moves the files document with the hex name from the
+// versions collection back to files.
+func restoreVersion(ctx context.Context, files *mongo.Collection, name string) error {
+	versions := versionsColl(files)
+	filter := bson.D{{Key: "filename", Value: name}}
+
+	var doc bson.M
+	if err := versions.FindOne(ctx, filter).Decode(&doc); err != nil {
+		return fmt.Errorf("failed to find the version %q, it may have been pruned: %w", name, err)
+	}
+
+	delete(doc, replacedByKey)
+	delete(doc, retiredAtKey)
+
+	if _, err := files.InsertOne(ctx, doc); err != nil {
+		return fmt.Errorf("failed to restore the version %q: %w", name, err)
+	}
+
+	if _, err := versions.DeleteOne(ctx, filter); err != nil {
+		return fmt.Errorf("failed to remove the restored version %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// checkVersions returns an error naming the versions with the hex names that
+// are no longer kept.
+func checkVersions(ctx context.Context, files *mongo.Collection, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	filter := bson.D{{Key: "filename", Value: bson.D{{Key: "$in", Value: names}}}}
+	projection := options.Find().SetProjection(bson.D{{Key: "filename", Value: 1}})
+
+	cur, err := versionsColl(files).Find(ctx, filter, projection)
+	if err != nil {
+		return fmt.Errorf("failed to find the versions: %w", err)
+	}
+
+	var found []struct {
+		Name string `bson:"filename"`
+	}
+
+	if err := cur.All(ctx, &found); err != nil {
+		return fmt.Errorf("failed to decode the versions: %w", err)
+	}
+
+	kept := make(map[string]bool, len(found))
+	for _, version := range found {
+		kept[version.Name] = true
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !kept[name] {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", errVersionPruned, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// isVersion reports whether the file with the hex name is a replaced version.
+func isVersion(ctx context.Context, files *mongo.Collection, name string) (bool, error) {
+	n, err := versionsColl(files).CountDocuments(ctx, bson.D{{Key: "filename", Value: name}})
+	if err != nil {
+		return false, fmt.Errorf("failed to find the version %q: %w", name, err)
+	}
+
+	return n > 0, nil
+}
+
+// pruneVersions deletes the versions that the policy does not keep: those
+// beyond the newest Keep in the line of the file with the ID and, once per
+// pusher, those of any file retired longer ago than MaxAge.
+func (p *Pusher) pruneVersions(ctx context.Context, id primitive.ObjectID) error {
+	files := p.bucket.GetFilesCollection()
+
+	if p.versions.MaxAge > 0 && !p.versionsAged {
+		cutoff := time.Now().Add(-p.versions.MaxAge)
+		filter := bson.D{{Key: retiredAtKey, Value: bson.D{{Key: "$lt", Value: cutoff}}}}
+
+		if err := p.deleteVersions(ctx, filter, 0); err != nil {
+			return err
+		}
+
+		p.versionsAged = true
+	}
+
+	if p.versions.Keep <= 0 {
+		return nil
+	}
+
+	var file struct {
+		Line string `bson:"line"`
+	}
+
+	if err := files.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&file); err != nil {
+		return fmt.Errorf("failed to find the file with id %q: %w", id, err)
+	}
+
+	return p.deleteVersions(ctx, bson.D{{Key: lineKey, Value: file.Line}}, p.versions.Keep)
+}
+
+// deleteVersions deletes the versions that match the filter, except for the
+// newest skip of them.
+func (p *Pusher) deleteVersions(ctx context.Context, filter bson.D, skip int) error {
+	opts := options.Find().
+		SetSort(bson.D{{Key: retiredAtKey, Value: -1}}).
+		SetSkip(int64(skip))
+
+	cur, err := versionsColl(p.bucket.GetFilesCollection()).Find(ctx, filter, opts)
+	if err != nil {
+		return fmt.Errorf("failed to find versions: %w", err)
+	}
+
+	var versions []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		Filename string             `bson:"filename"`
+	}
+
+	if err := cur.All(ctx, &versions); err != nil {
+		return fmt.Errorf("failed to decode versions: %w", err)
+	}
+
+	for _, version := range versions {
+		if err := p.deleteVersion(ctx, version.ID, version.Filename); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteVersion deletes the files document, chunks and name of a version.
+// Chunks that other files link to are kept.
+func (p *Pusher) deleteVersion(ctx context.Context, id primitive.ObjectID, name string) error {
+	versions := versionsColl(p.bucket.GetFilesCollection())
+
+	var version gridfs.File
+	if err := versions.FindOneAndDelete(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&version); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("failed to prune the version %q: %w", name, err)
+	}
+
+	version.ID = id
+
+	if err := releaseFile(ctx, p.bucket, version); err != nil {
+		return fmt.Errorf("failed to remove the data of the version %q: %w", name, err)
+	}
+
+	if err := p.nameIndex.deleteName(ctx, name); err != nil {
+		return fmt.Errorf("failed to prune the version %q: %w", name, err)
+	}
+
+	return nil
+}
+
+// recordReplaced remembers that the push of the file with the hex name
+// replaced the version with the hex name old, until its commit is added.
+func (p *Pusher) recordReplaced(name, old string) {
+	p.replacedMu.Lock()
+	defer p.replacedMu.Unlock()
+
+	if p.replaced == nil {
+		p.replaced = make(map[string]string)
+	}
+
+	p.replaced[name] = old
+}
+
+// takeReplaced returns and forgets the version replaced by the push of the
+// file with the hex name, if any.
+func (p *Pusher) takeReplaced(name string) string {
+	p.replacedMu.Lock()
+	defer p.replacedMu.Unlock()
+
+	old := p.replaced[name]
+	delete(p.replaced, name)
+
+	return old
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+// Observer is told of the files of a push or pull as they move, such as to
+// drive a user interface. Files are named as they are on the remote host.
+// Pull events are sent from the download workers as well as the caller, so
+// an Observer must be safe for concurrent use.
+type Observer interface {
+	// OnFileStart is called when the transfer of a file begins.
+	OnFileStart(name string)
+
+	// OnFileDone is called when a file has been transferred, with the number
+	// of bytes written.
+	OnFileDone(name string, bytes int64)
+
+	// OnError is called when the transfer of a file fails.
+	OnError(name string, err error)
+
+	// OnBatchDone is called once every file has been transferred, with the
+	// number of files and bytes written.
+	OnBatchDone(files int, bytes int64)
+}
+
+// ProgressObserver is an Observer that is also told of the bytes of a file as
+// they move, by the transfers that report them.
+type ProgressObserver interface {
+	Observer
+
+	// OnFileProgress is called as a file is transferred, with the number of
+	// bytes moved since the last call.
+	OnFileProgress(name string, bytes int64)
+}
+
+// NopObserver ignores every event. Embedding it lets an Observer implement
+// only the events it cares about.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+func (NopObserver) OnFileStart(string)       {}
+func (NopObserver) OnFileDone(string, int64) {}
+func (NopObserver) OnError(string, error)    {}
+func (NopObserver) OnBatchDone(int, int64)   {}
+
+// Observe returns o, or an observer that ignores every event if o is nil.
+func Observe(o Observer) Observer {
+	if o == nil {
+		return NopObserver{}
+	}
+
+	return o
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// RetentionPolicy is how much of a branch pruning keeps. The zero policy
+// keeps everything.
+type RetentionPolicy struct {
+	// KeepVersions is the number of replaced versions kept per file. Zero
+	// keeps any number, and a negative number keeps none.
+	KeepVersions int
+
+	// VersionMaxAge, if set, deletes the versions replaced longer ago than
+	// it.
+	VersionMaxAge time.Duration
+
+	// MaxAge, if set, deletes the files pushed longer ago than it, with
+	// their versions.
+	MaxAge time.Duration
+
+	// MaxSize, if set, deletes the oldest files, with their versions, until
+	// the branch stores at most this many bytes, counted as in Stats.
+	MaxSize int64
+}
+
+// PrunedFile is a file or replaced version that pruning deletes.
+type PrunedFile struct {
+	ID         string    `json:"id"`         // ID of the file on the remote host
+	Name       string    `json:"name"`       // Decrypted name, empty if it could not be read
+	Version    bool      `json:"version"`    // A replaced version rather than a current file
+	Size       int64     `json:"size"`       // Stored size in bytes
+	UploadDate time.Time `json:"uploadDate"` // When the file was pushed
+	Reason     string    `json:"reason"`     // The part of the policy that deletes it
+}
+
+// Pruner is an interface that defines the behavior of enforcing a retention
+// policy.
+type Pruner interface {
+	// Prune deletes the files and versions of the branch that the policy
+	// does not keep, with their names and the commits that wrote them,
+	// returning the number deleted.
+	Prune(ctx context.Context, policy RetentionPolicy) (int, error)
+
+	// DescribePrune lists what Prune would delete, without deleting
+	// anything. The names are decrypted with opener, if set.
+	DescribePrune(ctx context.Context, policy RetentionPolicy, opener dcrypto.Opener) ([]PrunedFile, error)
+}
@@ -16,14 +16,56 @@ package store
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/prestonvasquez/diskhop/exp/dcrypto"
 )
 
 const DefaultSampleSize = 5
 
+// ErrNotSingleMatch is returned by a single-file pull when the selection does
+// not resolve to exactly one file.
+var ErrNotSingleMatch = errors.New("selection does not match exactly one file")
+
+// ErrFileNotFound is returned when a file requested by name does not exist on
+// the remote host. It is an ErrNotFound.
+var ErrFileNotFound = fmt.Errorf("file %w", ErrNotFound)
+
 type PullDescription struct {
-	Count int
+	Count        int
+	Size         int64             // Bytes in the selected files
+	Files        []FileDescription // Populated when describing files
+	Explanations []FileExplanation // Populated when explaining the selection
+	Stats        *SizeStats        // Populated when summarizing the sizes
+}
+
+// SizeStats summarizes the sizes of the files selected by a pull.
+type SizeStats struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	Min   int64 `json:"min"`
+	Max   int64 `json:"max"`
+	Avg   int64 `json:"avg"`
+}
+
+// FileExplanation describes how the selection of a pull treated a candidate
+// file.
+type FileExplanation struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	Matched bool   `json:"matched"` // The file matched the filter or was named
+	Sampled bool   `json:"sampled"` // The file was chosen by the sampling
+	Reason  string `json:"reason"`
+}
+
+// FileDescription describes a single file selected by a pull.
+type FileDescription struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Tags       []string  `json:"tags"`
+	UploadDate time.Time `json:"uploadDate"`
 }
 
 // Puller is an interface that defines the behavior of pulling a slice of
@@ -35,12 +77,51 @@ type Puller interface {
 
 // PullOptions is a type for setting options for the pull operation.
 type PullOptions struct {
-	SampleSize   int    // The number of documents to pull.
-	Filter       string // Filter string
-	SealOpener   dcrypto.SealOpener
-	DescribeOnly bool
-	Workers      int
-	MaskName     bool // Use a UUID as a mask name
+	SampleSize    int    // The number of documents to pull.
+	Filter        string // Filter string
+	SealOpener    dcrypto.SealOpener
+	DescribeOnly  bool
+	DescribeFiles bool // List the selected files, implies DescribeOnly
+	Workers       int
+	MaskName      bool          // Use a UUID with the original extension as the name
+	Limiter       *Limiter      // Bounds concurrent downloads
+	MemoryBudget  *MemoryBudget // Bounds the bytes of the files held in memory
+	Single        bool          // Require the selection to match exactly one file
+	Names         []string      // Pull exactly these files, bypassing filter and sampling
+	Explain       bool          // Explain the selection of each file, implies DescribeOnly
+	Exclude       []string      // Leave these files out of the sample until every match is excluded
+	Stats         bool          // Summarize the sizes of the selected files, implies DescribeOnly
+	Prefix        string        // Only select files under this subpath, naming them relative to it
+	Commit        string        // Select the files as of this commit, bypassing filter and sampling
+
+	// ParallelChunks, if greater than one, is the number of ranges of chunks
+	// of a large file that are downloaded at once, rather than reading the
+	// file through one stream. Stores without chunks ignore it.
+	ParallelChunks int
+
+	// IncludeExcluded selects the files that the exclude policy of the remote
+	// host leaves out. See Excluder.
+	IncludeExcluded bool
+
+	// MetadataSealOpener, if set, decrypts the names and metadata of the
+	// files in place of SealOpener, which then only decrypts their data.
+	MetadataSealOpener dcrypto.SealOpener
+
+	// Resume, if set, returns the number of bytes of the named file that are
+	// already held locally from an interrupted pull. Streamed files resume
+	// from that offset where the store supports it, setting Document.Offset.
+	Resume func(name string) int64
+
+	// ContentFilter, if set, is applied to the decrypted data of each pulled
+	// file, and the files it rejects are discarded rather than written.
+	ContentFilter func(data []byte) bool
+
+	Observer Observer // Told of the progress of each file
+
+	// Raw pulls every file as the store holds it, without decrypting, so that
+	// no key is needed. Each document is named by its stored name, its data
+	// is the ciphertext and Sealed holds its encrypted name and metadata.
+	Raw bool
 }
 
 type PullOption func(*PullOptions)
@@ -63,6 +144,25 @@ func WithPullSealOpener(so dcrypto.SealOpener) PullOption {
 	}
 }
 
+// WithPullMetadataSealOpener sets the sealer and opener for the names and
+// metadata of the files, when they are encrypted with a different key than the
+// data.
+func WithPullMetadataSealOpener(so dcrypto.SealOpener) PullOption {
+	return func(o *PullOptions) {
+		o.MetadataSealOpener = so
+	}
+}
+
+// SealOpenerForMetadata returns the seal opener for the names and metadata of
+// the files, which is SealOpener unless MetadataSealOpener is set.
+func (o PullOptions) SealOpenerForMetadata() dcrypto.SealOpener {
+	if o.MetadataSealOpener != nil {
+		return o.MetadataSealOpener
+	}
+
+	return o.SealOpener
+}
+
 // WithPullDescribe will only describe the pull operation and not actually pull
 // the documents.
 func WithPullDescribe() PullOption {
@@ -71,14 +171,148 @@ func WithPullDescribe() PullOption {
 	}
 }
 
+func WithPullDescribeFiles() PullOption {
+	return func(o *PullOptions) {
+		o.DescribeOnly = true
+		o.DescribeFiles = true
+	}
+}
+
+// WithPullExplain describes, instead of pulling, whether each candidate file
+// matched the filter and the sampling.
+func WithPullExplain() PullOption {
+	return func(o *PullOptions) {
+		o.DescribeOnly = true
+		o.Explain = true
+	}
+}
+
+// WithPullStats describes, instead of pulling, the number of selected files
+// and the total, smallest, largest, and average of their sizes.
+func WithPullStats() PullOption {
+	return func(o *PullOptions) {
+		o.DescribeOnly = true
+		o.Stats = true
+	}
+}
+
+// WithPullPrefix selects only the files stored under the subpath prefix. The
+// names of the selected files, including those given to WithPullNames and
+// WithPullExclude, are relative to the prefix.
+func WithPullPrefix(prefix string) PullOption {
+	return func(o *PullOptions) {
+		o.Prefix = prefix
+	}
+}
+
+// WithPullCommit selects the files as they were right after the push recorded
+// by the commit sha, including the versions that later pushes replaced.
+func WithPullCommit(sha string) PullOption {
+	return func(o *PullOptions) {
+		o.Commit = sha
+	}
+}
+
+// WithPullResume resumes the download of each streamed file from the number of
+// bytes that offset returns for its name.
+func WithPullResume(offset func(name string) int64) PullOption {
+	return func(o *PullOptions) {
+		o.Resume = offset
+	}
+}
+
+// WithPullObserver sets the observer told of the progress of each pulled file.
+func WithPullObserver(observer Observer) PullOption {
+	return func(o *PullOptions) {
+		o.Observer = observer
+	}
+}
+
+// WithPullRaw pulls the ciphertext and encrypted metadata of the files without
+// decrypting them.
+func WithPullRaw() PullOption {
+	return func(o *PullOptions) {
+		o.Raw = true
+	}
+}
+
 func WithWorkers(workers int) PullOption {
 	return func(o *PullOptions) {
 		o.Workers = workers
 	}
 }
 
+// WithPullMemoryBudget bounds the bytes of the files that the pull holds in
+// memory at once. The workers wait before reading a file whose bytes would not
+// fit, until the files held before it are released.
+func WithPullMemoryBudget(b *MemoryBudget) PullOption {
+	return func(o *PullOptions) {
+		o.MemoryBudget = b
+	}
+}
+
+// WithPullParallelChunks downloads each large file as n ranges of chunks at
+// once, assembled in order, to make better use of high-latency links.
+func WithPullParallelChunks(n int) PullOption {
+	return func(o *PullOptions) {
+		o.ParallelChunks = n
+	}
+}
+
 func WithMaskName() PullOption {
 	return func(o *PullOptions) {
 		o.MaskName = true
 	}
 }
+
+func WithPullLimiter(l *Limiter) PullOption {
+	return func(o *PullOptions) {
+		o.Limiter = l
+	}
+}
+
+// WithPullSingle requires the selection to resolve to exactly one file,
+// failing with ErrNotSingleMatch otherwise.
+func WithPullSingle() PullOption {
+	return func(o *PullOptions) {
+		o.Single = true
+	}
+}
+
+// WithPullExclude leaves the named files out of the random sample. If every
+// file that matches the filter is excluded, the exclusions are ignored so that
+// the sample starts over.
+func WithPullExclude(names ...string) PullOption {
+	return func(o *PullOptions) {
+		o.Exclude = append(o.Exclude, names...)
+	}
+}
+
+// WithPullIncludeExcluded selects the files that the exclude policy of the
+// remote host would leave out, overriding it for the pull.
+func WithPullIncludeExcluded() PullOption {
+	return func(o *PullOptions) {
+		o.IncludeExcluded = true
+	}
+}
+
+// WithPullNames selects exactly the named files, bypassing the filter and
+// random sampling. Pulling fails with ErrFileNotFound if a name is unknown.
+func WithPullNames(names ...string) PullOption {
+	return func(o *PullOptions) {
+		o.Names = append(o.Names, names...)
+	}
+}
+
+// WithPullContentFilter discards the pulled files whose decrypted data do not
+// satisfy match, without writing them.
+//
+// The filter runs after a file is downloaded and decrypted, so a rejected
+// file still costs its full transfer. Files sealed as a stream are also
+// decrypted into memory rather than streamed, so that match sees the whole
+// file. Narrow the selection with a filter or names first where possible.
+func WithPullContentFilter(match func(data []byte) bool) PullOption {
+	return func(o *PullOptions) {
+		o.ContentFilter = match
+	}
+}
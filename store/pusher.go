@@ -26,13 +26,54 @@ type Pusher interface {
 	Push(ctx context.Context, name string, r io.ReadSeeker, opts ...PushOption) (string, error)
 }
 
+// Digest is the size and hex-encoded SHA-256 of the plaintext of a file.
+type Digest struct {
+	Size   int64
+	SHA256 string
+}
+
+// Verifier is implemented by pushers that can confirm that a pushed file is
+// stored durably, so that its local copy can be deleted.
+type Verifier interface {
+	// VerifyPush returns nil once the file with the ID returned by Push, its
+	// data and its name are stored durably by the remote host, and the file
+	// holds the contents described by want. The options are those of the
+	// push, such as the seal opener that its metadata is read with.
+	VerifyPush(ctx context.Context, id string, want Digest, opts ...PushOption) error
+}
+
 type PushOption func(*PushOptions)
 
 // PushOptions defines the options for pushing an object.
 type PushOptions struct {
 	Tags       []string // Metadata tags to associate with the object.
 	SealOpener dcrypto.SealOpener
-	Filter     string // Filter string
+	Filter     string   // Filter string
+	Limiter    *Limiter // Bounds concurrent uploads
+	Batch      string   // ID of the push run, recorded with the data
+	Label      string   // Label of the push run, recorded with the data
+	Prefix     string   // Subpath of the bucket to store the object under
+
+	// MetadataSealOpener, if set, encrypts the names and metadata of the
+	// objects in place of SealOpener, which then only encrypts their data.
+	MetadataSealOpener dcrypto.SealOpener
+
+	// SkipExisting skips objects whose name and content hash match those of
+	// the remote, checked against the loaded name index rather than the
+	// server.
+	SkipExisting bool
+
+	// Dedup stores an object whose contents the remote already holds under
+	// another name as a reference to those contents instead of uploading them
+	// again.
+	Dedup bool
+
+	Observer Observer // Told of the progress of each file
+
+	// Sealed, if set, pushes the object as it was fetched by a raw pull: the
+	// reader holds the ciphertext, the name is the stored name and nothing is
+	// encrypted.
+	Sealed *Sealed
 }
 
 // WithPushTags sets the tags for the object.
@@ -49,6 +90,25 @@ func WithPushSealOpener(so dcrypto.SealOpener) PushOption {
 	}
 }
 
+// WithPushMetadataSealOpener sets the sealer and opener for the names and
+// metadata of the objects, so that they are encrypted with a different key
+// than the data.
+func WithPushMetadataSealOpener(so dcrypto.SealOpener) PushOption {
+	return func(o *PushOptions) {
+		o.MetadataSealOpener = so
+	}
+}
+
+// SealOpenerForMetadata returns the seal opener for the names and metadata of
+// the objects, which is SealOpener unless MetadataSealOpener is set.
+func (o PushOptions) SealOpenerForMetadata() dcrypto.SealOpener {
+	if o.MetadataSealOpener != nil {
+		return o.MetadataSealOpener
+	}
+
+	return o.SealOpener
+}
+
 // WithPushFilter will allow the user to set a filter for the push operation,
 // specifically to avoid downloading chunk data for migration.
 func WithPushFilter(filter string) PushOption {
@@ -56,3 +116,59 @@ func WithPushFilter(filter string) PushOption {
 		o.Filter = filter
 	}
 }
+
+func WithPushLimiter(l *Limiter) PushOption {
+	return func(o *PushOptions) {
+		o.Limiter = l
+	}
+}
+
+// WithPushBatch records the ID and an optional label of the push run in the
+// metadata of each file whose data it writes, so that the files can be
+// selected as a group later.
+func WithPushBatch(id, label string) PushOption {
+	return func(o *PushOptions) {
+		o.Batch = id
+		o.Label = label
+	}
+}
+
+// WithPushPrefix stores the object under the subpath prefix of the bucket, so
+// that it can be pulled with the same prefix.
+func WithPushPrefix(prefix string) PushOption {
+	return func(o *PushOptions) {
+		o.Prefix = prefix
+	}
+}
+
+// WithPushSkipExisting skips pushing objects that already exist on the remote
+// with the same content, so that re-pushing a directory only uploads what
+// changed.
+func WithPushSkipExisting() PushOption {
+	return func(o *PushOptions) {
+		o.SkipExisting = true
+	}
+}
+
+// WithPushDedup makes objects with the same contents as one already on the
+// remote share its storage rather than being uploaded again.
+func WithPushDedup() PushOption {
+	return func(o *PushOptions) {
+		o.Dedup = true
+	}
+}
+
+// WithPushObserver sets the observer told of the progress of each pushed file.
+func WithPushObserver(observer Observer) PushOption {
+	return func(o *PushOptions) {
+		o.Observer = observer
+	}
+}
+
+// WithPushSealed pushes a pre-encrypted object with the encrypted name and
+// metadata of sealed, such as one fetched from another store by a raw pull.
+func WithPushSealed(sealed *Sealed) PushOption {
+	return func(o *PushOptions) {
+		o.Sealed = sealed
+	}
+}
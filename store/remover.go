@@ -0,0 +1,42 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// RemovedFile is a file that removing old files deletes.
+type RemovedFile struct {
+	ID         string    `json:"id"`         // ID of the file on the remote host
+	Name       string    `json:"name"`       // Decrypted name, empty if it could not be read
+	UploadDate time.Time `json:"uploadDate"` // When the file was pushed
+}
+
+// Remover is an interface that defines the behavior of deleting files by age.
+type Remover interface {
+	// RemoveOlderThan deletes the files of the branch pushed before the
+	// time, with the versions they replaced, their names and the commits
+	// that wrote them, returning the number of files deleted.
+	RemoveOlderThan(ctx context.Context, before time.Time) (int, error)
+
+	// DescribeRemoveOlderThan lists the files that RemoveOlderThan would
+	// delete, oldest first, without deleting anything. The names are
+	// decrypted with opener, if set.
+	DescribeRemoveOlderThan(ctx context.Context, before time.Time, opener dcrypto.Opener) ([]RemovedFile, error)
+}
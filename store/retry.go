@@ -0,0 +1,78 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RetryPolicy is how an operation against a remote host is retried when it
+// fails.
+type RetryPolicy struct {
+	Attempts int           // Attempts made before the failure is returned, one if less
+	Delay    time.Duration // Delay before the first retry, doubled after each
+
+	// Retryable reports whether a failure may succeed if retried. If nil,
+	// the failures with ErrUnavailable are retried.
+	Retryable func(error) bool
+}
+
+// retryable reports whether the policy retries err.
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	return errors.Is(err, ErrUnavailable)
+}
+
+// RetryWithPolicy calls fn until it succeeds, fails with an error that the
+// policy does not retry, or has been called as many times as the policy
+// allows. fn must be safe to call again after it fails, such as by resuming
+// or cleaning up after itself. If the context is done while waiting for a
+// retry, its error is returned.
+func RetryWithPolicy(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	delay := policy.Delay
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if !policy.retryable(err) {
+			return err
+		}
+
+		if attempt >= policy.Attempts {
+			if attempt == 1 {
+				return err
+			}
+
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
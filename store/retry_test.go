@@ -0,0 +1,122 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryWithPolicy(t *testing.T) {
+	t.Parallel()
+
+	errFatal := errors.New("fatal")
+
+	tests := []struct {
+		name      string
+		policy    RetryPolicy
+		errs      []error // Returned by the attempts in order, then nil
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name:      "success",
+			policy:    RetryPolicy{Attempts: 3},
+			wantCalls: 1,
+		},
+		{
+			name:      "unavailable is retried by default",
+			policy:    RetryPolicy{Attempts: 3},
+			errs:      []error{ErrUnavailable, ErrUnavailable},
+			wantCalls: 3,
+		},
+		{
+			name:      "other errors are not retried by default",
+			policy:    RetryPolicy{Attempts: 3},
+			errs:      []error{errFatal},
+			wantCalls: 1,
+			wantErr:   errFatal,
+		},
+		{
+			name:      "attempts are used up",
+			policy:    RetryPolicy{Attempts: 2},
+			errs:      []error{ErrUnavailable, ErrUnavailable, ErrUnavailable},
+			wantCalls: 2,
+			wantErr:   ErrUnavailable,
+		},
+		{
+			name:      "no attempts means one",
+			policy:    RetryPolicy{},
+			errs:      []error{ErrUnavailable},
+			wantCalls: 1,
+			wantErr:   ErrUnavailable,
+		},
+		{
+			name: "custom retryable",
+			policy: RetryPolicy{
+				Attempts:  3,
+				Retryable: func(err error) bool { return errors.Is(err, errFatal) },
+			},
+			errs:      []error{errFatal, ErrUnavailable},
+			wantCalls: 2,
+			wantErr:   ErrUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			calls := 0
+			err := RetryWithPolicy(context.Background(), tt.policy, func() error {
+				calls++
+				if calls <= len(tt.errs) {
+					return tt.errs[calls-1]
+				}
+
+				return nil
+			})
+
+			assert.Equal(t, tt.wantCalls, calls)
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetryWithPolicyCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := RetryWithPolicy(ctx, RetryPolicy{Attempts: 3, Delay: time.Hour}, func() error {
+		calls++
+
+		return ErrUnavailable
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
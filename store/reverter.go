@@ -14,13 +14,28 @@
 
 package store
 
-import "context"
+import (
+	"context"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// RevertedFile is a file that reverting a commit deletes.
+type RevertedFile struct {
+	ID       string `json:"id"`       // ID of the file on the remote host
+	Name     string `json:"name"`     // Decrypted name, empty if it could not be read
+	Restores bool   `json:"restores"` // The version the file replaced is restored
+}
 
 // Reverter is an interface that defines the behavior of reverting.
 type Reverter interface {
-	// Revert will DELETE the files associated with the SHA in ALL cases.
-	// This is a WIP and will be updated to support more complex behavior.
-	//
-	// Deprecatd: DO NOT USE IN PRODUCTION, SEE DESCRIPTION.
+	// Revert undoes the push recorded by the commit SHA. The files that it
+	// wrote are deleted, and the versions that they replaced are restored.
+	// A push cannot be reverted once its files have been replaced by a later
+	// push, until that push is reverted.
 	Revert(ctx context.Context, sha string) error
+
+	// DescribeRevert lists the files that Revert would delete for the SHA,
+	// without deleting anything. The names are decrypted with opener, if set.
+	DescribeRevert(ctx context.Context, sha string, opener dcrypto.Opener) ([]RevertedFile, error)
 }
@@ -0,0 +1,30 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// Rewrapper is an interface that defines the behavior of rewrapping the data
+// keys of everything sealed on a remote host, such as for a changed list of
+// recipients, without re-encrypting it.
+type Rewrapper interface {
+	// Rewrap rewraps every sealed value of the remote with rw, returning
+	// the number of files rewrapped.
+	Rewrap(ctx context.Context, rw dcrypto.Rewrapper) (int, error)
+}
@@ -0,0 +1,31 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import "context"
+
+// Stats summarizes the contents of a remote host.
+type Stats struct {
+	FileCount     int64  // Number of files stored
+	TotalSize     int64  // Stored size in bytes, including encryption overhead
+	FormatVersion int    // Layout version of the remote
+	NameEncoding  string // How file names are stored, if the remote has a choice
+}
+
+// Stater is an interface that defines the behavior of summarizing a remote
+// host without transferring any file data.
+type Stater interface {
+	Stats(ctx context.Context) (*Stats, error)
+}
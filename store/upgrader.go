@@ -0,0 +1,29 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package store
+
+import (
+	"context"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+)
+
+// Upgrader is an interface that defines the behavior of migrating a remote
+// host to the newest layout this client understands.
+type Upgrader interface {
+	// Upgrade migrates the remote forward, returning the format versions
+	// before and after the migration.
+	Upgrade(ctx context.Context, so dcrypto.SealOpener) (from, to int, err error)
+}
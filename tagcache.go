@@ -0,0 +1,160 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/prestonvasquez/diskhop/exp/dcrypto"
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+)
+
+// TagCacheName is the name of the file that holds the encrypted tags of the
+// local files that a pull cleaned, by file name, so that tags edited locally
+// are not lost when the files are pulled again. See FilePuller.TagMerge.
+const TagCacheName = ".diskhop-tags"
+
+const (
+	// TagMergeRemoteWins tags a file pulled again with its remote tags,
+	// ignoring the local ones.
+	TagMergeRemoteWins = "remote-wins"
+
+	// TagMergeLocalWins tags a file pulled again with the tags it had
+	// locally when it was cleaned, ignoring the remote ones.
+	TagMergeLocalWins = "local-wins"
+
+	// TagMergeUnion tags a file pulled again with both its remote tags and
+	// the tags it had locally.
+	TagMergeUnion = "union"
+)
+
+// ValidateTagMerge returns an error if policy is not a supported tag merge
+// policy. An empty policy keeps no tag cache.
+func ValidateTagMerge(policy string) error {
+	switch policy {
+	case "", TagMergeRemoteWins, TagMergeLocalWins, TagMergeUnion:
+		return nil
+	default:
+		return fmt.Errorf("unknown tag merge policy %q, expected %q, %q or %q",
+			policy, TagMergeRemoteWins, TagMergeLocalWins, TagMergeUnion)
+	}
+}
+
+// mergeTags returns the tags of a file pulled again, with the remote tags and
+// those it had locally, under the policy.
+func mergeTags(policy string, remote, local []string) []string {
+	switch policy {
+	case TagMergeLocalWins:
+		return local
+	case TagMergeUnion:
+		merged := slices.Clone(remote)
+		for _, tag := range local {
+			if !slices.Contains(merged, tag) {
+				merged = append(merged, tag)
+			}
+		}
+
+		return merged
+	default:
+		return remote
+	}
+}
+
+// tagCache maps the name of a cleaned file to the tags it had locally.
+type tagCache map[string][]string
+
+// readTagCache opens and decodes the tag cache in dir. It returns an empty
+// cache if the directory has none.
+func readTagCache(ctx context.Context, dir string, o dcrypto.Opener) (tagCache, error) {
+	cache := tagCache{}
+	if err := readSealedJSON(ctx, filepath.Join(dir, TagCacheName), o, &cache); err != nil {
+		return nil, fmt.Errorf("failed to read tag cache: %w", err)
+	}
+
+	return cache, nil
+}
+
+// writeTagCache encrypts the tag cache into dir, removing it once it is empty.
+func writeTagCache(ctx context.Context, dir string, s dcrypto.Sealer, cache tagCache) error {
+	var v any
+	if len(cache) > 0 {
+		v = cache
+	}
+
+	if err := writeSealedJSON(ctx, filepath.Join(dir, TagCacheName), s, v); err != nil {
+		return fmt.Errorf("failed to write tag cache: %w", err)
+	}
+
+	return nil
+}
+
+// SnapshotTags records the tags of the files in dir that a clean would remove
+// in the tag cache, replacing those recorded for the same names before. A
+// file whose tags cannot be read is left out, keeping what was recorded for
+// it.
+func SnapshotTags(ctx context.Context, dir string, so dcrypto.SealOpener) error {
+	entities, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read directory contents: %w", err)
+	}
+
+	cache, err := readTagCache(ctx, dir, so)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(entities))
+	for _, entry := range entities {
+		names[entry.Name()] = true
+	}
+
+	for _, entry := range entities {
+		info, err := entry.Info()
+		if err != nil || !isCleanable(info) || isPartial(info.Name()) {
+			continue
+		}
+
+		// Sidecars are recorded as the tags of their companion file.
+		if osutil.IsSidecar(entry.Name(), names) {
+			continue
+		}
+
+		tags, err := readLocalTags(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		cache[entry.Name()] = tags
+	}
+
+	return writeTagCache(ctx, dir, so, cache)
+}
+
+// readLocalTags returns the tags of the file at path, from its extended
+// attributes or its sidecar.
+func readLocalTags(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = file.Close() }()
+
+	return getTagsOrSidecar(file)
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTagMerge(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []string{"", TagMergeRemoteWins, TagMergeLocalWins, TagMergeUnion} {
+		assert.NoError(t, ValidateTagMerge(policy), policy)
+	}
+
+	assert.Error(t, ValidateTagMerge("newest"))
+}
+
+func TestMergeTags(t *testing.T) {
+	t.Parallel()
+
+	remote := []string{"beach", "2024"}
+	local := []string{"favorite", "beach"}
+
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{policy: TagMergeRemoteWins, want: []string{"beach", "2024"}},
+		{policy: TagMergeLocalWins, want: []string{"favorite", "beach"}},
+		{policy: TagMergeUnion, want: []string{"beach", "2024", "favorite"}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, mergeTags(tt.policy, remote, local), tt.policy)
+	}
+
+	assert.Equal(t, []string{"beach", "2024"}, remote, "remote tags are not modified")
+}
+
+func TestSnapshotTags(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	require.NoError(t, writeTagCache(ctx, dir, plainSealOpener{}, tagCache{
+		"old.jpg": {"kept"},
+		"a.jpg":   {"stale"},
+	}))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jpg"), []byte("a"), 0o600))
+	require.NoError(t, osutil.WriteSidecarTags(filepath.Join(dir, "a.jpg"), "favorite", "beach"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("h"), 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+
+	require.NoError(t, SnapshotTags(ctx, dir, plainSealOpener{}))
+
+	cache, err := readTagCache(ctx, dir, plainSealOpener{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"favorite", "beach"}, cache["a.jpg"])
+	assert.Equal(t, []string{"kept"}, cache["old.jpg"])
+	assert.NotContains(t, cache, "a.jpg"+osutil.SidecarExt)
+	assert.NotContains(t, cache, ".hidden")
+	assert.NotContains(t, cache, "sub")
+}
+
+func TestWriteTagCacheRemovesEmpty(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	require.NoError(t, writeTagCache(ctx, dir, plainSealOpener{}, tagCache{"a.jpg": {"x"}}))
+	require.FileExists(t, filepath.Join(dir, TagCacheName))
+
+	require.NoError(t, writeTagCache(ctx, dir, plainSealOpener{}, tagCache{}))
+	assert.NoFileExists(t, filepath.Join(dir, TagCacheName))
+}
@@ -15,9 +15,16 @@
 package diskhop
 
 import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"strings"
 
 	"github.com/prestonvasquez/diskhop/internal/osutil"
+	"github.com/prestonvasquez/diskhop/store"
 )
 
 func SetTags(file *os.File, tags ...string) error {
@@ -27,3 +34,159 @@ func SetTags(file *os.File, tags ...string) error {
 func GetTags(file *os.File) ([]string, error) {
 	return osutil.GetTags(file)
 }
+
+// ParseTagColors resolves a mapping of tags to the names of macOS Finder
+// colors, such as "important" to "red", into the color indices that
+// FilePuller.TagColors holds.
+func ParseTagColors(names map[string]string) (map[string]int, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	colors := make(map[string]int, len(names))
+
+	for tag, name := range names {
+		color, ok := osutil.FinderColors[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown Finder color %q for tag %q", name, tag)
+		}
+
+		colors[tag] = color
+	}
+
+	return colors, nil
+}
+
+// TagCount is the number of files that carry a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Files int    `json:"files"`
+}
+
+// ListTags returns the tags of the files that puller would pull with opts,
+// such as a filter and the seal opener of the metadata, with the number of
+// files carrying each. Nothing is downloaded: the tags are read from the
+// decrypted metadata of the remote, since the server only holds them
+// encrypted.
+func ListTags(ctx context.Context, puller store.Puller, opts ...store.PullOption) ([]TagCount, error) {
+	opts = append(opts, store.WithPullDescribeFiles())
+
+	desc, err := puller.Pull(ctx, store.NewDocumentBuffer(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return CountTags(desc.Files), nil
+}
+
+// CountTags returns the tags of the files with the number of files carrying
+// each, from the most to the fewest files and then by tag. A tag given twice
+// to a file is counted once.
+func CountTags(files []store.FileDescription) []TagCount {
+	counts := map[string]int{}
+
+	for _, file := range files {
+		seen := make(map[string]bool, len(file.Tags))
+
+		for _, tag := range file.Tags {
+			if tag == "" || seen[tag] {
+				continue
+			}
+
+			seen[tag] = true
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, files := range counts {
+		tags = append(tags, TagCount{Tag: tag, Files: files})
+	}
+
+	slices.SortFunc(tags, func(a, b TagCount) int {
+		if c := cmp.Compare(b.Files, a.Files); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Tag, b.Tag)
+	})
+
+	return tags
+}
+
+// SearchTags returns the tags that contain substr, ignoring case, keeping
+// their order.
+func SearchTags(tags []TagCount, substr string) []TagCount {
+	substr = strings.ToLower(substr)
+
+	found := make([]TagCount, 0, len(tags))
+
+	for _, tag := range tags {
+		if strings.Contains(strings.ToLower(tag.Tag), substr) {
+			found = append(found, tag)
+		}
+	}
+
+	return found
+}
+
+// TagErrorHandler is called when the tags of a file cannot be read or set and
+// the transfer continues without them.
+type TagErrorHandler func(name string, err error)
+
+// tagPolicy decides whether tag failures are fatal.
+type tagPolicy struct {
+	strict  bool
+	onError TagErrorHandler
+}
+
+// handle returns err if the policy is strict, and otherwise reports it and
+// returns nil.
+func (tp tagPolicy) handle(name string, err error) error {
+	if err == nil || tp.strict {
+		return err
+	}
+
+	if tp.onError != nil {
+		tp.onError(name, err)
+	}
+
+	return nil
+}
+
+// getTagsOrSidecar returns the tags of the file, falling back to its sidecar
+// tag file when the file has no extended attribute tags or they cannot be
+// read.
+func getTagsOrSidecar(file *os.File) ([]string, error) {
+	tags, err := GetTags(file)
+	if err == nil && len(tags) > 0 {
+		return tags, nil
+	}
+
+	sidecarTags, sidecarErr := osutil.ReadSidecarTags(file.Name())
+	if sidecarErr != nil {
+		return nil, fmt.Errorf("failed to read sidecar tags: %w", sidecarErr)
+	}
+
+	if sidecarTags == nil && err != nil {
+		return nil, err
+	}
+
+	return sidecarTags, nil
+}
+
+// setTagsOrSidecar sets the tags of the file, with the Finder color indices of
+// the tags in colors, writing a sidecar tag file when extended attributes
+// cannot be set.
+func setTagsOrSidecar(file *os.File, colors map[string]int, tags ...string) error {
+	err := osutil.SetColoredTags(file, colors, tags...)
+	if err == nil {
+		return nil
+	}
+
+	if sidecarErr := osutil.WriteSidecarTags(file.Name(), tags...); sidecarErr != nil {
+		return fmt.Errorf("failed to set tags: %w", errors.Join(err, sidecarErr))
+	}
+
+	return nil
+}
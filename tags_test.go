@@ -0,0 +1,67 @@
+// Copyright 2024 Preston Vasquez
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diskhop
+
+import (
+	"testing"
+
+	"github.com/prestonvasquez/diskhop/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTagColors(t *testing.T) {
+	t.Parallel()
+
+	colors, err := ParseTagColors(map[string]string{"important": "Red", "later": "blue"})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{"important": 6, "later": 4}, colors)
+
+	_, err = ParseTagColors(map[string]string{"important": "crimson"})
+	assert.ErrorContains(t, err, `unknown Finder color "crimson"`)
+
+	colors, err = ParseTagColors(nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, colors)
+}
+
+func TestCountTags(t *testing.T) {
+	t.Parallel()
+
+	files := []store.FileDescription{
+		{Name: "a.jpg", Tags: []string{"beach", "2024"}},
+		{Name: "b.jpg", Tags: []string{"beach", "beach"}},
+		{Name: "c.jpg", Tags: []string{"Beach Day", ""}},
+		{Name: "d.txt"},
+	}
+
+	tags := CountTags(files)
+
+	assert.Equal(t, []TagCount{
+		{Tag: "beach", Files: 2},
+		{Tag: "2024", Files: 1},
+		{Tag: "Beach Day", Files: 1},
+	}, tags)
+
+	assert.Equal(t, []TagCount{
+		{Tag: "beach", Files: 2},
+		{Tag: "Beach Day", Files: 1},
+	}, SearchTags(tags, "BEACH"))
+
+	assert.Empty(t, SearchTags(tags, "mountain"))
+	assert.Empty(t, CountTags(nil))
+}